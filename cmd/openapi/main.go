@@ -0,0 +1,45 @@
+// Command openapi writes the service's OpenAPI document, as YAML or JSON
+// depending on the output file's extension.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/openapi"
+	"gopkg.in/yaml.v3"
+)
+
+func main() {
+	out := flag.String("out", "api/openapi.yaml", "File to write the spec to")
+	flag.Parse()
+
+	spec := openapi.GenerateSpec()
+
+	var buf bytes.Buffer
+	if strings.EqualFold(filepath.Ext(*out), ".json") {
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(spec); err != nil {
+			log.Fatalf("encode spec: %v", err)
+		}
+	} else {
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(spec); err != nil {
+			log.Fatalf("encode spec: %v", err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(*out), 0o755); err != nil {
+		log.Fatalf("create output directory: %v", err)
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0o644); err != nil {
+		log.Fatalf("write spec: %v", err)
+	}
+}
@@ -4,23 +4,30 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/eventbus"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/server"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/scheduler"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/webhook"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/pkg/tracing"
 )
 
 func main() {
 	configPath := flag.String("config", "config.json", "Path to configuration file")
+	migrate := flag.String("migrate", "", "Run a migration command and exit: dry-run, or down:N to roll back the last N migrations")
 	flag.Parse()
 
 	log := logger.NewLogger()
@@ -31,13 +38,59 @@ func main() {
 		log.Fatal("Failed to load configuration", "error", configErr)
 	}
 
-	db, dbErr := postgres.NewConnection(cfg.Database)
+	if validationErr := config.Validate(cfg); validationErr != nil {
+		if fieldErrs, ok := validationErr.(config.ValidationErrors); ok {
+			for _, fieldErr := range fieldErrs {
+				log.Error("Invalid configuration", "field", fieldErr.Field, "problem", fieldErr.Problem)
+			}
+		}
+		log.Fatal("Configuration is invalid", "error", validationErr)
+	}
+
+	if cfg.Server.LogBufferSize > 0 {
+		log = logger.NewAsyncLogger(cfg.Server.LogBufferSize)
+		log.OnBufferFull(monitoring.LogDroppedTotal.Inc)
+	}
+	defer log.Close()
+
+	if cfg.Server.LogLevel != "" {
+		if err := log.SetLevel(cfg.Server.LogLevel); err != nil {
+			log.Fatal("Failed to set log level", "error", err)
+		}
+	}
+
+	shutdownTracing, tracingErr := tracing.Init(context.Background(), cfg.Tracing.OTLPEndpoint)
+	if tracingErr != nil {
+		log.Fatal("Failed to initialize tracing", "error", tracingErr)
+	}
+
+	var migrations fs.FS
+	if cfg.Database.UseEmbedded {
+		migrations = postgres.EmbeddedMigrations()
+	}
+
+	if *migrate == migrateDryRun {
+		if err := printMigrationPlan(cfg.Database, migrations); err != nil {
+			log.Fatal("Migration dry run failed", "error", err)
+		}
+		return
+	}
+
+	db, dbErr := postgres.NewConnection(cfg.Database, log)
 	if dbErr != nil {
 		log.Fatal("Failed to connect to database", "error", dbErr)
 	}
 	defer db.Close()
 
-	if migrationErr := postgres.RunMigrations(cfg.Database); migrationErr != nil {
+	if *migrate != "" {
+		if err := runMigrateCommand(db, migrations, *migrate); err != nil {
+			log.Fatal("Migration command failed", "command", *migrate, "error", err)
+		}
+		log.Info("Migration command completed", "command", *migrate)
+		return
+	}
+
+	if migrationErr := postgres.RunMigrations(cfg.Database, migrations); migrationErr != nil {
 		log.Fatal("Failed to run migrations", "error", migrationErr)
 	}
 
@@ -47,17 +100,64 @@ func main() {
 	}
 	defer redisClient.Close()
 
-	dbMetricsCollector := monitoring.NewDBMetricsCollector(db.GetDB())
+	saleRepo := postgres.NewSaleRepository(db)
+	checkoutRepo := postgres.NewCheckoutRepository(db)
+
+	dbMetricsCollector := monitoring.NewDBMetricsCollector(db.GetDB()).WithCheckoutCounter(checkoutRepo)
 	dbMetricsCollector.StartCollecting(context.Background(), 30*time.Second)
 
-	saleRepo := postgres.NewSaleRepository(db)
-	saleScheduler := scheduler.NewSaleScheduler(saleRepo, log, 10000)
+	// One cache serves the schedulers and the HTTP handlers, so they share
+	// its bloom filters and its fallback state during a Redis outage.
+	redisCache := redis.NewCache(redisClient, cfg.Cache, cfg.BloomFilter, log)
+	redisCache.SetBloomFilterSource(saleRepo)
+
+	// Keys written before the cluster-safe names are moved once at start;
+	// the cache keeps working without them, so a failure is only logged.
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), time.Minute)
+	if _, err := redisCache.MigrateLegacyKeys(migrateCtx); err != nil {
+		log.Error("Failed to migrate legacy cache keys", "error", err)
+	}
+	cancelMigrate()
 
-	httpServer := server.NewServer(cfg, db.GetDB(), redisClient, log)
+	cache := redis.NewResilientCache(redisCache, log)
+	saleScheduler := scheduler.NewSaleScheduler(cfg, db.GetDB(), saleRepo, checkoutRepo, cache, log)
+	remainingReconciler := scheduler.NewRemainingReconciler(saleRepo, cache, log, 30*time.Second)
+	eventBus := eventbus.NewMemoryBus()
+	outboxPublisher := scheduler.NewOutboxPublisher(postgres.NewOutboxRepository(db), eventBus, log, cfg.Outbox.PollInterval(), cfg.Outbox.BatchSize())
+
+	httpServer := server.NewServer(cfg, db.GetDB(), redisClient, cache, saleScheduler, log)
 
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
 
+	var metricsServer *monitoring.MetricsServer
+	if cfg.Server.MetricsPort > 0 {
+		metricsServer = monitoring.NewMetricsServer(fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.MetricsPort))
+		go func() {
+			if err := metricsServer.Start(serverCtx); err != nil {
+				log.Error("Metrics server failed", "error", err)
+			}
+		}()
+	}
+
 	go saleScheduler.Start(serverCtx)
+	go remainingReconciler.Start(serverCtx)
+
+	var webhookService *webhook.DeliveryService
+	if len(cfg.Webhooks) > 0 {
+		webhookService = webhook.NewDeliveryService(cfg.Webhooks, postgres.NewWebhookDeliveryRepository(db), log)
+		if err := webhookService.Subscribe(eventBus); err != nil {
+			log.Fatal("Failed to subscribe webhooks", "error", err)
+		}
+		go webhookService.Start(serverCtx)
+	}
+	go outboxPublisher.Start(serverCtx)
+
+	var quotaRebalancer *scheduler.QuotaRebalancer
+	if cfg.Region.Enabled() {
+		leaseRepo := postgres.NewQuotaLeaseRepository(db)
+		quotaRebalancer = scheduler.NewQuotaRebalancer(saleRepo, leaseRepo, cache, log, cfg.Region)
+		go quotaRebalancer.Start(serverCtx)
+	}
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -68,9 +168,25 @@ func main() {
 
 		log.Info("Shutting down server...")
 		saleScheduler.Stop()
+		remainingReconciler.Stop()
+		outboxPublisher.Stop()
+		if webhookService != nil {
+			webhookService.Stop()
+		}
+		if quotaRebalancer != nil {
+			quotaRebalancer.Stop()
+		}
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			log.Error("Server shutdown error", "error", err)
 		}
+		if metricsServer != nil {
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				log.Error("Metrics server shutdown error", "error", err)
+			}
+		}
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			log.Error("Tracing shutdown error", "error", err)
+		}
 
 		serverStopCtx()
 	}()
@@ -83,3 +199,45 @@ func main() {
 	<-serverCtx.Done()
 	log.Info("Server stopped")
 }
+
+const migrateDryRun = "dry-run"
+
+func printMigrationPlan(cfg config.DatabaseConfig, migrations fs.FS) error {
+	plans, err := postgres.DryRunMigrations(cfg, migrations)
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, plan := range plans {
+		status := "PENDING"
+		if plan.AlreadyApplied {
+			status = "APPLIED"
+		} else {
+			pending++
+		}
+
+		fmt.Printf("-- %s [%s]\n", plan.Name, status)
+		fmt.Println(strings.TrimSpace(plan.SQL))
+		fmt.Println()
+	}
+	fmt.Printf("-- %d migrations, %d pending\n", len(plans), pending)
+
+	return nil
+}
+
+// runMigrateCommand handles "down:N" for the -migrate flag; migrations are
+// applied automatically on a normal start.
+func runMigrateCommand(db *postgres.Connection, migrations fs.FS, command string) error {
+	direction, count, found := strings.Cut(command, ":")
+	if !found || direction != postgres.MigrationDown {
+		return fmt.Errorf("unsupported migrate command %q, expected down:N", command)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil || n <= 0 {
+		return fmt.Errorf("invalid migration count %q", count)
+	}
+
+	return postgres.RollbackLastN(db.GetDB(), migrations, n)
+}
@@ -14,12 +14,18 @@ import (
 type CheckoutCommand struct {
 	UserID string
 	ItemID string
+	SaleID string // Optional; defaults to the most recently started active sale
 }
 
 type CheckoutResponse struct {
-	Code       string    `json:"code"`
-	ItemsCount int       `json:"items_count"`
-	SaleEndsAt time.Time `json:"sale_ends_at"`
+	Code         string    `json:"code"`
+	ItemsCount   int       `json:"items_count"`
+	SaleStartsAt time.Time `json:"sale_starts_at"`
+	SaleEndsAt   time.Time `json:"sale_ends_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	// RemainingSlots is how many more items the user may check out. It is
+	// left out when the slot count could not be read.
+	RemainingSlots *int `json:"remaining_slots,omitempty"`
 }
 
 type CheckoutHandler struct {
@@ -28,6 +34,7 @@ type CheckoutHandler struct {
 	cache         ports.Cache
 	log           *logger.Logger
 	maxItemsLimit int
+	checkoutTTL   time.Duration
 	codeGen       *generator.CodeGenerator
 }
 
@@ -37,6 +44,7 @@ func NewCheckoutHandler(
 	cache ports.Cache,
 	log *logger.Logger,
 	maxItemsLimit int,
+	checkoutTTL time.Duration,
 	codeGen *generator.CodeGenerator,
 ) *CheckoutHandler {
 	return &CheckoutHandler{
@@ -45,45 +53,59 @@ func NewCheckoutHandler(
 		cache:         cache,
 		log:           log,
 		maxItemsLimit: maxItemsLimit,
+		checkoutTTL:   checkoutTTL,
 		codeGen:       codeGen,
 	}
 }
 
-func (h *CheckoutHandler) Handle(ctx context.Context, cmd CheckoutCommand) (*CheckoutResponse, error) {
-	activeSale, err := h.saleRepo.GetActiveSale(ctx)
+func (h *CheckoutHandler) Handle(ctx context.Context, cmd CheckoutCommand) (resp *CheckoutResponse, err error) {
+	log := h.log.WithContext(ctx).WithField("user_id", cmd.UserID).WithField("item_id", cmd.ItemID)
+
+	activeSale, err := h.resolveSale(ctx, cmd.SaleID)
 	if err != nil {
-		h.log.Error("Failed to get active sale", "error", err)
+		log.Error("Failed to get active sale", "error", err, "sale_id", cmd.SaleID)
 		return nil, errors.ErrSaleNotFound
 	}
-
-	if !activeSale.IsActive(time.Now().UTC()) {
+	log = log.WithField("sale_id", activeSale.ID)
+
+	now := time.Now().UTC()
+	if activeSale.IsUpcoming(now) {
+		// The partial response carries the start time so callers can tell
+		// the client how long to wait.
+		return &CheckoutResponse{
+			SaleStartsAt: activeSale.StartedAt,
+			SaleEndsAt:   activeSale.EndedAt,
+		}, errors.ErrSaleNotYetStarted
+	}
+	if !activeSale.IsActive(now) {
 		return nil, errors.ErrSaleNotActive
 	}
 
-	isSold, err := h.cache.ItemExistsInBloomFilter(ctx, cmd.ItemID)
+	isSold, err := h.cache.ItemExistsInBloomFilter(ctx, activeSale.ID, cmd.ItemID)
 	if err != nil {
-		h.log.Error("Failed to check bloom filter", "error", err, "item_id", cmd.ItemID)
-	} else if isSold {
-		return nil, errors.ErrItemAlreadySold
+		if ports.IsTemporaryError(err) {
+			// Only locally known sales are reported during an outage; the
+			// database check below still catches everything else.
+			log.Warn("Bloom filter unavailable, continuing with reduced safety", "error", err)
+		} else {
+			log.Error("Failed to check bloom filter", "error", err)
+			isSold = false
+		}
 	}
-
-	availableSlots, err := h.cache.GetAvailableCheckoutSlots(ctx, activeSale.ID, cmd.UserID, h.maxItemsLimit)
-	if err != nil {
-		h.log.Error("Failed to get available checkout slots", "error", err, "user_id", cmd.UserID)
-	} else if availableSlots <= 0 {
-		return nil, errors.ErrUserLimitExceeded
+	if isSold {
+		return nil, errors.ErrItemAlreadySold
 	}
 
 	hasCheckedOut, err := h.cache.HasUserCheckedOutItem(ctx, activeSale.ID, cmd.UserID, cmd.ItemID)
 	if err != nil {
-		h.log.Error("Failed to check user checkout history", "error", err, "user_id", cmd.UserID, "item_id", cmd.ItemID)
+		log.Error("Failed to check user checkout history", "error", err)
 	} else if hasCheckedOut {
 		return nil, errors.ErrUserAlreadyCheckedOutItem
 	}
 
 	item, err := h.saleRepo.GetItemByID(ctx, cmd.ItemID)
 	if err != nil {
-		h.log.Error("Failed to get item", "error", err, "item_id", cmd.ItemID)
+		log.Error("Failed to get item", "error", err)
 		if err == errors.ErrItemNotFound {
 			return nil, errors.ErrItemNotFound
 		}
@@ -95,40 +117,71 @@ func (h *CheckoutHandler) Handle(ctx context.Context, cmd CheckoutCommand) (*Che
 	}
 
 	if item.IsSold() {
-		_ = h.cache.AddItemToBloomFilter(ctx, cmd.ItemID)
+		_ = h.cache.AddItemToBloomFilter(ctx, activeSale.ID, cmd.ItemID)
 		return nil, errors.ErrItemAlreadySold
 	}
 
+	maxItems := h.maxItemsLimit
+	if activeSale.MaxItemsPerUser > 0 {
+		maxItems = activeSale.MaxItemsPerUser
+	}
+
+	codeTTL := h.codeTTL(activeSale)
+
+	var remainingSlots *int
+	remaining, reserved, err := h.cache.AtomicReserveCheckoutSlot(ctx, activeSale.ID, cmd.UserID, maxItems, codeTTL)
+	if err != nil {
+		log.Error("Failed to reserve checkout slot", "error", err)
+	} else if !reserved {
+		return nil, errors.ErrUserLimitExceeded
+	} else {
+		remainingSlots = &remaining
+	}
+
+	// The slot is claimed up front so that concurrent checkouts cannot both
+	// pass the limit; give it back if this checkout does not go through.
+	defer func() {
+		if err != nil && reserved {
+			if releaseErr := h.cache.ReleaseCheckoutReservation(ctx, activeSale.ID, cmd.UserID, 1); releaseErr != nil {
+				log.Error("Failed to release checkout slot", "error", releaseErr)
+			}
+		}
+	}()
+
+	// A cached code that no longer verifies, e.g. one signed with a rotated
+	// secret, is replaced rather than handed back to the user.
 	checkoutCode, err := h.cache.GetUserCheckoutCode(ctx, activeSale.ID, cmd.UserID)
-	if err != nil || checkoutCode == "" {
+	if err != nil || checkoutCode == "" || !h.codeGen.VerifyCheckoutCode(checkoutCode) {
 		checkoutCode, err = h.codeGen.GenerateCheckoutCode(activeSale.ID, cmd.UserID)
 		if err != nil {
-			h.log.Error("Failed to generate checkout code", "error", err, "user_id", cmd.UserID)
+			log.Error("Failed to generate checkout code", "error", err)
 			return nil, errors.ErrTransactionFailed
 		}
+	}
 
-		err = h.cache.SetUserCheckoutCode(ctx, activeSale.ID, cmd.UserID, checkoutCode, time.Until(activeSale.EndedAt))
-		if err != nil {
-			h.log.Error("Failed to set user checkout code", "error", err, "user_id", cmd.UserID)
-		}
+	// Every checkout refreshes the code's expiry, so an active user keeps
+	// their code while an abandoned one lapses after the configured TTL.
+	err = h.cache.SetUserCheckoutCode(ctx, activeSale.ID, cmd.UserID, checkoutCode, codeTTL)
+	if err != nil {
+		log.Error("Failed to set user checkout code", "error", err)
+	}
 
-		err = h.cache.SetCheckoutCode(ctx, checkoutCode, time.Until(activeSale.EndedAt))
-		if err != nil {
-			h.log.Error("Failed to set checkout code", "error", err, "code", checkoutCode)
-		}
+	err = h.cache.SetCheckoutCode(ctx, checkoutCode, codeTTL)
+	if err != nil {
+		log.Error("Failed to set checkout code", "error", err, "code", checkoutCode)
 	}
 
 	checkout, err := h.checkoutRepo.GetCheckoutByCode(ctx, checkoutCode)
 	if err != nil {
-		checkout, err = sale.NewCheckout(checkoutCode, activeSale.ID, cmd.UserID, []string{cmd.ItemID})
+		checkout, err = sale.NewCheckout(checkoutCode, activeSale.ID, cmd.UserID, []string{cmd.ItemID}, codeTTL)
 		if err != nil {
-			h.log.Error("Failed to create checkout", "error", err)
+			log.Error("Failed to create checkout", "error", err)
 			return nil, err
 		}
 
 		err = h.checkoutRepo.CreateCheckout(ctx, checkout)
 		if err != nil {
-			h.log.Error("Failed to store checkout", "error", err)
+			log.Error("Failed to store checkout", "error", err)
 			return nil, err
 		}
 	} else {
@@ -139,24 +192,42 @@ func (h *CheckoutHandler) Handle(ctx context.Context, cmd CheckoutCommand) (*Che
 
 		err = h.checkoutRepo.AddItemToCheckout(ctx, checkoutCode, cmd.ItemID)
 		if err != nil {
-			h.log.Error("Failed to add item to checkout", "error", err)
+			log.Error("Failed to add item to checkout", "error", err)
 			return nil, err
 		}
-	}
 
-	err = h.cache.IncrementUserCheckoutCount(ctx, activeSale.ID, cmd.UserID)
-	if err != nil {
-		h.log.Error("Failed to increment user checkout count", "error", err, "user_id", cmd.UserID, "sale_id", activeSale.ID)
+		checkout.ExpiresAt = time.Now().UTC().Add(codeTTL)
+		if expiryErr := h.checkoutRepo.RefreshCheckoutExpiry(ctx, checkoutCode, checkout.ExpiresAt); expiryErr != nil {
+			log.Error("Failed to refresh checkout expiry", "error", expiryErr, "code", checkoutCode)
+		}
 	}
 
-	err = h.cache.AddUserCheckedOutItem(ctx, activeSale.ID, cmd.UserID, cmd.ItemID, time.Until(activeSale.EndedAt))
-	if err != nil {
-		h.log.Error("Failed to mark item as checked out by user", "error", err, "user_id", cmd.UserID, "item_id", cmd.ItemID, "sale_id", activeSale.ID)
+	if markErr := h.cache.AddUserCheckedOutItem(ctx, activeSale.ID, cmd.UserID, cmd.ItemID, time.Until(activeSale.EndedAt)); markErr != nil {
+		log.Error("Failed to mark item as checked out by user", "error", markErr)
 	}
 
 	return &CheckoutResponse{
-		Code:       checkoutCode,
-		ItemsCount: checkout.ItemCount(),
-		SaleEndsAt: activeSale.EndedAt,
+		Code:           checkoutCode,
+		ItemsCount:     checkout.ItemCount(),
+		SaleStartsAt:   activeSale.StartedAt,
+		SaleEndsAt:     activeSale.EndedAt,
+		ExpiresAt:      checkout.ExpiresAt,
+		RemainingSlots: remainingSlots,
 	}, nil
 }
+
+func (h *CheckoutHandler) resolveSale(ctx context.Context, saleID string) (*sale.Sale, error) {
+	if saleID == "" {
+		return h.saleRepo.GetActiveSale(ctx)
+	}
+	return h.saleRepo.GetSaleByID(ctx, saleID)
+}
+
+// codeTTL caps the configured checkout TTL at the end of the sale.
+func (h *CheckoutHandler) codeTTL(activeSale *sale.Sale) time.Duration {
+	ttl := time.Until(activeSale.EndedAt)
+	if h.checkoutTTL > 0 && h.checkoutTTL < ttl {
+		ttl = h.checkoutTTL
+	}
+	return ttl
+}
@@ -3,8 +3,11 @@ package commands
 import (
 	"context"
 
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/application/use_cases"
+	"github.com/yuzvak/flashsale-service/internal/domain/errors"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
@@ -12,45 +15,48 @@ type PurchaseCommand struct {
 	CheckoutCode string
 }
 
-type PurchaseResponse struct {
-	Success        bool                      `json:"success"`
-	PurchasedItems []sale.PurchaseItemResult `json:"purchased_items"`
-	TotalPurchased int                       `json:"total_purchased"`
-	FailedCount    int                       `json:"failed_count"`
-}
+// PurchaseResponse is declared in ports so idempotent replays can store it.
+type PurchaseResponse = ports.PurchaseResponse
 
 type PurchaseHandler struct {
 	purchaseUseCase *use_cases.PurchaseUseCase
+	codeGen         *generator.CodeGenerator
 	log             *logger.Logger
 }
 
 func NewPurchaseHandler(
 	purchaseUseCase *use_cases.PurchaseUseCase,
+	codeGen *generator.CodeGenerator,
 	log *logger.Logger,
 ) *PurchaseHandler {
 	return &PurchaseHandler{
 		purchaseUseCase: purchaseUseCase,
+		codeGen:         codeGen,
 		log:             log,
 	}
 }
 
 func (h *PurchaseHandler) Handle(ctx context.Context, cmd PurchaseCommand) (*PurchaseResponse, error) {
-	h.log.Info("Processing purchase request", "checkout_code", cmd.CheckoutCode)
+	log := h.log.FromContext(ctx)
+
+	log.Info("Processing purchase request", "checkout_code", cmd.CheckoutCode)
+
+	// Forged or mistyped codes are rejected before they cost a lock or a
+	// database round trip.
+	if !h.codeGen.VerifyCheckoutCode(cmd.CheckoutCode) {
+		log.Warn("Rejected checkout code with invalid signature", "checkout_code", cmd.CheckoutCode)
+		return nil, errors.ErrInvalidCheckoutCode
+	}
 
 	result, err := h.purchaseUseCase.ExecutePurchase(ctx, cmd.CheckoutCode)
 	if err != nil {
-		h.log.Error("Purchase failed", "error", err.Error(), "checkout_code", cmd.CheckoutCode)
+		log.Error("Purchase failed", "error", err.Error(), "checkout_code", cmd.CheckoutCode)
 		return nil, err
 	}
 
-	response := &PurchaseResponse{
-		Success:        result.Success,
-		PurchasedItems: result.Items,
-		TotalPurchased: result.TotalPurchased,
-		FailedCount:    result.FailedCount,
-	}
+	response := newPurchaseResponse(result)
 
-	h.log.Info("Purchase completed successfully",
+	log.Info("Purchase completed successfully",
 		"checkout_code", cmd.CheckoutCode,
 		"total_purchased", result.TotalPurchased,
 		"failed_count", result.FailedCount,
@@ -58,3 +64,27 @@ func (h *PurchaseHandler) Handle(ctx context.Context, cmd PurchaseCommand) (*Pur
 
 	return response, nil
 }
+
+// Status returns the stored outcome of an earlier purchase of cmd's code.
+// It never starts a purchase.
+func (h *PurchaseHandler) Status(ctx context.Context, cmd PurchaseCommand) (*PurchaseResponse, error) {
+	if !h.codeGen.VerifyCheckoutCode(cmd.CheckoutCode) {
+		return nil, errors.ErrInvalidCheckoutCode
+	}
+
+	result, err := h.purchaseUseCase.GetPurchaseStatus(ctx, cmd.CheckoutCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPurchaseResponse(result), nil
+}
+
+func newPurchaseResponse(result *sale.PurchaseResult) *PurchaseResponse {
+	return &PurchaseResponse{
+		Success:        result.Success,
+		PurchasedItems: result.Items,
+		TotalPurchased: result.TotalPurchased,
+		FailedCount:    result.FailedCount,
+	}
+}
@@ -2,12 +2,54 @@ package ports
 
 import (
 	"context"
+	"errors"
 	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 )
 
+// ErrCacheUnavailable is returned by cache implementations when the backing
+// store cannot be reached and no local fallback could answer the call.
+var ErrCacheUnavailable = errors.New("cache unavailable")
+
+// ErrLockNotAcquired is returned when a lock is already held by someone else.
+var ErrLockNotAcquired = errors.New("lock not acquired")
+
+// ErrLockLost is the cause of a lock context's cancellation when the lock
+// expired or was taken over before its holder released it.
+var ErrLockLost = errors.New("lock lost")
+
+// PurchaseResponse is the outcome of a purchase as it is returned to clients
+// and replayed for a repeated Idempotency-Key.
+type PurchaseResponse struct {
+	Success        bool                      `json:"success"`
+	PurchasedItems []sale.PurchaseItemResult `json:"purchased_items"`
+	TotalPurchased int                       `json:"total_purchased"`
+	FailedCount    int                       `json:"failed_count"`
+}
+
+// IdempotentPurchase is what gets stored under a purchase's Idempotency-Key.
+// The checkout code is kept so a key cannot be replayed against another
+// checkout. Response is nil while the first request is still running.
+type IdempotentPurchase struct {
+	Code     string            `json:"code"`
+	Response *PurchaseResponse `json:"response,omitempty"`
+}
+
+// IsTemporaryError reports whether err was caused by the cache being
+// unreachable, in which case callers may choose to continue without it.
+func IsTemporaryError(err error) bool {
+	return errors.Is(err, ErrCacheUnavailable)
+}
+
 type Cache interface {
-	AddItemToBloomFilter(ctx context.Context, itemID string) error
-	ItemExistsInBloomFilter(ctx context.Context, itemID string) (bool, error)
+	AddItemToBloomFilter(ctx context.Context, saleID, itemID string) error
+	AddItemsToBloomFilter(ctx context.Context, saleID string, itemIDs []string) error
+	ItemExistsInBloomFilter(ctx context.Context, saleID, itemID string) (bool, error)
+	ItemsExistInBloomFilter(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error)
+	RemoveItemFromBloomFilter(ctx context.Context, saleID, itemID string) error
+	WarmBloomFilter(ctx context.Context, saleID string, itemIDs []string) error
+	ResetBloomFilterForSale(ctx context.Context, saleID string) error
 
 	GetUserItemCount(ctx context.Context, saleID, userID string) (int, error)
 	IncrementUserItemCount(ctx context.Context, saleID, userID string) error
@@ -17,6 +59,9 @@ type Cache interface {
 	IncrementUserCheckoutCount(ctx context.Context, saleID, userID string) error
 	SetUserCheckoutCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error
 	GetAvailableCheckoutSlots(ctx context.Context, saleID, userID string, maxItems int) (int, error)
+	AtomicCheckoutReserve(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (bool, error)
+	AtomicReserveCheckoutSlot(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (remaining int, ok bool, err error)
+	ReleaseCheckoutReservation(ctx context.Context, saleID, userID string, count int) error
 
 	GetUserCheckoutCode(ctx context.Context, saleID, userID string) (string, error)
 	SetUserCheckoutCode(ctx context.Context, saleID, userID, code string, expiration time.Duration) error
@@ -24,19 +69,45 @@ type Cache interface {
 	SetCheckoutCode(ctx context.Context, code string, expiration time.Duration) error
 	CheckoutCodeExists(ctx context.Context, code string) (bool, error)
 	RemoveCheckoutCode(ctx context.Context, code string) error
+	ExtendSaleCheckoutTTLs(ctx context.Context, saleID string, oldExpiry, newExpiry time.Time) error
+	PurgeSaleData(ctx context.Context, saleID string) error
 	HasUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string) (bool, error)
 	AddUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string, expiration time.Duration) error
 
 	IncrementSaleItemsSold(ctx context.Context, saleID string, count int) error
 	GetSaleItemsSold(ctx context.Context, saleID string) (int, error)
 	GetSaleItemCount(ctx context.Context, saleID string) (int, error)
+	SetSaleItemCount(ctx context.Context, saleID string, count int, expiration time.Duration) error
 	IncrementCounters(ctx context.Context, saleID, userID string, itemCount int) error
+	GetSaleTotalItems(ctx context.Context, saleID string) (int, bool, error)
+	SetSaleTotalItems(ctx context.Context, saleID string, totalItems int, expiration time.Duration) error
+	GetSaleQuota(ctx context.Context, saleID string) (int, bool, error)
+	SetSaleQuota(ctx context.Context, saleID string, quota int, expiration time.Duration) error
+	GetSaleRemaining(ctx context.Context, saleID string) (int, bool, error)
+	SetSaleRemaining(ctx context.Context, saleID string, remaining int, expiration time.Duration) error
+	DecrementSaleRemaining(ctx context.Context, saleID string, count int) error
+
+	PublishItemSold(ctx context.Context, saleID, itemID string) error
+	SubscribeItemSold(ctx context.Context, saleID string) (<-chan string, error)
 
 	AtomicPurchaseCheck(ctx context.Context, saleID, userID string, itemCount int, maxSaleItems, maxUserItems int) (bool, error)
 	AtomicUserLimitCheck(ctx context.Context, saleID, userID string, itemCount, maxItems int) (bool, error)
 	AtomicSaleLimitCheck(ctx context.Context, saleID string, itemCount, maxItems int) (bool, error)
 	DecrementCounters(ctx context.Context, saleID, userID string, itemCount int) error
 
+	// BeginIdempotentPurchase marks key as in flight for a purchase of code
+	// and returns true, or returns false with what is already stored under
+	// key. The marker expires after ttl if the purchase never finishes.
+	BeginIdempotentPurchase(ctx context.Context, key, code string, ttl time.Duration) (*IdempotentPurchase, bool, error)
+	CompleteIdempotentPurchase(ctx context.Context, key string, purchase *IdempotentPurchase, ttl time.Duration) error
+	// AbortIdempotentPurchase removes the in-flight marker of code so the
+	// key can be retried. A completed purchase is left in place.
+	AbortIdempotentPurchase(ctx context.Context, key, code string) error
+
 	DistributedLock(ctx context.Context, key string, expiration time.Duration) (bool, error)
 	ReleaseLock(ctx context.Context, key string) error
+	// TryLockWithHeartbeat returns a context derived from ctx that is
+	// cancelled with ErrLockLost if the lock is lost, and a CancelFunc that
+	// releases the lock. Work the lock protects must run under that context.
+	TryLockWithHeartbeat(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error)
 }
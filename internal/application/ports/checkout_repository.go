@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 )
@@ -10,8 +11,11 @@ type CheckoutRepository interface {
 	GetCheckoutByCode(ctx context.Context, code string) (*sale.Checkout, error)
 	CreateCheckout(ctx context.Context, checkout *sale.Checkout) error
 	AddItemToCheckout(ctx context.Context, checkoutCode string, itemID string) error
+	RefreshCheckoutExpiry(ctx context.Context, checkoutCode string, expiresAt time.Time) error
 	GetUserCheckoutCount(ctx context.Context, saleID, userID string) (int, error)
 	DeleteCheckout(ctx context.Context, checkoutCode string) error
+	GetExpiredCheckouts(ctx context.Context, olderThan time.Duration) ([]*sale.Checkout, error)
+	DeleteExpiredCheckouts(ctx context.Context, olderThan time.Duration) (int64, error)
 
 	LogCheckoutAttempt(ctx context.Context, saleID, userID, checkoutCode string, itemID string) error
 }
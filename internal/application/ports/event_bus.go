@@ -0,0 +1,9 @@
+package ports
+
+import "context"
+
+// EventBus delivers domain events to the handlers subscribed to their type.
+type EventBus interface {
+	Publish(ctx context.Context, event interface{}) error
+	Subscribe(eventType string, handler func(event interface{}) error) error
+}
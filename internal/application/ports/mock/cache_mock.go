@@ -0,0 +1,432 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+)
+
+var _ ports.Cache = (*Cache)(nil)
+
+// Cache is a ports.Cache whose behaviour is set per method through its On*
+// fields. A method whose field is nil returns zero values and a nil error;
+// TryLockWithHeartbeat then hands back ctx and a no-op cancel func.
+type Cache struct {
+	OnAddItemToBloomFilter      func(ctx context.Context, saleID, itemID string) error
+	OnAddItemsToBloomFilter     func(ctx context.Context, saleID string, itemIDs []string) error
+	OnItemExistsInBloomFilter   func(ctx context.Context, saleID, itemID string) (bool, error)
+	OnItemsExistInBloomFilter   func(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error)
+	OnRemoveItemFromBloomFilter func(ctx context.Context, saleID, itemID string) error
+	OnWarmBloomFilter           func(ctx context.Context, saleID string, itemIDs []string) error
+	OnResetBloomFilterForSale   func(ctx context.Context, saleID string) error
+
+	OnGetUserItemCount       func(ctx context.Context, saleID, userID string) (int, error)
+	OnIncrementUserItemCount func(ctx context.Context, saleID, userID string) error
+	OnSetUserItemCount       func(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error
+
+	OnGetUserCheckoutCount       func(ctx context.Context, saleID, userID string) (int, error)
+	OnIncrementUserCheckoutCount func(ctx context.Context, saleID, userID string) error
+	OnSetUserCheckoutCount       func(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error
+	OnGetAvailableCheckoutSlots  func(ctx context.Context, saleID, userID string, maxItems int) (int, error)
+	OnAtomicCheckoutReserve      func(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (bool, error)
+	OnAtomicReserveCheckoutSlot  func(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (remaining int, ok bool, err error)
+	OnReleaseCheckoutReservation func(ctx context.Context, saleID, userID string, count int) error
+
+	OnGetUserCheckoutCode    func(ctx context.Context, saleID, userID string) (string, error)
+	OnSetUserCheckoutCode    func(ctx context.Context, saleID, userID, code string, expiration time.Duration) error
+	OnRemoveUserCheckoutCode func(ctx context.Context, saleID, userID string) error
+	OnSetCheckoutCode        func(ctx context.Context, code string, expiration time.Duration) error
+	OnCheckoutCodeExists     func(ctx context.Context, code string) (bool, error)
+	OnRemoveCheckoutCode     func(ctx context.Context, code string) error
+	OnExtendSaleCheckoutTTLs func(ctx context.Context, saleID string, oldExpiry, newExpiry time.Time) error
+	OnPurgeSaleData          func(ctx context.Context, saleID string) error
+	OnHasUserCheckedOutItem  func(ctx context.Context, saleID, userID, itemID string) (bool, error)
+	OnAddUserCheckedOutItem  func(ctx context.Context, saleID, userID, itemID string, expiration time.Duration) error
+
+	OnIncrementSaleItemsSold func(ctx context.Context, saleID string, count int) error
+	OnGetSaleItemsSold       func(ctx context.Context, saleID string) (int, error)
+	OnGetSaleItemCount       func(ctx context.Context, saleID string) (int, error)
+	OnSetSaleItemCount       func(ctx context.Context, saleID string, count int, expiration time.Duration) error
+	OnIncrementCounters      func(ctx context.Context, saleID, userID string, itemCount int) error
+	OnGetSaleTotalItems      func(ctx context.Context, saleID string) (int, bool, error)
+	OnSetSaleTotalItems      func(ctx context.Context, saleID string, totalItems int, expiration time.Duration) error
+	OnGetSaleQuota           func(ctx context.Context, saleID string) (int, bool, error)
+	OnSetSaleQuota           func(ctx context.Context, saleID string, quota int, expiration time.Duration) error
+	OnGetSaleRemaining       func(ctx context.Context, saleID string) (int, bool, error)
+	OnSetSaleRemaining       func(ctx context.Context, saleID string, remaining int, expiration time.Duration) error
+	OnDecrementSaleRemaining func(ctx context.Context, saleID string, count int) error
+
+	OnPublishItemSold   func(ctx context.Context, saleID, itemID string) error
+	OnSubscribeItemSold func(ctx context.Context, saleID string) (<-chan string, error)
+
+	OnAtomicPurchaseCheck  func(ctx context.Context, saleID, userID string, itemCount int, maxSaleItems, maxUserItems int) (bool, error)
+	OnAtomicUserLimitCheck func(ctx context.Context, saleID, userID string, itemCount, maxItems int) (bool, error)
+	OnAtomicSaleLimitCheck func(ctx context.Context, saleID string, itemCount, maxItems int) (bool, error)
+	OnDecrementCounters    func(ctx context.Context, saleID, userID string, itemCount int) error
+
+	OnBeginIdempotentPurchase    func(ctx context.Context, key, code string, ttl time.Duration) (*ports.IdempotentPurchase, bool, error)
+	OnCompleteIdempotentPurchase func(ctx context.Context, key string, purchase *ports.IdempotentPurchase, ttl time.Duration) error
+	OnAbortIdempotentPurchase    func(ctx context.Context, key, code string) error
+
+	OnDistributedLock      func(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	OnReleaseLock          func(ctx context.Context, key string) error
+	OnTryLockWithHeartbeat func(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error)
+}
+
+func (m *Cache) AddItemToBloomFilter(ctx context.Context, saleID, itemID string) error {
+	if m.OnAddItemToBloomFilter != nil {
+		return m.OnAddItemToBloomFilter(ctx, saleID, itemID)
+	}
+	return nil
+}
+
+func (m *Cache) AddItemsToBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	if m.OnAddItemsToBloomFilter != nil {
+		return m.OnAddItemsToBloomFilter(ctx, saleID, itemIDs)
+	}
+	return nil
+}
+
+func (m *Cache) ItemExistsInBloomFilter(ctx context.Context, saleID, itemID string) (bool, error) {
+	if m.OnItemExistsInBloomFilter != nil {
+		return m.OnItemExistsInBloomFilter(ctx, saleID, itemID)
+	}
+	return false, nil
+}
+
+func (m *Cache) ItemsExistInBloomFilter(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error) {
+	if m.OnItemsExistInBloomFilter != nil {
+		return m.OnItemsExistInBloomFilter(ctx, saleID, itemIDs)
+	}
+	return nil, nil
+}
+
+func (m *Cache) RemoveItemFromBloomFilter(ctx context.Context, saleID, itemID string) error {
+	if m.OnRemoveItemFromBloomFilter != nil {
+		return m.OnRemoveItemFromBloomFilter(ctx, saleID, itemID)
+	}
+	return nil
+}
+
+func (m *Cache) WarmBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	if m.OnWarmBloomFilter != nil {
+		return m.OnWarmBloomFilter(ctx, saleID, itemIDs)
+	}
+	return nil
+}
+
+func (m *Cache) ResetBloomFilterForSale(ctx context.Context, saleID string) error {
+	if m.OnResetBloomFilterForSale != nil {
+		return m.OnResetBloomFilterForSale(ctx, saleID)
+	}
+	return nil
+}
+
+func (m *Cache) GetUserItemCount(ctx context.Context, saleID, userID string) (int, error) {
+	if m.OnGetUserItemCount != nil {
+		return m.OnGetUserItemCount(ctx, saleID, userID)
+	}
+	return 0, nil
+}
+
+func (m *Cache) IncrementUserItemCount(ctx context.Context, saleID, userID string) error {
+	if m.OnIncrementUserItemCount != nil {
+		return m.OnIncrementUserItemCount(ctx, saleID, userID)
+	}
+	return nil
+}
+
+func (m *Cache) SetUserItemCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
+	if m.OnSetUserItemCount != nil {
+		return m.OnSetUserItemCount(ctx, saleID, userID, count, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) GetUserCheckoutCount(ctx context.Context, saleID, userID string) (int, error) {
+	if m.OnGetUserCheckoutCount != nil {
+		return m.OnGetUserCheckoutCount(ctx, saleID, userID)
+	}
+	return 0, nil
+}
+
+func (m *Cache) IncrementUserCheckoutCount(ctx context.Context, saleID, userID string) error {
+	if m.OnIncrementUserCheckoutCount != nil {
+		return m.OnIncrementUserCheckoutCount(ctx, saleID, userID)
+	}
+	return nil
+}
+
+func (m *Cache) SetUserCheckoutCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
+	if m.OnSetUserCheckoutCount != nil {
+		return m.OnSetUserCheckoutCount(ctx, saleID, userID, count, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) GetAvailableCheckoutSlots(ctx context.Context, saleID, userID string, maxItems int) (int, error) {
+	if m.OnGetAvailableCheckoutSlots != nil {
+		return m.OnGetAvailableCheckoutSlots(ctx, saleID, userID, maxItems)
+	}
+	return 0, nil
+}
+
+func (m *Cache) AtomicCheckoutReserve(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (bool, error) {
+	if m.OnAtomicCheckoutReserve != nil {
+		return m.OnAtomicCheckoutReserve(ctx, saleID, userID, count, maxItems, expiration)
+	}
+	return false, nil
+}
+
+func (m *Cache) AtomicReserveCheckoutSlot(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (remaining int, ok bool, err error) {
+	if m.OnAtomicReserveCheckoutSlot != nil {
+		return m.OnAtomicReserveCheckoutSlot(ctx, saleID, userID, maxItems, expiration)
+	}
+	return 0, false, nil
+}
+
+func (m *Cache) ReleaseCheckoutReservation(ctx context.Context, saleID, userID string, count int) error {
+	if m.OnReleaseCheckoutReservation != nil {
+		return m.OnReleaseCheckoutReservation(ctx, saleID, userID, count)
+	}
+	return nil
+}
+
+func (m *Cache) GetUserCheckoutCode(ctx context.Context, saleID, userID string) (string, error) {
+	if m.OnGetUserCheckoutCode != nil {
+		return m.OnGetUserCheckoutCode(ctx, saleID, userID)
+	}
+	return "", nil
+}
+
+func (m *Cache) SetUserCheckoutCode(ctx context.Context, saleID, userID, code string, expiration time.Duration) error {
+	if m.OnSetUserCheckoutCode != nil {
+		return m.OnSetUserCheckoutCode(ctx, saleID, userID, code, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) RemoveUserCheckoutCode(ctx context.Context, saleID, userID string) error {
+	if m.OnRemoveUserCheckoutCode != nil {
+		return m.OnRemoveUserCheckoutCode(ctx, saleID, userID)
+	}
+	return nil
+}
+
+func (m *Cache) SetCheckoutCode(ctx context.Context, code string, expiration time.Duration) error {
+	if m.OnSetCheckoutCode != nil {
+		return m.OnSetCheckoutCode(ctx, code, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) CheckoutCodeExists(ctx context.Context, code string) (bool, error) {
+	if m.OnCheckoutCodeExists != nil {
+		return m.OnCheckoutCodeExists(ctx, code)
+	}
+	return false, nil
+}
+
+func (m *Cache) RemoveCheckoutCode(ctx context.Context, code string) error {
+	if m.OnRemoveCheckoutCode != nil {
+		return m.OnRemoveCheckoutCode(ctx, code)
+	}
+	return nil
+}
+
+func (m *Cache) ExtendSaleCheckoutTTLs(ctx context.Context, saleID string, oldExpiry, newExpiry time.Time) error {
+	if m.OnExtendSaleCheckoutTTLs != nil {
+		return m.OnExtendSaleCheckoutTTLs(ctx, saleID, oldExpiry, newExpiry)
+	}
+	return nil
+}
+
+func (m *Cache) PurgeSaleData(ctx context.Context, saleID string) error {
+	if m.OnPurgeSaleData != nil {
+		return m.OnPurgeSaleData(ctx, saleID)
+	}
+	return nil
+}
+
+func (m *Cache) HasUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string) (bool, error) {
+	if m.OnHasUserCheckedOutItem != nil {
+		return m.OnHasUserCheckedOutItem(ctx, saleID, userID, itemID)
+	}
+	return false, nil
+}
+
+func (m *Cache) AddUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string, expiration time.Duration) error {
+	if m.OnAddUserCheckedOutItem != nil {
+		return m.OnAddUserCheckedOutItem(ctx, saleID, userID, itemID, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) IncrementSaleItemsSold(ctx context.Context, saleID string, count int) error {
+	if m.OnIncrementSaleItemsSold != nil {
+		return m.OnIncrementSaleItemsSold(ctx, saleID, count)
+	}
+	return nil
+}
+
+func (m *Cache) GetSaleItemsSold(ctx context.Context, saleID string) (int, error) {
+	if m.OnGetSaleItemsSold != nil {
+		return m.OnGetSaleItemsSold(ctx, saleID)
+	}
+	return 0, nil
+}
+
+func (m *Cache) GetSaleItemCount(ctx context.Context, saleID string) (int, error) {
+	if m.OnGetSaleItemCount != nil {
+		return m.OnGetSaleItemCount(ctx, saleID)
+	}
+	return 0, nil
+}
+
+func (m *Cache) SetSaleItemCount(ctx context.Context, saleID string, count int, expiration time.Duration) error {
+	if m.OnSetSaleItemCount != nil {
+		return m.OnSetSaleItemCount(ctx, saleID, count, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) IncrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
+	if m.OnIncrementCounters != nil {
+		return m.OnIncrementCounters(ctx, saleID, userID, itemCount)
+	}
+	return nil
+}
+
+func (m *Cache) GetSaleTotalItems(ctx context.Context, saleID string) (int, bool, error) {
+	if m.OnGetSaleTotalItems != nil {
+		return m.OnGetSaleTotalItems(ctx, saleID)
+	}
+	return 0, false, nil
+}
+
+func (m *Cache) SetSaleTotalItems(ctx context.Context, saleID string, totalItems int, expiration time.Duration) error {
+	if m.OnSetSaleTotalItems != nil {
+		return m.OnSetSaleTotalItems(ctx, saleID, totalItems, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) GetSaleQuota(ctx context.Context, saleID string) (int, bool, error) {
+	if m.OnGetSaleQuota != nil {
+		return m.OnGetSaleQuota(ctx, saleID)
+	}
+	return 0, false, nil
+}
+
+func (m *Cache) SetSaleQuota(ctx context.Context, saleID string, quota int, expiration time.Duration) error {
+	if m.OnSetSaleQuota != nil {
+		return m.OnSetSaleQuota(ctx, saleID, quota, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) GetSaleRemaining(ctx context.Context, saleID string) (int, bool, error) {
+	if m.OnGetSaleRemaining != nil {
+		return m.OnGetSaleRemaining(ctx, saleID)
+	}
+	return 0, false, nil
+}
+
+func (m *Cache) SetSaleRemaining(ctx context.Context, saleID string, remaining int, expiration time.Duration) error {
+	if m.OnSetSaleRemaining != nil {
+		return m.OnSetSaleRemaining(ctx, saleID, remaining, expiration)
+	}
+	return nil
+}
+
+func (m *Cache) DecrementSaleRemaining(ctx context.Context, saleID string, count int) error {
+	if m.OnDecrementSaleRemaining != nil {
+		return m.OnDecrementSaleRemaining(ctx, saleID, count)
+	}
+	return nil
+}
+
+func (m *Cache) PublishItemSold(ctx context.Context, saleID, itemID string) error {
+	if m.OnPublishItemSold != nil {
+		return m.OnPublishItemSold(ctx, saleID, itemID)
+	}
+	return nil
+}
+
+func (m *Cache) SubscribeItemSold(ctx context.Context, saleID string) (<-chan string, error) {
+	if m.OnSubscribeItemSold != nil {
+		return m.OnSubscribeItemSold(ctx, saleID)
+	}
+	return nil, nil
+}
+
+func (m *Cache) AtomicPurchaseCheck(ctx context.Context, saleID, userID string, itemCount int, maxSaleItems, maxUserItems int) (bool, error) {
+	if m.OnAtomicPurchaseCheck != nil {
+		return m.OnAtomicPurchaseCheck(ctx, saleID, userID, itemCount, maxSaleItems, maxUserItems)
+	}
+	return false, nil
+}
+
+func (m *Cache) AtomicUserLimitCheck(ctx context.Context, saleID, userID string, itemCount, maxItems int) (bool, error) {
+	if m.OnAtomicUserLimitCheck != nil {
+		return m.OnAtomicUserLimitCheck(ctx, saleID, userID, itemCount, maxItems)
+	}
+	return false, nil
+}
+
+func (m *Cache) AtomicSaleLimitCheck(ctx context.Context, saleID string, itemCount, maxItems int) (bool, error) {
+	if m.OnAtomicSaleLimitCheck != nil {
+		return m.OnAtomicSaleLimitCheck(ctx, saleID, itemCount, maxItems)
+	}
+	return false, nil
+}
+
+func (m *Cache) DecrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
+	if m.OnDecrementCounters != nil {
+		return m.OnDecrementCounters(ctx, saleID, userID, itemCount)
+	}
+	return nil
+}
+
+func (m *Cache) BeginIdempotentPurchase(ctx context.Context, key, code string, ttl time.Duration) (*ports.IdempotentPurchase, bool, error) {
+	if m.OnBeginIdempotentPurchase != nil {
+		return m.OnBeginIdempotentPurchase(ctx, key, code, ttl)
+	}
+	return nil, true, nil
+}
+
+func (m *Cache) CompleteIdempotentPurchase(ctx context.Context, key string, purchase *ports.IdempotentPurchase, ttl time.Duration) error {
+	if m.OnCompleteIdempotentPurchase != nil {
+		return m.OnCompleteIdempotentPurchase(ctx, key, purchase, ttl)
+	}
+	return nil
+}
+
+func (m *Cache) AbortIdempotentPurchase(ctx context.Context, key, code string) error {
+	if m.OnAbortIdempotentPurchase != nil {
+		return m.OnAbortIdempotentPurchase(ctx, key, code)
+	}
+	return nil
+}
+
+func (m *Cache) DistributedLock(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	if m.OnDistributedLock != nil {
+		return m.OnDistributedLock(ctx, key, expiration)
+	}
+	return false, nil
+}
+
+func (m *Cache) ReleaseLock(ctx context.Context, key string) error {
+	if m.OnReleaseLock != nil {
+		return m.OnReleaseLock(ctx, key)
+	}
+	return nil
+}
+
+func (m *Cache) TryLockWithHeartbeat(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error) {
+	if m.OnTryLockWithHeartbeat != nil {
+		return m.OnTryLockWithHeartbeat(ctx, key, ttl)
+	}
+	return ctx, func() {}, nil
+}
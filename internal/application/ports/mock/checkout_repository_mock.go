@@ -0,0 +1,90 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+)
+
+var _ ports.CheckoutRepository = (*CheckoutRepository)(nil)
+
+// CheckoutRepository is a ports.CheckoutRepository whose behaviour is set
+// per method through its On* fields. A method whose field is nil returns
+// zero values and a nil error.
+type CheckoutRepository struct {
+	OnGetCheckoutByCode      func(ctx context.Context, code string) (*sale.Checkout, error)
+	OnCreateCheckout         func(ctx context.Context, checkout *sale.Checkout) error
+	OnAddItemToCheckout      func(ctx context.Context, checkoutCode string, itemID string) error
+	OnRefreshCheckoutExpiry  func(ctx context.Context, checkoutCode string, expiresAt time.Time) error
+	OnGetUserCheckoutCount   func(ctx context.Context, saleID, userID string) (int, error)
+	OnDeleteCheckout         func(ctx context.Context, checkoutCode string) error
+	OnGetExpiredCheckouts    func(ctx context.Context, olderThan time.Duration) ([]*sale.Checkout, error)
+	OnDeleteExpiredCheckouts func(ctx context.Context, olderThan time.Duration) (int64, error)
+
+	OnLogCheckoutAttempt func(ctx context.Context, saleID, userID, checkoutCode string, itemID string) error
+}
+
+func (m *CheckoutRepository) GetCheckoutByCode(ctx context.Context, code string) (*sale.Checkout, error) {
+	if m.OnGetCheckoutByCode != nil {
+		return m.OnGetCheckoutByCode(ctx, code)
+	}
+	return nil, nil
+}
+
+func (m *CheckoutRepository) CreateCheckout(ctx context.Context, checkout *sale.Checkout) error {
+	if m.OnCreateCheckout != nil {
+		return m.OnCreateCheckout(ctx, checkout)
+	}
+	return nil
+}
+
+func (m *CheckoutRepository) AddItemToCheckout(ctx context.Context, checkoutCode string, itemID string) error {
+	if m.OnAddItemToCheckout != nil {
+		return m.OnAddItemToCheckout(ctx, checkoutCode, itemID)
+	}
+	return nil
+}
+
+func (m *CheckoutRepository) RefreshCheckoutExpiry(ctx context.Context, checkoutCode string, expiresAt time.Time) error {
+	if m.OnRefreshCheckoutExpiry != nil {
+		return m.OnRefreshCheckoutExpiry(ctx, checkoutCode, expiresAt)
+	}
+	return nil
+}
+
+func (m *CheckoutRepository) GetUserCheckoutCount(ctx context.Context, saleID, userID string) (int, error) {
+	if m.OnGetUserCheckoutCount != nil {
+		return m.OnGetUserCheckoutCount(ctx, saleID, userID)
+	}
+	return 0, nil
+}
+
+func (m *CheckoutRepository) DeleteCheckout(ctx context.Context, checkoutCode string) error {
+	if m.OnDeleteCheckout != nil {
+		return m.OnDeleteCheckout(ctx, checkoutCode)
+	}
+	return nil
+}
+
+func (m *CheckoutRepository) GetExpiredCheckouts(ctx context.Context, olderThan time.Duration) ([]*sale.Checkout, error) {
+	if m.OnGetExpiredCheckouts != nil {
+		return m.OnGetExpiredCheckouts(ctx, olderThan)
+	}
+	return nil, nil
+}
+
+func (m *CheckoutRepository) DeleteExpiredCheckouts(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if m.OnDeleteExpiredCheckouts != nil {
+		return m.OnDeleteExpiredCheckouts(ctx, olderThan)
+	}
+	return 0, nil
+}
+
+func (m *CheckoutRepository) LogCheckoutAttempt(ctx context.Context, saleID, userID, checkoutCode string, itemID string) error {
+	if m.OnLogCheckoutAttempt != nil {
+		return m.OnLogCheckoutAttempt(ctx, saleID, userID, checkoutCode, itemID)
+	}
+	return nil
+}
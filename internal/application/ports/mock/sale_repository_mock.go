@@ -0,0 +1,246 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+)
+
+var _ ports.SaleRepository = (*SaleRepository)(nil)
+
+// SaleRepository is a ports.SaleRepository whose behaviour is set per method
+// through its On* fields. A method whose field is nil returns zero values and
+// a nil error, except BeginTx, which returns the mock itself so code running
+// inside a transaction keeps hitting the same hooks.
+type SaleRepository struct {
+	OnGetActiveSale           func(ctx context.Context) (*sale.Sale, error)
+	OnGetActiveSaleByCategory func(ctx context.Context, category string) (*sale.Sale, error)
+	OnGetSaleByID             func(ctx context.Context, id string) (*sale.Sale, error)
+	OnGetSaleByIDForUpdate    func(ctx context.Context, id string) (*sale.Sale, error)
+	OnGetUpcomingSales        func(ctx context.Context, until time.Time, limit int) ([]*sale.Sale, error)
+	OnListSales               func(ctx context.Context, status string, afterID string, limit int) ([]*sale.Sale, error)
+	OnCreateSale              func(ctx context.Context, sale *sale.Sale) error
+	OnUpdateSale              func(ctx context.Context, sale *sale.Sale) error
+	OnIncrementSaleTotalItems func(ctx context.Context, id string, count int) (*sale.Sale, error)
+
+	OnGetItemByID               func(ctx context.Context, id string) (*sale.Item, error)
+	OnGetItemsBySaleID          func(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error)
+	OnCountItemsBySaleID        func(ctx context.Context, saleID string) (int, error)
+	OnGetSaleSoldCount          func(ctx context.Context, saleID string) (int, error)
+	OnGetSoldItemIDsBySaleID    func(ctx context.Context, saleID string) ([]string, error)
+	OnGetAvailableItemsBySaleID func(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error)
+	OnCreateItem                func(ctx context.Context, item *sale.Item) error
+	OnCreateItems               func(ctx context.Context, items []*sale.Item) error
+	OnCreateItemsWithCopy       func(ctx context.Context, items []*sale.Item) error
+	OnMarkItemAsSold            func(ctx context.Context, id string, userID string) (bool, error)
+	OnBatchMarkItemsAsSold      func(ctx context.Context, itemIDs []string, userID string) ([]string, error)
+	OnMarkItemAsUnsold          func(ctx context.Context, itemID, userID string) error
+	OnRecordPurchases           func(ctx context.Context, saleID, userID, checkoutCode string, itemIDs []string) error
+
+	OnSavePurchaseResult func(ctx context.Context, checkoutCode string, result *sale.PurchaseResult) error
+	OnGetPurchaseResult  func(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error)
+
+	OnAppendOutboxEvent func(ctx context.Context, eventType string, payload interface{}) error
+
+	OnBeginTx    func(ctx context.Context) (ports.SaleRepository, error)
+	OnCommitTx   func(ctx context.Context) error
+	OnRollbackTx func(ctx context.Context) error
+}
+
+func (m *SaleRepository) GetActiveSale(ctx context.Context) (*sale.Sale, error) {
+	if m.OnGetActiveSale != nil {
+		return m.OnGetActiveSale(ctx)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetActiveSaleByCategory(ctx context.Context, category string) (*sale.Sale, error) {
+	if m.OnGetActiveSaleByCategory != nil {
+		return m.OnGetActiveSaleByCategory(ctx, category)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetSaleByID(ctx context.Context, id string) (*sale.Sale, error) {
+	if m.OnGetSaleByID != nil {
+		return m.OnGetSaleByID(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetSaleByIDForUpdate(ctx context.Context, id string) (*sale.Sale, error) {
+	if m.OnGetSaleByIDForUpdate != nil {
+		return m.OnGetSaleByIDForUpdate(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetUpcomingSales(ctx context.Context, until time.Time, limit int) ([]*sale.Sale, error) {
+	if m.OnGetUpcomingSales != nil {
+		return m.OnGetUpcomingSales(ctx, until, limit)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) ListSales(ctx context.Context, status string, afterID string, limit int) ([]*sale.Sale, error) {
+	if m.OnListSales != nil {
+		return m.OnListSales(ctx, status, afterID, limit)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) CreateSale(ctx context.Context, sale *sale.Sale) error {
+	if m.OnCreateSale != nil {
+		return m.OnCreateSale(ctx, sale)
+	}
+	return nil
+}
+
+func (m *SaleRepository) UpdateSale(ctx context.Context, sale *sale.Sale) error {
+	if m.OnUpdateSale != nil {
+		return m.OnUpdateSale(ctx, sale)
+	}
+	return nil
+}
+
+func (m *SaleRepository) IncrementSaleTotalItems(ctx context.Context, id string, count int) (*sale.Sale, error) {
+	if m.OnIncrementSaleTotalItems != nil {
+		return m.OnIncrementSaleTotalItems(ctx, id, count)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetItemByID(ctx context.Context, id string) (*sale.Item, error) {
+	if m.OnGetItemByID != nil {
+		return m.OnGetItemByID(ctx, id)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error) {
+	if m.OnGetItemsBySaleID != nil {
+		return m.OnGetItemsBySaleID(ctx, saleID, limit, offset)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) CountItemsBySaleID(ctx context.Context, saleID string) (int, error) {
+	if m.OnCountItemsBySaleID != nil {
+		return m.OnCountItemsBySaleID(ctx, saleID)
+	}
+	return 0, nil
+}
+
+func (m *SaleRepository) GetSaleSoldCount(ctx context.Context, saleID string) (int, error) {
+	if m.OnGetSaleSoldCount != nil {
+		return m.OnGetSaleSoldCount(ctx, saleID)
+	}
+	return 0, nil
+}
+
+func (m *SaleRepository) GetSoldItemIDsBySaleID(ctx context.Context, saleID string) ([]string, error) {
+	if m.OnGetSoldItemIDsBySaleID != nil {
+		return m.OnGetSoldItemIDsBySaleID(ctx, saleID)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) GetAvailableItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error) {
+	if m.OnGetAvailableItemsBySaleID != nil {
+		return m.OnGetAvailableItemsBySaleID(ctx, saleID, limit, offset)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) CreateItem(ctx context.Context, item *sale.Item) error {
+	if m.OnCreateItem != nil {
+		return m.OnCreateItem(ctx, item)
+	}
+	return nil
+}
+
+func (m *SaleRepository) CreateItems(ctx context.Context, items []*sale.Item) error {
+	if m.OnCreateItems != nil {
+		return m.OnCreateItems(ctx, items)
+	}
+	return nil
+}
+
+func (m *SaleRepository) CreateItemsWithCopy(ctx context.Context, items []*sale.Item) error {
+	if m.OnCreateItemsWithCopy != nil {
+		return m.OnCreateItemsWithCopy(ctx, items)
+	}
+	return nil
+}
+
+func (m *SaleRepository) MarkItemAsSold(ctx context.Context, id string, userID string) (bool, error) {
+	if m.OnMarkItemAsSold != nil {
+		return m.OnMarkItemAsSold(ctx, id, userID)
+	}
+	return false, nil
+}
+
+func (m *SaleRepository) BatchMarkItemsAsSold(ctx context.Context, itemIDs []string, userID string) ([]string, error) {
+	if m.OnBatchMarkItemsAsSold != nil {
+		return m.OnBatchMarkItemsAsSold(ctx, itemIDs, userID)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) MarkItemAsUnsold(ctx context.Context, itemID, userID string) error {
+	if m.OnMarkItemAsUnsold != nil {
+		return m.OnMarkItemAsUnsold(ctx, itemID, userID)
+	}
+	return nil
+}
+
+func (m *SaleRepository) RecordPurchases(ctx context.Context, saleID, userID, checkoutCode string, itemIDs []string) error {
+	if m.OnRecordPurchases != nil {
+		return m.OnRecordPurchases(ctx, saleID, userID, checkoutCode, itemIDs)
+	}
+	return nil
+}
+
+func (m *SaleRepository) SavePurchaseResult(ctx context.Context, checkoutCode string, result *sale.PurchaseResult) error {
+	if m.OnSavePurchaseResult != nil {
+		return m.OnSavePurchaseResult(ctx, checkoutCode, result)
+	}
+	return nil
+}
+
+func (m *SaleRepository) GetPurchaseResult(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error) {
+	if m.OnGetPurchaseResult != nil {
+		return m.OnGetPurchaseResult(ctx, checkoutCode)
+	}
+	return nil, nil
+}
+
+func (m *SaleRepository) AppendOutboxEvent(ctx context.Context, eventType string, payload interface{}) error {
+	if m.OnAppendOutboxEvent != nil {
+		return m.OnAppendOutboxEvent(ctx, eventType, payload)
+	}
+	return nil
+}
+
+func (m *SaleRepository) BeginTx(ctx context.Context) (ports.SaleRepository, error) {
+	if m.OnBeginTx != nil {
+		return m.OnBeginTx(ctx)
+	}
+	return m, nil
+}
+
+func (m *SaleRepository) CommitTx(ctx context.Context) error {
+	if m.OnCommitTx != nil {
+		return m.OnCommitTx(ctx)
+	}
+	return nil
+}
+
+func (m *SaleRepository) RollbackTx(ctx context.Context) error {
+	if m.OnRollbackTx != nil {
+		return m.OnRollbackTx(ctx)
+	}
+	return nil
+}
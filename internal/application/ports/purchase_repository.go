@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// PurchaseExportRow is one purchased item, with the item's name and price.
+type PurchaseExportRow struct {
+	PurchaseID  string          `json:"purchase_id"`
+	UserID      string          `json:"user_id"`
+	ItemID      string          `json:"item_id"`
+	ItemName    string          `json:"item_name"`
+	Price       decimal.Decimal `json:"price"`
+	PurchasedAt time.Time       `json:"purchased_at"`
+}
+
+// PurchaseExporter streams a sale's purchases for download.
+type PurchaseExporter interface {
+	// ExportPurchases calls fn for each purchase of a sale in purchase
+	// order and stops at the first error fn returns.
+	ExportPurchases(ctx context.Context, saleID string, fn func(PurchaseExportRow) error) error
+}
@@ -2,26 +2,41 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 )
 
 type SaleRepository interface {
 	GetActiveSale(ctx context.Context) (*sale.Sale, error)
+	GetActiveSaleByCategory(ctx context.Context, category string) (*sale.Sale, error)
 	GetSaleByID(ctx context.Context, id string) (*sale.Sale, error)
+	GetSaleByIDForUpdate(ctx context.Context, id string) (*sale.Sale, error)
+	GetUpcomingSales(ctx context.Context, until time.Time, limit int) ([]*sale.Sale, error)
+	ListSales(ctx context.Context, status string, afterID string, limit int) ([]*sale.Sale, error)
 	CreateSale(ctx context.Context, sale *sale.Sale) error
 	UpdateSale(ctx context.Context, sale *sale.Sale) error
+	IncrementSaleTotalItems(ctx context.Context, id string, count int) (*sale.Sale, error)
 
 	GetItemByID(ctx context.Context, id string) (*sale.Item, error)
 	GetItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error)
+	CountItemsBySaleID(ctx context.Context, saleID string) (int, error)
+	GetSaleSoldCount(ctx context.Context, saleID string) (int, error)
+	GetSoldItemIDsBySaleID(ctx context.Context, saleID string) ([]string, error)
 	GetAvailableItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error)
 	CreateItem(ctx context.Context, item *sale.Item) error
 	CreateItems(ctx context.Context, items []*sale.Item) error
+	CreateItemsWithCopy(ctx context.Context, items []*sale.Item) error
 	MarkItemAsSold(ctx context.Context, id string, userID string) (bool, error)
+	BatchMarkItemsAsSold(ctx context.Context, itemIDs []string, userID string) ([]string, error)
+	MarkItemAsUnsold(ctx context.Context, itemID, userID string) error
+	RecordPurchases(ctx context.Context, saleID, userID, checkoutCode string, itemIDs []string) error
 
 	SavePurchaseResult(ctx context.Context, checkoutCode string, result *sale.PurchaseResult) error
 	GetPurchaseResult(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error)
 
+	AppendOutboxEvent(ctx context.Context, eventType string, payload interface{}) error
+
 	BeginTx(ctx context.Context) (SaleRepository, error)
 	CommitTx(ctx context.Context) error
 	RollbackTx(ctx context.Context) error
@@ -7,6 +7,7 @@ import (
 
 	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/events"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
@@ -18,10 +19,8 @@ type PurchaseUseCase struct {
 	purchaseSvc  *sale.PurchaseService
 	log          *logger.Logger
 
-	maxItemsPerSale int
-	maxItemsPerUser int
-	retryAttempts   int
-	lockTimeout     time.Duration
+	retryAttempts int
+	lockTimeout   time.Duration
 }
 
 func NewPurchaseUseCase(
@@ -31,61 +30,65 @@ func NewPurchaseUseCase(
 	log *logger.Logger,
 ) *PurchaseUseCase {
 	return &PurchaseUseCase{
-		saleRepo:        saleRepo,
-		checkoutRepo:    checkoutRepo,
-		cache:           cache,
-		purchaseSvc:     sale.NewPurchaseService(10000, 10),
-		log:             log,
-		maxItemsPerSale: 10000,
-		maxItemsPerUser: 10,
-		retryAttempts:   2,
-		lockTimeout:     time.Second * 3,
+		saleRepo:      saleRepo,
+		checkoutRepo:  checkoutRepo,
+		cache:         cache,
+		purchaseSvc:   sale.NewPurchaseService(),
+		log:           log,
+		retryAttempts: 2,
+		lockTimeout:   time.Second * 3,
 	}
 }
 
 func (uc *PurchaseUseCase) ExecutePurchase(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error) {
+	log := uc.log.WithContext(ctx).WithField("checkout_code", checkoutCode)
+
 	exists, err := uc.cache.CheckoutCodeExists(ctx, checkoutCode)
 	if err != nil {
-		uc.log.Error("Failed to check checkout code", "error", err, "checkout_code", checkoutCode)
+		log.Error("Failed to check checkout code", "error", err)
 		return nil, err
 	}
 
 	checkout, err := uc.checkoutRepo.GetCheckoutByCode(ctx, checkoutCode)
 	if err != nil {
-		uc.log.Error("Failed to get checkout", "error", err, "checkout_code", checkoutCode)
+		log.Error("Failed to get checkout", "error", err)
 		return nil, errors.ErrCheckoutNotFound
 	}
 
+	log = log.WithField("sale_id", checkout.SaleID).WithField("user_id", checkout.UserID)
+
 	if !exists {
 		if err := uc.cache.SetCheckoutCode(ctx, checkoutCode, time.Hour); err != nil {
-			uc.log.Warn("Failed to restore checkout code in cache", "error", err, "checkout_code", checkoutCode)
+			log.Warn("Failed to restore checkout code in cache", "error", err)
 		}
 	}
 
 	lockKey := fmt.Sprintf("purchase:%s", checkoutCode)
-	locked, err := uc.cache.DistributedLock(ctx, lockKey, uc.lockTimeout)
+	lockCtx, unlock, err := uc.cache.TryLockWithHeartbeat(ctx, lockKey, uc.lockTimeout)
 	if err != nil {
-		uc.log.Error("Failed to acquire lock", "error", err, "lock_key", lockKey)
+		if err == ports.ErrLockNotAcquired {
+			return nil, fmt.Errorf("another purchase is in progress for this user")
+		}
+		log.Error("Failed to acquire lock", "error", err, "lock_key", lockKey)
 		return nil, fmt.Errorf("failed to acquire lock: %w", err)
 	}
-	if !locked {
-		return nil, fmt.Errorf("another purchase is in progress for this user")
-	}
-	defer func() {
-		if err := uc.cache.ReleaseLock(ctx, lockKey); err != nil {
-			uc.log.Error("Failed to release lock", "error", err, "lock_key", lockKey)
-		}
-	}()
+	defer unlock()
 
+	// Attempts run under lockCtx, so losing the lock cancels the purchase
+	// transaction instead of letting it commit next to another holder's.
 	var result *sale.PurchaseResult
 	for attempt := 0; attempt < uc.retryAttempts; attempt++ {
-		result, err = uc.attemptPurchase(ctx, checkout)
+		result, err = uc.attemptPurchase(lockCtx, log, checkout)
 		if err == nil {
 			break
 		}
 
-		uc.log.Warn("Purchase attempt failed", "attempt", attempt+1, "error", err.Error(), "checkout_code", checkoutCode)
+		log.Warn("Purchase attempt failed", "attempt", attempt+1, "error", err.Error())
 
+		if context.Cause(lockCtx) == ports.ErrLockLost {
+			log.Error("Purchase lock lost, purchase aborted", "lock_key", lockKey)
+			return nil, fmt.Errorf("purchase aborted: %w", ports.ErrLockLost)
+		}
 		if isBusinessLogicError(err) {
 			break
 		}
@@ -99,65 +102,65 @@ func (uc *PurchaseUseCase) ExecutePurchase(ctx context.Context, checkoutCode str
 		return nil, err
 	}
 
-	if err := uc.cleanupCheckout(ctx, checkoutCode, checkout.SaleID, checkout.UserID); err != nil {
-		uc.log.Error("Failed to cleanup checkout", "error", err, "checkout_code", checkoutCode)
+	if err := uc.cleanupCheckout(ctx, log, checkoutCode, checkout.SaleID, checkout.UserID); err != nil {
+		log.Error("Failed to cleanup checkout", "error", err)
 	}
 
 	return result, nil
 }
 
-func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, checkout *sale.Checkout) (*sale.PurchaseResult, error) {
-	for _, itemID := range checkout.ItemIDs {
-		if err := uc.checkoutRepo.LogCheckoutAttempt(ctx, checkout.SaleID, checkout.UserID, checkout.Code, itemID); err != nil {
-			uc.log.Error("Failed to log checkout attempt", "error", err, "checkout_code", checkout.Code, "item_id", itemID)
-		}
+// GetPurchaseStatus returns the stored result of a processed checkout, so a
+// client that lost the purchase response can find out how it went.
+func (uc *PurchaseUseCase) GetPurchaseStatus(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error) {
+	result, err := uc.saleRepo.GetPurchaseResult(ctx, checkoutCode)
+	if err != nil {
+		return nil, err
 	}
+	if result == nil {
+		return nil, errors.ErrPurchaseResultNotFound
+	}
+	if result.Corrupted {
+		uc.log.WithContext(ctx).Error("Stored purchase result is corrupted",
+			"checkout_code", checkoutCode,
+			"error", result.CorruptionError)
+		return nil, errors.ErrInvalidPurchaseResult
+	}
+	return result, nil
+}
 
-	currentUserCount, _ := uc.cache.GetUserItemCount(ctx, checkout.SaleID, checkout.UserID)
-	uc.log.Info("Pre-purchase check",
-		"user_id", checkout.UserID,
-		"sale_id", checkout.SaleID,
-		"current_user_count", currentUserCount,
-		"item_count", len(checkout.ItemIDs),
-		"max_sale_items", uc.maxItemsPerSale,
-		"max_user_items", uc.maxItemsPerUser)
-
-	currentSaleCount, _ := uc.cache.GetSaleItemCount(ctx, checkout.SaleID)
-	if currentSaleCount+len(checkout.ItemIDs) > uc.maxItemsPerSale {
-		uc.log.Warn("Sale limit would be exceeded",
-			"sale_id", checkout.SaleID,
-			"current_sale_count", currentSaleCount,
-			"item_count", len(checkout.ItemIDs),
-			"max_sale_items", uc.maxItemsPerSale)
-		return nil, errors.ErrSaleLimitExceeded
+func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, log *logger.Logger, checkout *sale.Checkout) (*sale.PurchaseResult, error) {
+	if checkout.IsExpired(time.Now().UTC()) {
+		log.Warn("Checkout has expired", "expires_at", checkout.ExpiresAt)
+		return nil, errors.ErrCheckoutExpiredTTL
 	}
 
-	if currentUserCount+len(checkout.ItemIDs) > uc.maxItemsPerUser {
-		uc.log.Warn("User limit would be exceeded",
-			"user_id", checkout.UserID,
-			"sale_id", checkout.SaleID,
-			"current_user_count", currentUserCount,
-			"item_count", len(checkout.ItemIDs),
-			"max_user_items", uc.maxItemsPerUser)
-		return nil, errors.ErrUserLimitExceeded
+	for _, itemID := range checkout.ItemIDs {
+		if err := uc.checkoutRepo.LogCheckoutAttempt(ctx, checkout.SaleID, checkout.UserID, checkout.Code, itemID); err != nil {
+			log.Error("Failed to log checkout attempt", "error", err, "item_id", itemID)
+		}
 	}
 
 	txRepo, err := uc.saleRepo.BeginTx(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	committed := false
 	defer func() {
-		if err != nil {
+		if !committed {
 			_ = txRepo.RollbackTx(ctx)
 		}
 	}()
 
 	existingResult, err := txRepo.GetPurchaseResult(ctx, checkout.Code)
 	if err != nil {
-		uc.log.Error("Failed to check existing purchase result", "error", err, "checkout_code", checkout.Code)
+		log.Error("Failed to check existing purchase result", "error", err)
 		return nil, err
 	}
 	if existingResult != nil {
+		if existingResult.Corrupted {
+			// log carries the checkout code.
+			log.Error("Stored purchase result is corrupted", "error", existingResult.CorruptionError)
+		}
 		return nil, errors.ErrCheckoutAlreadyProcessed
 	}
 
@@ -166,11 +169,43 @@ func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, checkout *sale.C
 		return nil, fmt.Errorf("failed to get sale: %w", err)
 	}
 
+	maxSaleItems := saleEntity.MaxItemsPerSale
+	if totalItems, found, err := uc.cache.GetSaleTotalItems(ctx, checkout.SaleID); err == nil && found && totalItems > maxSaleItems {
+		maxSaleItems = totalItems
+	}
+	if quota, found, err := uc.cache.GetSaleQuota(ctx, checkout.SaleID); err == nil && found {
+		maxSaleItems = quota
+	}
+
+	currentUserCount, _ := uc.cache.GetUserItemCount(ctx, checkout.SaleID, checkout.UserID)
+	log.Info("Pre-purchase check",
+		"current_user_count", currentUserCount,
+		"item_count", len(checkout.ItemIDs),
+		"max_sale_items", maxSaleItems,
+		"max_user_items", saleEntity.MaxItemsPerUser)
+
+	currentSaleCount, _ := uc.cache.GetSaleItemCount(ctx, checkout.SaleID)
+	if currentSaleCount+len(checkout.ItemIDs) > maxSaleItems {
+		log.Warn("Sale limit would be exceeded",
+			"current_sale_count", currentSaleCount,
+			"item_count", len(checkout.ItemIDs),
+			"max_sale_items", maxSaleItems)
+		return nil, errors.ErrSaleLimitExceeded
+	}
+
+	if currentUserCount+len(checkout.ItemIDs) > saleEntity.MaxItemsPerUser {
+		log.Warn("User limit would be exceeded",
+			"current_user_count", currentUserCount,
+			"item_count", len(checkout.ItemIDs),
+			"max_user_items", saleEntity.MaxItemsPerUser)
+		return nil, errors.ErrUserLimitExceeded
+	}
+
 	items := make([]*sale.Item, 0, len(checkout.ItemIDs))
 	for _, itemID := range checkout.ItemIDs {
 		item, err := txRepo.GetItemByID(ctx, itemID)
 		if err != nil {
-			uc.log.Error("Failed to get item", "error", err, "item_id", itemID)
+			log.Error("Failed to get item", "error", err, "item_id", itemID)
 			continue
 		}
 		items = append(items, item)
@@ -182,49 +217,47 @@ func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, checkout *sale.C
 
 	userLimits := &sale.UserLimits{
 		CurrentItemCount: 0, // Will be checked atomically
-		MaxItemsPerUser:  uc.maxItemsPerUser,
+		MaxItemsPerUser:  saleEntity.MaxItemsPerUser,
 	}
 
 	if err := uc.purchaseSvc.ValidatePurchase(saleEntity, userLimits, items); err != nil {
 		return nil, fmt.Errorf("purchase validation failed: %w", err)
 	}
 
-	successfulPurchases := make([]string, 0, len(items))
-	for _, item := range items {
-		alreadySold, err := uc.cache.ItemExistsInBloomFilter(ctx, item.ID)
-		if err != nil {
-			uc.log.Error("Bloom filter check failed", "error", err, "item_id", item.ID)
-		}
-		if alreadySold {
-			uc.log.Info("Item likely already sold (bloom filter)", "item_id", item.ID)
-			continue
-		}
+	soldItems := uc.checkBloomFilter(ctx, log, checkout.SaleID, items)
 
-		success, err := txRepo.MarkItemAsSold(ctx, item.ID, checkout.UserID)
-		if err != nil {
-			uc.log.Error("Failed to mark item as sold", "error", err, "item_id", item.ID)
+	candidates := make([]string, 0, len(items))
+	for _, item := range items {
+		if soldItems[item.ID] {
+			log.Info("Item likely already sold (bloom filter)", "item_id", item.ID)
 			continue
 		}
+		candidates = append(candidates, item.ID)
+	}
 
-		if success {
-			successfulPurchases = append(successfulPurchases, item.ID)
-			_ = uc.cache.AddItemToBloomFilter(ctx, item.ID)
-		} else {
-			_ = uc.cache.AddItemToBloomFilter(ctx, item.ID)
-		}
+	// The sale row is locked only now, after the cache round trips, so
+	// concurrent purchases queue on it for the database writes alone.
+	// items_sold is taken from the locked row, not the read above.
+	lockedSale, err := txRepo.GetSaleByIDForUpdate(ctx, checkout.SaleID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock sale: %w", err)
 	}
 
-	result := uc.purchaseSvc.CalculatePurchaseResult(items, successfulPurchases)
+	successfulPurchases, err := txRepo.BatchMarkItemsAsSold(ctx, candidates, checkout.UserID)
+	if err != nil {
+		log.Error("Failed to mark items as sold", "error", err, "item_count", len(candidates))
+		return nil, fmt.Errorf("failed to mark items as sold: %w", err)
+	}
 
-	if len(successfulPurchases) > 0 {
-		if err := uc.cache.IncrementCounters(ctx, checkout.SaleID, checkout.UserID, len(successfulPurchases)); err != nil {
-			uc.log.Error("Failed to increment counters", "error", err, "checkout_code", checkout.Code, "increment", len(successfulPurchases))
-		}
+	if err := txRepo.RecordPurchases(ctx, checkout.SaleID, checkout.UserID, checkout.Code, successfulPurchases); err != nil {
+		return nil, fmt.Errorf("failed to record purchases: %w", err)
 	}
 
+	result := uc.purchaseSvc.CalculatePurchaseResult(items, successfulPurchases)
+
 	if len(successfulPurchases) > 0 {
-		saleEntity.ItemsSold += len(successfulPurchases)
-		if err := txRepo.UpdateSale(ctx, saleEntity); err != nil {
+		lockedSale.ItemsSold += len(successfulPurchases)
+		if err := txRepo.UpdateSale(ctx, lockedSale); err != nil {
 			return nil, fmt.Errorf("failed to update sale: %w", err)
 		}
 	}
@@ -233,18 +266,48 @@ func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, checkout *sale.C
 		return nil, fmt.Errorf("failed to save purchase result: %w", err)
 	}
 
+	if err := uc.appendPurchaseEvents(ctx, txRepo, checkout, result); err != nil {
+		return nil, fmt.Errorf("failed to record purchase events: %w", err)
+	}
+
 	if err := txRepo.CommitTx(ctx); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	committed = true
+
+	// The purchase is final now; losing the lock or the request must not
+	// stop the cache from counting it.
+	ctx = context.WithoutCancel(ctx)
+
+	// Items that were not updated were sold to someone else in the meantime,
+	// so every candidate belongs in the filter either way.
+	if err := uc.cache.AddItemsToBloomFilter(ctx, checkout.SaleID, candidates); err != nil {
+		log.Error("Failed to add items to bloom filter", "error", err)
+	}
+
+	// Counting the sale publishes it to event subscribers, so it waits for
+	// the commit; a rolled back purchase must not be announced.
+	if len(successfulPurchases) > 0 {
+		if err := uc.cache.IncrementCounters(ctx, checkout.SaleID, checkout.UserID, len(successfulPurchases)); err != nil {
+			log.Error("Failed to increment counters", "error", err, "increment", len(successfulPurchases))
+		}
+		if err := uc.cache.DecrementSaleRemaining(ctx, checkout.SaleID, len(successfulPurchases)); err != nil {
+			log.Error("Failed to refresh remaining items count", "error", err)
+		}
+	}
+
+	for _, itemID := range successfulPurchases {
+		if err := uc.cache.PublishItemSold(ctx, checkout.SaleID, itemID); err != nil {
+			log.Warn("Failed to publish sold item", "error", err, "item_id", itemID)
+			break
+		}
+	}
 
 	if len(successfulPurchases) == 0 {
 		return nil, errors.ErrAllItemsSold
 	}
 
-	uc.log.Info("Purchase completed",
-		"checkout_code", checkout.Code,
-		"user_id", checkout.UserID,
-		"sale_id", checkout.SaleID,
+	log.Info("Purchase completed",
 		"attempted", len(items),
 		"successful", len(successfulPurchases),
 	)
@@ -252,17 +315,77 @@ func (uc *PurchaseUseCase) attemptPurchase(ctx context.Context, checkout *sale.C
 	return result, nil
 }
 
-func (uc *PurchaseUseCase) cleanupCheckout(ctx context.Context, checkoutCode, saleID, userID string) error {
+// appendPurchaseEvents writes the purchase's events to the outbox within the
+// purchase transaction, so they are published exactly when it commits.
+func (uc *PurchaseUseCase) appendPurchaseEvents(ctx context.Context, txRepo ports.SaleRepository, checkout *sale.Checkout, result *sale.PurchaseResult) error {
+	now := time.Now().UTC()
+	completed := events.PurchaseCompletedEvent{
+		SaleID:            checkout.SaleID,
+		UserID:            checkout.UserID,
+		CheckoutCode:      checkout.Code,
+		SuccessfulItemIDs: []string{},
+		FailedItemIDs:     []string{},
+		CompletedAt:       now,
+	}
+
+	for _, item := range result.Items {
+		if !item.Sold {
+			completed.FailedItemIDs = append(completed.FailedItemIDs, item.ID)
+			continue
+		}
+		completed.SuccessfulItemIDs = append(completed.SuccessfulItemIDs, item.ID)
+
+		sold := events.ItemSoldEvent{
+			SaleID: checkout.SaleID,
+			ItemID: item.ID,
+			UserID: checkout.UserID,
+			SoldAt: now,
+		}
+		if err := txRepo.AppendOutboxEvent(ctx, sold.EventType(), sold); err != nil {
+			return err
+		}
+	}
+
+	return txRepo.AppendOutboxEvent(ctx, completed.EventType(), completed)
+}
+
+// checkBloomFilter reports which items are probably sold already, using one
+// pipelined round trip when there is more than one item.
+func (uc *PurchaseUseCase) checkBloomFilter(ctx context.Context, log *logger.Logger, saleID string, items []*sale.Item) map[string]bool {
+	if len(items) == 1 {
+		alreadySold, err := uc.cache.ItemExistsInBloomFilter(ctx, saleID, items[0].ID)
+		if err != nil {
+			log.Error("Bloom filter check failed", "error", err, "item_id", items[0].ID)
+		}
+		return map[string]bool{items[0].ID: alreadySold}
+	}
+
+	itemIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	soldItems, err := uc.cache.ItemsExistInBloomFilter(ctx, saleID, itemIDs)
+	if err != nil {
+		log.Error("Bloom filter batch check failed", "error", err, "item_count", len(itemIDs))
+	}
+	if soldItems == nil {
+		soldItems = make(map[string]bool)
+	}
+	return soldItems
+}
+
+func (uc *PurchaseUseCase) cleanupCheckout(ctx context.Context, log *logger.Logger, checkoutCode, saleID, userID string) error {
 	if err := uc.cache.RemoveUserCheckoutCode(ctx, saleID, userID); err != nil {
-		uc.log.Error("Failed to remove user checkout code from cache", "error", err)
+		log.Error("Failed to remove user checkout code from cache", "error", err)
 	}
 
 	if err := uc.cache.RemoveCheckoutCode(ctx, checkoutCode); err != nil {
-		uc.log.Error("Failed to remove checkout from cache", "error", err)
+		log.Error("Failed to remove checkout from cache", "error", err)
 	}
 
 	if err := uc.checkoutRepo.DeleteCheckout(ctx, checkoutCode); err != nil {
-		uc.log.Error("Failed to delete checkout from database", "error", err)
+		log.Error("Failed to delete checkout from database", "error", err)
 		return err
 	}
 
@@ -271,7 +394,8 @@ func (uc *PurchaseUseCase) cleanupCheckout(ctx context.Context, checkoutCode, sa
 
 func isBusinessLogicError(err error) bool {
 	switch err {
-	case errors.ErrCheckoutNotFound, errors.ErrSaleNotFound, errors.ErrUserLimitExceeded, errors.ErrCheckoutAlreadyProcessed:
+	case errors.ErrCheckoutNotFound, errors.ErrSaleNotFound, errors.ErrUserLimitExceeded, errors.ErrCheckoutAlreadyProcessed,
+		errors.ErrCheckoutExpiredTTL:
 		return true
 	default:
 		return false
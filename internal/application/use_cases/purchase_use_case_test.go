@@ -0,0 +1,593 @@
+package use_cases_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/application/ports/mock"
+	"github.com/yuzvak/flashsale-service/internal/application/use_cases"
+	"github.com/yuzvak/flashsale-service/internal/config"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+// purchaseEnv backs the use case's ports with the rows of a fixture
+// scenario and records what the purchase did to them.
+type purchaseEnv struct {
+	saleRepo     *mock.SaleRepository
+	checkoutRepo *mock.CheckoutRepository
+	cache        *mock.Cache
+
+	items    map[string]*sale.Item
+	results  map[string]*sale.PurchaseResult
+	outbox   []string
+	counted  int
+	deleted  []string
+	commits  int
+	rollback int
+}
+
+func newPurchaseEnv(scenario *fixtures.Scenario, checkouts ...*sale.Checkout) *purchaseEnv {
+	env := &purchaseEnv{
+		items:   make(map[string]*sale.Item, len(scenario.Items)),
+		results: make(map[string]*sale.PurchaseResult),
+	}
+	for _, item := range scenario.Items {
+		env.items[item.ID] = item
+	}
+	byCode := make(map[string]*sale.Checkout, len(checkouts))
+	for _, checkout := range checkouts {
+		byCode[checkout.Code] = checkout
+	}
+
+	getSale := func(ctx context.Context, id string) (*sale.Sale, error) {
+		if id != scenario.Sale.ID {
+			return nil, domainErrors.ErrSaleNotFound
+		}
+		s := *scenario.Sale
+		return &s, nil
+	}
+
+	env.saleRepo = &mock.SaleRepository{
+		OnGetSaleByID:          getSale,
+		OnGetSaleByIDForUpdate: getSale,
+		OnGetItemByID: func(ctx context.Context, id string) (*sale.Item, error) {
+			item, ok := env.items[id]
+			if !ok {
+				return nil, domainErrors.ErrItemNotFound
+			}
+			return item, nil
+		},
+		OnBatchMarkItemsAsSold: func(ctx context.Context, itemIDs []string, userID string) ([]string, error) {
+			var sold []string
+			for _, id := range itemIDs {
+				if item := env.items[id]; item != nil && !item.Sold {
+					item.MarkAsSold(userID)
+					sold = append(sold, id)
+				}
+			}
+			return sold, nil
+		},
+		OnSavePurchaseResult: func(ctx context.Context, checkoutCode string, result *sale.PurchaseResult) error {
+			env.results[checkoutCode] = result
+			return nil
+		},
+		OnGetPurchaseResult: func(ctx context.Context, checkoutCode string) (*sale.PurchaseResult, error) {
+			return env.results[checkoutCode], nil
+		},
+		OnAppendOutboxEvent: func(ctx context.Context, eventType string, payload interface{}) error {
+			env.outbox = append(env.outbox, eventType)
+			return nil
+		},
+		OnCommitTx: func(ctx context.Context) error {
+			env.commits++
+			return nil
+		},
+		OnRollbackTx: func(ctx context.Context) error {
+			env.rollback++
+			return nil
+		},
+	}
+
+	env.checkoutRepo = &mock.CheckoutRepository{
+		OnGetCheckoutByCode: func(ctx context.Context, code string) (*sale.Checkout, error) {
+			checkout, ok := byCode[code]
+			if !ok {
+				return nil, domainErrors.ErrCheckoutNotFound
+			}
+			return checkout, nil
+		},
+		OnDeleteCheckout: func(ctx context.Context, checkoutCode string) error {
+			env.deleted = append(env.deleted, checkoutCode)
+			return nil
+		},
+	}
+
+	env.cache = &mock.Cache{
+		OnCheckoutCodeExists: func(ctx context.Context, code string) (bool, error) {
+			return true, nil
+		},
+		OnGetSaleItemCount: func(ctx context.Context, saleID string) (int, error) {
+			return scenario.Sale.ItemsSold, nil
+		},
+		OnIncrementCounters: func(ctx context.Context, saleID, userID string, increment int) error {
+			env.counted += increment
+			return nil
+		},
+	}
+
+	return env
+}
+
+func (env *purchaseEnv) useCase() *use_cases.PurchaseUseCase {
+	return use_cases.NewPurchaseUseCase(env.saleRepo, env.checkoutRepo, env.cache, logger.NewLogger())
+}
+
+func liveCheckout(s *sale.Sale, itemIDs ...string) *sale.Checkout {
+	return fixtures.NewCheckoutBuilder().
+		ForSale(s.ID).
+		WithItems(itemIDs...).
+		CreatedAt(time.Now().UTC()).
+		Build()
+}
+
+func TestExecutePurchaseSellsCheckedOutItems(t *testing.T) {
+	scenario := fixtures.FreshSale(clock.NewRealClock(), 5)
+	checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID, scenario.Items[1].ID)
+	env := newPurchaseEnv(scenario, checkout)
+
+	result, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code)
+	if err != nil {
+		t.Fatalf("ExecutePurchase: %v", err)
+	}
+
+	if !result.Success || result.TotalPurchased != 2 || result.FailedCount != 0 {
+		t.Errorf("result = %+v, want 2 purchased and none failed", result)
+	}
+	for _, id := range checkout.ItemIDs {
+		if item := env.items[id]; !item.Sold || item.SoldToUserID != checkout.UserID {
+			t.Errorf("item %s sold=%v to %q, want sold to %q", id, item.Sold, item.SoldToUserID, checkout.UserID)
+		}
+	}
+	if env.commits != 1 {
+		t.Errorf("committed %d times, want once", env.commits)
+	}
+	if env.results[checkout.Code] != result {
+		t.Error("purchase result was not stored")
+	}
+	if env.counted != 2 {
+		t.Errorf("counters incremented by %d, want 2", env.counted)
+	}
+	// One ItemSold per item and one PurchaseCompleted.
+	if len(env.outbox) != 3 {
+		t.Errorf("outbox events = %v, want 3", env.outbox)
+	}
+	if len(env.deleted) != 1 || env.deleted[0] != checkout.Code {
+		t.Errorf("deleted checkouts = %v, want %s", env.deleted, checkout.Code)
+	}
+}
+
+func TestExecutePurchaseReportsItemsSoldMeanwhile(t *testing.T) {
+	scenario := fixtures.NearlySoldOutSale(clock.NewRealClock(), 10, 5)
+	soldID, availableID := scenario.Items[0].ID, scenario.AvailableItemIDs()[0]
+	checkout := liveCheckout(scenario.Sale, soldID, availableID)
+	env := newPurchaseEnv(scenario, checkout)
+
+	result, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code)
+	if err != nil {
+		t.Fatalf("ExecutePurchase: %v", err)
+	}
+
+	if result.TotalPurchased != 1 || result.FailedCount != 1 {
+		t.Errorf("result = %+v, want 1 purchased and 1 failed", result)
+	}
+	for _, item := range result.Items {
+		if want := item.ID == availableID; item.Sold != want {
+			t.Errorf("item %s sold = %v, want %v", item.ID, item.Sold, want)
+		}
+	}
+	if env.items[soldID].SoldToUserID == checkout.UserID {
+		t.Error("an item sold before the purchase changed hands")
+	}
+}
+
+func TestExecutePurchaseRejects(t *testing.T) {
+	realClock := clock.NewRealClock()
+
+	tests := []struct {
+		name    string
+		build   func() (*fixtures.Scenario, *sale.Checkout)
+		prepare func(env *purchaseEnv, checkout *sale.Checkout)
+		code    func(checkout *sale.Checkout) string
+		wantErr error
+	}{
+		{
+			name: "unknown checkout",
+			build: func() (*fixtures.Scenario, *sale.Checkout) {
+				scenario := fixtures.FreshSale(realClock, 3)
+				return scenario, liveCheckout(scenario.Sale, scenario.Items[0].ID)
+			},
+			code:    func(*sale.Checkout) string { return "CHK-unknown" },
+			wantErr: domainErrors.ErrCheckoutNotFound,
+		},
+		{
+			name: "expired checkout",
+			build: func() (*fixtures.Scenario, *sale.Checkout) {
+				scenario := fixtures.FreshSale(realClock, 3)
+				checkout := fixtures.NewCheckoutBuilder().
+					ForSale(scenario.Sale.ID).
+					WithItems(scenario.Items[0].ID).
+					CreatedAt(time.Now().UTC().Add(-time.Hour)).
+					Build()
+				return scenario, checkout
+			},
+			wantErr: domainErrors.ErrCheckoutExpiredTTL,
+		},
+		{
+			name: "already processed",
+			build: func() (*fixtures.Scenario, *sale.Checkout) {
+				scenario := fixtures.FreshSale(realClock, 3)
+				return scenario, liveCheckout(scenario.Sale, scenario.Items[0].ID)
+			},
+			prepare: func(env *purchaseEnv, checkout *sale.Checkout) {
+				env.results[checkout.Code] = &sale.PurchaseResult{Success: true, TotalPurchased: 1}
+			},
+			wantErr: domainErrors.ErrCheckoutAlreadyProcessed,
+		},
+		{
+			name: "user limit",
+			build: func() (*fixtures.Scenario, *sale.Checkout) {
+				builder := fixtures.NewSaleBuilder().Active(realClock).WithItems(3).WithLimits(1, 10)
+				scenario := &fixtures.Scenario{Sale: builder.Build(), Items: builder.BuildItems()}
+				return scenario, liveCheckout(scenario.Sale, scenario.Items[0].ID, scenario.Items[1].ID)
+			},
+			wantErr: domainErrors.ErrUserLimitExceeded,
+		},
+		{
+			name: "sale limit",
+			build: func() (*fixtures.Scenario, *sale.Checkout) {
+				builder := fixtures.NewSaleBuilder().Active(realClock).WithItems(10).WithItemsSold(9).WithLimits(10, 10)
+				scenario := &fixtures.Scenario{Sale: builder.Build(), Items: builder.BuildItems()}
+				return scenario, liveCheckout(scenario.Sale, scenario.AvailableItemIDs()[0], scenario.Items[0].ID)
+			},
+			wantErr: domainErrors.ErrSaleLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scenario, checkout := tt.build()
+			env := newPurchaseEnv(scenario, checkout)
+			if tt.prepare != nil {
+				tt.prepare(env, checkout)
+			}
+			code := checkout.Code
+			if tt.code != nil {
+				code = tt.code(checkout)
+			}
+
+			_, err := env.useCase().ExecutePurchase(context.Background(), code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ExecutePurchase error = %v, want %v", err, tt.wantErr)
+			}
+
+			if env.commits != 0 {
+				t.Errorf("committed %d times after a rejected purchase", env.commits)
+			}
+			if len(env.deleted) != 0 {
+				t.Errorf("checkout deleted after a rejected purchase: %v", env.deleted)
+			}
+			for _, item := range scenario.Items {
+				if item.SoldToUserID == checkout.UserID {
+					t.Errorf("item %s was sold by a rejected purchase", item.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestExecutePurchaseWhileLocked(t *testing.T) {
+	scenario := fixtures.FreshSale(clock.NewRealClock(), 3)
+	checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID)
+	env := newPurchaseEnv(scenario, checkout)
+	env.cache.OnTryLockWithHeartbeat = func(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error) {
+		return nil, nil, ports.ErrLockNotAcquired
+	}
+
+	if _, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code); err == nil {
+		t.Fatal("ExecutePurchase succeeded while another purchase held the lock")
+	}
+	if scenario.Items[0].Sold {
+		t.Error("item was sold without the lock")
+	}
+}
+
+func TestExecutePurchaseAbortsWhenLockIsLost(t *testing.T) {
+	scenario := fixtures.FreshSale(clock.NewRealClock(), 3)
+	checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID)
+	env := newPurchaseEnv(scenario, checkout)
+
+	var loseLock context.CancelCauseFunc
+	env.cache.OnTryLockWithHeartbeat = func(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error) {
+		lockCtx, cancel := context.WithCancelCause(ctx)
+		loseLock = cancel
+		return lockCtx, func() { cancel(context.Canceled) }, nil
+	}
+	// The lock expires while the transaction is open; like database/sql,
+	// the commit fails once its context is done.
+	env.saleRepo.OnAppendOutboxEvent = func(ctx context.Context, eventType string, payload interface{}) error {
+		loseLock(ports.ErrLockLost)
+		return nil
+	}
+	env.saleRepo.OnCommitTx = func(ctx context.Context) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		env.commits++
+		return nil
+	}
+
+	_, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code)
+	if !errors.Is(err, ports.ErrLockLost) {
+		t.Fatalf("ExecutePurchase error = %v, want ErrLockLost", err)
+	}
+	if env.commits != 0 {
+		t.Errorf("committed %d times after the lock was lost", env.commits)
+	}
+	if env.counted != 0 {
+		t.Errorf("counted %d items of an aborted purchase", env.counted)
+	}
+	if len(env.deleted) != 0 {
+		t.Errorf("checkout deleted after an aborted purchase: %v", env.deleted)
+	}
+}
+
+func TestGetPurchaseStatus(t *testing.T) {
+	scenario := fixtures.FreshSale(clock.NewRealClock(), 1)
+	checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID)
+
+	tests := []struct {
+		name    string
+		stored  *sale.PurchaseResult
+		wantErr error
+	}{
+		{name: "not processed", stored: nil, wantErr: domainErrors.ErrPurchaseResultNotFound},
+		{name: "corrupted", stored: &sale.PurchaseResult{Corrupted: true, CorruptionError: "unexpected end of JSON input"}, wantErr: domainErrors.ErrInvalidPurchaseResult},
+		{name: "processed", stored: &sale.PurchaseResult{Success: true, TotalPurchased: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newPurchaseEnv(scenario, checkout)
+			if tt.stored != nil {
+				env.results[checkout.Code] = tt.stored
+			}
+
+			result, err := env.useCase().GetPurchaseStatus(context.Background(), checkout.Code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetPurchaseStatus error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && result != tt.stored {
+				t.Errorf("GetPurchaseStatus = %+v, want the stored result", result)
+			}
+		})
+	}
+}
+
+// Counting a sale announces it to event subscribers, so it must follow the
+// commit and never happen for a purchase that rolls back.
+func TestExecutePurchaseCountsOnlyCommittedSales(t *testing.T) {
+	t.Run("after commit", func(t *testing.T) {
+		scenario := fixtures.FreshSale(clock.NewRealClock(), 3)
+		checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID)
+		env := newPurchaseEnv(scenario, checkout)
+
+		countedBeforeCommit := false
+		env.cache.OnIncrementCounters = func(ctx context.Context, saleID, userID string, increment int) error {
+			countedBeforeCommit = env.commits == 0
+			env.counted += increment
+			return nil
+		}
+
+		if _, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code); err != nil {
+			t.Fatalf("ExecutePurchase: %v", err)
+		}
+		if env.counted != 1 {
+			t.Fatalf("counters incremented by %d, want 1", env.counted)
+		}
+		if countedBeforeCommit {
+			t.Error("counters were incremented before the commit")
+		}
+	})
+
+	t.Run("commit fails", func(t *testing.T) {
+		scenario := fixtures.FreshSale(clock.NewRealClock(), 3)
+		checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID)
+		env := newPurchaseEnv(scenario, checkout)
+		env.saleRepo.OnCommitTx = func(ctx context.Context) error {
+			return errors.New("connection reset")
+		}
+
+		if _, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code); err == nil {
+			t.Fatal("ExecutePurchase succeeded although the commit failed")
+		}
+		if env.counted != 0 {
+			t.Errorf("counters incremented by %d for a rolled back purchase", env.counted)
+		}
+	})
+}
+
+// The sale row lock serializes purchases, so it is taken only for the
+// database writes: no cache round trip happens while it is held.
+func TestExecutePurchaseLocksSaleOnlyForWrites(t *testing.T) {
+	scenario := fixtures.FreshSale(clock.NewRealClock(), 5)
+	checkout := liveCheckout(scenario.Sale, scenario.Items[0].ID, scenario.Items[1].ID)
+	env := newPurchaseEnv(scenario, checkout)
+
+	locked, lockedForWrites := false, false
+	var whileLocked []string
+	cacheCall := func(name string) {
+		if locked {
+			whileLocked = append(whileLocked, name)
+		}
+	}
+
+	env.saleRepo.OnGetSaleByIDForUpdate = func(ctx context.Context, id string) (*sale.Sale, error) {
+		locked = true
+		s := *scenario.Sale
+		return &s, nil
+	}
+	markAsSold := env.saleRepo.OnBatchMarkItemsAsSold
+	env.saleRepo.OnBatchMarkItemsAsSold = func(ctx context.Context, itemIDs []string, userID string) ([]string, error) {
+		lockedForWrites = locked
+		return markAsSold(ctx, itemIDs, userID)
+	}
+	env.saleRepo.OnCommitTx = func(ctx context.Context) error {
+		locked = false
+		env.commits++
+		return nil
+	}
+	env.saleRepo.OnUpdateSale = func(ctx context.Context, s *sale.Sale) error {
+		if want := scenario.Sale.ItemsSold + 2; s.ItemsSold != want {
+			t.Errorf("items_sold updated to %d, want %d", s.ItemsSold, want)
+		}
+		return nil
+	}
+
+	env.cache.OnGetSaleTotalItems = func(ctx context.Context, saleID string) (int, bool, error) {
+		cacheCall("GetSaleTotalItems")
+		return 0, false, nil
+	}
+	env.cache.OnGetSaleQuota = func(ctx context.Context, saleID string) (int, bool, error) {
+		cacheCall("GetSaleQuota")
+		return 0, false, nil
+	}
+	env.cache.OnGetUserItemCount = func(ctx context.Context, saleID, userID string) (int, error) {
+		cacheCall("GetUserItemCount")
+		return 0, nil
+	}
+	env.cache.OnGetSaleItemCount = func(ctx context.Context, saleID string) (int, error) {
+		cacheCall("GetSaleItemCount")
+		return scenario.Sale.ItemsSold, nil
+	}
+	env.cache.OnItemsExistInBloomFilter = func(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error) {
+		cacheCall("ItemsExistInBloomFilter")
+		return map[string]bool{}, nil
+	}
+	env.cache.OnAddItemsToBloomFilter = func(ctx context.Context, saleID string, itemIDs []string) error {
+		cacheCall("AddItemsToBloomFilter")
+		return nil
+	}
+	env.cache.OnIncrementCounters = func(ctx context.Context, saleID, userID string, increment int) error {
+		cacheCall("IncrementCounters")
+		env.counted += increment
+		return nil
+	}
+	env.cache.OnDecrementSaleRemaining = func(ctx context.Context, saleID string, count int) error {
+		cacheCall("DecrementSaleRemaining")
+		return nil
+	}
+
+	if _, err := env.useCase().ExecutePurchase(context.Background(), checkout.Code); err != nil {
+		t.Fatalf("ExecutePurchase: %v", err)
+	}
+	if !lockedForWrites {
+		t.Error("items were marked as sold without the sale lock")
+	}
+	if len(whileLocked) != 0 {
+		t.Errorf("cache calls while the sale was locked: %v", whileLocked)
+	}
+	if env.counted != 2 {
+		t.Errorf("counters incremented by %d, want 2", env.counted)
+	}
+}
+
+// Concurrent purchases of one sale each add their items to the count the
+// others stored, so no purchase reads a stale items_sold: the stored count
+// matches the items actually sold.
+func TestExecutePurchaseConcurrentlyKeepsItemsSold(t *testing.T) {
+	const buyers = 10
+
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	cache := redis.NewCache(integration.Redis(t), config.CacheConfig{}, config.BloomFilterConfig{}, logger.NewLogger())
+	saleRepo := postgres.NewSaleRepository(conn)
+	checkoutRepo := postgres.NewCheckoutRepository(conn)
+
+	s, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Active(clock.NewRealClock()).
+		WithItems(buyers).
+		WithLimits(1, buyers))
+	t.Cleanup(func() { _ = cache.PurgeSaleData(context.Background(), s.ID) })
+
+	codes := make([]string, buyers)
+	for i, item := range items {
+		codes[i] = fmt.Sprintf("CHK-%s-%016d", s.ID, i)
+		checkout := fixtures.NewCheckoutBuilder().
+			WithCode(codes[i]).
+			ForSale(s.ID).
+			ForUser(fmt.Sprintf("user_%d", i)).
+			WithItems(item.ID).
+			CreatedAt(time.Now().UTC()).
+			Build()
+		if err := checkoutRepo.CreateCheckout(ctx, checkout); err != nil {
+			t.Fatalf("CreateCheckout: %v", err)
+		}
+	}
+	integration.DeletePurchaseResultsOnCleanup(t, conn, codes...)
+
+	uc := use_cases.NewPurchaseUseCase(saleRepo, checkoutRepo, cache, logger.NewLogger())
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		purchased int
+	)
+	start := make(chan struct{})
+	for _, code := range codes {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			<-start
+			// A purchase whose transaction fails to serialize is retried
+			// and may still fail; only the count of those that went
+			// through matters here.
+			result, err := uc.ExecutePurchase(ctx, code)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			purchased += result.TotalPurchased
+			mu.Unlock()
+		}(code)
+	}
+	close(start)
+	wg.Wait()
+
+	if purchased == 0 {
+		t.Fatal("no purchase went through")
+	}
+
+	stored, err := saleRepo.GetSaleByID(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("GetSaleByID: %v", err)
+	}
+	sold, err := saleRepo.GetSaleSoldCount(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("GetSaleSoldCount: %v", err)
+	}
+	if stored.ItemsSold != sold || sold != purchased {
+		t.Errorf("items_sold = %d, sold items = %d, purchased = %d; want all equal", stored.ItemsSold, sold, purchased)
+	}
+}
@@ -2,38 +2,459 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server   ServerConfig   `json:"server"`
-	Database DatabaseConfig `json:"database"`
-	Redis    RedisConfig    `json:"redis"`
+	Server    ServerConfig    `json:"server" yaml:"server"`
+	Database  DatabaseConfig  `json:"database" yaml:"database"`
+	Redis     RedisConfig     `json:"redis" yaml:"redis"`
+	Region    RegionConfig    `json:"region" yaml:"region"`
+	Admin     AdminConfig     `json:"admin" yaml:"admin"`
+	Cache     CacheConfig     `json:"cache" yaml:"cache"`
+	Auth      AuthConfig      `json:"auth" yaml:"auth"`
+	Tracing   TracingConfig   `json:"tracing" yaml:"tracing"`
+	Sale      SaleConfig      `json:"sale" yaml:"sale"`
+	Scheduler SchedulerConfig `json:"scheduler" yaml:"scheduler"`
+
+	BloomFilter BloomFilterConfig `json:"bloom_filter" yaml:"bloom_filter"`
+	RateLimit   RateLimitConfig   `json:"rate_limit" yaml:"rate_limit"`
+	Outbox      OutboxConfig      `json:"outbox" yaml:"outbox"`
+
+	Webhooks []WebhookConfig `json:"webhooks" yaml:"webhooks"`
 }
 
 type ServerConfig struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
+	Host          string `json:"host" yaml:"host"`
+	Port          int    `json:"port" yaml:"port"`
+	MaxGoroutines int    `json:"max_goroutines" yaml:"max_goroutines"`
+	// LogLevel is the lowest level written: DEBUG, INFO, WARN or ERROR.
+	// Empty means INFO.
+	LogLevel string `json:"log_level" yaml:"log_level"`
+	// LogBufferSize enables asynchronous logging with a buffer of that many
+	// entries; 0 keeps logging synchronous.
+	LogBufferSize int `json:"log_buffer_size" yaml:"log_buffer_size"`
+	// MetricsPort serves /metrics on a port of its own, so it can be kept
+	// off the public listener; 0 disables the separate server.
+	MetricsPort int `json:"metrics_port" yaml:"metrics_port"`
+	// AllowedOrigins enables CORS for the listed origins; "*" allows any,
+	// without credentials. Empty disables CORS. Empty AllowedMethods or AllowedHeaders fall back
+	// to everything the API uses.
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods" yaml:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers" yaml:"allowed_headers"`
+	// MaxRequestBodyBytes caps request bodies; 0 means 1 MiB.
+	MaxRequestBodyBytes int64 `json:"max_request_body_bytes" yaml:"max_request_body_bytes"`
+	// MaxImportBodyBytes caps item import bodies instead; 0 means 32 MiB.
+	MaxImportBodyBytes int64 `json:"max_import_body_bytes" yaml:"max_import_body_bytes"`
+	// TLSEnabled serves HTTPS using TLSCertFile and TLSKeyFile, or, with
+	// TLSAutoTLS, certificates obtained from Let's Encrypt for TLSDomains.
+	// TLSCacheDir keeps those certificates across restarts; empty means
+	// "autocert-cache".
+	TLSEnabled  bool     `json:"tls_enabled" yaml:"tls_enabled"`
+	TLSCertFile string   `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile  string   `json:"tls_key_file" yaml:"tls_key_file"`
+	TLSAutoTLS  bool     `json:"tls_auto_tls" yaml:"tls_auto_tls"`
+	TLSDomains  []string `json:"tls_domains" yaml:"tls_domains"`
+	TLSCacheDir string   `json:"tls_cache_dir" yaml:"tls_cache_dir"`
 }
 
 type DatabaseConfig struct {
-	Host           string `json:"host"`
-	Port           int    `json:"port"`
-	User           string `json:"user"`
-	Password       string `json:"password"`
-	DBName         string `json:"dbname"`
-	SSLMode        string `json:"sslmode"`
-	MigrationsPath string `json:"migrations_path"`
+	Host           string `json:"host" yaml:"host"`
+	Port           int    `json:"port" yaml:"port"`
+	User           string `json:"user" yaml:"user"`
+	Password       string `json:"password" yaml:"password"`
+	DBName         string `json:"dbname" yaml:"dbname"`
+	SSLMode        string `json:"sslmode" yaml:"sslmode"`
+	MigrationsPath string `json:"migrations_path" yaml:"migrations_path"`
+	MaxRetries     int    `json:"max_retries" yaml:"max_retries"`
+	RetryDelayMs   int    `json:"retry_delay_ms" yaml:"retry_delay_ms"`
+	// UseEmbedded runs the migrations compiled into the binary instead of
+	// reading MigrationsPath.
+	UseEmbedded bool `json:"use_embedded" yaml:"use_embedded"`
+	// ReplicaDSN optionally points hot read paths at a read replica.
+	ReplicaDSN string `json:"replica_dsn" yaml:"replica_dsn"`
+	// Pool sizing for the primary and the replica; 0 means 100 open,
+	// 50 idle and a one hour lifetime.
+	MaxOpenConns           int `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns           int `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetimeSeconds int `json:"conn_max_lifetime_seconds" yaml:"conn_max_lifetime_seconds"`
+	// StatementTimeoutMs aborts statements on the primary that run longer;
+	// 0 leaves them unbounded.
+	StatementTimeoutMs int `json:"statement_timeout_ms" yaml:"statement_timeout_ms"`
 }
 
+const (
+	RedisModeSingle   = "single"
+	RedisModeCluster  = "cluster"
+	RedisModeSentinel = "sentinel"
+)
+
+// RedisConfig uses Host and Port in single mode. Cluster mode takes its
+// seed nodes from Addrs; sentinel mode takes the sentinels from Addrs and
+// needs MasterName.
 type RedisConfig struct {
-	Host     string `json:"host"`
-	Port     int    `json:"port"`
-	Password string `json:"password"`
-	DB       int    `json:"db"`
+	Mode       string   `json:"mode" yaml:"mode"`
+	Host       string   `json:"host" yaml:"host"`
+	Port       int      `json:"port" yaml:"port"`
+	Addrs      []string `json:"addrs" yaml:"addrs"`
+	MasterName string   `json:"master_name" yaml:"master_name"`
+	Password   string   `json:"password" yaml:"password"`
+	DB         int      `json:"db" yaml:"db"`
+	// TLSEnabled is needed by most managed Redis services. TLSSkipVerify
+	// accepts any server certificate and is meant for testing only.
+	TLSEnabled    bool `json:"tls_enabled" yaml:"tls_enabled"`
+	TLSSkipVerify bool `json:"tls_skip_verify" yaml:"tls_skip_verify"`
+	// MaxRetries and MinRetryBackoffMs tune command retries; 0 keeps the
+	// client defaults of 3 retries starting at 8ms, -1 disables them.
+	MaxRetries        int `json:"max_retries" yaml:"max_retries"`
+	MinRetryBackoffMs int `json:"min_retry_backoff_ms" yaml:"min_retry_backoff_ms"`
+}
+
+// MinRetryBackoff converts MinRetryBackoffMs into the value the client
+// expects, where 0 selects its default and -1 disables backoff.
+func (c *RedisConfig) MinRetryBackoff() time.Duration {
+	if c.MinRetryBackoffMs < 0 {
+		return -1
+	}
+	return time.Duration(c.MinRetryBackoffMs) * time.Millisecond
+}
+
+type RegionConfig struct {
+	ID                       string             `json:"id" yaml:"id"`
+	Split                    map[string]float64 `json:"split" yaml:"split"`
+	LeaseTTLSeconds          int                `json:"lease_ttl_seconds" yaml:"lease_ttl_seconds"`
+	RebalanceIntervalSeconds int                `json:"rebalance_interval_seconds" yaml:"rebalance_interval_seconds"`
+	RebalanceThreshold       float64            `json:"rebalance_threshold" yaml:"rebalance_threshold"`
+	RebalanceChunk           int                `json:"rebalance_chunk" yaml:"rebalance_chunk"`
+}
+
+type AdminConfig struct {
+	APIKeys []string `json:"api_keys" yaml:"api_keys"`
+}
+
+// AuthConfig enables JWT authentication of checkout requests when JWTSecret
+// is set; otherwise the user_id query parameter is trusted.
+type AuthConfig struct {
+	JWTSecret string `json:"jwt_secret" yaml:"jwt_secret"`
+}
+
+// TracingConfig enables span export when OTLPEndpoint is set, e.g.
+// "http://otel-collector:4318".
+type TracingConfig struct {
+	OTLPEndpoint string `json:"otlp_endpoint" yaml:"otlp_endpoint"`
+}
+
+type SaleConfig struct {
+	RefundWindowMinutes int `json:"refund_window_minutes" yaml:"refund_window_minutes"`
+}
+
+// SchedulerConfig controls how often the scheduler checks for an active
+// sale and what the sales it creates look like.
+type SchedulerConfig struct {
+	IntervalMinutes     int `json:"interval_minutes" yaml:"interval_minutes"`
+	TotalItems          int `json:"total_items" yaml:"total_items"`
+	SaleDurationMinutes int `json:"sale_duration_minutes" yaml:"sale_duration_minutes"`
+	// PreWarmMinutes is how far ahead of their start upcoming sales get
+	// their cache warmed.
+	PreWarmMinutes int `json:"pre_warm_minutes" yaml:"pre_warm_minutes"`
+}
+
+type CacheConfig struct {
+	CheckoutTTLSeconds    int `json:"checkout_ttl_seconds" yaml:"checkout_ttl_seconds"`
+	IdempotencyTTLSeconds int `json:"idempotency_ttl_seconds" yaml:"idempotency_ttl_seconds"`
+	// CheckoutHMACSecret signs checkout codes. Changing it invalidates
+	// every outstanding code.
+	CheckoutHMACSecret string `json:"checkout_hmac_secret" yaml:"checkout_hmac_secret"`
+	// CheckoutCodePrefix starts every checkout code; empty means "CHK".
+	CheckoutCodePrefix string `json:"checkout_code_prefix" yaml:"checkout_code_prefix"`
+	// CountingBloomFilter keeps sold items in a counting bloom filter so
+	// that refunded items can be removed from it.
+	CountingBloomFilter bool `json:"counting_bloom_filter" yaml:"counting_bloom_filter"`
+	// ScalableBloomFilter adds filter layers as items are sold, keeping the
+	// false positive rate bounded past the initial capacity. It cannot be
+	// combined with CountingBloomFilter.
+	ScalableBloomFilter bool `json:"scalable_bloom_filter" yaml:"scalable_bloom_filter"`
+}
+
+// BloomFilterConfig sizes each sale's sold items filter. A scalable filter
+// uses ExpectedElements as the capacity of its first layer.
+type BloomFilterConfig struct {
+	// ExpectedElements is the number of sold items the filter is sized
+	// for; 0 means 100000.
+	ExpectedElements uint64 `json:"expected_elements" yaml:"expected_elements"`
+	// FalsePositiveRate is the target rate at ExpectedElements items,
+	// between 0 and 1 exclusive; 0 means 0.01.
+	FalsePositiveRate float64 `json:"false_positive_rate" yaml:"false_positive_rate"`
+}
+
+// RateLimitConfig limits requests per second for each user, or each client
+// IP for anonymous requests. A zero rate leaves that scope unlimited.
+// GlobalRPS applies to every route; the others only to their endpoint.
+type RateLimitConfig struct {
+	CheckoutRPS int `json:"checkout_rps" yaml:"checkout_rps"`
+	PurchaseRPS int `json:"purchase_rps" yaml:"purchase_rps"`
+	GlobalRPS   int `json:"global_rps" yaml:"global_rps"`
+	// BurstMultiplier sizes each token bucket as a multiple of its rate;
+	// 0 means 2.
+	BurstMultiplier float64 `json:"burst_multiplier" yaml:"burst_multiplier"`
+}
+
+// OutboxConfig controls the worker that publishes the domain events stored
+// in the outbox table by the purchase transaction.
+type OutboxConfig struct {
+	// PollIntervalSeconds is the time between polls; 0 means 1.
+	PollIntervalSeconds int `json:"poll_interval_seconds" yaml:"poll_interval_seconds"`
+	// MaxBatchSize caps the events published per poll; 0 means 100.
+	MaxBatchSize int `json:"max_batch_size" yaml:"max_batch_size"`
+}
+
+// WebhookConfig is an endpoint that is POSTed the domain events it subscribes
+// to, signed with HMAC-SHA256 using Secret.
+type WebhookConfig struct {
+	URL    string `json:"url" yaml:"url"`
+	Secret string `json:"secret" yaml:"secret"`
+	// Events lists the event types to deliver; empty means only
+	// purchase.completed.
+	Events []string `json:"events" yaml:"events"`
+	// MaxRetries is the number of retries after a failed delivery; 0 means 3
+	// and -1 disables retries.
+	MaxRetries int `json:"max_retries" yaml:"max_retries"`
+}
+
+const (
+	defaultMaxGoroutines       = 10000
+	defaultMaxRequestBodyBytes = 1 << 20
+	defaultMaxImportBodyBytes  = 32 << 20
+)
+
+// GoroutineLimit is the goroutine count above which the liveness probe fails.
+func (c *ServerConfig) GoroutineLimit() int {
+	if c.MaxGoroutines <= 0 {
+		return defaultMaxGoroutines
+	}
+	return c.MaxGoroutines
+}
+
+func (c *ServerConfig) RequestBodyLimit() int64 {
+	if c.MaxRequestBodyBytes <= 0 {
+		return defaultMaxRequestBodyBytes
+	}
+	return c.MaxRequestBodyBytes
+}
+
+func (c *ServerConfig) ImportBodyLimit() int64 {
+	if c.MaxImportBodyBytes <= 0 {
+		return defaultMaxImportBodyBytes
+	}
+	return c.MaxImportBodyBytes
+}
+
+const defaultTLSCacheDir = "autocert-cache"
+
+func (c *ServerConfig) AutocertCacheDir() string {
+	if c.TLSCacheDir == "" {
+		return defaultTLSCacheDir
+	}
+	return c.TLSCacheDir
+}
+
+const (
+	defaultDBMaxRetries   = 5
+	defaultDBRetryDelayMs = 100
+)
+
+// ConnectRetries is how many times the initial database ping is retried.
+func (c *DatabaseConfig) ConnectRetries() int {
+	if c.MaxRetries <= 0 {
+		return defaultDBMaxRetries
+	}
+	return c.MaxRetries
+}
+
+// RetryDelay is the wait before the first retry; it doubles on each attempt.
+func (c *DatabaseConfig) RetryDelay() time.Duration {
+	if c.RetryDelayMs <= 0 {
+		return defaultDBRetryDelayMs * time.Millisecond
+	}
+	return time.Duration(c.RetryDelayMs) * time.Millisecond
+}
+
+const (
+	defaultDBMaxOpenConns           = 100
+	defaultDBMaxIdleConns           = 50
+	defaultDBConnMaxLifetimeSeconds = 3600
+)
+
+func (c *DatabaseConfig) OpenConnLimit() int {
+	if c.MaxOpenConns <= 0 {
+		return defaultDBMaxOpenConns
+	}
+	return c.MaxOpenConns
+}
+
+func (c *DatabaseConfig) IdleConnLimit() int {
+	if c.MaxIdleConns <= 0 {
+		return defaultDBMaxIdleConns
+	}
+	return c.MaxIdleConns
 }
 
+func (c *DatabaseConfig) ConnMaxLifetime() time.Duration {
+	if c.ConnMaxLifetimeSeconds <= 0 {
+		return defaultDBConnMaxLifetimeSeconds * time.Second
+	}
+	return time.Duration(c.ConnMaxLifetimeSeconds) * time.Second
+}
+
+const (
+	defaultCheckoutTTLSeconds    = 600
+	defaultIdempotencyTTLSeconds = 86400
+)
+
+func (c *CacheConfig) CheckoutTTL() time.Duration {
+	if c.CheckoutTTLSeconds <= 0 {
+		return defaultCheckoutTTLSeconds * time.Second
+	}
+	return time.Duration(c.CheckoutTTLSeconds) * time.Second
+}
+
+func (c *CacheConfig) IdempotencyTTL() time.Duration {
+	if c.IdempotencyTTLSeconds <= 0 {
+		return defaultIdempotencyTTLSeconds * time.Second
+	}
+	return time.Duration(c.IdempotencyTTLSeconds) * time.Second
+}
+
+const defaultRefundWindowMinutes = 60
+
+// RefundWindow is how long after a sale ends its purchases can be refunded.
+func (c *SaleConfig) RefundWindow() time.Duration {
+	if c.RefundWindowMinutes <= 0 {
+		return defaultRefundWindowMinutes * time.Minute
+	}
+	return time.Duration(c.RefundWindowMinutes) * time.Minute
+}
+
+const (
+	defaultSchedulerIntervalMinutes = 60
+	defaultSchedulerTotalItems      = 10000
+	defaultSaleDurationMinutes      = 60
+	defaultPreWarmMinutes           = 5
+)
+
+// Interval is the time between scheduler ticks. Sale start times are
+// aligned to it.
+func (c *SchedulerConfig) Interval() time.Duration {
+	if c.IntervalMinutes <= 0 {
+		return defaultSchedulerIntervalMinutes * time.Minute
+	}
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+// ItemsPerSale is the number of items generated for each new sale.
+func (c *SchedulerConfig) ItemsPerSale() int {
+	if c.TotalItems <= 0 {
+		return defaultSchedulerTotalItems
+	}
+	return c.TotalItems
+}
+
+func (c *SchedulerConfig) SaleDuration() time.Duration {
+	if c.SaleDurationMinutes <= 0 {
+		return defaultSaleDurationMinutes * time.Minute
+	}
+	return time.Duration(c.SaleDurationMinutes) * time.Minute
+}
+
+func (c *SchedulerConfig) PreWarmWindow() time.Duration {
+	if c.PreWarmMinutes <= 0 {
+		return defaultPreWarmMinutes * time.Minute
+	}
+	return time.Duration(c.PreWarmMinutes) * time.Minute
+}
+
+const (
+	defaultBloomExpectedElements  = 100000
+	defaultBloomFalsePositiveRate = 0.01
+)
+
+func (c *BloomFilterConfig) Capacity() uint64 {
+	if c.ExpectedElements == 0 {
+		return defaultBloomExpectedElements
+	}
+	return c.ExpectedElements
+}
+
+func (c *BloomFilterConfig) TargetFalsePositiveRate() float64 {
+	if c.FalsePositiveRate == 0 {
+		return defaultBloomFalsePositiveRate
+	}
+	return c.FalsePositiveRate
+}
+
+const defaultBurstMultiplier = 2.0
+
+// Burst is the token bucket size for a limit of rps requests per second.
+// It is never below 1, so a limit can always admit a request.
+func (c *RateLimitConfig) Burst(rps int) int {
+	multiplier := c.BurstMultiplier
+	if multiplier <= 0 {
+		multiplier = defaultBurstMultiplier
+	}
+	burst := int(math.Ceil(float64(rps) * multiplier))
+	if burst < 1 {
+		return 1
+	}
+	return burst
+}
+
+const (
+	defaultOutboxPollIntervalSeconds = 1
+	defaultOutboxMaxBatchSize        = 100
+)
+
+func (c *OutboxConfig) PollInterval() time.Duration {
+	if c.PollIntervalSeconds <= 0 {
+		return defaultOutboxPollIntervalSeconds * time.Second
+	}
+	return time.Duration(c.PollIntervalSeconds) * time.Second
+}
+
+func (c *OutboxConfig) BatchSize() int {
+	if c.MaxBatchSize <= 0 {
+		return defaultOutboxMaxBatchSize
+	}
+	return c.MaxBatchSize
+}
+
+const defaultWebhookMaxRetries = 3
+
+func (c *WebhookConfig) RetryLimit() int {
+	switch {
+	case c.MaxRetries == 0:
+		return defaultWebhookMaxRetries
+	case c.MaxRetries < 0:
+		return 0
+	}
+	return c.MaxRetries
+}
+
+func (c *RegionConfig) Enabled() bool {
+	return c.ID != "" && len(c.Split) > 1 && c.Split[c.ID] > 0
+}
+
+// LoadConfig reads a YAML file when path ends in .yaml or .yml and a JSON
+// file otherwise, then applies the FLASHSALE_* environment overrides.
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -42,14 +463,29 @@ func LoadConfig(path string) (*Config, error) {
 	defer file.Close()
 
 	var config Config
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&config); err != nil {
-		return nil, err
+	if isYAMLPath(path) {
+		if err := yaml.NewDecoder(file).Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+	} else {
+		if err := json.NewDecoder(file).Decode(&config); err != nil {
+			return nil, err
+		}
 	}
 
+	applyEnvOverrides(&config)
+
 	return &config, nil
 }
 
+func isYAMLPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
 func (c *DatabaseConfig) GetDSN() string {
 	return "host=" + c.Host +
 		" port=" + strconv.Itoa(c.Port) +
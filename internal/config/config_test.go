@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRegionConfigEnabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		region RegionConfig
+		want   bool
+	}{
+		{name: "no region", region: RegionConfig{}, want: false},
+		{name: "no split", region: RegionConfig{ID: "eu"}, want: false},
+		{name: "single region", region: RegionConfig{ID: "eu", Split: map[string]float64{"eu": 1}}, want: false},
+		{name: "in split", region: RegionConfig{ID: "eu", Split: map[string]float64{"eu": 1, "us": 1}}, want: true},
+		{name: "missing from split", region: RegionConfig{ID: "ap", Split: map[string]float64{"eu": 1, "us": 1}}, want: false},
+		{name: "zero weight", region: RegionConfig{ID: "eu", Split: map[string]float64{"eu": 0, "us": 1}}, want: false},
+		{name: "split without id", region: RegionConfig{Split: map[string]float64{"eu": 1, "us": 1}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.region.Enabled(); got != tt.want {
+				t.Errorf("Enabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRegionInSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  RegionConfig
+		invalid bool
+	}{
+		{name: "disabled", region: RegionConfig{}, invalid: false},
+		{name: "in split", region: RegionConfig{ID: "eu", Split: map[string]float64{"eu": 1, "us": 1}}, invalid: false},
+		{name: "missing from split", region: RegionConfig{ID: "ap", Split: map[string]float64{"eu": 1, "us": 1}}, invalid: true},
+		{name: "zero weight", region: RegionConfig{ID: "eu", Split: map[string]float64{"eu": 0, "us": 1}}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Region = tt.region
+
+			if got := hasFieldError(Validate(cfg), "region.id"); got != tt.invalid {
+				t.Errorf("region.id rejected = %v, want %v", got, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestValidateCheckoutHMACSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		invalid bool
+	}{
+		{name: "empty", secret: "", invalid: true},
+		{name: "shipped placeholder", secret: "change-me-in-production", invalid: true},
+		{name: "set", secret: "9f2c4e7a1b", invalid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			cfg.Cache.CheckoutHMACSecret = tt.secret
+
+			if got := hasFieldError(Validate(cfg), "cache.checkout_hmac_secret"); got != tt.invalid {
+				t.Errorf("cache.checkout_hmac_secret rejected = %v, want %v", got, tt.invalid)
+			}
+		})
+	}
+}
+
+// The placeholder in config.json must be replaced before the service runs.
+func TestValidateRejectsBundledCheckoutHMACSecret(t *testing.T) {
+	cfg, err := LoadConfig("../../config.json")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !hasFieldError(Validate(cfg), "cache.checkout_hmac_secret") {
+		t.Error("bundled checkout_hmac_secret is accepted")
+	}
+}
+
+func hasFieldError(err error, field string) bool {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	for _, e := range errs {
+		if e.Field == field {
+			return true
+		}
+	}
+	return false
+}
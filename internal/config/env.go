@@ -0,0 +1,266 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables that override values from the config file. List
+// values are comma separated; the region split is written as
+// "region=share,..." e.g. "eu=0.6,us=0.4".
+const (
+	EnvServerHost           = "FLASHSALE_SERVER_HOST"
+	EnvServerPort           = "FLASHSALE_SERVER_PORT"
+	EnvServerMaxGoroutines  = "FLASHSALE_SERVER_MAX_GOROUTINES"
+	EnvServerLogLevel       = "FLASHSALE_SERVER_LOG_LEVEL"
+	EnvServerLogBufferSize  = "FLASHSALE_SERVER_LOG_BUFFER_SIZE"
+	EnvServerMetricsPort    = "FLASHSALE_SERVER_METRICS_PORT"
+	EnvServerAllowedOrigins = "FLASHSALE_SERVER_ALLOWED_ORIGINS"
+	EnvServerAllowedMethods = "FLASHSALE_SERVER_ALLOWED_METHODS"
+	EnvServerAllowedHeaders = "FLASHSALE_SERVER_ALLOWED_HEADERS"
+	EnvServerMaxBodyBytes   = "FLASHSALE_SERVER_MAX_REQUEST_BODY_BYTES"
+	EnvServerMaxImportBytes = "FLASHSALE_SERVER_MAX_IMPORT_BODY_BYTES"
+	EnvServerTLSEnabled     = "FLASHSALE_SERVER_TLS_ENABLED"
+	EnvServerTLSCertFile    = "FLASHSALE_SERVER_TLS_CERT_FILE"
+	EnvServerTLSKeyFile     = "FLASHSALE_SERVER_TLS_KEY_FILE"
+	EnvServerTLSAutoTLS     = "FLASHSALE_SERVER_TLS_AUTO_TLS"
+	EnvServerTLSDomains     = "FLASHSALE_SERVER_TLS_DOMAINS"
+	EnvServerTLSCacheDir    = "FLASHSALE_SERVER_TLS_CACHE_DIR"
+
+	EnvDBHost           = "FLASHSALE_DB_HOST"
+	EnvDBPort           = "FLASHSALE_DB_PORT"
+	EnvDBUser           = "FLASHSALE_DB_USER"
+	EnvDBPassword       = "FLASHSALE_DB_PASSWORD"
+	EnvDBName           = "FLASHSALE_DB_NAME"
+	EnvDBSSLMode        = "FLASHSALE_DB_SSLMODE"
+	EnvDBMigrationsPath = "FLASHSALE_DB_MIGRATIONS_PATH"
+	EnvDBUseEmbedded    = "FLASHSALE_DB_USE_EMBEDDED"
+	EnvDBMaxRetries     = "FLASHSALE_DB_MAX_RETRIES"
+	EnvDBRetryDelayMs   = "FLASHSALE_DB_RETRY_DELAY_MS"
+	EnvDBReplicaDSN     = "FLASHSALE_DB_REPLICA_DSN"
+	EnvDBMaxOpenConns   = "FLASHSALE_DB_MAX_OPEN_CONNS"
+	EnvDBMaxIdleConns   = "FLASHSALE_DB_MAX_IDLE_CONNS"
+	EnvDBConnMaxLife    = "FLASHSALE_DB_CONN_MAX_LIFETIME_SECONDS"
+	EnvDBStmtTimeoutMs  = "FLASHSALE_DB_STATEMENT_TIMEOUT_MS"
+
+	EnvRedisMode       = "FLASHSALE_REDIS_MODE"
+	EnvRedisHost       = "FLASHSALE_REDIS_HOST"
+	EnvRedisPort       = "FLASHSALE_REDIS_PORT"
+	EnvRedisAddrs      = "FLASHSALE_REDIS_ADDRS"
+	EnvRedisMasterName = "FLASHSALE_REDIS_MASTER_NAME"
+	EnvRedisPassword   = "FLASHSALE_REDIS_PASSWORD"
+	EnvRedisDB         = "FLASHSALE_REDIS_DB"
+	EnvRedisTLSEnabled = "FLASHSALE_REDIS_TLS_ENABLED"
+	EnvRedisTLSSkip    = "FLASHSALE_REDIS_TLS_SKIP_VERIFY"
+	EnvRedisMaxRetries = "FLASHSALE_REDIS_MAX_RETRIES"
+	EnvRedisMinBackoff = "FLASHSALE_REDIS_MIN_RETRY_BACKOFF_MS"
+
+	EnvRegionID                = "FLASHSALE_REGION_ID"
+	EnvRegionSplit             = "FLASHSALE_REGION_SPLIT"
+	EnvRegionLeaseTTLSeconds   = "FLASHSALE_REGION_LEASE_TTL_SECONDS"
+	EnvRegionRebalanceInterval = "FLASHSALE_REGION_REBALANCE_INTERVAL_SECONDS"
+	EnvRegionRebalanceThresh   = "FLASHSALE_REGION_REBALANCE_THRESHOLD"
+	EnvRegionRebalanceChunk    = "FLASHSALE_REGION_REBALANCE_CHUNK"
+
+	EnvAdminAPIKeys = "FLASHSALE_ADMIN_API_KEYS"
+
+	EnvCacheCheckoutTTLSeconds    = "FLASHSALE_CACHE_CHECKOUT_TTL_SECONDS"
+	EnvCacheIdempotencyTTLSeconds = "FLASHSALE_CACHE_IDEMPOTENCY_TTL_SECONDS"
+	EnvCacheCheckoutHMACSecret    = "FLASHSALE_CACHE_CHECKOUT_HMAC_SECRET"
+	EnvCacheCheckoutCodePrefix    = "FLASHSALE_CACHE_CHECKOUT_CODE_PREFIX"
+	EnvCacheCountingBloomFilter   = "FLASHSALE_CACHE_COUNTING_BLOOM_FILTER"
+	EnvCacheScalableBloomFilter   = "FLASHSALE_CACHE_SCALABLE_BLOOM_FILTER"
+
+	EnvAuthJWTSecret = "FLASHSALE_AUTH_JWT_SECRET"
+
+	EnvTracingOTLPEndpoint = "FLASHSALE_TRACING_OTLP_ENDPOINT"
+
+	EnvSaleRefundWindowMinutes = "FLASHSALE_SALE_REFUND_WINDOW_MINUTES"
+
+	EnvSchedulerIntervalMinutes     = "FLASHSALE_SCHEDULER_INTERVAL_MINUTES"
+	EnvSchedulerTotalItems          = "FLASHSALE_SCHEDULER_TOTAL_ITEMS"
+	EnvSchedulerSaleDurationMinutes = "FLASHSALE_SCHEDULER_SALE_DURATION_MINUTES"
+	EnvSchedulerPreWarmMinutes      = "FLASHSALE_SCHEDULER_PRE_WARM_MINUTES"
+
+	EnvBloomFilterExpectedElements  = "FLASHSALE_BLOOM_FILTER_EXPECTED_ELEMENTS"
+	EnvBloomFilterFalsePositiveRate = "FLASHSALE_BLOOM_FILTER_FALSE_POSITIVE_RATE"
+
+	EnvRateLimitCheckoutRPS     = "FLASHSALE_RATE_LIMIT_CHECKOUT_RPS"
+	EnvRateLimitPurchaseRPS     = "FLASHSALE_RATE_LIMIT_PURCHASE_RPS"
+	EnvRateLimitGlobalRPS       = "FLASHSALE_RATE_LIMIT_GLOBAL_RPS"
+	EnvRateLimitBurstMultiplier = "FLASHSALE_RATE_LIMIT_BURST_MULTIPLIER"
+
+	EnvOutboxPollIntervalSeconds = "FLASHSALE_OUTBOX_POLL_INTERVAL_SECONDS"
+	EnvOutboxMaxBatchSize        = "FLASHSALE_OUTBOX_MAX_BATCH_SIZE"
+)
+
+func applyEnvOverrides(cfg *Config) {
+	envString(EnvServerHost, &cfg.Server.Host)
+	envInt(EnvServerPort, &cfg.Server.Port)
+	envInt(EnvServerMaxGoroutines, &cfg.Server.MaxGoroutines)
+	envString(EnvServerLogLevel, &cfg.Server.LogLevel)
+	envInt(EnvServerLogBufferSize, &cfg.Server.LogBufferSize)
+	envInt(EnvServerMetricsPort, &cfg.Server.MetricsPort)
+	envList(EnvServerAllowedOrigins, &cfg.Server.AllowedOrigins)
+	envList(EnvServerAllowedMethods, &cfg.Server.AllowedMethods)
+	envList(EnvServerAllowedHeaders, &cfg.Server.AllowedHeaders)
+	envInt64(EnvServerMaxBodyBytes, &cfg.Server.MaxRequestBodyBytes)
+	envInt64(EnvServerMaxImportBytes, &cfg.Server.MaxImportBodyBytes)
+	envBool(EnvServerTLSEnabled, &cfg.Server.TLSEnabled)
+	envString(EnvServerTLSCertFile, &cfg.Server.TLSCertFile)
+	envString(EnvServerTLSKeyFile, &cfg.Server.TLSKeyFile)
+	envBool(EnvServerTLSAutoTLS, &cfg.Server.TLSAutoTLS)
+	envList(EnvServerTLSDomains, &cfg.Server.TLSDomains)
+	envString(EnvServerTLSCacheDir, &cfg.Server.TLSCacheDir)
+
+	envString(EnvDBHost, &cfg.Database.Host)
+	envInt(EnvDBPort, &cfg.Database.Port)
+	envString(EnvDBUser, &cfg.Database.User)
+	envString(EnvDBPassword, &cfg.Database.Password)
+	envString(EnvDBName, &cfg.Database.DBName)
+	envString(EnvDBSSLMode, &cfg.Database.SSLMode)
+	envString(EnvDBMigrationsPath, &cfg.Database.MigrationsPath)
+	envBool(EnvDBUseEmbedded, &cfg.Database.UseEmbedded)
+	envInt(EnvDBMaxRetries, &cfg.Database.MaxRetries)
+	envInt(EnvDBRetryDelayMs, &cfg.Database.RetryDelayMs)
+	envString(EnvDBReplicaDSN, &cfg.Database.ReplicaDSN)
+	envInt(EnvDBMaxOpenConns, &cfg.Database.MaxOpenConns)
+	envInt(EnvDBMaxIdleConns, &cfg.Database.MaxIdleConns)
+	envInt(EnvDBConnMaxLife, &cfg.Database.ConnMaxLifetimeSeconds)
+	envInt(EnvDBStmtTimeoutMs, &cfg.Database.StatementTimeoutMs)
+
+	envString(EnvRedisMode, &cfg.Redis.Mode)
+	envString(EnvRedisHost, &cfg.Redis.Host)
+	envInt(EnvRedisPort, &cfg.Redis.Port)
+	envList(EnvRedisAddrs, &cfg.Redis.Addrs)
+	envString(EnvRedisMasterName, &cfg.Redis.MasterName)
+	envString(EnvRedisPassword, &cfg.Redis.Password)
+	envInt(EnvRedisDB, &cfg.Redis.DB)
+	envBool(EnvRedisTLSEnabled, &cfg.Redis.TLSEnabled)
+	envBool(EnvRedisTLSSkip, &cfg.Redis.TLSSkipVerify)
+	envInt(EnvRedisMaxRetries, &cfg.Redis.MaxRetries)
+	envInt(EnvRedisMinBackoff, &cfg.Redis.MinRetryBackoffMs)
+
+	envString(EnvRegionID, &cfg.Region.ID)
+	envSplit(EnvRegionSplit, &cfg.Region.Split)
+	envInt(EnvRegionLeaseTTLSeconds, &cfg.Region.LeaseTTLSeconds)
+	envInt(EnvRegionRebalanceInterval, &cfg.Region.RebalanceIntervalSeconds)
+	envFloat(EnvRegionRebalanceThresh, &cfg.Region.RebalanceThreshold)
+	envInt(EnvRegionRebalanceChunk, &cfg.Region.RebalanceChunk)
+
+	envList(EnvAdminAPIKeys, &cfg.Admin.APIKeys)
+
+	envInt(EnvCacheCheckoutTTLSeconds, &cfg.Cache.CheckoutTTLSeconds)
+	envInt(EnvCacheIdempotencyTTLSeconds, &cfg.Cache.IdempotencyTTLSeconds)
+	envString(EnvCacheCheckoutHMACSecret, &cfg.Cache.CheckoutHMACSecret)
+	envString(EnvCacheCheckoutCodePrefix, &cfg.Cache.CheckoutCodePrefix)
+	envBool(EnvCacheCountingBloomFilter, &cfg.Cache.CountingBloomFilter)
+	envBool(EnvCacheScalableBloomFilter, &cfg.Cache.ScalableBloomFilter)
+
+	envString(EnvAuthJWTSecret, &cfg.Auth.JWTSecret)
+
+	envString(EnvTracingOTLPEndpoint, &cfg.Tracing.OTLPEndpoint)
+
+	envInt(EnvSaleRefundWindowMinutes, &cfg.Sale.RefundWindowMinutes)
+
+	envInt(EnvSchedulerIntervalMinutes, &cfg.Scheduler.IntervalMinutes)
+	envInt(EnvSchedulerTotalItems, &cfg.Scheduler.TotalItems)
+	envInt(EnvSchedulerSaleDurationMinutes, &cfg.Scheduler.SaleDurationMinutes)
+	envInt(EnvSchedulerPreWarmMinutes, &cfg.Scheduler.PreWarmMinutes)
+
+	envUint64(EnvBloomFilterExpectedElements, &cfg.BloomFilter.ExpectedElements)
+	envFloat(EnvBloomFilterFalsePositiveRate, &cfg.BloomFilter.FalsePositiveRate)
+
+	envInt(EnvRateLimitCheckoutRPS, &cfg.RateLimit.CheckoutRPS)
+	envInt(EnvRateLimitPurchaseRPS, &cfg.RateLimit.PurchaseRPS)
+	envInt(EnvRateLimitGlobalRPS, &cfg.RateLimit.GlobalRPS)
+	envFloat(EnvRateLimitBurstMultiplier, &cfg.RateLimit.BurstMultiplier)
+
+	envInt(EnvOutboxPollIntervalSeconds, &cfg.Outbox.PollIntervalSeconds)
+	envInt(EnvOutboxMaxBatchSize, &cfg.Outbox.MaxBatchSize)
+}
+
+func envString(name string, dst *string) {
+	if value, ok := os.LookupEnv(name); ok {
+		*dst = value
+	}
+}
+
+func envInt(name string, dst *int) {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			*dst = parsed
+		}
+	}
+}
+
+func envInt64(name string, dst *int64) {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			*dst = parsed
+		}
+	}
+}
+
+func envUint64(name string, dst *uint64) {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+			*dst = parsed
+		}
+	}
+}
+
+func envBool(name string, dst *bool) {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			*dst = parsed
+		}
+	}
+}
+
+func envFloat(name string, dst *float64) {
+	if value := os.Getenv(name); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			*dst = parsed
+		}
+	}
+}
+
+func envList(name string, dst *[]string) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return
+	}
+
+	list := make([]string, 0)
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			list = append(list, part)
+		}
+	}
+	*dst = list
+}
+
+// envSplit replaces the split only when every entry parses, so a typo does
+// not leave a partial split behind.
+func envSplit(name string, dst *map[string]float64) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+
+	split := make(map[string]float64)
+	for _, part := range strings.Split(value, ",") {
+		region, share, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return
+		}
+		parsed, err := strconv.ParseFloat(share, 64)
+		if err != nil {
+			return
+		}
+		split[strings.TrimSpace(region)] = parsed
+	}
+	*dst = split
+}
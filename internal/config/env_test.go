@@ -0,0 +1,126 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const envTestJSON = `{
+	"server": {"host": "0.0.0.0", "port": 8080, "allowed_origins": ["https://shop.example.com"]},
+	"database": {"host": "db.internal", "port": 5432, "user": "flashsale", "password": "from-file"},
+	"redis": {"host": "redis.internal", "port": 6379},
+	"region": {"id": "eu", "split": {"eu": 1, "us": 1}},
+	"bloom_filter": {"expected_elements": 1000, "false_positive_rate": 0.01},
+	"rate_limit": {"checkout_rps": 10}
+}`
+
+const envTestYAML = `
+database:
+  host: db.internal
+  port: 5432
+redis:
+  host: redis.internal
+  port: 6379
+`
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadConfigAppliesEnvOverrides(t *testing.T) {
+	t.Setenv(EnvServerPort, "9090")
+	t.Setenv(EnvServerAllowedOrigins, "https://a.example.com, https://b.example.com,")
+	t.Setenv(EnvServerTLSEnabled, "true")
+	t.Setenv(EnvDBHost, "db.override")
+	t.Setenv(EnvDBPassword, "")
+	t.Setenv(EnvDBStmtTimeoutMs, "2500")
+	t.Setenv(EnvRedisAddrs, "r1:6379,r2:6379")
+	t.Setenv(EnvRegionSplit, "eu=0.6, us=0.4")
+	t.Setenv(EnvBloomFilterExpectedElements, "500000")
+	t.Setenv(EnvBloomFilterFalsePositiveRate, "0.001")
+	t.Setenv(EnvServerMaxBodyBytes, "2097152")
+
+	cfg, err := LoadConfig(writeConfigFile(t, "config.json", envTestJSON))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	checks := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{EnvServerPort, cfg.Server.Port, 9090},
+		{EnvServerAllowedOrigins, cfg.Server.AllowedOrigins, []string{"https://a.example.com", "https://b.example.com"}},
+		{EnvServerTLSEnabled, cfg.Server.TLSEnabled, true},
+		{EnvDBHost, cfg.Database.Host, "db.override"},
+		{EnvDBPassword + " set but empty", cfg.Database.Password, ""},
+		{EnvDBStmtTimeoutMs, cfg.Database.StatementTimeoutMs, 2500},
+		{EnvRedisAddrs, cfg.Redis.Addrs, []string{"r1:6379", "r2:6379"}},
+		{EnvRegionSplit, cfg.Region.Split, map[string]float64{"eu": 0.6, "us": 0.4}},
+		{EnvBloomFilterExpectedElements, cfg.BloomFilter.ExpectedElements, uint64(500000)},
+		{EnvBloomFilterFalsePositiveRate, cfg.BloomFilter.FalsePositiveRate, 0.001},
+		{EnvServerMaxBodyBytes, cfg.Server.MaxRequestBodyBytes, int64(2097152)},
+		{"file value without override", cfg.Database.User, "flashsale"},
+		{"file value without override", cfg.RateLimit.CheckoutRPS, 10},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigIgnoresUnparsableEnvOverrides(t *testing.T) {
+	t.Setenv(EnvServerPort, "eighty")
+	t.Setenv(EnvDBPort, "")
+	t.Setenv(EnvServerTLSEnabled, "maybe")
+	t.Setenv(EnvRegionSplit, "eu=0.6,us")
+	t.Setenv(EnvBloomFilterFalsePositiveRate, "1%")
+
+	cfg, err := LoadConfig(writeConfigFile(t, "config.json", envTestJSON))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if cfg.Server.Port != 8080 {
+		t.Errorf("server port = %d, want the file's 8080", cfg.Server.Port)
+	}
+	if cfg.Database.Port != 5432 {
+		t.Errorf("database port = %d, want the file's 5432", cfg.Database.Port)
+	}
+	if cfg.Server.TLSEnabled {
+		t.Error("TLS enabled by an unparsable value")
+	}
+	if want := map[string]float64{"eu": 1, "us": 1}; !reflect.DeepEqual(cfg.Region.Split, want) {
+		t.Errorf("region split = %v, want the file's %v", cfg.Region.Split, want)
+	}
+	if cfg.BloomFilter.FalsePositiveRate != 0.01 {
+		t.Errorf("false positive rate = %v, want the file's 0.01", cfg.BloomFilter.FalsePositiveRate)
+	}
+}
+
+func TestLoadConfigAppliesEnvOverridesToYAML(t *testing.T) {
+	t.Setenv(EnvRedisHost, "redis.override")
+	t.Setenv(EnvRedisPort, "6380")
+
+	cfg, err := LoadConfig(writeConfigFile(t, "config.yaml", envTestYAML))
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+
+	if cfg.Redis.Host != "redis.override" || cfg.Redis.Port != 6380 {
+		t.Errorf("redis = %s:%d, want redis.override:6380", cfg.Redis.Host, cfg.Redis.Port)
+	}
+	if cfg.Database.Host != "db.internal" {
+		t.Errorf("database host = %q, want the file's db.internal", cfg.Database.Host)
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultYAMLTemplate holds the same settings as the config.json shipped with
+// the service, with each non-obvious one explained.
+const defaultYAMLTemplate = `# Flash sale service configuration.
+# Every setting can also be overridden with a FLASHSALE_* environment variable.
+
+server:
+  host: 0.0.0.0
+  port: 8080
+  # Liveness fails once the process runs more goroutines than this.
+  max_goroutines: 10000
+  # DEBUG, INFO, WARN or ERROR.
+  log_level: INFO
+  # Entries buffered for asynchronous logging; 0 logs synchronously.
+  log_buffer_size: 4096
+  # Serves /metrics on its own port; 0 disables the separate server.
+  metrics_port: 9090
+  # CORS is disabled while this list is empty. Listed origins may send
+  # credentials; "*" also allows any other origin, without credentials.
+  allowed_origins: []
+  allowed_methods: []
+  allowed_headers: []
+  # Larger request bodies are rejected with 413.
+  max_request_body_bytes: 1048576
+  # Item imports (POST /admin/sales/{id}/items/import) may be larger.
+  max_import_body_bytes: 33554432
+  # Serve HTTPS with the cert and key files, or with tls_auto_tls, with
+  # Let's Encrypt certificates for tls_domains kept in tls_cache_dir.
+  tls_enabled: false
+  tls_cert_file: ""
+  tls_key_file: ""
+  tls_auto_tls: false
+  tls_domains: []
+  tls_cache_dir: autocert-cache
+
+database:
+  host: postgres
+  port: 5432
+  user: postgres
+  password: postgres
+  dbname: flashsale
+  sslmode: disable
+  migrations_path: internal/infrastructure/persistence/postgres/migrations
+  # Run the migrations compiled into the binary instead of migrations_path.
+  use_embedded: false
+  # Attempts at the initial ping; the delay doubles after each one.
+  max_retries: 5
+  retry_delay_ms: 100
+  # Optional read replica for the hot read paths.
+  replica_dsn: ""
+  # Connection pool of the primary and the replica.
+  max_open_conns: 100
+  max_idle_conns: 50
+  conn_max_lifetime_seconds: 3600
+  # Statements on the primary running longer are cancelled; 0 disables.
+  statement_timeout_ms: 0
+
+redis:
+  # single uses host and port; cluster and sentinel use addrs.
+  mode: single
+  host: redis
+  port: 6379
+  addrs: []
+  # Required in sentinel mode.
+  master_name: ""
+  password: ""
+  db: 0
+  # Most managed Redis services require TLS. Skipping verification is for
+  # testing only.
+  tls_enabled: false
+  tls_skip_verify: false
+  # Command retries; 0 keeps the client default and -1 disables them.
+  max_retries: 3
+  min_retry_backoff_ms: 8
+
+region:
+  # Leave id empty to run as a single region.
+  id: ""
+  # Share of each sale's items per region, e.g. {eu: 0.5, us: 0.5}.
+  split: {}
+  lease_ttl_seconds: 60
+  rebalance_interval_seconds: 10
+  # Fraction of a region's share sold before it borrows from the others.
+  rebalance_threshold: 0.8
+  rebalance_chunk: 500
+
+admin:
+  # Keys accepted by the /admin and /internal endpoints.
+  api_keys: []
+
+cache:
+  checkout_ttl_seconds: 600
+  idempotency_ttl_seconds: 86400
+  # Signs checkout codes; changing it invalidates every outstanding code.
+  # The service refuses to start with this placeholder.
+  checkout_hmac_secret: change-me-in-production
+  checkout_code_prefix: CHK
+  # A counting filter lets refunded items be removed from it.
+  counting_bloom_filter: false
+  # A scalable filter keeps its false positive rate past its capacity.
+  # It cannot be combined with counting_bloom_filter.
+  scalable_bloom_filter: false
+
+auth:
+  # Enables JWT authentication of checkouts; empty trusts user_id.
+  jwt_secret: ""
+
+tracing:
+  # e.g. http://otel-collector:4318; empty disables span export.
+  otlp_endpoint: ""
+
+sale:
+  # How long after a sale ends its purchases can be refunded.
+  refund_window_minutes: 60
+
+scheduler:
+  interval_minutes: 60
+  total_items: 10000
+  sale_duration_minutes: 60
+  # How far ahead of their start upcoming sales get their cache warmed.
+  pre_warm_minutes: 5
+
+bloom_filter:
+  # Each sale's sold items filter is sized for this many items at this
+  # false positive rate; the computed size is logged at startup.
+  expected_elements: 100000
+  false_positive_rate: 0.01
+
+rate_limit:
+  # Requests per second per user, or per client IP when anonymous.
+  # 0 leaves that scope unlimited; global_rps covers every route.
+  checkout_rps: 5
+  purchase_rps: 0
+  global_rps: 0
+  # Each bucket holds rate * burst_multiplier tokens.
+  burst_multiplier: 2.0
+
+outbox:
+  # Events written by purchases are published to subscribers in batches.
+  poll_interval_seconds: 1
+  max_batch_size: 100
+
+# Endpoints POSTed the events they subscribe to, e.g.
+#   - url: https://example.com/hooks/flashsale
+#     secret: shared-signing-secret
+#     events: [purchase.completed]
+#     max_retries: 3
+# Each body is signed with HMAC-SHA256 in the X-Flashsale-Signature header.
+webhooks: []
+`
+
+// WriteDefaultConfig writes a starting configuration to path. format is
+// "yaml" (or "yml") for the commented template, or "json".
+func WriteDefaultConfig(format, path string) error {
+	var data []byte
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		data = []byte(defaultYAMLTemplate)
+	case "json":
+		var cfg Config
+		if err := yaml.Unmarshal([]byte(defaultYAMLTemplate), &cfg); err != nil {
+			return err
+		}
+		encoded, err := json.MarshalIndent(&cfg, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(encoded, '\n')
+	default:
+		return fmt.Errorf("unsupported config format %q", format)
+	}
+
+	return os.WriteFile(path, data, 0o600)
+}
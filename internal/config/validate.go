@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// placeholderCheckoutHMACSecret is the checkout_hmac_secret of the shipped
+// config.json, which is public.
+const placeholderCheckoutHMACSecret = "change-me-in-production"
+
+type FieldError struct {
+	Field   string
+	Problem string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// ValidationErrors lists every problem found in a config so that all of
+// them can be fixed in one go.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	problems := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		problems = append(problems, fieldErr.Error())
+	}
+	return "invalid configuration: " + strings.Join(problems, "; ")
+}
+
+// Validate checks the fields the service cannot start without. It returns
+// ValidationErrors, or nil when the config is usable.
+func Validate(cfg *Config) error {
+	var errs ValidationErrors
+	add := func(field, problem string) {
+		errs = append(errs, FieldError{Field: field, Problem: problem})
+	}
+
+	if cfg.Server.Port <= 0 {
+		add("server.port", "must be a positive integer")
+	}
+	switch strings.ToUpper(cfg.Server.LogLevel) {
+	case "", "DEBUG", "INFO", "WARN", "ERROR":
+	default:
+		add("server.log_level", "must be one of DEBUG, INFO, WARN or ERROR")
+	}
+	if cfg.Server.LogBufferSize < 0 {
+		add("server.log_buffer_size", "must not be negative")
+	}
+	if cfg.Server.MaxRequestBodyBytes < 0 {
+		add("server.max_request_body_bytes", "must not be negative")
+	}
+	if cfg.Server.MaxImportBodyBytes < 0 {
+		add("server.max_import_body_bytes", "must not be negative")
+	}
+	if cfg.Server.MetricsPort < 0 {
+		add("server.metrics_port", "must not be negative")
+	} else if cfg.Server.MetricsPort != 0 && cfg.Server.MetricsPort == cfg.Server.Port {
+		add("server.metrics_port", "must differ from server.port")
+	}
+	switch {
+	case cfg.Server.TLSAutoTLS && !cfg.Server.TLSEnabled:
+		add("server.tls_auto_tls", "requires tls_enabled")
+	case cfg.Server.TLSAutoTLS:
+		if len(cfg.Server.TLSDomains) == 0 {
+			add("server.tls_domains", "at least one domain is required with tls_auto_tls")
+		}
+	case cfg.Server.TLSEnabled:
+		if cfg.Server.TLSCertFile == "" {
+			add("server.tls_cert_file", "is required when tls_enabled is set")
+		}
+		if cfg.Server.TLSKeyFile == "" {
+			add("server.tls_key_file", "is required when tls_enabled is set")
+		}
+	}
+
+	if cfg.Database.Host == "" {
+		add("database.host", "is required")
+	}
+	if cfg.Database.Port <= 0 {
+		add("database.port", "must be a positive integer")
+	}
+	if cfg.Database.User == "" {
+		add("database.user", "is required")
+	}
+	if cfg.Database.Password == "" {
+		add("database.password", "is required")
+	}
+	if cfg.Database.DBName == "" {
+		add("database.dbname", "is required")
+	}
+	if cfg.Database.MaxOpenConns < 0 {
+		add("database.max_open_conns", "must not be negative")
+	}
+	if cfg.Database.MaxIdleConns < 0 {
+		add("database.max_idle_conns", "must not be negative")
+	} else if cfg.Database.IdleConnLimit() > cfg.Database.OpenConnLimit() {
+		add("database.max_idle_conns", "must not exceed max_open_conns")
+	}
+	if cfg.Database.ConnMaxLifetimeSeconds < 0 {
+		add("database.conn_max_lifetime_seconds", "must not be negative")
+	}
+	if cfg.Database.StatementTimeoutMs < 0 {
+		add("database.statement_timeout_ms", "must not be negative")
+	}
+	if cfg.Database.MigrationsPath == "" && !cfg.Database.UseEmbedded {
+		add("database.migrations_path", "is required unless use_embedded is set")
+	}
+
+	// Anyone who knows the secret can forge checkout codes.
+	switch cfg.Cache.CheckoutHMACSecret {
+	case "":
+		add("cache.checkout_hmac_secret", "is required to sign checkout codes")
+	case placeholderCheckoutHMACSecret:
+		add("cache.checkout_hmac_secret", "must be changed from the shipped placeholder")
+	}
+
+	// checkout_code columns are VARCHAR(64); the rest of a code takes 58.
+	if len(cfg.Cache.CheckoutCodePrefix) > 6 {
+		add("cache.checkout_code_prefix", "must be at most 6 characters")
+	}
+	if strings.Contains(cfg.Cache.CheckoutCodePrefix, "-") {
+		add("cache.checkout_code_prefix", "must not contain '-'")
+	}
+
+	if cfg.Cache.CountingBloomFilter && cfg.Cache.ScalableBloomFilter {
+		add("cache.scalable_bloom_filter", "cannot be combined with counting_bloom_filter")
+	}
+
+	// ExpectedElements cannot be negative; 0 selects the default size.
+	if fpr := cfg.BloomFilter.FalsePositiveRate; fpr < 0 || fpr >= 1 {
+		add("bloom_filter.false_positive_rate", "must be between 0 and 1 exclusive")
+	}
+
+	// A node outside the split would run with no lease of its own.
+	if cfg.Region.ID != "" && len(cfg.Region.Split) > 1 && cfg.Region.Split[cfg.Region.ID] <= 0 {
+		add("region.id", "must be a region with a positive weight in region.split")
+	}
+
+	if cfg.RateLimit.CheckoutRPS < 0 {
+		add("rate_limit.checkout_rps", "must not be negative")
+	}
+	if cfg.RateLimit.PurchaseRPS < 0 {
+		add("rate_limit.purchase_rps", "must not be negative")
+	}
+	if cfg.RateLimit.GlobalRPS < 0 {
+		add("rate_limit.global_rps", "must not be negative")
+	}
+	if cfg.RateLimit.BurstMultiplier < 0 {
+		add("rate_limit.burst_multiplier", "must not be negative")
+	}
+
+	if cfg.Outbox.PollIntervalSeconds < 0 {
+		add("outbox.poll_interval_seconds", "must not be negative")
+	}
+	if cfg.Outbox.MaxBatchSize < 0 {
+		add("outbox.max_batch_size", "must not be negative")
+	}
+
+	for i, webhook := range cfg.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(field+".url", "must be an absolute http or https URL")
+		}
+		if webhook.Secret == "" {
+			add(field+".secret", "is required to sign deliveries")
+		}
+		for _, event := range webhook.Events {
+			if strings.TrimSpace(event) == "" {
+				add(field+".events", "must not contain empty event types")
+				break
+			}
+		}
+	}
+
+	if cfg.Scheduler.IntervalMinutes < 0 {
+		add("scheduler.interval_minutes", "must not be negative")
+	}
+	if cfg.Scheduler.TotalItems < 0 {
+		add("scheduler.total_items", "must not be negative")
+	}
+	if cfg.Scheduler.SaleDurationMinutes < 0 {
+		add("scheduler.sale_duration_minutes", "must not be negative")
+	}
+	if cfg.Scheduler.PreWarmMinutes < 0 {
+		add("scheduler.pre_warm_minutes", "must not be negative")
+	}
+
+	if cfg.Redis.MaxRetries < -1 {
+		add("redis.max_retries", "must be -1 or more")
+	}
+	if cfg.Redis.MinRetryBackoffMs < -1 {
+		add("redis.min_retry_backoff_ms", "must be -1 or more")
+	}
+	if cfg.Redis.TLSSkipVerify && !cfg.Redis.TLSEnabled {
+		add("redis.tls_skip_verify", "requires tls_enabled")
+	}
+
+	switch cfg.Redis.Mode {
+	case "", RedisModeSingle:
+		if cfg.Redis.Host == "" {
+			add("redis.host", "is required")
+		}
+		if cfg.Redis.Port <= 0 {
+			add("redis.port", "must be a positive integer")
+		}
+	case RedisModeCluster:
+		if len(cfg.Redis.Addrs) == 0 {
+			add("redis.addrs", "at least one address is required in cluster mode")
+		}
+	case RedisModeSentinel:
+		if len(cfg.Redis.Addrs) == 0 {
+			add("redis.addrs", "at least one sentinel address is required in sentinel mode")
+		}
+		if cfg.Redis.MasterName == "" {
+			add("redis.master_name", "is required in sentinel mode")
+		}
+	default:
+		add("redis.mode", "must be one of single, cluster or sentinel")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 var (
 	ErrSaleNotFound      = errors.New("sale not found")
 	ErrSaleNotActive     = errors.New("sale is not active")
+	ErrSaleNotYetStarted = errors.New("sale has not started yet")
 	ErrSaleOutOfStock    = errors.New("sale is out of stock")
 	ErrSaleLimitExceeded = errors.New("purchase would exceed sale limit")
 	ErrNoItemsToPurchase = errors.New("no items to purchase")
@@ -15,15 +16,63 @@ var (
 	ErrItemAlreadySold = errors.New("item already sold")
 	ErrItemNotInSale   = errors.New("item not in current sale")
 	ErrAllItemsSold    = errors.New("all items from checkout already sold")
+	ErrItemNotSold     = errors.New("item has not been sold")
 
 	ErrCheckoutNotFound          = errors.New("checkout not found")
+	ErrInvalidCheckoutCode       = errors.New("checkout code is malformed or has an invalid signature")
 	ErrCheckoutExpired           = errors.New("checkout expired")
+	ErrCheckoutExpiredTTL        = errors.New("checkout has passed its expiry time")
 	ErrItemAlreadyInCheckout     = errors.New("item already in checkout")
 	ErrUserAlreadyCheckedOutItem = errors.New("user already checked out this item")
 
 	ErrUserLimitExceeded = errors.New("user has reached maximum items limit")
 
 	ErrCheckoutAlreadyProcessed = errors.New("checkout code has already been processed")
+	ErrPurchaseResultNotFound   = errors.New("purchase result not found")
+	ErrInvalidPurchaseResult    = errors.New("purchase result is not valid JSON")
+
+	ErrRefundWindowClosed = errors.New("refund window has closed")
+	ErrItemNotOwnedByUser = errors.New("item was not sold to this user")
+
+	ErrQuotaLeaseNotFound = errors.New("quota lease not found")
 
 	ErrTransactionFailed = errors.New("transaction failed")
 )
+
+// Machine-readable codes for the errors above. They are part of the HTTP
+// API, so clients can branch on them instead of matching messages; once
+// published a code must not change.
+const (
+	ErrCodeSaleNotFound      = "SALE_NOT_FOUND"
+	ErrCodeSaleNotActive     = "SALE_NOT_ACTIVE"
+	ErrCodeSaleNotYetStarted = "SALE_NOT_YET_STARTED"
+	ErrCodeSaleOutOfStock    = "SALE_OUT_OF_STOCK"
+	ErrCodeSaleLimitExceeded = "SALE_LIMIT_EXCEEDED"
+	ErrCodeNoItemsToPurchase = "NO_ITEMS_TO_PURCHASE"
+
+	ErrCodeItemNotFound    = "ITEM_NOT_FOUND"
+	ErrCodeItemAlreadySold = "ITEM_ALREADY_SOLD"
+	ErrCodeItemNotInSale   = "ITEM_NOT_IN_SALE"
+	ErrCodeAllItemsSold    = "ALL_ITEMS_SOLD"
+	ErrCodeItemNotSold     = "ITEM_NOT_SOLD"
+
+	ErrCodeCheckoutNotFound          = "CHECKOUT_NOT_FOUND"
+	ErrCodeInvalidCheckoutCode       = "INVALID_CHECKOUT_CODE"
+	ErrCodeCheckoutExpired           = "CHECKOUT_EXPIRED"
+	ErrCodeCheckoutExpiredTTL        = "CHECKOUT_EXPIRED_TTL"
+	ErrCodeItemAlreadyInCheckout     = "ITEM_ALREADY_IN_CHECKOUT"
+	ErrCodeUserAlreadyCheckedOutItem = "USER_ALREADY_CHECKED_OUT_ITEM"
+
+	ErrCodeUserLimitExceeded = "USER_LIMIT_EXCEEDED"
+
+	ErrCodeCheckoutAlreadyProcessed = "CHECKOUT_ALREADY_PROCESSED"
+	ErrCodePurchaseResultNotFound   = "PURCHASE_RESULT_NOT_FOUND"
+	ErrCodeInvalidPurchaseResult    = "INVALID_PURCHASE_RESULT"
+
+	ErrCodeRefundWindowClosed = "REFUND_WINDOW_CLOSED"
+	ErrCodeItemNotOwnedByUser = "ITEM_NOT_OWNED_BY_USER"
+
+	ErrCodeQuotaLeaseNotFound = "QUOTA_LEASE_NOT_FOUND"
+
+	ErrCodeTransactionFailed = "TRANSACTION_FAILED"
+)
@@ -0,0 +1,77 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	TypeSaleStarted       = "sale.started"
+	TypeItemSold          = "item.sold"
+	TypePurchaseCompleted = "purchase.completed"
+)
+
+// Event is implemented by every domain event so that buses can route it to
+// the subscribers of its type.
+type Event interface {
+	EventType() string
+}
+
+type SaleStartedEvent struct {
+	SaleID     string    `json:"sale_id"`
+	StartedAt  time.Time `json:"started_at"`
+	TotalItems int       `json:"total_items"`
+}
+
+func (SaleStartedEvent) EventType() string { return TypeSaleStarted }
+
+type ItemSoldEvent struct {
+	SaleID string    `json:"sale_id"`
+	ItemID string    `json:"item_id"`
+	UserID string    `json:"user_id"`
+	SoldAt time.Time `json:"sold_at"`
+}
+
+func (ItemSoldEvent) EventType() string { return TypeItemSold }
+
+type PurchaseCompletedEvent struct {
+	SaleID            string    `json:"sale_id"`
+	UserID            string    `json:"user_id"`
+	CheckoutCode      string    `json:"checkout_code"`
+	SuccessfulItemIDs []string  `json:"successful_item_ids"`
+	FailedItemIDs     []string  `json:"failed_item_ids"`
+	CompletedAt       time.Time `json:"completed_at"`
+}
+
+func (PurchaseCompletedEvent) EventType() string { return TypePurchaseCompleted }
+
+// TypeOf returns the type of event, or "" when it is not a domain event.
+func TypeOf(event interface{}) string {
+	if e, ok := event.(Event); ok {
+		return e.EventType()
+	}
+	return ""
+}
+
+// Decode rebuilds an event of eventType from its JSON payload.
+func Decode(eventType string, payload []byte) (Event, error) {
+	switch eventType {
+	case TypeSaleStarted:
+		return decode[SaleStartedEvent](payload)
+	case TypeItemSold:
+		return decode[ItemSoldEvent](payload)
+	case TypePurchaseCompleted:
+		return decode[PurchaseCompletedEvent](payload)
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+}
+
+func decode[T Event](payload []byte) (Event, error) {
+	var event T
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
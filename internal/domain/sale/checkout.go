@@ -12,9 +12,12 @@ type Checkout struct {
 	UserID    string
 	ItemIDs   []string
 	CreatedAt time.Time
+	// ExpiresAt is zero for checkouts stored before expiry was recorded;
+	// those never expire here and rely on the Redis code TTL alone.
+	ExpiresAt time.Time
 }
 
-func NewCheckout(code, saleID, userID string, itemIDs []string) (*Checkout, error) {
+func NewCheckout(code, saleID, userID string, itemIDs []string, ttl time.Duration) (*Checkout, error) {
 	if code == "" {
 		return nil, errors.New("checkout code cannot be empty")
 	}
@@ -31,15 +34,21 @@ func NewCheckout(code, saleID, userID string, itemIDs []string) (*Checkout, erro
 		return nil, errors.New("item ids cannot be empty")
 	}
 
+	now := time.Now().UTC()
 	return &Checkout{
 		Code:      code,
 		SaleID:    saleID,
 		UserID:    userID,
 		ItemIDs:   itemIDs,
-		CreatedAt: time.Now().UTC(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
 	}, nil
 }
 
+func (c *Checkout) IsExpired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
 func (c *Checkout) AddItem(itemID string) error {
 	for _, id := range c.ItemIDs {
 		if id == itemID {
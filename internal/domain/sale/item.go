@@ -2,6 +2,8 @@ package sale
 
 import (
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type Item struct {
@@ -9,18 +11,22 @@ type Item struct {
 	SaleID       string
 	Name         string
 	ImageURL     string
+	Price        decimal.Decimal
+	Description  string
+	Metadata     map[string]interface{}
 	Sold         bool
 	SoldToUserID string
 	SoldAt       *time.Time
 	CreatedAt    time.Time
 }
 
-func NewItem(id, saleID, name, imageURL string) *Item {
+func NewItem(id, saleID, name, imageURL string, price decimal.Decimal) *Item {
 	return &Item{
 		ID:        id,
 		SaleID:    saleID,
 		Name:      name,
 		ImageURL:  imageURL,
+		Price:     price,
 		Sold:      false,
 		CreatedAt: time.Now().UTC(),
 	}
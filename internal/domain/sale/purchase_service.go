@@ -4,7 +4,9 @@ import (
 	"errors"
 	"time"
 
+	"github.com/shopspring/decimal"
 	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
 )
 
 type UserLimits struct {
@@ -12,24 +14,40 @@ type UserLimits struct {
 	MaxItemsPerUser  int
 }
 
+// DefaultRefundWindow is how long after a sale ends refunds are accepted
+// unless WithRefundWindow says otherwise.
+const DefaultRefundWindow = time.Hour
+
 type PurchaseService struct {
-	maxItemsPerSale int
-	maxItemsPerUser int
+	refundWindow time.Duration
+	clock        clock.Clock
 }
 
-func NewPurchaseService(maxItemsPerSale, maxItemsPerUser int) *PurchaseService {
+func NewPurchaseService() *PurchaseService {
 	return &PurchaseService{
-		maxItemsPerSale: maxItemsPerSale,
-		maxItemsPerUser: maxItemsPerUser,
+		refundWindow: DefaultRefundWindow,
+		clock:        clock.NewRealClock(),
 	}
 }
 
+// WithClock replaces the clock used to decide whether a sale is active and
+// whether its refund window is still open.
+func (s *PurchaseService) WithClock(c clock.Clock) *PurchaseService {
+	s.clock = c
+	return s
+}
+
+func (s *PurchaseService) WithRefundWindow(window time.Duration) *PurchaseService {
+	s.refundWindow = window
+	return s
+}
+
 func (s *PurchaseService) ValidatePurchase(sale *Sale, userLimits *UserLimits, items []*Item) error {
 	if sale == nil {
 		return errors.New("sale cannot be nil")
 	}
 
-	if !sale.IsActive(time.Now().UTC()) {
+	if !sale.IsActive(s.clock.Now().UTC()) {
 		return domainErrors.ErrSaleNotActive
 	}
 
@@ -37,11 +55,16 @@ func (s *PurchaseService) ValidatePurchase(sale *Sale, userLimits *UserLimits, i
 		return domainErrors.ErrNoItemsToPurchase
 	}
 
-	if sale.ItemsSold+len(items) > s.maxItemsPerSale {
+	maxItemsPerSale := sale.MaxItemsPerSale
+	if sale.TotalItems > maxItemsPerSale {
+		maxItemsPerSale = sale.TotalItems
+	}
+
+	if sale.ItemsSold+len(items) > maxItemsPerSale {
 		return domainErrors.ErrSaleLimitExceeded
 	}
 
-	if userLimits.CurrentItemCount+len(items) > s.maxItemsPerUser {
+	if userLimits.CurrentItemCount+len(items) > userLimits.MaxItemsPerUser {
 		return domainErrors.ErrUserLimitExceeded
 	}
 
@@ -54,6 +77,32 @@ func (s *PurchaseService) ValidatePurchase(sale *Sale, userLimits *UserLimits, i
 	return nil
 }
 
+// ValidateRefund checks that item was bought by userID in sale and that the
+// sale ended no longer than the refund window ago.
+func (s *PurchaseService) ValidateRefund(sale *Sale, item *Item, userID string) error {
+	if sale == nil {
+		return errors.New("sale cannot be nil")
+	}
+
+	if !item.BelongsToSale(sale.ID) {
+		return domainErrors.ErrItemNotInSale
+	}
+
+	if !item.IsSold() {
+		return domainErrors.ErrItemNotSold
+	}
+
+	if item.SoldToUserID != userID {
+		return domainErrors.ErrItemNotOwnedByUser
+	}
+
+	if s.clock.Now().UTC().After(sale.EndedAt.Add(s.refundWindow)) {
+		return domainErrors.ErrRefundWindowClosed
+	}
+
+	return nil
+}
+
 func (s *PurchaseService) CalculatePurchaseResult(attemptedItems []*Item, successfulPurchases []string) *PurchaseResult {
 	result := &PurchaseResult{
 		Items:          make([]PurchaseItemResult, 0, len(attemptedItems)),
@@ -69,9 +118,10 @@ func (s *PurchaseService) CalculatePurchaseResult(attemptedItems []*Item, succes
 
 	for _, item := range attemptedItems {
 		result.Items = append(result.Items, PurchaseItemResult{
-			ID:   item.ID,
-			Name: item.Name,
-			Sold: successMap[item.ID],
+			ID:    item.ID,
+			Name:  item.Name,
+			Price: item.Price,
+			Sold:  successMap[item.ID],
 		})
 	}
 
@@ -83,10 +133,14 @@ type PurchaseResult struct {
 	Items          []PurchaseItemResult `json:"purchased_items"`
 	TotalPurchased int                  `json:"total_purchased"`
 	FailedCount    int                  `json:"failed_count"`
+	Corrupted      bool                 `json:"corrupted,omitempty"`
+	// CorruptionError says why a stored result could not be decoded.
+	CorruptionError string `json:"-"`
 }
 
 type PurchaseItemResult struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Sold bool   `json:"sold"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Price decimal.Decimal `json:"price"`
+	Sold  bool            `json:"sold"`
 }
@@ -0,0 +1,295 @@
+package sale_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+)
+
+const testSaleID = "S-validate001"
+
+var (
+	saleStart = fixtures.BaseTime.Add(-30 * time.Minute)
+	saleEnd   = fixtures.BaseTime.Add(30 * time.Minute)
+)
+
+// newTestSale returns a sale of 100 items running from saleStart to saleEnd
+// with 40 sold, after applying configure to the builder.
+func newTestSale(configure func(b *fixtures.SaleBuilder)) *sale.Sale {
+	b := fixtures.NewSaleBuilder().
+		WithID(testSaleID).
+		Between(saleStart, saleEnd).
+		WithTotalItems(100).
+		WithItemsSold(40).
+		WithLimits(5, 100)
+	if configure != nil {
+		configure(b)
+	}
+	return b.Build()
+}
+
+// testItems returns n unsold items of the sale with the given ID.
+func testItems(saleID string, n int) []*sale.Item {
+	return fixtures.NewSaleBuilder().WithID(saleID).WithItems(n).BuildItems()
+}
+
+func TestValidatePurchase(t *testing.T) {
+	foreign := testItems("S-other001", 1)[0]
+
+	tests := []struct {
+		name    string
+		sale    *sale.Sale
+		now     time.Time
+		limits  sale.UserLimits
+		items   []*sale.Item
+		wantErr error
+		// wantMsg is checked instead of wantErr for errors without a sentinel.
+		wantMsg string
+	}{
+		{
+			name:    "nil sale",
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantMsg: "sale cannot be nil",
+		},
+		{
+			name:    "nil sale without items",
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			wantMsg: "sale cannot be nil",
+		},
+		{
+			name:    "sale not started",
+			sale:    newTestSale(nil),
+			now:     saleStart.Add(-time.Minute),
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleNotActive,
+		},
+		{
+			name:    "at the start instant",
+			sale:    newTestSale(nil),
+			now:     saleStart,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleNotActive,
+		},
+		{
+			name:    "just after the start",
+			sale:    newTestSale(nil),
+			now:     saleStart.Add(time.Nanosecond),
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: nil,
+		},
+		{
+			name:    "sale ended",
+			sale:    newTestSale(nil),
+			now:     saleEnd.Add(time.Minute),
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleNotActive,
+		},
+		{
+			name:    "at the end instant",
+			sale:    newTestSale(nil),
+			now:     saleEnd,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleNotActive,
+		},
+		{
+			name:    "inactive is checked before items",
+			sale:    newTestSale(nil),
+			now:     saleEnd.Add(time.Minute),
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			wantErr: domainErrors.ErrSaleNotActive,
+		},
+		{
+			name:    "no items",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   []*sale.Item{},
+			wantErr: domainErrors.ErrNoItemsToPurchase,
+		},
+		{
+			name:    "nil items",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			wantErr: domainErrors.ErrNoItemsToPurchase,
+		},
+		{
+			name:    "sale limit exceeded",
+			sale:    newTestSale(func(b *fixtures.SaleBuilder) { b.WithItemsSold(99) }),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 2),
+			wantErr: domainErrors.ErrSaleLimitExceeded,
+		},
+		{
+			name:    "sale sold out",
+			sale:    newTestSale(func(b *fixtures.SaleBuilder) { b.WithItemsSold(100) }),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleLimitExceeded,
+		},
+		{
+			name:    "exactly reaching the sale limit",
+			sale:    newTestSale(func(b *fixtures.SaleBuilder) { b.WithItemsSold(98) }),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 2),
+			wantErr: nil,
+		},
+		{
+			name: "total items above the per-sale maximum raise the cap",
+			sale: newTestSale(func(b *fixtures.SaleBuilder) {
+				b.WithLimits(5, 50).WithTotalItems(100).WithItemsSold(60)
+			}),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 2),
+			wantErr: nil,
+		},
+		{
+			name:    "user limit exceeded",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{CurrentItemCount: 4, MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 2),
+			wantErr: domainErrors.ErrUserLimitExceeded,
+		},
+		{
+			name:    "user already at the limit",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{CurrentItemCount: 5, MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrUserLimitExceeded,
+		},
+		{
+			name:    "exactly reaching the user limit",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{CurrentItemCount: 3, MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 2),
+			wantErr: nil,
+		},
+		{
+			name:    "sale limit is checked before the user limit",
+			sale:    newTestSale(func(b *fixtures.SaleBuilder) { b.WithItemsSold(100) }),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{CurrentItemCount: 5, MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: domainErrors.ErrSaleLimitExceeded,
+		},
+		{
+			name:    "item of another sale",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   []*sale.Item{foreign},
+			wantErr: domainErrors.ErrItemNotInSale,
+		},
+		{
+			name:    "one foreign item among several",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   append(testItems(testSaleID, 3), foreign),
+			wantErr: domainErrors.ErrItemNotInSale,
+		},
+		{
+			name:    "single item",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 5},
+			items:   testItems(testSaleID, 1),
+			wantErr: nil,
+		},
+		{
+			name:    "ten items",
+			sale:    newTestSale(nil),
+			now:     fixtures.BaseTime,
+			limits:  sale.UserLimits{MaxItemsPerUser: 10},
+			items:   testItems(testSaleID, 10),
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := sale.NewPurchaseService().WithClock(clock.NewMockClock(tt.now))
+			limits := tt.limits
+
+			err := service.ValidatePurchase(tt.sale, &limits, tt.items)
+
+			if tt.wantMsg != "" {
+				if err == nil || err.Error() != tt.wantMsg {
+					t.Fatalf("error = %v, want %q", err, tt.wantMsg)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// The service reads the injected clock on every call rather than once.
+func TestValidatePurchaseFollowsClock(t *testing.T) {
+	c := clock.NewMockClock(saleStart.Add(-time.Minute))
+	service := sale.NewPurchaseService().WithClock(c)
+	s := newTestSale(nil)
+	items := testItems(testSaleID, 1)
+	limits := &sale.UserLimits{MaxItemsPerUser: 5}
+
+	if err := service.ValidatePurchase(s, limits, items); !errors.Is(err, domainErrors.ErrSaleNotActive) {
+		t.Fatalf("before the start: error = %v, want ErrSaleNotActive", err)
+	}
+	c.Advance(2 * time.Minute)
+	if err := service.ValidatePurchase(s, limits, items); err != nil {
+		t.Fatalf("after the start: error = %v", err)
+	}
+	c.Set(saleEnd)
+	if err := service.ValidatePurchase(s, limits, items); !errors.Is(err, domainErrors.ErrSaleNotActive) {
+		t.Fatalf("at the end: error = %v, want ErrSaleNotActive", err)
+	}
+}
+
+func BenchmarkValidatePurchase(b *testing.B) {
+	service := sale.NewPurchaseService().WithClock(clock.NewMockClock(fixtures.BaseTime))
+	s := newTestSale(nil)
+
+	benchmarks := []struct {
+		name   string
+		limits sale.UserLimits
+		items  []*sale.Item
+	}{
+		{name: "Valid", limits: sale.UserLimits{MaxItemsPerUser: 10}, items: testItems(testSaleID, 10)},
+		{name: "UserLimitExceeded", limits: sale.UserLimits{CurrentItemCount: 5, MaxItemsPerUser: 10}, items: testItems(testSaleID, 10)},
+		// The foreign item is last, so every item is checked.
+		{name: "ForeignLastItem", limits: sale.UserLimits{MaxItemsPerUser: 10}, items: append(testItems(testSaleID, 9), testItems("S-other001", 1)...)},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			limits := bm.limits
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = service.ValidatePurchase(s, &limits, bm.items)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package sale
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type QuotaLease struct {
+	SaleID    string
+	Region    string
+	Quota     int
+	Used      int
+	ExpiresAt time.Time
+	UpdatedAt time.Time
+}
+
+func (l *QuotaLease) Unused() int {
+	if l.Used >= l.Quota {
+		return 0
+	}
+	return l.Quota - l.Used
+}
+
+func (l *QuotaLease) Utilization() float64 {
+	if l.Quota == 0 {
+		return 1
+	}
+	return float64(l.Used) / float64(l.Quota)
+}
+
+func (l *QuotaLease) IsExpired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// SplitQuota divides total across regions proportionally to their weights.
+// Rounding leftovers go to regions in name order so every node computes the
+// same split.
+func SplitQuota(total int, weights map[string]float64) map[string]int {
+	regions := make([]string, 0, len(weights))
+	var sum float64
+	for region, weight := range weights {
+		if weight <= 0 {
+			continue
+		}
+		regions = append(regions, region)
+		sum += weight
+	}
+	sort.Strings(regions)
+
+	quotas := make(map[string]int, len(regions))
+	if len(regions) == 0 {
+		return quotas
+	}
+
+	assigned := 0
+	for _, region := range regions {
+		quota := int(math.Floor(float64(total) * weights[region] / sum))
+		quotas[region] = quota
+		assigned += quota
+	}
+
+	for i := 0; assigned < total; i++ {
+		quotas[regions[i%len(regions)]]++
+		assigned++
+	}
+
+	return quotas
+}
@@ -5,13 +5,29 @@ import (
 	"time"
 )
 
+const (
+	StatusUpcoming = "upcoming"
+	StatusActive   = "active"
+	StatusEnded    = "ended"
+)
+
+// Purchase limits used when a sale is created without its own.
+const (
+	DefaultMaxItemsPerUser = 10
+	DefaultMaxItemsPerSale = 10000
+)
+
 type Sale struct {
 	ID         string // Format: YYYYMMDDHH
+	Category   string // Empty for the default, uncategorised sale
 	StartedAt  time.Time
 	EndedAt    time.Time
 	TotalItems int
 	ItemsSold  int
 	CreatedAt  time.Time
+
+	MaxItemsPerUser int
+	MaxItemsPerSale int
 }
 
 func NewSale(id string, startedAt, endedAt time.Time, totalItems int) (*Sale, error) {
@@ -34,6 +50,9 @@ func NewSale(id string, startedAt, endedAt time.Time, totalItems int) (*Sale, er
 		TotalItems: totalItems,
 		ItemsSold:  0,
 		CreatedAt:  time.Now().UTC(),
+
+		MaxItemsPerUser: DefaultMaxItemsPerUser,
+		MaxItemsPerSale: DefaultMaxItemsPerSale,
 	}, nil
 }
 
@@ -41,6 +60,27 @@ func (s *Sale) IsActive(now time.Time) bool {
 	return now.After(s.StartedAt) && now.Before(s.EndedAt)
 }
 
+func (s *Sale) IsEnded(now time.Time) bool {
+	return s.EndedAt.Before(now)
+}
+
+func (s *Sale) IsUpcoming(now time.Time) bool {
+	return s.StartedAt.After(now)
+}
+
+// Status reports the lifecycle state of the sale at now as one of
+// StatusUpcoming, StatusActive or StatusEnded.
+func (s *Sale) Status(now time.Time) string {
+	switch {
+	case s.IsUpcoming(now):
+		return StatusUpcoming
+	case s.IsEnded(now):
+		return StatusEnded
+	default:
+		return StatusActive
+	}
+}
+
 func (s *Sale) HasAvailableItems() bool {
 	return s.ItemsSold < s.TotalItems
 }
@@ -0,0 +1,257 @@
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	localbloom "github.com/yuzvak/flashsale-service/internal/pkg/bloom"
+)
+
+type staticSource []string
+
+func (s staticSource) GetSoldItemIDs(ctx context.Context) ([]string, error) {
+	return s, nil
+}
+
+func newTestClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func elements(prefix string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s-%d", prefix, i)
+	}
+	return out
+}
+
+// The filters are small enough that probes hit false positives, so agreement
+// covers the hashing scheme and not just the added elements.
+func TestImplementationsAgreeOnMembership(t *testing.T) {
+	const m, k = 512, 4
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	added := elements("item", 100)
+	probes := append(elements("probe", 500), added...)
+
+	local := localbloom.NewBloomFilter(m, k)
+	localCounting := localbloom.NewCountingBloomFilter(m, k)
+	for _, element := range added {
+		local.Add(element)
+		localCounting.Add(element)
+	}
+
+	bits := NewRedisBloomFilter(client, "bloom:bits", m, k)
+	counting := NewRedisCountingBloomFilter(client, "bloom:counting", m, k)
+	if err := bits.AddBatch(ctx, added); err != nil {
+		t.Fatalf("AddBatch bits: %v", err)
+	}
+	if err := counting.AddBatch(ctx, added); err != nil {
+		t.Fatalf("AddBatch counting: %v", err)
+	}
+
+	bitsResult, err := bits.ContainsBatch(ctx, probes)
+	if err != nil {
+		t.Fatalf("ContainsBatch bits: %v", err)
+	}
+	countingResult, err := counting.ContainsBatch(ctx, probes)
+	if err != nil {
+		t.Fatalf("ContainsBatch counting: %v", err)
+	}
+
+	falsePositives := 0
+	for i, probe := range probes {
+		want := local.Contains(probe)
+		if i < 500 && want {
+			falsePositives++
+		}
+
+		if got := localCounting.Contains(probe); got != want {
+			t.Errorf("local counting filter Contains(%q) = %v, local filter says %v", probe, got, want)
+		}
+		if got := bitsResult[probe]; got != want {
+			t.Errorf("Redis filter Contains(%q) = %v, local filter says %v", probe, got, want)
+		}
+		if got := countingResult[probe]; got != want {
+			t.Errorf("Redis counting filter Contains(%q) = %v, local filter says %v", probe, got, want)
+		}
+
+		single, err := bits.Contains(ctx, probe)
+		if err != nil {
+			t.Fatalf("Contains: %v", err)
+		}
+		if single != bitsResult[probe] {
+			t.Errorf("Redis filter Contains(%q) = %v, ContainsBatch says %v", probe, single, bitsResult[probe])
+		}
+	}
+
+	for _, element := range added {
+		if !bitsResult[element] {
+			t.Errorf("added element %q is missing", element)
+		}
+	}
+	if falsePositives == 0 {
+		t.Error("no probe was a false positive, so the filters are too large to compare hashing")
+	}
+}
+
+func TestParameterMismatchIsDetected(t *testing.T) {
+	tests := []struct {
+		name   string
+		m, k   uint64
+		header bool
+		match  bool
+	}{
+		{name: "same parameters", m: 1024, k: 5, header: true, match: true},
+		{name: "different m", m: 2048, k: 5, header: true, match: false},
+		{name: "different k", m: 1024, k: 3, header: true, match: false},
+		{name: "missing header", m: 1024, k: 5, header: false, match: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newTestClient(t)
+
+			old := NewRedisBloomFilter(client, "bloom:sold", 1024, 5)
+			if err := old.EnsureParameters(ctx); err != nil {
+				t.Fatalf("EnsureParameters: %v", err)
+			}
+			if err := old.Add(ctx, "item-1"); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if !tt.header {
+				client.Del(ctx, old.metaKey())
+			}
+
+			filter := NewRedisBloomFilter(client, "bloom:sold", tt.m, tt.k)
+			match, err := filter.ParametersMatch(ctx)
+			if err != nil {
+				t.Fatalf("ParametersMatch: %v", err)
+			}
+			if match != tt.match {
+				t.Errorf("ParametersMatch() = %v, want %v", match, tt.match)
+			}
+		})
+	}
+}
+
+func TestParameterMismatchRebuildsFromSource(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	sold := staticSource(elements("sold", 50))
+
+	old := NewRedisBloomFilter(client, "bloom:sold", 256, 3)
+	if err := old.EnsureParameters(ctx); err != nil {
+		t.Fatalf("EnsureParameters: %v", err)
+	}
+	// Left over from before the rebuild; the source does not list it.
+	if err := old.Add(ctx, "stale"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	filter := NewRedisBloomFilter(client, "bloom:sold", 4096, 6)
+	filter.SetSource(sold)
+	if err := filter.EnsureParameters(ctx); err != nil {
+		t.Fatalf("EnsureParameters: %v", err)
+	}
+
+	match, err := filter.ParametersMatch(ctx)
+	if err != nil {
+		t.Fatalf("ParametersMatch: %v", err)
+	}
+	if !match {
+		t.Fatal("header was not rewritten after the rebuild")
+	}
+
+	reference := localbloom.NewBloomFilter(4096, 6)
+	for _, element := range sold {
+		reference.Add(element)
+	}
+	for _, element := range append([]string{"stale"}, sold...) {
+		got, err := filter.Contains(ctx, element)
+		if err != nil {
+			t.Fatalf("Contains: %v", err)
+		}
+		if want := reference.Contains(element); got != want {
+			t.Errorf("Contains(%q) = %v after rebuild, want %v", element, got, want)
+		}
+	}
+}
+
+func TestRebuildWithoutSourceFails(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	old := NewRedisBloomFilter(client, "bloom:sold", 256, 3)
+	if err := old.EnsureParameters(ctx); err != nil {
+		t.Fatalf("EnsureParameters: %v", err)
+	}
+	if err := old.Add(ctx, "item-1"); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	filter := NewRedisBloomFilter(client, "bloom:sold", 512, 3)
+	if err := filter.EnsureParameters(ctx); err == nil {
+		t.Fatal("EnsureParameters succeeded without a source to rebuild from")
+	}
+}
+
+// Instances sharing a scalable filter follow each other's growth and Clear.
+func TestScalableLayersFollowOtherInstances(t *testing.T) {
+	const prefix = "bloom:{scalable}"
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	grower := NewScalableBloomFilter(client, prefix, 10, 0.01)
+	for i := 0; grower.LayerCount() < 3; i++ {
+		if i == 100 {
+			t.Fatalf("filter has %d layers after %d batches, want 3", grower.LayerCount(), i)
+		}
+		if err := grower.AddBatch(ctx, elements(fmt.Sprintf("batch%d", i), 5)); err != nil {
+			t.Fatalf("AddBatch: %v", err)
+		}
+	}
+
+	other := NewScalableBloomFilter(client, prefix, 10, 0.01)
+	if err := other.syncLayers(ctx, true); err != nil {
+		t.Fatalf("syncLayers: %v", err)
+	}
+	if got := other.LayerCount(); got != 3 {
+		t.Fatalf("other instance sees %d layers, want 3", got)
+	}
+
+	// An instance that never saw the new layers still clears them.
+	fresh := NewScalableBloomFilter(client, prefix, 10, 0.01)
+	if err := fresh.Clear(ctx); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if n, err := client.Exists(ctx, prefix+":2").Result(); err != nil || n != 0 {
+		t.Errorf("newest layer still exists after Clear (%d, %v)", n, err)
+	}
+
+	for name, bf := range map[string]*ScalableBloomFilter{"grower": grower, "other": other} {
+		if err := bf.syncLayers(ctx, true); err != nil {
+			t.Fatalf("syncLayers %s: %v", name, err)
+		}
+		if got := bf.LayerCount(); got != 1 {
+			t.Errorf("%s sees %d layers after another instance's Clear, want 1", name, got)
+		}
+		found, err := bf.Contains(ctx, "batch0-0")
+		if err != nil {
+			t.Fatalf("Contains %s: %v", name, err)
+		}
+		if found {
+			t.Errorf("%s still contains an element added before Clear", name)
+		}
+	}
+}
@@ -2,22 +2,35 @@ package bloom
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/binary"
-	"hash/fnv"
+	"fmt"
 	"math"
+	"strconv"
+	"sync"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/yuzvak/flashsale-service/internal/pkg/hashing"
 )
 
+// filterVersion must be bumped whenever the hashing scheme changes so that
+// filters written by older deployments are rebuilt instead of reused.
+const filterVersion = 1
+
+const migrateBatchSize = 1000
+
+type SoldItemsSource interface {
+	GetSoldItemIDs(ctx context.Context) ([]string, error)
+}
+
 type RedisBloomFilter struct {
-	client *redis.Client
+	client redis.UniversalClient
 	key    string
 	m      uint64 // size in bits
 	k      uint64 // number of hash functions
+	source SoldItemsSource
+	mu     sync.RWMutex
 }
 
-func NewRedisBloomFilter(client *redis.Client, key string, m, k uint64) *RedisBloomFilter {
+func NewRedisBloomFilter(client redis.UniversalClient, key string, m, k uint64) *RedisBloomFilter {
 	return &RedisBloomFilter{
 		client: client,
 		key:    key,
@@ -26,13 +39,20 @@ func NewRedisBloomFilter(client *redis.Client, key string, m, k uint64) *RedisBl
 	}
 }
 
+func (bf *RedisBloomFilter) SetSource(source SoldItemsSource) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	bf.source = source
+}
+
 func (bf *RedisBloomFilter) Add(ctx context.Context, element string) error {
-	hashes := bf.getHashes(element)
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 
 	pipe := bf.client.Pipeline()
 
-	for i := uint64(0); i < bf.k; i++ {
-		bitPos := hashes[i] % bf.m
+	for _, bitPos := range hashing.Locations(element, bf.m, bf.k) {
 		pipe.SetBit(ctx, bf.key, int64(bitPos), 1)
 	}
 
@@ -40,15 +60,58 @@ func (bf *RedisBloomFilter) Add(ctx context.Context, element string) error {
 	return err
 }
 
+// AddBatch sets the bits of every element in a single pipeline.
+func (bf *RedisBloomFilter) AddBatch(ctx context.Context, elements []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	pipe := bf.client.Pipeline()
+
+	for _, element := range elements {
+		for _, bitPos := range hashing.Locations(element, bf.m, bf.k) {
+			pipe.SetBit(ctx, bf.key, int64(bitPos), 1)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// WarmFromDB sets the bits of already sold items in a single transaction,
+// so a filter emptied by a restart never appears partially loaded.
+func (bf *RedisBloomFilter) WarmFromDB(ctx context.Context, itemIDs []string) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	pipe := bf.client.TxPipeline()
+
+	for _, itemID := range itemIDs {
+		for _, bitPos := range hashing.Locations(itemID, bf.m, bf.k) {
+			pipe.SetBit(ctx, bf.key, int64(bitPos), 1)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
 func (bf *RedisBloomFilter) Contains(ctx context.Context, element string) (bool, error) {
-	hashes := bf.getHashes(element)
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 
 	pipe := bf.client.Pipeline()
-	cmds := make([]*redis.IntCmd, bf.k)
+	cmds := make([]*redis.IntCmd, 0, bf.k)
 
-	for i := uint64(0); i < bf.k; i++ {
-		bitPos := hashes[i] % bf.m
-		cmds[i] = pipe.GetBit(ctx, bf.key, int64(bitPos))
+	for _, bitPos := range hashing.Locations(element, bf.m, bf.k) {
+		cmds = append(cmds, pipe.GetBit(ctx, bf.key, int64(bitPos)))
 	}
 
 	_, err := pipe.Exec(ctx)
@@ -65,32 +128,177 @@ func (bf *RedisBloomFilter) Contains(ctx context.Context, element string) (bool,
 	return true, nil
 }
 
+// ContainsBatch checks every element in a single pipeline and reports, per
+// element, whether it is possibly in the set.
+func (bf *RedisBloomFilter) ContainsBatch(ctx context.Context, elements []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(elements))
+	if len(elements) == 0 {
+		return result, nil
+	}
+
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	pipe := bf.client.Pipeline()
+	cmds := make(map[string][]*redis.IntCmd, len(elements))
+
+	for _, element := range elements {
+		if _, seen := cmds[element]; seen {
+			continue
+		}
+		elementCmds := make([]*redis.IntCmd, 0, bf.k)
+		for _, bitPos := range hashing.Locations(element, bf.m, bf.k) {
+			elementCmds = append(elementCmds, pipe.GetBit(ctx, bf.key, int64(bitPos)))
+		}
+		cmds[element] = elementCmds
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for element, elementCmds := range cmds {
+		contains := true
+		for _, cmd := range elementCmds {
+			if cmd.Val() == 0 {
+				contains = false
+				break
+			}
+		}
+		result[element] = contains
+	}
+
+	return result, nil
+}
+
 func (bf *RedisBloomFilter) Clear(ctx context.Context) error {
-	return bf.client.Del(ctx, bf.key).Err()
+	return bf.client.Del(ctx, bf.key, bf.metaKey()).Err()
 }
 
-func (bf *RedisBloomFilter) getHashes(element string) []uint64 {
-	hashes := make([]uint64, bf.k)
+func (bf *RedisBloomFilter) Parameters() (m, k uint64) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 
-	h1 := bf.hash1(element)
-	h2 := bf.hash2(element)
+	return bf.m, bf.k
+}
+
+// ParametersMatch reports whether the header stored next to the filter was
+// written with the same version, m and k as this instance. A missing filter
+// matches trivially; a filter without a header does not.
+func (bf *RedisBloomFilter) ParametersMatch(ctx context.Context) (bool, error) {
+	bf.mu.RLock()
+	m, k := bf.m, bf.k
+	bf.mu.RUnlock()
+
+	meta, err := bf.client.HGetAll(ctx, bf.metaKey()).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if len(meta) == 0 {
+		exists, err := bf.client.Exists(ctx, bf.key).Result()
+		if err != nil {
+			return false, err
+		}
+		return exists == 0, nil
+	}
+
+	return meta["version"] == strconv.Itoa(filterVersion) &&
+		meta["m"] == strconv.FormatUint(m, 10) &&
+		meta["k"] == strconv.FormatUint(k, 10), nil
+}
+
+// EnsureParameters rebuilds the filter from the source of truth when the
+// stored header does not match, and writes the header for a fresh filter.
+func (bf *RedisBloomFilter) EnsureParameters(ctx context.Context) error {
+	match, err := bf.ParametersMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	m, k := bf.Parameters()
+	if !match {
+		return bf.Migrate(ctx, m, k)
+	}
+
+	return bf.writeMeta(ctx, bf.client, m, k)
+}
+
+// Migrate rebuilds the filter with new parameters from the sold items source.
+// Bits are written to a temporary key which then atomically replaces the
+// live filter, so readers never observe a half-built filter.
+func (bf *RedisBloomFilter) Migrate(ctx context.Context, newM, newK uint64) error {
+	if newM == 0 || newK == 0 {
+		return fmt.Errorf("invalid bloom filter parameters: m=%d k=%d", newM, newK)
+	}
+
+	bf.mu.RLock()
+	source := bf.source
+	bf.mu.RUnlock()
+
+	if source == nil {
+		return fmt.Errorf("bloom filter %s has no sold items source to rebuild from", bf.key)
+	}
 
-	for i := uint64(0); i < bf.k; i++ {
-		hashes[i] = h1 + i*h2
+	itemIDs, err := source.GetSoldItemIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load sold items: %w", err)
+	}
+
+	tmpKey := bf.key + ":rebuild"
+	if err := bf.client.Del(ctx, tmpKey).Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(itemIDs); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(itemIDs) {
+			end = len(itemIDs)
+		}
+
+		pipe := bf.client.Pipeline()
+		for _, itemID := range itemIDs[start:end] {
+			for _, bitPos := range hashing.Locations(itemID, newM, newK) {
+				pipe.SetBit(ctx, tmpKey, int64(bitPos), 1)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
 	}
 
-	return hashes
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	pipe := bf.client.TxPipeline()
+	if len(itemIDs) > 0 {
+		pipe.Rename(ctx, tmpKey, bf.key)
+	} else {
+		pipe.Del(ctx, bf.key)
+	}
+	if err := bf.writeMeta(ctx, pipe, newM, newK); err != nil {
+		return err
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	bf.m = newM
+	bf.k = newK
+
+	return nil
 }
 
-func (bf *RedisBloomFilter) hash1(element string) uint64 {
-	h := fnv.New64a()
-	h.Write([]byte(element))
-	return h.Sum64()
+func (bf *RedisBloomFilter) writeMeta(ctx context.Context, cmd redis.Cmdable, m, k uint64) error {
+	return cmd.HSet(ctx, bf.metaKey(),
+		"version", filterVersion,
+		"m", strconv.FormatUint(m, 10),
+		"k", strconv.FormatUint(k, 10),
+	).Err()
 }
 
-func (bf *RedisBloomFilter) hash2(element string) uint64 {
-	h := sha256.Sum256([]byte(element))
-	return binary.BigEndian.Uint64(h[:8])
+func (bf *RedisBloomFilter) metaKey() string {
+	return bf.key + ":meta"
 }
 
 func (bf *RedisBloomFilter) EstimateFalsePositiveRate(elementsAdded uint64) float64 {
@@ -98,9 +306,31 @@ func (bf *RedisBloomFilter) EstimateFalsePositiveRate(elementsAdded uint64) floa
 		return 0.0
 	}
 
-	exponent := -float64(bf.k*elementsAdded) / float64(bf.m)
+	m, k := bf.Parameters()
+	exponent := -float64(k*elementsAdded) / float64(m)
 	base := 1.0 - math.Exp(exponent)
-	return math.Pow(base, float64(bf.k))
+	return math.Pow(base, float64(k))
+}
+
+// EstimateElementCount approximates how many distinct elements have been
+// added from the number of set bits, which stays accurate after restarts
+// and across instances sharing the filter.
+func (bf *RedisBloomFilter) EstimateElementCount(ctx context.Context) (uint64, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	setBits, err := bf.client.BitCount(ctx, bf.key, nil).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	m, k := float64(bf.m), float64(bf.k)
+	if float64(setBits) >= m {
+		return bf.m, nil
+	}
+
+	estimate := -(m / k) * math.Log(1-float64(setBits)/m)
+	return uint64(math.Round(estimate)), nil
 }
 
 func GetOptimalParameters(expectedElements uint64, falsePositiveRate float64) (m, k uint64) {
@@ -0,0 +1,357 @@
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yuzvak/flashsale-service/internal/pkg/hashing"
+)
+
+// countingAddLuaScript increments the counters of each element unless all
+// of them are already non-zero. Sold items are added again whenever a
+// purchase or checkout runs into them; counting those repeats would keep a
+// refunded item in the filter after its single Remove.
+//
+// ARGV[1] is k, followed by k positions per element.
+const countingAddLuaScript = `
+	local k = tonumber(ARGV[1])
+	local added = 0
+
+	for offset = 2, #ARGV, k do
+		local present = true
+		for i = offset, offset + k - 1 do
+			if tonumber(redis.call('HGET', KEYS[1], ARGV[i]) or 0) <= 0 then
+				present = false
+				break
+			end
+		end
+
+		if not present then
+			for i = offset, offset + k - 1 do
+				redis.call('HINCRBY', KEYS[1], ARGV[i], 1)
+			end
+			added = added + 1
+		end
+	end
+
+	return added
+`
+
+// countingRemoveLuaScript decrements the counters of an element that is
+// possibly present. Counters that reach zero are deleted so that HLEN stays
+// the number of occupied positions.
+const countingRemoveLuaScript = `
+	for i = 1, #ARGV do
+		if tonumber(redis.call('HGET', KEYS[1], ARGV[i]) or 0) <= 0 then
+			return 0
+		end
+	end
+
+	for i = 1, #ARGV do
+		if redis.call('HINCRBY', KEYS[1], ARGV[i], -1) <= 0 then
+			redis.call('HDEL', KEYS[1], ARGV[i])
+		end
+	end
+
+	return 1
+`
+
+// RedisCountingBloomFilter is a counting bloom filter stored as a Redis
+// hash from position to counter. Unlike RedisBloomFilter it supports
+// removing elements, at the cost of more memory per position.
+type RedisCountingBloomFilter struct {
+	client redis.UniversalClient
+	key    string
+	m      uint64 // number of counters
+	k      uint64 // number of hash functions
+	source SoldItemsSource
+	mu     sync.RWMutex
+
+	addScript    *redis.Script
+	removeScript *redis.Script
+}
+
+func NewRedisCountingBloomFilter(client redis.UniversalClient, key string, m, k uint64) *RedisCountingBloomFilter {
+	return &RedisCountingBloomFilter{
+		client:       client,
+		key:          key,
+		m:            m,
+		k:            k,
+		addScript:    redis.NewScript(countingAddLuaScript),
+		removeScript: redis.NewScript(countingRemoveLuaScript),
+	}
+}
+
+func (bf *RedisCountingBloomFilter) SetSource(source SoldItemsSource) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	bf.source = source
+}
+
+func (bf *RedisCountingBloomFilter) Add(ctx context.Context, element string) error {
+	return bf.AddBatch(ctx, []string{element})
+}
+
+func (bf *RedisCountingBloomFilter) AddBatch(ctx context.Context, elements []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	args := make([]interface{}, 0, 1+len(elements)*int(bf.k))
+	args = append(args, bf.k)
+	for _, element := range elements {
+		for _, pos := range hashing.Locations(element, bf.m, bf.k) {
+			args = append(args, pos)
+		}
+	}
+
+	return bf.addScript.Run(ctx, bf.client, []string{bf.key}, args...).Err()
+}
+
+// Remove takes element out of the filter. It reports false when the element
+// was definitely not in it, in which case nothing changes.
+func (bf *RedisCountingBloomFilter) Remove(ctx context.Context, element string) (bool, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	args := make([]interface{}, 0, bf.k)
+	for _, pos := range hashing.Locations(element, bf.m, bf.k) {
+		args = append(args, pos)
+	}
+
+	removed, err := bf.removeScript.Run(ctx, bf.client, []string{bf.key}, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+func (bf *RedisCountingBloomFilter) Contains(ctx context.Context, element string) (bool, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	values, err := bf.client.HMGet(ctx, bf.key, bf.fields(element)...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return allPositive(values), nil
+}
+
+// ContainsBatch checks every element in a single pipeline.
+func (bf *RedisCountingBloomFilter) ContainsBatch(ctx context.Context, elements []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(elements))
+	if len(elements) == 0 {
+		return result, nil
+	}
+
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	pipe := bf.client.Pipeline()
+	cmds := make(map[string]*redis.SliceCmd, len(elements))
+
+	for _, element := range elements {
+		if _, seen := cmds[element]; seen {
+			continue
+		}
+		cmds[element] = pipe.HMGet(ctx, bf.key, bf.fields(element)...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for element, cmd := range cmds {
+		result[element] = allPositive(cmd.Val())
+	}
+
+	return result, nil
+}
+
+func (bf *RedisCountingBloomFilter) Clear(ctx context.Context) error {
+	return bf.client.Del(ctx, bf.key, bf.metaKey()).Err()
+}
+
+func (bf *RedisCountingBloomFilter) Parameters() (m, k uint64) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	return bf.m, bf.k
+}
+
+// ParametersMatch reports whether the stored header matches this instance,
+// with the same rules as RedisBloomFilter.ParametersMatch.
+func (bf *RedisCountingBloomFilter) ParametersMatch(ctx context.Context) (bool, error) {
+	bf.mu.RLock()
+	m, k := bf.m, bf.k
+	bf.mu.RUnlock()
+
+	meta, err := bf.client.HGetAll(ctx, bf.metaKey()).Result()
+	if err != nil {
+		return false, err
+	}
+
+	if len(meta) == 0 {
+		exists, err := bf.client.Exists(ctx, bf.key).Result()
+		if err != nil {
+			return false, err
+		}
+		return exists == 0, nil
+	}
+
+	return meta["version"] == strconv.Itoa(filterVersion) &&
+		meta["m"] == strconv.FormatUint(m, 10) &&
+		meta["k"] == strconv.FormatUint(k, 10), nil
+}
+
+func (bf *RedisCountingBloomFilter) EnsureParameters(ctx context.Context) error {
+	match, err := bf.ParametersMatch(ctx)
+	if err != nil {
+		return err
+	}
+
+	m, k := bf.Parameters()
+	if !match {
+		return bf.Migrate(ctx, m, k)
+	}
+
+	return bf.writeMeta(ctx, bf.client, m, k)
+}
+
+// Migrate rebuilds the counters from the sold items source into a
+// temporary key and swaps it in atomically.
+func (bf *RedisCountingBloomFilter) Migrate(ctx context.Context, newM, newK uint64) error {
+	if newM == 0 || newK == 0 {
+		return fmt.Errorf("invalid bloom filter parameters: m=%d k=%d", newM, newK)
+	}
+
+	bf.mu.RLock()
+	source := bf.source
+	bf.mu.RUnlock()
+
+	if source == nil {
+		return fmt.Errorf("bloom filter %s has no sold items source to rebuild from", bf.key)
+	}
+
+	itemIDs, err := source.GetSoldItemIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load sold items: %w", err)
+	}
+
+	tmpKey := bf.key + ":rebuild"
+	if err := bf.client.Del(ctx, tmpKey).Err(); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(itemIDs); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(itemIDs) {
+			end = len(itemIDs)
+		}
+
+		pipe := bf.client.Pipeline()
+		for _, itemID := range itemIDs[start:end] {
+			for _, pos := range hashing.Locations(itemID, newM, newK) {
+				pipe.HIncrBy(ctx, tmpKey, strconv.FormatUint(pos, 10), 1)
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	pipe := bf.client.TxPipeline()
+	if len(itemIDs) > 0 {
+		pipe.Rename(ctx, tmpKey, bf.key)
+	} else {
+		pipe.Del(ctx, bf.key)
+	}
+	if err := bf.writeMeta(ctx, pipe, newM, newK); err != nil {
+		return err
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	bf.m = newM
+	bf.k = newK
+
+	return nil
+}
+
+func (bf *RedisCountingBloomFilter) writeMeta(ctx context.Context, cmd redis.Cmdable, m, k uint64) error {
+	return cmd.HSet(ctx, bf.metaKey(),
+		"version", filterVersion,
+		"m", strconv.FormatUint(m, 10),
+		"k", strconv.FormatUint(k, 10),
+	).Err()
+}
+
+func (bf *RedisCountingBloomFilter) metaKey() string {
+	return bf.key + ":meta"
+}
+
+func (bf *RedisCountingBloomFilter) EstimateFalsePositiveRate(elementsAdded uint64) float64 {
+	if elementsAdded == 0 {
+		return 0.0
+	}
+
+	m, k := bf.Parameters()
+	exponent := -float64(k*elementsAdded) / float64(m)
+	base := 1.0 - math.Exp(exponent)
+	return math.Pow(base, float64(k))
+}
+
+// EstimateElementCount approximates the number of elements from the number
+// of non-zero counters, the same way RedisBloomFilter uses set bits.
+func (bf *RedisCountingBloomFilter) EstimateElementCount(ctx context.Context) (uint64, error) {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	occupied, err := bf.client.HLen(ctx, bf.key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	m, k := float64(bf.m), float64(bf.k)
+	if float64(occupied) >= m {
+		return bf.m, nil
+	}
+
+	estimate := -(m / k) * math.Log(1-float64(occupied)/m)
+	return uint64(math.Round(estimate)), nil
+}
+
+func (bf *RedisCountingBloomFilter) fields(element string) []string {
+	positions := hashing.Locations(element, bf.m, bf.k)
+	fields := make([]string, 0, len(positions))
+	for _, pos := range positions {
+		fields = append(fields, strconv.FormatUint(pos, 10))
+	}
+	return fields
+}
+
+func allPositive(values []interface{}) bool {
+	for _, value := range values {
+		counter, ok := value.(string)
+		if !ok {
+			return false
+		}
+		if n, err := strconv.ParseInt(counter, 10, 64); err != nil || n <= 0 {
+			return false
+		}
+	}
+	return true
+}
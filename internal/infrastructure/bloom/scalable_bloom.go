@@ -0,0 +1,349 @@
+package bloom
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// A layer is considered full once this share of its capacity is used.
+	scalableFillThreshold = 0.8
+	// Each layer holds twice as many elements as the one before it and
+	// has half its false positive rate, so the rates sum to at most the
+	// configured one however many layers there are.
+	scalableGrowthFactor    = 2
+	scalableTighteningRatio = 0.5
+
+	// layerSyncInterval bounds how long an instance may miss a layer added
+	// by another instance sharing the filter.
+	layerSyncInterval = time.Second
+)
+
+// growLuaScript adds a layer only if nobody else has done so since the
+// caller read the layer count, and returns the resulting count.
+const growLuaScript = `
+	local current = tonumber(redis.call('GET', KEYS[1]) or 1)
+	if current == tonumber(ARGV[1]) then
+		current = current + 1
+		redis.call('SET', KEYS[1], current)
+	end
+	return current
+`
+
+// ScalableBloomFilter is a stack of RedisBloomFilter layers that grows as
+// elements are added, keeping the false positive rate bounded. Elements go
+// into the newest layer; lookups check every layer.
+type ScalableBloomFilter struct {
+	client          redis.UniversalClient
+	keyPrefix       string
+	initialCapacity uint64
+	fpRate          float64
+	source          SoldItemsSource
+	growScript      *redis.Script
+
+	mu         sync.RWMutex
+	layers     []*RedisBloomFilter
+	lastSynced time.Time
+}
+
+// NewScalableBloomFilter creates a filter whose first layer is sized for
+// initialCapacity elements. keyPrefix should contain a hash tag so that all
+// layers land in the same cluster slot.
+func NewScalableBloomFilter(client redis.UniversalClient, keyPrefix string, initialCapacity uint64, fpRate float64) *ScalableBloomFilter {
+	bf := &ScalableBloomFilter{
+		client:          client,
+		keyPrefix:       keyPrefix,
+		initialCapacity: initialCapacity,
+		fpRate:          fpRate,
+		growScript:      redis.NewScript(growLuaScript),
+	}
+	bf.layers = []*RedisBloomFilter{bf.newLayer(0)}
+	return bf
+}
+
+// LayerCount returns how many layers this instance currently knows of.
+func (bf *ScalableBloomFilter) LayerCount() int {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	return len(bf.layers)
+}
+
+func (bf *ScalableBloomFilter) SetSource(source SoldItemsSource) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	bf.source = source
+	for _, layer := range bf.layers {
+		layer.SetSource(source)
+	}
+}
+
+func (bf *ScalableBloomFilter) Add(ctx context.Context, element string) error {
+	return bf.AddBatch(ctx, []string{element})
+}
+
+// AddBatch adds elements to the newest layer and starts a new layer once
+// that one passes its fill threshold.
+func (bf *ScalableBloomFilter) AddBatch(ctx context.Context, elements []string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+
+	if err := bf.syncLayers(ctx, false); err != nil {
+		return err
+	}
+
+	bf.mu.RLock()
+	index := len(bf.layers) - 1
+	layer := bf.layers[index]
+	bf.mu.RUnlock()
+
+	if err := layer.AddBatch(ctx, elements); err != nil {
+		return err
+	}
+
+	// Repeated elements are counted again, which only makes growth happen
+	// a little early.
+	added, err := bf.client.IncrBy(ctx, bf.countKey(index), int64(len(elements))).Result()
+	if err != nil {
+		return err
+	}
+
+	if float64(added) < scalableFillThreshold*float64(bf.layerCapacity(index)) {
+		return nil
+	}
+	return bf.grow(ctx, index+1)
+}
+
+func (bf *ScalableBloomFilter) Contains(ctx context.Context, element string) (bool, error) {
+	if err := bf.syncLayers(ctx, false); err != nil {
+		return false, err
+	}
+
+	for _, layer := range bf.snapshot() {
+		found, err := layer.Contains(ctx, element)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+func (bf *ScalableBloomFilter) ContainsBatch(ctx context.Context, elements []string) (map[string]bool, error) {
+	if err := bf.syncLayers(ctx, false); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]bool, len(elements))
+	for _, layer := range bf.snapshot() {
+		found, err := layer.ContainsBatch(ctx, elements)
+		if err != nil {
+			return nil, err
+		}
+		for element, contains := range found {
+			result[element] = result[element] || contains
+		}
+	}
+	return result, nil
+}
+
+// Clear removes every layer, including those added by other instances
+// that this one has not seen yet.
+func (bf *ScalableBloomFilter) Clear(ctx context.Context) error {
+	if err := bf.syncLayers(ctx, true); err != nil {
+		return err
+	}
+	layers := bf.snapshot()
+
+	keys := []string{bf.layersKey()}
+	for i, layer := range layers {
+		keys = append(keys, layer.key, layer.metaKey(), bf.countKey(i))
+	}
+	if err := bf.client.Del(ctx, keys...).Err(); err != nil {
+		return err
+	}
+
+	bf.mu.Lock()
+	bf.layers = bf.layers[:1]
+	bf.mu.Unlock()
+	return nil
+}
+
+// Parameters returns the size and hash count of the newest layer.
+func (bf *ScalableBloomFilter) Parameters() (m, k uint64) {
+	bf.mu.RLock()
+	layer := bf.layers[len(bf.layers)-1]
+	bf.mu.RUnlock()
+
+	return layer.Parameters()
+}
+
+// ParametersMatch checks the first layer; later layers are derived from
+// the same settings, so they match whenever it does.
+func (bf *ScalableBloomFilter) ParametersMatch(ctx context.Context) (bool, error) {
+	return bf.snapshot()[0].ParametersMatch(ctx)
+}
+
+// EnsureParameters rebuilds every layer from the source when the stored
+// settings differ. The rebuild is not atomic; while it runs lookups may
+// miss sold items and fall through to the database.
+func (bf *ScalableBloomFilter) EnsureParameters(ctx context.Context) error {
+	match, err := bf.ParametersMatch(ctx)
+	if err != nil {
+		return err
+	}
+	if match {
+		if err := bf.syncLayers(ctx, true); err != nil {
+			return err
+		}
+		first := bf.snapshot()[0]
+		m, k := first.Parameters()
+		return first.writeMeta(ctx, bf.client, m, k)
+	}
+
+	bf.mu.RLock()
+	source := bf.source
+	bf.mu.RUnlock()
+	if source == nil {
+		return fmt.Errorf("bloom filter %s has no sold items source to rebuild from", bf.keyPrefix)
+	}
+
+	itemIDs, err := source.GetSoldItemIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load sold items: %w", err)
+	}
+
+	if err := bf.Clear(ctx); err != nil {
+		return err
+	}
+	first := bf.snapshot()[0]
+	m, k := first.Parameters()
+	if err := first.writeMeta(ctx, bf.client, m, k); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(itemIDs); start += migrateBatchSize {
+		end := start + migrateBatchSize
+		if end > len(itemIDs) {
+			end = len(itemIDs)
+		}
+		if err := bf.AddBatch(ctx, itemIDs[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EstimateFalsePositiveRate combines the rates of the layers, assuming the
+// elements filled them in order up to their thresholds.
+func (bf *ScalableBloomFilter) EstimateFalsePositiveRate(elementsAdded uint64) float64 {
+	layers := bf.snapshot()
+
+	missAll := 1.0
+	remaining := elementsAdded
+	for i, layer := range layers {
+		inLayer := remaining
+		if i < len(layers)-1 {
+			limit := uint64(scalableFillThreshold * float64(bf.layerCapacity(i)))
+			if inLayer > limit {
+				inLayer = limit
+			}
+		}
+		remaining -= inLayer
+		missAll *= 1 - layer.EstimateFalsePositiveRate(inLayer)
+	}
+	return 1 - missAll
+}
+
+func (bf *ScalableBloomFilter) EstimateElementCount(ctx context.Context) (uint64, error) {
+	var total uint64
+	for _, layer := range bf.snapshot() {
+		count, err := layer.EstimateElementCount(ctx)
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+func (bf *ScalableBloomFilter) grow(ctx context.Context, known int) error {
+	count, err := bf.growScript.Run(ctx, bf.client, []string{bf.layersKey()}, known).Int()
+	if err != nil {
+		return err
+	}
+	bf.setLayerCount(count)
+	return nil
+}
+
+// syncLayers picks up layers added by other instances, and drops layers
+// another instance's Clear removed. Unless forced it reads the shared count
+// at most once per layerSyncInterval.
+func (bf *ScalableBloomFilter) syncLayers(ctx context.Context, force bool) error {
+	bf.mu.RLock()
+	fresh := time.Since(bf.lastSynced) < layerSyncInterval
+	bf.mu.RUnlock()
+	if fresh && !force {
+		return nil
+	}
+
+	count, err := bf.client.Get(ctx, bf.layersKey()).Int()
+	if err == redis.Nil {
+		count = 1
+	} else if err != nil {
+		return err
+	}
+
+	bf.setLayerCount(count)
+	return nil
+}
+
+func (bf *ScalableBloomFilter) setLayerCount(count int) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+
+	if count < 1 {
+		count = 1
+	}
+	if len(bf.layers) > count {
+		bf.layers = bf.layers[:count]
+	}
+	for len(bf.layers) < count {
+		layer := bf.newLayer(len(bf.layers))
+		layer.SetSource(bf.source)
+		bf.layers = append(bf.layers, layer)
+	}
+	bf.lastSynced = time.Now()
+}
+
+func (bf *ScalableBloomFilter) snapshot() []*RedisBloomFilter {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
+
+	return append([]*RedisBloomFilter(nil), bf.layers...)
+}
+
+func (bf *ScalableBloomFilter) newLayer(index int) *RedisBloomFilter {
+	fpRate := bf.fpRate * (1 - scalableTighteningRatio) * math.Pow(scalableTighteningRatio, float64(index))
+	m, k := GetOptimalParameters(bf.layerCapacity(index), fpRate)
+	return NewRedisBloomFilter(bf.client, bf.keyPrefix+":"+strconv.Itoa(index), m, k)
+}
+
+func (bf *ScalableBloomFilter) layerCapacity(index int) uint64 {
+	return bf.initialCapacity * uint64(math.Pow(scalableGrowthFactor, float64(index)))
+}
+
+func (bf *ScalableBloomFilter) layersKey() string {
+	return bf.keyPrefix + ":layers"
+}
+
+func (bf *ScalableBloomFilter) countKey(index int) string {
+	return bf.keyPrefix + ":" + strconv.Itoa(index) + ":count"
+}
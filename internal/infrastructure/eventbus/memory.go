@@ -0,0 +1,65 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/events"
+)
+
+var _ ports.EventBus = (*MemoryBus)(nil)
+
+// MemoryBus is an in-process EventBus. Handlers run synchronously on the
+// publishing goroutine, so Publish returns only after every handler is done.
+type MemoryBus struct {
+	mu       sync.RWMutex
+	handlers map[string][]func(event interface{}) error
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		handlers: make(map[string][]func(event interface{}) error),
+	}
+}
+
+func (b *MemoryBus) Subscribe(eventType string, handler func(event interface{}) error) error {
+	if eventType == "" {
+		return errors.New("event type is required")
+	}
+	if handler == nil {
+		return errors.New("handler is required")
+	}
+
+	b.mu.Lock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+	b.mu.Unlock()
+	return nil
+}
+
+// Publish runs every handler subscribed to the event's type, even when some
+// of them fail, and returns their errors joined together.
+func (b *MemoryBus) Publish(ctx context.Context, event interface{}) error {
+	eventType := events.TypeOf(event)
+	if eventType == "" {
+		return fmt.Errorf("unknown event %T", event)
+	}
+
+	b.mu.RLock()
+	handlers := b.handlers[eventType]
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, handler := range handlers {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := handler(event); err != nil {
+			errs = append(errs, fmt.Errorf("%s handler: %w", eventType, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
@@ -15,35 +21,153 @@ import (
 )
 
 type AdminHandler struct {
-	saleRepo      *postgres.SaleRepository
-	itemGenerator *generator.ItemGenerator
-	codeGenerator *generator.CodeGenerator
-	logger        *logger.Logger
+	saleRepo         *postgres.SaleRepository
+	purchaseRepo     *postgres.PurchaseRepository
+	checkoutRepo     *postgres.CheckoutRepository
+	purchaseExporter ports.PurchaseExporter
+	cache            ports.Cache
+	purchaseSvc      *sale.PurchaseService
+	itemGenerator    *generator.ItemGenerator
+	codeGenerator    *generator.CodeGenerator
+	logger           *logger.Logger
 }
 
 func NewAdminHandler(
 	saleRepo *postgres.SaleRepository,
+	purchaseRepo *postgres.PurchaseRepository,
+	checkoutRepo *postgres.CheckoutRepository,
+	cache ports.Cache,
+	refundWindow time.Duration,
 	logger *logger.Logger,
 ) *AdminHandler {
 	return &AdminHandler{
-		saleRepo:      saleRepo,
-		itemGenerator: generator.NewItemGenerator(),
-		codeGenerator: generator.NewCodeGenerator(),
-		logger:        logger,
+		saleRepo:         saleRepo,
+		purchaseRepo:     purchaseRepo,
+		checkoutRepo:     checkoutRepo,
+		purchaseExporter: purchaseRepo,
+		cache:            cache,
+		purchaseSvc:      sale.NewPurchaseService().WithRefundWindow(refundWindow),
+		itemGenerator:    generator.NewItemGenerator(),
+		codeGenerator:    generator.NewCodeGenerator(nil, ""),
+		logger:           logger,
 	}
 }
 
 type CreateSaleRequest struct {
+	Category   string `json:"category,omitempty"`
 	StartedAt  string `json:"started_at,omitempty"`
 	EndedAt    string `json:"ended_at,omitempty"`
 	TotalItems int    `json:"total_items"`
+	// Price, when set, is used for every item instead of a generated price.
+	// Description and Metadata likewise apply to every generated item.
+	Price       *decimal.Decimal       `json:"price,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+
+	// Purchase limits for this sale; zero uses the service defaults.
+	MaxItemsPerUser int `json:"max_items_per_user,omitempty"`
+	MaxItemsPerSale int `json:"max_items_per_sale,omitempty"`
 }
 
 type CreateSaleResponse struct {
 	ID         string `json:"id"`
+	Category   string `json:"category,omitempty"`
 	StartedAt  string `json:"started_at"`
 	EndedAt    string `json:"ended_at"`
 	TotalItems int    `json:"total_items"`
+
+	MaxItemsPerUser int `json:"max_items_per_user"`
+	MaxItemsPerSale int `json:"max_items_per_sale"`
+}
+
+type UpdateSaleRequest struct {
+	StartedAt  *string `json:"started_at,omitempty"`
+	EndedAt    *string `json:"ended_at,omitempty"`
+	TotalItems *int    `json:"total_items,omitempty"`
+}
+
+type UpdateSaleResponse struct {
+	ID         string `json:"id"`
+	StartedAt  string `json:"started_at"`
+	EndedAt    string `json:"ended_at"`
+	TotalItems int    `json:"total_items"`
+	ItemsSold  int    `json:"items_sold"`
+}
+
+type ListSalesResponse struct {
+	Data       []SaleResponse `json:"data"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+type RefundResponse struct {
+	ItemID string `json:"item_id"`
+	SaleID string `json:"sale_id"`
+	UserID string `json:"user_id"`
+}
+
+type CancelSaleResponse struct {
+	ID        string `json:"id"`
+	EndedAt   string `json:"ended_at"`
+	ItemsSold int    `json:"items_sold"`
+}
+
+type ItemDefinition struct {
+	Name        string                 `json:"name"`
+	ImageURL    string                 `json:"image_url"`
+	Price       *decimal.Decimal       `json:"price,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type AddItemsRequest struct {
+	Count int              `json:"count"`
+	Items []ItemDefinition `json:"-"`
+}
+
+type AddItemsResponse struct {
+	SaleID     string   `json:"sale_id"`
+	ItemsAdded int      `json:"items_added"`
+	TotalItems int      `json:"total_items"`
+	ItemIDs    []string `json:"item_ids"`
+}
+
+type SaleStatsResponse struct {
+	SaleID              string `json:"sale_id"`
+	Status              string `json:"status"`
+	TotalItems          int    `json:"total_items"`
+	ItemsSold           int    `json:"items_sold"`
+	ActiveCheckouts     int    `json:"active_checkouts"`
+	ActiveCheckoutItems int    `json:"active_checkout_items"`
+}
+
+type PurchaseStatsResponse struct {
+	SaleID         string                         `json:"sale_id"`
+	TotalPurchases int                            `json:"total_purchases"`
+	UniqueUsers    int                            `json:"unique_users"`
+	TopItems       []postgres.ItemPurchaseCount   `json:"top_items"`
+	TopUsers       []postgres.UserPurchaseCount   `json:"top_users"`
+	HourlyCounts   []postgres.HourlyPurchaseCount `json:"hourly_counts"`
+}
+
+type PurchaseTimeSeriesResponse struct {
+	SaleID        string                    `json:"sale_id"`
+	From          string                    `json:"from"`
+	To            string                    `json:"to"`
+	BucketMinutes int                       `json:"bucket_minutes"`
+	Buckets       []postgres.PurchaseBucket `json:"buckets"`
+}
+
+const (
+	defaultTimeSeriesBucketMinutes = 5
+	// maxTimeSeriesBuckets bounds the buckets one request can ask for.
+	maxTimeSeriesBuckets = 10000
+)
+
+type PurchaseResultDetailResponse struct {
+	CheckoutCode string               `json:"checkout_code"`
+	Valid        bool                 `json:"valid"`
+	Raw          string               `json:"raw"`
+	Result       *sale.PurchaseResult `json:"result,omitempty"`
 }
 
 func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request) {
@@ -51,7 +175,7 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 
 	var req CreateSaleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.WriteError(w, http.StatusBadRequest, response.StatusValidationError, "Invalid request body", err.Error())
+		response.WriteBodyError(w, err)
 		return
 	}
 
@@ -59,6 +183,18 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 	if req.TotalItems <= 0 {
 		validationErrors["total_items"] = "Total items must be greater than 0"
 	}
+	if len(req.Category) > 64 {
+		validationErrors["category"] = "Category must be at most 64 characters"
+	}
+	if req.Price != nil && req.Price.IsNegative() {
+		validationErrors["price"] = "Price must not be negative"
+	}
+	if req.MaxItemsPerUser < 0 {
+		validationErrors["max_items_per_user"] = "Max items per user must not be negative"
+	}
+	if req.MaxItemsPerSale < 0 {
+		validationErrors["max_items_per_sale"] = "Max items per sale must not be negative"
+	}
 
 	var startedAt, endedAt time.Time
 	var err error
@@ -97,14 +233,24 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 
 	newSale := sale.Sale{
 		ID:         saleID,
+		Category:   req.Category,
 		StartedAt:  startedAt,
 		EndedAt:    endedAt,
 		TotalItems: req.TotalItems,
 		ItemsSold:  0,
 		CreatedAt:  time.Now(),
+
+		MaxItemsPerUser: sale.DefaultMaxItemsPerUser,
+		MaxItemsPerSale: sale.DefaultMaxItemsPerSale,
+	}
+	if req.MaxItemsPerUser > 0 {
+		newSale.MaxItemsPerUser = req.MaxItemsPerUser
+	}
+	if req.MaxItemsPerSale > 0 {
+		newSale.MaxItemsPerSale = req.MaxItemsPerSale
 	}
 
-	activeSale, err := h.saleRepo.GetActiveSale(ctx)
+	activeSale, err := h.saleRepo.GetActiveSaleByCategory(ctx, req.Category)
 	if err != nil && !errors.Is(err, domainErrors.ErrSaleNotFound) {
 		h.logger.Error("Failed to check active sales", map[string]interface{}{"error": err.Error()})
 		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to check active sales", err.Error())
@@ -112,7 +258,7 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 	}
 
 	if activeSale != nil {
-		response.WriteError(w, http.StatusConflict, response.StatusValidationError, "Cannot create new sale", "A sale is currently active. Wait until it ends before creating a new one.")
+		response.WriteError(w, http.StatusConflict, response.StatusValidationError, "Cannot create new sale", "A sale in this category is currently active. Wait until it ends before creating a new one.")
 		return
 	}
 
@@ -125,11 +271,17 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 
 	items := make([]*sale.Item, 0, req.TotalItems)
 	for i := 0; i < req.TotalItems; i++ {
-		item := sale.NewItem(h.itemGenerator.GenerateItemID(), newSale.ID, h.itemGenerator.GenerateName(), h.itemGenerator.GenerateImageURL())
+		item := sale.NewItem(h.itemGenerator.GenerateItemID(), newSale.ID, h.itemGenerator.GenerateName(), h.itemGenerator.GenerateImageURL(), h.itemPrice(req.Price))
+		item.Description = req.Description
+		item.Metadata = req.Metadata
 		items = append(items, item)
 	}
 
-	err = h.saleRepo.CreateItems(ctx, items)
+	if len(items) > postgres.CopyInsertThreshold {
+		err = h.saleRepo.CreateItemsWithCopy(ctx, items)
+	} else {
+		err = h.saleRepo.CreateItems(ctx, items)
+	}
 	if err != nil {
 		h.logger.Error("Failed to create items", map[string]interface{}{"error": err.Error(), "sale_id": saleID})
 		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to create items", err.Error())
@@ -138,10 +290,725 @@ func (h *AdminHandler) HandleCreateSale(w http.ResponseWriter, r *http.Request)
 
 	saleResponse := CreateSaleResponse{
 		ID:         saleID,
+		Category:   req.Category,
 		StartedAt:  startedAt.Format(time.RFC3339),
 		EndedAt:    endedAt.Format(time.RFC3339),
 		TotalItems: req.TotalItems,
+
+		MaxItemsPerUser: newSale.MaxItemsPerUser,
+		MaxItemsPerSale: newSale.MaxItemsPerSale,
 	}
 
 	response.WriteJSON(w, http.StatusCreated, response.Success(saleResponse, "Sale created successfully"))
 }
+
+func (h *AdminHandler) HandleUpdateSale(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	saleID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/sales/"), "/")
+
+	if saleID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"sale_id": "Sale ID is required",
+		})
+		return
+	}
+
+	var req UpdateSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBodyError(w, err)
+		return
+	}
+
+	// The row stays locked until the update commits, so purchases cannot
+	// raise items_sold between the read and the write.
+	txRepo, err := h.saleRepo.BeginTx(ctx)
+	if err != nil {
+		h.logger.Error("Failed to begin transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to update sale", err.Error())
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txRepo.RollbackTx(ctx)
+		}
+	}()
+
+	existingSale, err := txRepo.GetSaleByIDForUpdate(ctx, saleID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	validationErrors := make(map[string]string)
+	startedAt := existingSale.StartedAt
+	endedAt := existingSale.EndedAt
+	totalItems := existingSale.TotalItems
+
+	if req.StartedAt != nil {
+		startedAt, err = time.Parse(time.RFC3339, *req.StartedAt)
+		if err != nil {
+			validationErrors["started_at"] = "Invalid started_at time format (use RFC3339)"
+		}
+	}
+
+	if req.EndedAt != nil {
+		endedAt, err = time.Parse(time.RFC3339, *req.EndedAt)
+		if err != nil {
+			validationErrors["ended_at"] = "Invalid ended_at time format (use RFC3339)"
+		} else if endedAt.Before(time.Now().UTC()) {
+			validationErrors["ended_at"] = "ended_at cannot be in the past"
+		}
+	}
+
+	if req.TotalItems != nil {
+		totalItems = *req.TotalItems
+		if totalItems < existingSale.ItemsSold {
+			validationErrors["total_items"] = "Total items cannot be less than items already sold"
+		}
+	}
+
+	if _, ok := validationErrors["started_at"]; !ok && !startedAt.Before(endedAt) {
+		validationErrors["started_at"] = "started_at must be before ended_at"
+	}
+
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	previousEndedAt := existingSale.EndedAt
+
+	existingSale.StartedAt = startedAt
+	existingSale.EndedAt = endedAt
+	existingSale.TotalItems = totalItems
+
+	if err := txRepo.UpdateSale(ctx, existingSale); err != nil {
+		h.logger.Error("Failed to update sale", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to update sale", err.Error())
+		return
+	}
+
+	if err := txRepo.CommitTx(ctx); err != nil {
+		h.logger.Error("Failed to commit transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to update sale", err.Error())
+		return
+	}
+	committed = true
+
+	if !endedAt.Equal(previousEndedAt) {
+		if err := h.cache.ExtendSaleCheckoutTTLs(ctx, saleID, previousEndedAt, endedAt); err != nil {
+			h.logger.Error("Failed to update checkout TTLs", "error", err.Error(), "sale_id", saleID)
+		}
+	}
+
+	saleResponse := UpdateSaleResponse{
+		ID:         existingSale.ID,
+		StartedAt:  existingSale.StartedAt.Format(time.RFC3339),
+		EndedAt:    existingSale.EndedAt.Format(time.RFC3339),
+		TotalItems: existingSale.TotalItems,
+		ItemsSold:  existingSale.ItemsSold,
+	}
+
+	response.WriteSuccess(w, saleResponse, "Sale updated successfully")
+}
+
+func (h *AdminHandler) HandleListSales(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	validationErrors := make(map[string]string)
+
+	status := query.Get("status")
+	switch status {
+	case "", postgres.SaleStatusActive, postgres.SaleStatusUpcoming, postgres.SaleStatusEnded:
+	default:
+		validationErrors["status"] = "status must be one of active, upcoming or ended"
+	}
+
+	limit := defaultItemsLimit
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			validationErrors["limit"] = "limit must be a positive integer"
+		} else if parsed > maxItemsLimit {
+			limit = maxItemsLimit
+		} else {
+			limit = parsed
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	// One extra row tells whether another page follows.
+	sales, err := h.saleRepo.ListSales(ctx, status, query.Get("cursor"), limit+1)
+	if err != nil {
+		h.logger.Error("Failed to list sales", "error", err.Error(), "status", status)
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	listResponse := ListSalesResponse{Data: make([]SaleResponse, 0, len(sales))}
+	if len(sales) > limit {
+		sales = sales[:limit]
+		listResponse.NextCursor = sales[limit-1].ID
+	}
+
+	now := time.Now().UTC()
+	for _, s := range sales {
+		listResponse.Data = append(listResponse.Data, SaleResponse{
+			ID:         s.ID,
+			Category:   s.Category,
+			StartedAt:  s.StartedAt.Format(time.RFC3339),
+			EndedAt:    s.EndedAt.Format(time.RFC3339),
+			TotalItems: s.TotalItems,
+			ItemsSold:  s.ItemsSold,
+			Status:     s.Status(now),
+
+			MaxItemsPerUser: s.MaxItemsPerUser,
+			MaxItemsPerSale: s.MaxItemsPerSale,
+		})
+	}
+
+	response.WriteSuccess(w, listResponse)
+}
+
+// HandleCancelSale ends a sale immediately and drops its Redis state, which
+// would otherwise linger until the keys expire.
+func (h *AdminHandler) HandleCancelSale(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	if saleID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"sale_id": "Sale ID is required",
+		})
+		return
+	}
+
+	// As in HandleUpdateSale, the row stays locked until the cancellation
+	// commits, so a purchase's items_sold is not overwritten.
+	txRepo, err := h.saleRepo.BeginTx(ctx)
+	if err != nil {
+		h.logger.Error("Failed to begin transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to cancel sale", err.Error())
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txRepo.RollbackTx(ctx)
+		}
+	}()
+
+	existingSale, err := txRepo.GetSaleByIDForUpdate(ctx, saleID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	if !existingSale.EndedAt.After(now) {
+		response.WriteError(w, http.StatusConflict, response.StatusConflict, "Sale has already ended")
+		return
+	}
+
+	existingSale.EndedAt = now
+	if existingSale.StartedAt.After(now) {
+		existingSale.StartedAt = now
+	}
+
+	if err := txRepo.UpdateSale(ctx, existingSale); err != nil {
+		h.logger.Error("Failed to cancel sale", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to cancel sale", err.Error())
+		return
+	}
+
+	if err := txRepo.CommitTx(ctx); err != nil {
+		h.logger.Error("Failed to commit transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to cancel sale", err.Error())
+		return
+	}
+	committed = true
+
+	if err := h.cache.PurgeSaleData(ctx, saleID); err != nil {
+		h.logger.Error("Failed to purge sale data from cache", "error", err.Error(), "sale_id", saleID)
+	}
+
+	h.logger.Info("Sale cancelled", "sale_id", saleID, "items_sold", existingSale.ItemsSold)
+
+	response.WriteSuccess(w, CancelSaleResponse{
+		ID:        existingSale.ID,
+		EndedAt:   existingSale.EndedAt.Format(time.RFC3339),
+		ItemsSold: existingSale.ItemsSold,
+	}, "Sale cancelled successfully")
+}
+
+// HandleGetSaleStats reports a sale's progress along with the checkouts it
+// currently holds.
+func (h *AdminHandler) HandleGetSaleStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	existingSale, err := h.saleRepo.GetSaleByID(ctx, saleID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	checkouts, err := h.checkoutRepo.CountActiveCheckoutsBySale(ctx, saleID)
+	if err != nil {
+		h.logger.Error("Failed to count active checkouts", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to get sale stats", err.Error())
+		return
+	}
+
+	items, err := h.checkoutRepo.CountActiveCheckoutItemsBySale(ctx, saleID)
+	if err != nil {
+		h.logger.Error("Failed to count active checkout items", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to get sale stats", err.Error())
+		return
+	}
+
+	response.WriteSuccess(w, SaleStatsResponse{
+		SaleID:              saleID,
+		Status:              existingSale.Status(time.Now().UTC()),
+		TotalItems:          existingSale.TotalItems,
+		ItemsSold:           existingSale.ItemsSold,
+		ActiveCheckouts:     checkouts,
+		ActiveCheckoutItems: items,
+	})
+}
+
+func (h *AdminHandler) HandleGetPurchaseStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	if _, err := h.saleRepo.GetSaleByID(ctx, saleID); err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	stats, err := h.purchaseRepo.GetPurchaseStats(ctx, saleID)
+	if err != nil {
+		h.logger.Error("Failed to get purchase stats", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to get purchase stats", err.Error())
+		return
+	}
+
+	response.WriteSuccess(w, PurchaseStatsResponse{
+		SaleID:         saleID,
+		TotalPurchases: stats.TotalPurchases,
+		UniqueUsers:    stats.UniqueUsers,
+		TopItems:       stats.TopItems,
+		TopUsers:       stats.TopUsers,
+		HourlyCounts:   stats.HourlyCounts,
+	})
+}
+
+// HandleGetPurchaseTimeSeries counts a sale's purchases per time bucket.
+// from and to default to the sale's start and end.
+func (h *AdminHandler) HandleGetPurchaseTimeSeries(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	existingSale, err := h.saleRepo.GetSaleByID(ctx, saleID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	validationErrors := make(map[string]string)
+
+	from := existingSale.StartedAt
+	if raw := query.Get("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			validationErrors["from"] = "from must be an RFC 3339 timestamp"
+		} else {
+			from = parsed
+		}
+	}
+
+	to := existingSale.EndedAt
+	if raw := query.Get("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			validationErrors["to"] = "to must be an RFC 3339 timestamp"
+		} else {
+			to = parsed
+		}
+	}
+
+	bucketMinutes := defaultTimeSeriesBucketMinutes
+	if raw := query.Get("bucket_minutes"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			validationErrors["bucket_minutes"] = "bucket_minutes must be a positive integer"
+		} else {
+			bucketMinutes = parsed
+		}
+	}
+
+	if len(validationErrors) == 0 {
+		bucket := time.Duration(bucketMinutes) * time.Minute
+		if !to.After(from) {
+			validationErrors["to"] = "to must be after from"
+		} else if to.Sub(from)/bucket > maxTimeSeriesBuckets {
+			validationErrors["bucket_minutes"] = fmt.Sprintf("the range spans more than %d buckets", maxTimeSeriesBuckets)
+		}
+	}
+
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	buckets, err := h.purchaseRepo.GetPurchasesInTimeRange(ctx, saleID, from, to, bucketMinutes)
+	if err != nil {
+		h.logger.Error("Failed to get purchase time series", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to get purchase time series", err.Error())
+		return
+	}
+
+	response.WriteSuccess(w, PurchaseTimeSeriesResponse{
+		SaleID:        saleID,
+		From:          from.UTC().Format(time.RFC3339),
+		To:            to.UTC().Format(time.RFC3339),
+		BucketMinutes: bucketMinutes,
+		Buckets:       buckets,
+	})
+}
+
+// HandleRefund reverses the purchase of one item. With the counting bloom
+// filter enabled the item is removed from the sold items filter and can be
+// checked out again; the plain filter cannot forget it, so there the item
+// stays unavailable to checkout until the filter is rebuilt.
+func (h *AdminHandler) HandleRefund(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID := r.URL.Query().Get("item_id")
+	userID := r.URL.Query().Get("user_id")
+
+	validationErrors := make(map[string]string)
+	if itemID == "" {
+		validationErrors["item_id"] = "Item ID is required"
+	}
+	if userID == "" {
+		validationErrors["user_id"] = "User ID is required"
+	}
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	item, err := h.saleRepo.GetItemByID(ctx, itemID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrItemNotFound) {
+			h.logger.Error("Failed to get item", "error", err.Error(), "item_id", itemID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	saleEntity, err := h.saleRepo.GetSaleByID(ctx, item.SaleID)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", item.SaleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	if err := h.purchaseSvc.ValidateRefund(saleEntity, item, userID); err != nil {
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	if err := h.saleRepo.MarkItemAsUnsold(ctx, itemID, userID); err != nil {
+		if !errors.Is(err, domainErrors.ErrItemNotSold) {
+			h.logger.Error("Failed to refund item", "error", err.Error(), "item_id", itemID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	if err := h.cache.DecrementCounters(ctx, saleEntity.ID, userID, 1); err != nil {
+		h.logger.Error("Failed to decrement purchase counters", "error", err.Error(), "sale_id", saleEntity.ID, "user_id", userID)
+	}
+	if err := h.cache.RemoveItemFromBloomFilter(ctx, saleEntity.ID, itemID); err != nil {
+		h.logger.Error("Failed to remove item from bloom filter", "error", err.Error(), "item_id", itemID)
+	}
+	// A negative count hands the item back to the remaining counter.
+	if err := h.cache.DecrementSaleRemaining(ctx, saleEntity.ID, -1); err != nil {
+		h.logger.Error("Failed to update remaining items count", "error", err.Error(), "sale_id", saleEntity.ID)
+	}
+
+	h.logger.Info("Item refunded", "item_id", itemID, "sale_id", saleEntity.ID, "user_id", userID)
+
+	response.WriteSuccess(w, RefundResponse{
+		ItemID: itemID,
+		SaleID: saleEntity.ID,
+		UserID: userID,
+	}, "Item refunded successfully")
+}
+
+func (h *AdminHandler) HandleAddItemsToSale(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	if saleID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"sale_id": "Sale ID is required",
+		})
+		return
+	}
+
+	req, err := decodeAddItemsRequest(r)
+	if err != nil {
+		response.WriteBodyError(w, err)
+		return
+	}
+
+	validationErrors := make(map[string]string)
+	if req.Items == nil && req.Count <= 0 {
+		validationErrors["count"] = "Count must be greater than 0"
+	}
+	if req.Items != nil && len(req.Items) == 0 {
+		validationErrors["items"] = "At least one item definition is required"
+	}
+	for i, def := range req.Items {
+		if def.Price != nil && def.Price.IsNegative() {
+			validationErrors[fmt.Sprintf("items[%d].price", i)] = "Price must not be negative"
+		}
+	}
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	items := h.buildItems(saleID, req)
+
+	existingSale := h.appendItems(w, r, saleID, items, ports.SaleRepository.CreateItems)
+	if existingSale == nil {
+		return
+	}
+
+	itemIDs := make([]string, 0, len(items))
+	for _, item := range items {
+		itemIDs = append(itemIDs, item.ID)
+	}
+
+	response.WriteJSON(w, http.StatusCreated, response.Success(AddItemsResponse{
+		SaleID:     saleID,
+		ItemsAdded: len(items),
+		TotalItems: existingSale.TotalItems,
+		ItemIDs:    itemIDs,
+	}, "Items added successfully"))
+}
+
+// appendItems stores items in the sale with create and raises its total in
+// one transaction, then refreshes the cached counts. On failure it writes
+// the error response and returns nil.
+func (h *AdminHandler) appendItems(
+	w http.ResponseWriter,
+	r *http.Request,
+	saleID string,
+	items []*sale.Item,
+	create func(ports.SaleRepository, context.Context, []*sale.Item) error,
+) *sale.Sale {
+	ctx := r.Context()
+
+	txRepo, err := h.saleRepo.BeginTx(ctx)
+	if err != nil {
+		h.logger.Error("Failed to begin transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to add items", err.Error())
+		return nil
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = txRepo.RollbackTx(ctx)
+		}
+	}()
+
+	// The increment locks the sale row, so the end check below and the
+	// inserted items cannot race a concurrent update of the sale.
+	existingSale, err := txRepo.IncrementSaleTotalItems(ctx, saleID, len(items))
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to update sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return nil
+	}
+
+	if !existingSale.EndedAt.After(time.Now().UTC()) {
+		response.WriteError(w, http.StatusConflict, response.StatusConflict, "Cannot add items", "Sale has already ended")
+		return nil
+	}
+
+	if err := create(txRepo, ctx, items); err != nil {
+		h.logger.Error("Failed to create items", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to create items", err.Error())
+		return nil
+	}
+
+	if err := txRepo.CommitTx(ctx); err != nil {
+		h.logger.Error("Failed to commit transaction", "error", err.Error(), "sale_id", saleID)
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to add items", err.Error())
+		return nil
+	}
+	committed = true
+
+	ttl := time.Until(existingSale.EndedAt)
+	if err := h.cache.SetSaleTotalItems(ctx, saleID, existingSale.TotalItems, ttl); err != nil {
+		h.logger.Error("Failed to update sale total items in cache", "error", err.Error(), "sale_id", saleID)
+	}
+	if err := h.cache.SetSaleRemaining(ctx, saleID, existingSale.TotalItems-existingSale.ItemsSold, ttl); err != nil {
+		h.logger.Error("Failed to update remaining items in cache", "error", err.Error(), "sale_id", saleID)
+	}
+
+	return existingSale
+}
+
+func decodeAddItemsRequest(r *http.Request) (*AddItemsRequest, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	var req AddItemsRequest
+	if trimmed := strings.TrimSpace(string(raw)); strings.HasPrefix(trimmed, "[") {
+		req.Items = make([]ItemDefinition, 0)
+		if err := json.Unmarshal(raw, &req.Items); err != nil {
+			return nil, err
+		}
+		return &req, nil
+	}
+
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+func (h *AdminHandler) buildItems(saleID string, req *AddItemsRequest) []*sale.Item {
+	if req.Items == nil {
+		items := make([]*sale.Item, 0, req.Count)
+		for i := 0; i < req.Count; i++ {
+			items = append(items, sale.NewItem(h.itemGenerator.GenerateItemID(), saleID, h.itemGenerator.GenerateName(), h.itemGenerator.GenerateImageURL(), h.itemGenerator.GeneratePrice()))
+		}
+		return items
+	}
+
+	items := make([]*sale.Item, 0, len(req.Items))
+	for _, def := range req.Items {
+		name := def.Name
+		if name == "" {
+			name = h.itemGenerator.GenerateName()
+		}
+		imageURL := def.ImageURL
+		if imageURL == "" {
+			imageURL = h.itemGenerator.GenerateImageURL()
+		}
+		item := sale.NewItem(h.itemGenerator.GenerateItemID(), saleID, name, imageURL, h.itemPrice(def.Price))
+		item.Description = def.Description
+		item.Metadata = def.Metadata
+		items = append(items, item)
+	}
+	return items
+}
+
+func (h *AdminHandler) itemPrice(override *decimal.Decimal) decimal.Decimal {
+	if override != nil {
+		return *override
+	}
+	return h.itemGenerator.GeneratePrice()
+}
+
+func (h *AdminHandler) HandleGetPurchaseResult(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/purchase-results/"), "/")
+
+	if code == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"code": "checkout code is required",
+		})
+		return
+	}
+
+	raw, err := h.saleRepo.GetRawPurchaseResult(ctx, code)
+	if err != nil {
+		if !errors.Is(err, domainErrors.ErrPurchaseResultNotFound) {
+			h.logger.Error("Failed to get purchase result", "error", err.Error(), "code", code)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	detail := PurchaseResultDetailResponse{
+		CheckoutCode: code,
+		Raw:          string(raw),
+	}
+
+	var result sale.PurchaseResult
+	if err := json.Unmarshal(raw, &result); err == nil {
+		detail.Valid = true
+		detail.Result = &result
+	}
+
+	response.WriteSuccess(w, detail)
+}
+
+func (h *AdminHandler) HandleRepairPurchaseResult(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	code := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/purchase-results/"), "/")
+
+	if code == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"code": "checkout code is required",
+		})
+		return
+	}
+
+	var result sale.PurchaseResult
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		response.WriteBodyError(w, err)
+		return
+	}
+	result.Corrupted = false
+
+	if err := h.saleRepo.ReplacePurchaseResult(ctx, code, &result); err != nil {
+		if !errors.Is(err, domainErrors.ErrPurchaseResultNotFound) {
+			h.logger.Error("Failed to repair purchase result", "error", err.Error(), "code", code)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	h.logger.Info("Purchase result repaired", "code", code)
+	response.WriteSuccess(w, result, "Purchase result repaired successfully")
+}
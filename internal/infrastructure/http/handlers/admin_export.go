@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+const (
+	// purchaseExportTimeout replaces the server's write timeout, which a
+	// large sale's export would outlast.
+	purchaseExportTimeout = 10 * time.Minute
+	// purchaseExportFlushRows is how many rows are written between flushes
+	// to the client.
+	purchaseExportFlushRows = 1000
+)
+
+var purchaseExportColumns = []string{"purchase_id", "user_id", "item_id", "item_name", "price", "purchased_at"}
+
+// HandleExportPurchases streams a sale's purchases as a CSV or JSON
+// download. Rows are written as they are read, so once the first one is
+// sent a later failure can only be logged and the download ends early.
+func (h *AdminHandler) HandleExportPurchases(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"format": "format must be csv or json",
+		})
+		return
+	}
+
+	if _, err := h.saleRepo.GetSaleByID(ctx, saleID); err != nil {
+		if !errors.Is(err, domainErrors.ErrSaleNotFound) {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(purchaseExportTimeout))
+
+	var export purchaseExport
+	if format == "csv" {
+		export = &csvPurchaseExport{w: csv.NewWriter(w)}
+	} else {
+		export = &jsonPurchaseExport{w: bufio.NewWriter(w)}
+	}
+
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", export.contentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="sale_%s_purchases.%s"`, saleID, format))
+		w.WriteHeader(http.StatusOK)
+		return export.begin()
+	}
+
+	rows := 0
+	err := h.purchaseExporter.ExportPurchases(ctx, saleID, func(row ports.PurchaseExportRow) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := export.write(row); err != nil {
+			return err
+		}
+		rows++
+		if rows%purchaseExportFlushRows == 0 {
+			if err := export.flush(); err != nil {
+				return err
+			}
+			_ = rc.Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err != nil {
+		if !started {
+			h.logger.Error("Failed to export purchases", "error", err.Error(), "sale_id", saleID)
+			response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to export purchases", err.Error())
+			return
+		}
+		h.logger.Error("Purchase export ended early", "error", err.Error(), "sale_id", saleID, "rows", rows)
+		return
+	}
+
+	if err := export.end(); err != nil {
+		h.logger.Error("Failed to finish purchase export", "error", err.Error(), "sale_id", saleID, "rows", rows)
+		return
+	}
+
+	h.logger.Info("Purchases exported", "sale_id", saleID, "format", format, "rows", rows)
+}
+
+// purchaseExport encodes the rows of a purchase export in one format.
+type purchaseExport interface {
+	contentType() string
+	begin() error
+	write(row ports.PurchaseExportRow) error
+	flush() error
+	end() error
+}
+
+type csvPurchaseExport struct {
+	w *csv.Writer
+}
+
+func (e *csvPurchaseExport) contentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (e *csvPurchaseExport) begin() error {
+	return e.w.Write(purchaseExportColumns)
+}
+
+func (e *csvPurchaseExport) write(row ports.PurchaseExportRow) error {
+	return e.w.Write([]string{
+		row.PurchaseID,
+		csvText(row.UserID),
+		row.ItemID,
+		csvText(row.ItemName),
+		row.Price.StringFixed(2),
+		row.PurchasedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// csvText keeps free text from being read as a formula by spreadsheets
+// that open the export, by prefixing cells starting with a formula
+// character with a single quote.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (e *csvPurchaseExport) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvPurchaseExport) end() error {
+	return e.flush()
+}
+
+// jsonPurchaseExport writes a JSON array one element at a time.
+type jsonPurchaseExport struct {
+	w    *bufio.Writer
+	rows int
+}
+
+func (e *jsonPurchaseExport) contentType() string {
+	return "application/json"
+}
+
+func (e *jsonPurchaseExport) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonPurchaseExport) write(row ports.PurchaseExportRow) error {
+	row.PurchasedAt = row.PurchasedAt.UTC()
+	body, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if e.rows > 0 {
+		if err := e.w.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	e.rows++
+	_, err = e.w.Write(body)
+	return err
+}
+
+func (e *jsonPurchaseExport) flush() error {
+	return e.w.Flush()
+}
+
+func (e *jsonPurchaseExport) end() error {
+	if _, err := io.WriteString(e.w, "]"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+)
+
+// Item names and user IDs come from outside, so a cell a spreadsheet would
+// evaluate is written as text instead.
+func TestCSVPurchaseExportEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		itemName string
+		want     string
+	}{
+		{itemName: "Red Mug", want: "Red Mug"},
+		{itemName: `=HYPERLINK("http://evil.example.com","Mug")`, want: `'=HYPERLINK("http://evil.example.com","Mug")`},
+		{itemName: "+1+1", want: "'+1+1"},
+		{itemName: "-2+3", want: "'-2+3"},
+		{itemName: "@SUM(A1:A2)", want: "'@SUM(A1:A2)"},
+		{itemName: "\t=1", want: "'\t=1"},
+		{itemName: "Mug = Cup", want: "Mug = Cup"},
+		{itemName: "", want: ""},
+	}
+
+	var buf bytes.Buffer
+	export := &csvPurchaseExport{w: csv.NewWriter(&buf)}
+	if err := export.begin(); err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	for i, tt := range tests {
+		row := ports.PurchaseExportRow{
+			PurchaseID:  "purchase",
+			UserID:      "=cmd|' /C calc'!A0",
+			ItemID:      "item",
+			ItemName:    tt.itemName,
+			Price:       decimal.NewFromInt(int64(i)),
+			PurchasedAt: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC),
+		}
+		if err := export.write(row); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if err := export.end(); err != nil {
+		t.Fatalf("end: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	if len(records) != len(tests)+1 {
+		t.Fatalf("got %d records, want a header and %d rows", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		record := records[i+1]
+		if record[3] != tt.want {
+			t.Errorf("item_name %q written as %q, want %q", tt.itemName, record[3], tt.want)
+		}
+		if record[1] != "'=cmd|' /C calc'!A0" {
+			t.Errorf("user_id written as %q, want it escaped", record[1])
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+const (
+	maxImportItems = 50000
+	// maxImportErrors bounds the row errors echoed back; Failed still
+	// counts every rejected row.
+	maxImportErrors = 100
+
+	maxItemNameLength     = 255
+	maxItemImageURLLength = 500
+)
+
+// ImportItemRow is one item of an import. The JSON form is an array of
+// these; the CSV form has a header row naming the same columns.
+type ImportItemRow struct {
+	Name        string           `json:"name"`
+	ImageURL    string           `json:"image_url"`
+	Price       *decimal.Decimal `json:"price"`
+	Description string           `json:"description,omitempty"`
+}
+
+type ImportItemError struct {
+	// Row is the 1-based position of the item in the upload, not counting
+	// the CSV header.
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type ImportItemsResponse struct {
+	SaleID     string            `json:"sale_id"`
+	Imported   int               `json:"imported"`
+	Failed     int               `json:"failed"`
+	Errors     []ImportItemError `json:"errors"`
+	TotalItems int               `json:"total_items"`
+}
+
+// importResult collects the items that passed validation and the rows that
+// did not.
+type importResult struct {
+	items  []*sale.Item
+	failed int
+	errors []ImportItemError
+}
+
+func (res *importResult) reject(row int, err string) {
+	res.failed++
+	if len(res.errors) < maxImportErrors {
+		res.errors = append(res.errors, ImportItemError{Row: row, Error: err})
+	}
+}
+
+// HandleImportItems adds a product catalog to a sale from a JSON array or a
+// CSV file. Rows that fail validation are reported and skipped; the rest are
+// stored with COPY in one transaction.
+func (h *AdminHandler) HandleImportItems(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	saleID := strings.Split(path, "/")[0]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var res *importResult
+	var err error
+	switch mediaType {
+	case "application/json":
+		res, err = h.importJSON(saleID, r.Body)
+	case "text/csv":
+		res, err = h.importCSV(saleID, r.Body)
+	default:
+		response.WriteError(w, http.StatusUnsupportedMediaType, response.StatusValidationError,
+			"Unsupported content type", "Content-Type must be application/json or text/csv")
+		return
+	}
+	if err != nil {
+		response.WriteBodyError(w, err)
+		return
+	}
+
+	if len(res.items) == 0 && res.failed == 0 {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"items": "At least one item is required",
+		})
+		return
+	}
+
+	summary := ImportItemsResponse{
+		SaleID:   saleID,
+		Imported: len(res.items),
+		Failed:   res.failed,
+		Errors:   res.errors,
+	}
+	if summary.Errors == nil {
+		summary.Errors = []ImportItemError{}
+	}
+
+	if len(res.items) == 0 {
+		existingSale, err := h.saleRepo.GetSaleByID(r.Context(), saleID)
+		if err != nil {
+			response.WriteDomainError(w, err)
+			return
+		}
+		summary.TotalItems = existingSale.TotalItems
+		response.WriteJSON(w, http.StatusOK, response.Success(summary))
+		return
+	}
+
+	existingSale := h.appendItems(w, r, saleID, res.items, ports.SaleRepository.CreateItemsWithCopy)
+	if existingSale == nil {
+		return
+	}
+
+	h.logger.Info("Items imported", "sale_id", saleID, "imported", summary.Imported, "failed", summary.Failed)
+
+	summary.TotalItems = existingSale.TotalItems
+	response.WriteJSON(w, http.StatusCreated, response.Success(summary, "Items imported successfully"))
+}
+
+func (h *AdminHandler) importJSON(saleID string, body io.Reader) (*importResult, error) {
+	var rows []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&rows); err != nil {
+		return nil, err
+	}
+	if len(rows) > maxImportItems {
+		return nil, fmt.Errorf("import is limited to %d items", maxImportItems)
+	}
+
+	res := &importResult{items: make([]*sale.Item, 0, len(rows))}
+	for i, raw := range rows {
+		var row ImportItemRow
+		if err := json.Unmarshal(raw, &row); err != nil {
+			res.reject(i+1, err.Error())
+			continue
+		}
+		h.importRow(saleID, i+1, row, res)
+	}
+
+	return res, nil
+}
+
+func (h *AdminHandler) importCSV(saleID string, body io.Reader) (*importResult, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	// Rows may leave off trailing optional columns such as description.
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("CSV header row is missing")
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "image_url", "price"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", required)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	res := &importResult{}
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if row > maxImportItems {
+			return nil, fmt.Errorf("import is limited to %d items", maxImportItems)
+		}
+
+		item := ImportItemRow{
+			Name:        field(record, "name"),
+			ImageURL:    field(record, "image_url"),
+			Description: field(record, "description"),
+		}
+		if raw := strings.TrimSpace(field(record, "price")); raw != "" {
+			price, err := decimal.NewFromString(raw)
+			if err != nil {
+				res.reject(row, "price must be a decimal number")
+				continue
+			}
+			item.Price = &price
+		}
+		h.importRow(saleID, row, item, res)
+	}
+
+	return res, nil
+}
+
+// importRow validates row and adds it to res as an item or a rejection.
+func (h *AdminHandler) importRow(saleID string, n int, row ImportItemRow, res *importResult) {
+	name := strings.TrimSpace(row.Name)
+	imageURL := strings.TrimSpace(row.ImageURL)
+
+	switch {
+	case name == "":
+		res.reject(n, "name is required")
+		return
+	case utf8.RuneCountInString(name) > maxItemNameLength:
+		res.reject(n, fmt.Sprintf("name must be at most %d characters", maxItemNameLength))
+		return
+	case imageURL == "":
+		res.reject(n, "image_url is required")
+		return
+	case utf8.RuneCountInString(imageURL) > maxItemImageURLLength:
+		res.reject(n, fmt.Sprintf("image_url must be at most %d characters", maxItemImageURLLength))
+		return
+	case row.Price == nil:
+		res.reject(n, "price is required")
+		return
+	case row.Price.IsNegative():
+		res.reject(n, "price must not be negative")
+		return
+	}
+
+	item := sale.NewItem(h.itemGenerator.GenerateItemID(), saleID, name, imageURL, *row.Price)
+	item.Description = row.Description
+	res.items = append(res.items, item)
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+const (
+	defaultUpcomingLimit        = 10
+	maxUpcomingLimit            = 100
+	defaultUpcomingHorizonHours = 7 * 24
+	maxUpcomingHorizonHours     = 90 * 24
+
+	calendarContentType = "text/calendar"
+	calendarProdID      = "-//flashsale-service//Sale Calendar//EN"
+	calendarMaxAge      = 5 * time.Minute
+)
+
+type UpcomingSalesResponse struct {
+	Horizon string         `json:"horizon"`
+	Sales   []SaleResponse `json:"sales"`
+}
+
+func (h *SaleHandler) HandleGetUpcomingSales(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit, horizon, validationErrors := parseUpcomingParams(r)
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	sales, err := h.saleRepo.GetUpcomingSales(ctx, time.Now().UTC().Add(horizon), limit)
+	if err != nil {
+		h.logger.Error("Failed to get upcoming sales", "error", err.Error())
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	if wantsCalendar(r) {
+		writeCacheable(w, r, calendarContentType+"; charset=utf-8", buildSaleCalendar(sales))
+		return
+	}
+
+	upcoming := UpcomingSalesResponse{
+		Horizon: horizon.String(),
+		Sales:   make([]SaleResponse, 0, len(sales)),
+	}
+	now := time.Now().UTC()
+	for _, s := range sales {
+		upcoming.Sales = append(upcoming.Sales, SaleResponse{
+			ID:         s.ID,
+			Category:   s.Category,
+			StartedAt:  s.StartedAt.Format(time.RFC3339),
+			EndedAt:    s.EndedAt.Format(time.RFC3339),
+			TotalItems: s.TotalItems,
+			ItemsSold:  s.ItemsSold,
+			Status:     s.Status(now),
+
+			MaxItemsPerUser: s.MaxItemsPerUser,
+			MaxItemsPerSale: s.MaxItemsPerSale,
+		})
+	}
+
+	body, err := json.Marshal(upcoming)
+	if err != nil {
+		h.logger.Error("Failed to encode upcoming sales", "error", err.Error())
+		response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Internal server error")
+		return
+	}
+
+	writeCacheable(w, r, "application/json", append(body, '\n'))
+}
+
+func parseUpcomingParams(r *http.Request) (int, time.Duration, map[string]string) {
+	limit := defaultUpcomingLimit
+	horizonHours := defaultUpcomingHorizonHours
+	validationErrors := make(map[string]string)
+
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			validationErrors["limit"] = "limit must be a positive integer"
+		} else if parsed > maxUpcomingLimit {
+			limit = maxUpcomingLimit
+		} else {
+			limit = parsed
+		}
+	}
+
+	if raw := query.Get("horizon_hours"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			validationErrors["horizon_hours"] = "horizon_hours must be a positive integer"
+		} else if parsed > maxUpcomingHorizonHours {
+			horizonHours = maxUpcomingHorizonHours
+		} else {
+			horizonHours = parsed
+		}
+	}
+
+	return limit, time.Duration(horizonHours) * time.Hour, validationErrors
+}
+
+func wantsCalendar(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "ics" {
+		return true
+	}
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(accepted, ";", 2)[0])
+		if strings.EqualFold(mediaType, calendarContentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildSaleCalendar renders one VEVENT per sale window. DTSTAMP uses the
+// sale's creation time rather than the request time so that the feed, and
+// therefore its ETag, only changes when the schedule does.
+func buildSaleCalendar(sales []*sale.Sale) []byte {
+	cal := newICalWriter(calendarProdID)
+	for _, s := range sales {
+		cal.beginEvent()
+		cal.text("UID", s.ID+"@flashsale-service")
+		cal.time("DTSTAMP", s.CreatedAt)
+		cal.time("DTSTART", s.StartedAt)
+		cal.time("DTEND", s.EndedAt)
+		cal.text("SUMMARY", "Flash sale "+s.ID)
+		cal.text("DESCRIPTION", fmt.Sprintf("%d items available", s.TotalItems))
+		cal.endEvent()
+	}
+	return cal.bytes()
+}
+
+func writeCacheable(w http.ResponseWriter, r *http.Request, contentType string, body []byte) {
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(calendarMaxAge.Seconds())))
+	w.Header().Add("Vary", "Accept")
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+)
+
+func TestBuildSaleCalendarParses(t *testing.T) {
+	first := fixtures.NewSaleBuilder().
+		WithID("S-upcoming001").
+		Between(fixtures.BaseTime.Add(time.Hour), fixtures.BaseTime.Add(2*time.Hour)).
+		WithTotalItems(10000).
+		Build()
+	// Long enough to be folded, with characters that need escaping.
+	second := fixtures.NewSaleBuilder().
+		WithID("S-upcoming002-"+strings.Repeat("ü", 40)+";,\\").
+		Between(fixtures.BaseTime.Add(25*time.Hour), fixtures.BaseTime.Add(26*time.Hour)).
+		WithTotalItems(5).
+		Build()
+
+	body := buildSaleCalendar([]*sale.Sale{first, second})
+
+	for i, line := range bytes.Split(bytes.TrimSuffix(body, []byte("\r\n")), []byte("\r\n")) {
+		if len(line) > icalLineLimit {
+			t.Errorf("line %d is %d octets, want at most %d", i+1, len(line), icalLineLimit)
+		}
+	}
+
+	cal, err := ics.ParseCalendar(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseCalendar: %v\n%s", err, body)
+	}
+
+	events := cal.Events()
+	if len(events) != 2 {
+		t.Fatalf("calendar has %d events, want 2", len(events))
+	}
+
+	for i, s := range []*sale.Sale{first, second} {
+		event := events[i]
+		if got, want := event.Id(), s.ID+"@flashsale-service"; got != want {
+			t.Errorf("event %d UID = %q, want %q", i, got, want)
+		}
+
+		start, err := event.GetStartAt()
+		if err != nil {
+			t.Fatalf("event %d DTSTART: %v", i, err)
+		}
+		if !start.Equal(s.StartedAt) {
+			t.Errorf("event %d starts at %v, want %v", i, start, s.StartedAt)
+		}
+		end, err := event.GetEndAt()
+		if err != nil {
+			t.Fatalf("event %d DTEND: %v", i, err)
+		}
+		if !end.Equal(s.EndedAt) {
+			t.Errorf("event %d ends at %v, want %v", i, end, s.EndedAt)
+		}
+
+		if prop := event.GetProperty(ics.ComponentPropertyDtstamp); prop == nil {
+			t.Errorf("event %d has no DTSTAMP", i)
+		}
+	}
+}
+
+func TestBuildSaleCalendarIsStable(t *testing.T) {
+	s := fixtures.NewSaleBuilder().Build()
+
+	a := buildSaleCalendar([]*sale.Sale{s})
+	b := buildSaleCalendar([]*sale.Sale{s})
+	if !bytes.Equal(a, b) {
+		t.Error("the same schedule rendered two different calendars, which breaks the ETag")
+	}
+}
+
+func TestParseUpcomingParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantLimit   int
+		wantHorizon time.Duration
+		wantErrors  []string
+	}{
+		{name: "defaults", query: "", wantLimit: defaultUpcomingLimit, wantHorizon: defaultUpcomingHorizonHours * time.Hour},
+		{name: "explicit", query: "limit=5&horizon_hours=48", wantLimit: 5, wantHorizon: 48 * time.Hour},
+		{name: "limit capped", query: "limit=1000", wantLimit: maxUpcomingLimit, wantHorizon: defaultUpcomingHorizonHours * time.Hour},
+		{name: "horizon capped", query: "horizon_hours=100000", wantLimit: defaultUpcomingLimit, wantHorizon: maxUpcomingHorizonHours * time.Hour},
+		{name: "zero limit", query: "limit=0", wantErrors: []string{"limit"}},
+		{name: "negative horizon", query: "horizon_hours=-1", wantErrors: []string{"horizon_hours"}},
+		{name: "not numbers", query: "limit=ten&horizon_hours=week", wantErrors: []string{"limit", "horizon_hours"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/sales/upcoming?"+tt.query, nil)
+			limit, horizon, errs := parseUpcomingParams(r)
+
+			if len(errs) != len(tt.wantErrors) {
+				t.Fatalf("validation errors = %v, want errors for %v", errs, tt.wantErrors)
+			}
+			for _, field := range tt.wantErrors {
+				if _, ok := errs[field]; !ok {
+					t.Errorf("no validation error for %s", field)
+				}
+			}
+			if len(tt.wantErrors) > 0 {
+				return
+			}
+
+			if limit != tt.wantLimit {
+				t.Errorf("limit = %d, want %d", limit, tt.wantLimit)
+			}
+			if horizon != tt.wantHorizon {
+				t.Errorf("horizon = %v, want %v", horizon, tt.wantHorizon)
+			}
+		})
+	}
+}
+
+func TestWantsCalendar(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   bool
+	}{
+		{name: "default", want: false},
+		{name: "format query", query: "format=ics", want: true},
+		{name: "accept header", accept: "text/calendar", want: true},
+		{name: "accept among others", accept: "application/json;q=0.5, Text/Calendar;q=0.9", want: true},
+		{name: "json", accept: "application/json", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/sales/upcoming?"+tt.query, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := wantsCalendar(r); got != tt.want {
+				t.Errorf("wantsCalendar() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
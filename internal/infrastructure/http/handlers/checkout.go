@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/yuzvak/flashsale-service/internal/application/commands"
 	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/middleware"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
@@ -15,6 +19,8 @@ type CheckoutHandler struct {
 	saleRepo     ports.SaleRepository
 	checkoutRepo ports.CheckoutRepository
 	cache        ports.Cache
+	checkoutTTL  time.Duration
+	codeGen      *generator.CodeGenerator
 	log          *logger.Logger
 }
 
@@ -22,12 +28,16 @@ func NewCheckoutHandler(
 	saleRepo ports.SaleRepository,
 	checkoutRepo ports.CheckoutRepository,
 	cache ports.Cache,
+	checkoutTTL time.Duration,
+	codeGen *generator.CodeGenerator,
 	log *logger.Logger,
 ) *CheckoutHandler {
 	return &CheckoutHandler{
 		saleRepo:     saleRepo,
 		checkoutRepo: checkoutRepo,
 		cache:        cache,
+		checkoutTTL:  checkoutTTL,
+		codeGen:      codeGen,
 		log:          log,
 	}
 }
@@ -39,28 +49,37 @@ func (h *CheckoutHandler) HandleCheckout() http.HandlerFunc {
 			return
 		}
 
-		userID := r.URL.Query().Get("user_id")
+		r = withCorrelationID(w, r)
+		log := h.log.WithContext(r.Context())
+
+		// An authenticated user ID always wins; the query parameter is only
+		// honoured when the JWT middleware is not configured.
+		userID, authenticated := middleware.UserIDFromContext(r.Context())
+		if !authenticated {
+			userID = r.URL.Query().Get("user_id")
+		}
+		if userID == "" {
+			response.WriteError(w, http.StatusUnauthorized, response.StatusUnauthorized, "Unauthorized", "user is not authenticated")
+			return
+		}
+
 		itemID := r.URL.Query().Get("id")
+		saleID := r.URL.Query().Get("sale_id")
+		log = log.WithField("user_id", userID).WithField("item_id", itemID)
 
-		h.log.Info("Checkout request received",
-			"user_id", userID,
-			"item_id", itemID,
+		log.Info("Checkout request received",
+			"sale_id", saleID,
 			"method", r.Method,
 			"url", r.URL.String(),
 		)
 
 		errors := make(map[string]string)
-		if userID == "" {
-			errors["user_id"] = "user_id is required"
-		}
 		if itemID == "" {
 			errors["id"] = "id is required"
 		}
 		if len(errors) > 0 {
-			h.log.Warn("Checkout validation failed",
+			log.Warn("Checkout validation failed",
 				"errors", errors,
-				"user_id", userID,
-				"item_id", itemID,
 			)
 			response.WriteValidationError(w, "Validation failed", errors)
 			return
@@ -69,6 +88,7 @@ func (h *CheckoutHandler) HandleCheckout() http.HandlerFunc {
 		cmd := commands.CheckoutCommand{
 			UserID: userID,
 			ItemID: itemID,
+			SaleID: saleID,
 		}
 
 		metrics := monitoring.NewCheckoutMetrics(userID, itemID)
@@ -80,24 +100,24 @@ func (h *CheckoutHandler) HandleCheckout() http.HandlerFunc {
 			h.cache,
 			h.log,
 			10,
-			generator.NewCodeGenerator(),
+			h.checkoutTTL,
+			h.codeGen,
 		)
 
 		resp, err := handler.Handle(r.Context(), cmd)
 		if err != nil {
-			h.log.Error("Checkout command failed",
-				"user_id", userID,
-				"item_id", itemID,
+			log.Error("Checkout command failed",
 				"error", err.Error(),
 			)
 			metrics.RecordFailure(err.Error())
+			if resp != nil && !resp.SaleStartsAt.IsZero() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(resp.SaleStartsAt).Seconds()))))
+			}
 			response.WriteDomainError(w, err)
 			return
 		}
 
-		h.log.Info("Checkout completed successfully",
-			"user_id", userID,
-			"item_id", itemID,
+		log.Info("Checkout completed successfully",
 			"code", resp.Code,
 		)
 		metrics.RecordSuccess()
@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/application/ports/mock"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+)
+
+// checkoutItemID is the ID of the first item fixtures build for the sale.
+const checkoutItemID = "item_S-checkout001_00000"
+
+// checkoutEnv wires a CheckoutHandler to mocks that let a checkout of
+// item through by default; each test overrides the step it is about.
+type checkoutEnv struct {
+	sale         *sale.Sale
+	item         *sale.Item
+	saleRepo     *mock.SaleRepository
+	checkoutRepo *mock.CheckoutRepository
+	cache        *mock.Cache
+
+	released   int
+	bloomAdded []string
+	created    []*sale.Checkout
+	added      []string
+}
+
+func newCheckoutEnv() *checkoutEnv {
+	builder := fixtures.NewSaleBuilder().
+		WithID("S-checkout001").
+		Active(clock.NewRealClock()).
+		WithItems(2)
+	env := &checkoutEnv{
+		sale: builder.Build(),
+		item: builder.BuildItems()[0],
+	}
+
+	env.saleRepo = &mock.SaleRepository{
+		OnGetActiveSale: func(ctx context.Context) (*sale.Sale, error) {
+			return env.sale, nil
+		},
+		OnGetSaleByID: func(ctx context.Context, id string) (*sale.Sale, error) {
+			if id != env.sale.ID {
+				return nil, domainErrors.ErrSaleNotFound
+			}
+			return env.sale, nil
+		},
+		OnGetItemByID: func(ctx context.Context, id string) (*sale.Item, error) {
+			return env.item, nil
+		},
+	}
+	env.checkoutRepo = &mock.CheckoutRepository{
+		OnGetCheckoutByCode: func(ctx context.Context, code string) (*sale.Checkout, error) {
+			return nil, domainErrors.ErrCheckoutNotFound
+		},
+		OnCreateCheckout: func(ctx context.Context, checkout *sale.Checkout) error {
+			env.created = append(env.created, checkout)
+			return nil
+		},
+		OnAddItemToCheckout: func(ctx context.Context, code, itemID string) error {
+			env.added = append(env.added, itemID)
+			return nil
+		},
+	}
+	env.cache = &mock.Cache{
+		OnAtomicReserveCheckoutSlot: func(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (int, bool, error) {
+			return maxItems - 1, true, nil
+		},
+		OnReleaseCheckoutReservation: func(ctx context.Context, saleID, userID string, count int) error {
+			env.released += count
+			return nil
+		},
+		OnAddItemToBloomFilter: func(ctx context.Context, saleID, itemID string) error {
+			env.bloomAdded = append(env.bloomAdded, itemID)
+			return nil
+		},
+	}
+	return env
+}
+
+func (env *checkoutEnv) serve(method, query string) *httptest.ResponseRecorder {
+	h := NewCheckoutHandler(env.saleRepo, env.checkoutRepo, env.cache, 10*time.Minute,
+		generator.NewCodeGenerator([]byte("secret"), ""), logger.NewLogger())
+
+	rec := httptest.NewRecorder()
+	h.HandleCheckout()(rec, httptest.NewRequest(method, "/checkout?"+query, nil))
+	return rec
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var body response.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error body %q: %v", rec.Body.String(), err)
+	}
+	return body.Code
+}
+
+func TestHandleCheckoutErrors(t *testing.T) {
+	errDatabase := errors.New("connection reset")
+
+	tests := []struct {
+		name      string
+		method    string
+		query     string
+		configure func(env *checkoutEnv)
+		want      int
+		wantCode  string
+		// wantReleased is whether the reserved slot is handed back.
+		wantReleased bool
+	}{
+		{
+			name:   "wrong method",
+			method: http.MethodGet,
+			want:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:  "no user",
+			query: "id=" + checkoutItemID,
+			want:  http.StatusUnauthorized,
+		},
+		{
+			name:  "no item",
+			query: "user_id=user_1",
+			want:  http.StatusBadRequest,
+		},
+		{
+			name: "no active sale",
+			configure: func(env *checkoutEnv) {
+				env.saleRepo.OnGetActiveSale = func(ctx context.Context) (*sale.Sale, error) {
+					return nil, domainErrors.ErrSaleNotFound
+				}
+			},
+			want:     http.StatusNotFound,
+			wantCode: domainErrors.ErrCodeSaleNotFound,
+		},
+		{
+			name:     "unknown sale ID",
+			query:    "sale_id=S-unknown&user_id=user_1&id=" + checkoutItemID,
+			want:     http.StatusNotFound,
+			wantCode: domainErrors.ErrCodeSaleNotFound,
+		},
+		{
+			name: "sale lookup fails",
+			configure: func(env *checkoutEnv) {
+				env.saleRepo.OnGetActiveSale = func(ctx context.Context) (*sale.Sale, error) {
+					return nil, errDatabase
+				}
+			},
+			want:     http.StatusNotFound,
+			wantCode: domainErrors.ErrCodeSaleNotFound,
+		},
+		{
+			name: "sale not started",
+			configure: func(env *checkoutEnv) {
+				env.sale.StartedAt = time.Now().Add(time.Hour)
+				env.sale.EndedAt = time.Now().Add(2 * time.Hour)
+			},
+			want:     http.StatusTooEarly,
+			wantCode: domainErrors.ErrCodeSaleNotYetStarted,
+		},
+		{
+			name: "sale ended",
+			configure: func(env *checkoutEnv) {
+				env.sale.StartedAt = time.Now().Add(-2 * time.Hour)
+				env.sale.EndedAt = time.Now().Add(-time.Hour)
+			},
+			want:     http.StatusBadRequest,
+			wantCode: domainErrors.ErrCodeSaleNotActive,
+		},
+		{
+			name: "sold according to the bloom filter",
+			configure: func(env *checkoutEnv) {
+				env.cache.OnItemExistsInBloomFilter = func(ctx context.Context, saleID, itemID string) (bool, error) {
+					return true, nil
+				}
+			},
+			want:     http.StatusConflict,
+			wantCode: domainErrors.ErrCodeItemAlreadySold,
+		},
+		{
+			name: "already checked out by the user",
+			configure: func(env *checkoutEnv) {
+				env.cache.OnHasUserCheckedOutItem = func(ctx context.Context, saleID, userID, itemID string) (bool, error) {
+					return true, nil
+				}
+			},
+			want:     http.StatusBadRequest,
+			wantCode: domainErrors.ErrCodeUserAlreadyCheckedOutItem,
+		},
+		{
+			name: "item not found",
+			configure: func(env *checkoutEnv) {
+				env.saleRepo.OnGetItemByID = func(ctx context.Context, id string) (*sale.Item, error) {
+					return nil, domainErrors.ErrItemNotFound
+				}
+			},
+			want:     http.StatusNotFound,
+			wantCode: domainErrors.ErrCodeItemNotFound,
+		},
+		{
+			name: "item lookup fails",
+			configure: func(env *checkoutEnv) {
+				env.saleRepo.OnGetItemByID = func(ctx context.Context, id string) (*sale.Item, error) {
+					return nil, errDatabase
+				}
+			},
+			want:     http.StatusInternalServerError,
+			wantCode: response.CodeInternalError,
+		},
+		{
+			name: "item of another sale",
+			configure: func(env *checkoutEnv) {
+				env.item.SaleID = "S-other001"
+			},
+			want:     http.StatusBadRequest,
+			wantCode: domainErrors.ErrCodeItemNotInSale,
+		},
+		{
+			name: "item sold in the database",
+			configure: func(env *checkoutEnv) {
+				env.item.Sold = true
+			},
+			want:     http.StatusConflict,
+			wantCode: domainErrors.ErrCodeItemAlreadySold,
+		},
+		{
+			name: "user has no checkout slot left",
+			configure: func(env *checkoutEnv) {
+				env.cache.OnAtomicReserveCheckoutSlot = func(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (int, bool, error) {
+					return 0, false, nil
+				}
+			},
+			want:     http.StatusBadRequest,
+			wantCode: domainErrors.ErrCodeUserLimitExceeded,
+		},
+		{
+			name: "storing the checkout fails",
+			configure: func(env *checkoutEnv) {
+				env.checkoutRepo.OnCreateCheckout = func(ctx context.Context, checkout *sale.Checkout) error {
+					return errDatabase
+				}
+			},
+			want:         http.StatusInternalServerError,
+			wantCode:     response.CodeInternalError,
+			wantReleased: true,
+		},
+		{
+			name: "item already in the open checkout",
+			configure: func(env *checkoutEnv) {
+				env.checkoutRepo.OnGetCheckoutByCode = func(ctx context.Context, code string) (*sale.Checkout, error) {
+					return fixtures.NewCheckoutBuilder().WithCode(code).ForSale(env.sale.ID).ForUser("user_1").
+						WithItems(env.item.ID).CreatedAt(time.Now()).Build(), nil
+				}
+			},
+			want:         http.StatusBadRequest,
+			wantCode:     domainErrors.ErrCodeUserAlreadyCheckedOutItem,
+			wantReleased: true,
+		},
+		{
+			name: "adding to the open checkout fails",
+			configure: func(env *checkoutEnv) {
+				env.checkoutRepo.OnGetCheckoutByCode = func(ctx context.Context, code string) (*sale.Checkout, error) {
+					return fixtures.NewCheckoutBuilder().WithCode(code).ForSale(env.sale.ID).ForUser("user_1").
+						WithItems("item_other").CreatedAt(time.Now()).Build(), nil
+				}
+				env.checkoutRepo.OnAddItemToCheckout = func(ctx context.Context, code, itemID string) error {
+					return errDatabase
+				}
+			},
+			want:         http.StatusInternalServerError,
+			wantCode:     response.CodeInternalError,
+			wantReleased: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newCheckoutEnv()
+			if tt.configure != nil {
+				tt.configure(env)
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			query := tt.query
+			if query == "" {
+				query = "user_id=user_1&id=" + checkoutItemID
+			}
+
+			rec := env.serve(method, query)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if tt.wantCode != "" {
+				if got := errorCode(t, rec); got != tt.wantCode {
+					t.Errorf("code = %q, want %q", got, tt.wantCode)
+				}
+			}
+			if released := env.released > 0; released != tt.wantReleased {
+				t.Errorf("slot released = %v, want %v", released, tt.wantReleased)
+			}
+			if len(env.created) > 0 {
+				t.Errorf("a failed checkout stored %d checkouts", len(env.created))
+			}
+		})
+	}
+}
+
+func TestHandleCheckoutRetryAfterForUpcomingSale(t *testing.T) {
+	env := newCheckoutEnv()
+	env.sale.StartedAt = time.Now().Add(90 * time.Second)
+	env.sale.EndedAt = env.sale.StartedAt.Add(time.Hour)
+
+	rec := env.serve(http.MethodPost, "user_id=user_1&id="+checkoutItemID)
+
+	if rec.Code != http.StatusTooEarly {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusTooEarly)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "90" && got != "89" {
+		t.Errorf("Retry-After = %q, want about 90", got)
+	}
+}
+
+func TestHandleCheckoutMarksSoldItemInBloomFilter(t *testing.T) {
+	env := newCheckoutEnv()
+	env.item.Sold = true
+
+	if rec := env.serve(http.MethodPost, "user_id=user_1&id="+checkoutItemID); rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if len(env.bloomAdded) != 1 || env.bloomAdded[0] != env.item.ID {
+		t.Errorf("bloom filter additions = %v, want [%s]", env.bloomAdded, env.item.ID)
+	}
+}
+
+// Cache failures other than a sold item or a full slot count are logged and
+// the checkout goes ahead on the database checks.
+func TestHandleCheckoutSurvivesCacheErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cache *mock.Cache)
+	}{
+		{
+			name: "bloom filter unavailable",
+			configure: func(cache *mock.Cache) {
+				cache.OnItemExistsInBloomFilter = func(ctx context.Context, saleID, itemID string) (bool, error) {
+					return false, ports.ErrCacheUnavailable
+				}
+			},
+		},
+		{
+			name: "bloom filter error",
+			configure: func(cache *mock.Cache) {
+				cache.OnItemExistsInBloomFilter = func(ctx context.Context, saleID, itemID string) (bool, error) {
+					return true, errors.New("bad reply")
+				}
+			},
+		},
+		{
+			name: "checkout history error",
+			configure: func(cache *mock.Cache) {
+				cache.OnHasUserCheckedOutItem = func(ctx context.Context, saleID, userID, itemID string) (bool, error) {
+					return true, errors.New("bad reply")
+				}
+			},
+		},
+		{
+			name: "slot reservation error",
+			configure: func(cache *mock.Cache) {
+				cache.OnAtomicReserveCheckoutSlot = func(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (int, bool, error) {
+					return 0, false, errors.New("bad reply")
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newCheckoutEnv()
+			tt.configure(env.cache)
+
+			rec := env.serve(http.MethodPost, "user_id=user_1&id="+checkoutItemID)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body.String())
+			}
+			if len(env.created) != 1 {
+				t.Errorf("stored %d checkouts, want 1", len(env.created))
+			}
+		})
+	}
+}
+
+func TestHandleCheckoutAddsToOpenCheckout(t *testing.T) {
+	env := newCheckoutEnv()
+	env.checkoutRepo.OnGetCheckoutByCode = func(ctx context.Context, code string) (*sale.Checkout, error) {
+		return fixtures.NewCheckoutBuilder().WithCode(code).ForSale(env.sale.ID).ForUser("user_1").
+			WithItems("item_other").CreatedAt(time.Now()).Build(), nil
+	}
+
+	rec := env.serve(http.MethodPost, "user_id=user_1&id="+checkoutItemID)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body.String())
+	}
+	if len(env.created) != 0 || len(env.added) != 1 || env.added[0] != checkoutItemID {
+		t.Errorf("created %d checkouts and added %v, want the item added to the open checkout", len(env.created), env.added)
+	}
+	if env.released != 0 {
+		t.Errorf("released %d slots after a successful checkout", env.released)
+	}
+}
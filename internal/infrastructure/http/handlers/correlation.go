@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+const (
+	correlationIDHeader    = "X-Correlation-ID"
+	maxCorrelationIDLength = 128
+)
+
+// withCorrelationID attaches the caller's correlation ID, or a fresh one, to
+// the request context and echoes it back in the response headers.
+func withCorrelationID(w http.ResponseWriter, r *http.Request) *http.Request {
+	correlationID := r.Header.Get(correlationIDHeader)
+	if correlationID == "" || len(correlationID) > maxCorrelationIDLength {
+		correlationID = generator.NewCodeGenerator(nil, "").GenerateCorrelationID()
+	}
+
+	w.Header().Set(correlationIDHeader, correlationID)
+	return r.WithContext(logger.ContextWithCorrelationID(r.Context(), correlationID))
+}
@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -12,18 +14,24 @@ import (
 )
 
 type HealthHandler struct {
-	db        *sql.DB
-	redis     *redis.Client
-	log       *logger.Logger
-	startTime time.Time
+	db            *sql.DB
+	redis         redis.UniversalClient
+	log           *logger.Logger
+	startTime     time.Time
+	maxGoroutines int
+	scheduler     SchedulerStatusProvider
 }
 
-func NewHealthHandler(db *sql.DB, redis *redis.Client, log *logger.Logger) *HealthHandler {
+// NewHealthHandler takes an optional scheduler whose status is included in
+// the readiness check; nil leaves it out.
+func NewHealthHandler(db *sql.DB, redis redis.UniversalClient, maxGoroutines int, scheduler SchedulerStatusProvider, log *logger.Logger) *HealthHandler {
 	return &HealthHandler{
-		db:        db,
-		redis:     redis,
-		log:       log,
-		startTime: time.Now().UTC(),
+		db:            db,
+		redis:         redis,
+		log:           log,
+		startTime:     time.Now().UTC(),
+		maxGoroutines: maxGoroutines,
+		scheduler:     scheduler,
 	}
 }
 
@@ -40,6 +48,17 @@ type ServicesStatus struct {
 	Redis    string `json:"redis"`
 }
 
+type ReadinessData struct {
+	Database  string `json:"database"`
+	Redis     string `json:"redis"`
+	Scheduler string `json:"scheduler,omitempty"`
+}
+
+type LivenessData struct {
+	Uptime     string `json:"uptime"`
+	Goroutines int    `json:"goroutines"`
+}
+
 type HealthData struct {
 	ServicesStatus ServicesStatus `json:"services_status"`
 	Uptime         string         `json:"uptime"`
@@ -81,3 +100,62 @@ func (h *HealthHandler) HandleHealth() http.HandlerFunc {
 		response.WriteSuccess(w, data)
 	}
 }
+
+// HandleReadiness reports whether the service can take traffic, i.e. both
+// the database and Redis answer a ping and the scheduler has not been
+// failing for more than two intervals.
+func (h *HealthHandler) HandleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := ReadinessData{Database: "UP", Redis: "UP"}
+		var down []string
+
+		if err := h.db.PingContext(r.Context()); err != nil {
+			h.log.Warn("Readiness check failed", "dependency", "database", "error", err.Error())
+			data.Database = "DOWN"
+			down = append(down, "database")
+		}
+
+		if err := h.redis.Ping(r.Context()).Err(); err != nil {
+			h.log.Warn("Readiness check failed", "dependency", "redis", "error", err.Error())
+			data.Redis = "DOWN"
+			down = append(down, "redis")
+		}
+
+		if h.scheduler != nil {
+			data.Scheduler = "UP"
+			if status := h.scheduler.Status(); status.Degraded(time.Now().UTC()) {
+				h.log.Warn("Readiness check failed", "dependency", "scheduler",
+					"last_run_at", status.LastRunAt, "error", status.LastRunError.Error())
+				data.Scheduler = "DEGRADED"
+				down = append(down, "scheduler")
+			}
+		}
+
+		if len(down) > 0 {
+			response.WriteError(w, http.StatusServiceUnavailable, response.StatusServiceUnavailable,
+				"Service not ready", strings.Join(down, ", ")+" unavailable")
+			return
+		}
+
+		response.WriteSuccess(w, data)
+	}
+}
+
+// HandleLiveness only checks the process itself, so that dependency outages
+// take the pod out of rotation without getting it restarted.
+func (h *HealthHandler) HandleLiveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		goroutines := runtime.NumGoroutine()
+		if h.maxGoroutines > 0 && goroutines > h.maxGoroutines {
+			h.log.Error("Liveness check failed", "goroutines", goroutines, "max_goroutines", h.maxGoroutines)
+			response.WriteError(w, http.StatusServiceUnavailable, response.StatusServiceUnavailable,
+				"Service not live", fmt.Sprintf("%d goroutines exceed limit of %d", goroutines, h.maxGoroutines))
+			return
+		}
+
+		response.WriteSuccess(w, LivenessData{
+			Uptime:     time.Since(h.startTime).String(),
+			Goroutines: goroutines,
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"bytes"
+	"strings"
+	"time"
+)
+
+const (
+	icalTimeFormat = "20060102T150405Z"
+	icalLineLimit  = 75
+)
+
+// icalWriter builds an RFC 5545 calendar. It only covers what the sale feed
+// needs: text and UTC date-time properties inside VEVENT components.
+type icalWriter struct {
+	buf bytes.Buffer
+}
+
+func newICalWriter(prodID string) *icalWriter {
+	w := &icalWriter{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + escapeICalText(prodID))
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	return w
+}
+
+func (w *icalWriter) beginEvent() {
+	w.line("BEGIN:VEVENT")
+}
+
+func (w *icalWriter) endEvent() {
+	w.line("END:VEVENT")
+}
+
+func (w *icalWriter) text(name, value string) {
+	w.line(name + ":" + escapeICalText(value))
+}
+
+func (w *icalWriter) time(name string, t time.Time) {
+	w.line(name + ":" + t.UTC().Format(icalTimeFormat))
+}
+
+func (w *icalWriter) bytes() []byte {
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// line writes a content line, folding it so no physical line exceeds 75
+// octets. Folds never split a multi-byte UTF-8 sequence.
+func (w *icalWriter) line(content string) {
+	limit := icalLineLimit
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Start(content[cut]) {
+			cut--
+		}
+		w.buf.WriteString(content[:cut])
+		w.buf.WriteString("\r\n ")
+		content = content[cut:]
+		limit = icalLineLimit - 1
+	}
+	w.buf.WriteString(content)
+	w.buf.WriteString("\r\n")
+}
+
+func isUTF8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+var icalTextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escapeICalText(value string) string {
+	return icalTextEscaper.Replace(value)
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/scheduler"
+)
+
+// SchedulerStatusProvider is implemented by scheduler.SaleScheduler.
+type SchedulerStatusProvider interface {
+	Status() scheduler.SchedulerStatus
+}
+
+// InternalHandler serves operational endpoints meant for operators rather
+// than clients.
+type InternalHandler struct {
+	scheduler SchedulerStatusProvider
+}
+
+func NewInternalHandler(scheduler SchedulerStatusProvider) *InternalHandler {
+	return &InternalHandler{scheduler: scheduler}
+}
+
+type SchedulerStatusResponse struct {
+	Running      bool       `json:"running"`
+	Degraded     bool       `json:"degraded"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	LastRunError string     `json:"last_run_error,omitempty"`
+	NextRunAt    *time.Time `json:"next_run_at,omitempty"`
+	Interval     string     `json:"interval"`
+}
+
+func (h *InternalHandler) HandleSchedulerStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.scheduler == nil {
+		response.WriteError(w, http.StatusServiceUnavailable, response.StatusServiceUnavailable,
+			"Scheduler not configured")
+		return
+	}
+
+	status := h.scheduler.Status()
+	resp := SchedulerStatusResponse{
+		Running:   status.Running,
+		Degraded:  status.Degraded(time.Now().UTC()),
+		LastRunAt: optionalTime(status.LastRunAt),
+		NextRunAt: optionalTime(status.NextRunAt),
+		Interval:  status.Interval.String(),
+	}
+	if status.LastRunError != nil {
+		resp.LastRunError = status.LastRunError.Error()
+	}
+
+	response.WriteSuccess(w, resp)
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
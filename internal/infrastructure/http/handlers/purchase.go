@@ -1,26 +1,48 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/yuzvak/flashsale-service/internal/application/commands"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/application/use_cases"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	// idempotencyInFlightTTL bounds how long a purchase that never finished,
+	// for instance because its instance died, keeps its key blocked.
+	idempotencyInFlightTTL = time.Minute
+)
+
 type PurchaseHandler struct {
 	purchaseUseCase *use_cases.PurchaseUseCase
+	cache           ports.Cache
+	idempotencyTTL  time.Duration
+	codeGen         *generator.CodeGenerator
 	log             *logger.Logger
 }
 
 func NewPurchaseHandler(
 	purchaseUseCase *use_cases.PurchaseUseCase,
+	cache ports.Cache,
+	idempotencyTTL time.Duration,
+	codeGen *generator.CodeGenerator,
 	log *logger.Logger,
 ) *PurchaseHandler {
 	return &PurchaseHandler{
 		purchaseUseCase: purchaseUseCase,
+		cache:           cache,
+		idempotencyTTL:  idempotencyTTL,
+		codeGen:         codeGen,
 		log:             log,
 	}
 }
@@ -32,16 +54,19 @@ func (h *PurchaseHandler) HandlePurchase() http.HandlerFunc {
 			return
 		}
 
+		r = withCorrelationID(w, r)
+		log := h.log.FromContext(r.Context())
+
 		code := r.URL.Query().Get("code")
 
-		h.log.Info("Purchase request received",
+		log.Info("Purchase request received",
 			"code", code,
 			"method", r.Method,
 			"url", r.URL.String(),
 		)
 
 		if code == "" {
-			h.log.Warn("Purchase validation failed",
+			log.Warn("Purchase validation failed",
 				"error", "checkout code is required",
 				"code", code,
 			)
@@ -51,6 +76,47 @@ func (h *PurchaseHandler) HandlePurchase() http.HandlerFunc {
 			return
 		}
 
+		idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+		if len(idempotencyKey) > maxIdempotencyKeyLen {
+			response.WriteValidationError(w, "Validation failed", map[string]string{
+				"idempotency_key": "Idempotency-Key must be at most 255 characters",
+			})
+			return
+		}
+
+		// claimed is set once this request holds the key's in-flight marker;
+		// without it the purchase runs as if no key had been sent.
+		claimed := false
+		if idempotencyKey != "" {
+			stored, begun, err := h.cache.BeginIdempotentPurchase(r.Context(), idempotencyKey, code, idempotencyInFlightTTL)
+			if err != nil {
+				log.Warn("Failed to claim idempotency key",
+					"error", err.Error(),
+					"code", code,
+				)
+			} else if !begun {
+				if stored.Code != code {
+					response.WriteError(w, http.StatusUnprocessableEntity, response.StatusError,
+						"Idempotency-Key was already used for a different checkout code")
+					return
+				}
+				if stored.Response == nil {
+					response.WriteError(w, http.StatusConflict, response.StatusConflict,
+						"A purchase with this Idempotency-Key is still in progress")
+					return
+				}
+
+				log.Info("Replaying idempotent purchase",
+					"code", code,
+				)
+				w.Header().Set("Idempotent-Replayed", "true")
+				response.WriteSuccess(w, stored.Response, "Purchase completed successfully")
+				return
+			} else {
+				claimed = true
+			}
+		}
+
 		cmd := commands.PurchaseCommand{
 			CheckoutCode: code,
 		}
@@ -60,26 +126,45 @@ func (h *PurchaseHandler) HandlePurchase() http.HandlerFunc {
 
 		handler := commands.NewPurchaseHandler(
 			h.purchaseUseCase,
+			h.codeGen,
 			h.log,
 		)
 
 		resp, err := handler.Handle(r.Context(), cmd)
 		if err != nil {
-			h.log.Error("Purchase command failed",
+			log.Error("Purchase command failed",
 				"code", code,
 				"error", err.Error(),
 			)
 			metrics.RecordFailure(err.Error())
+			if claimed {
+				if err := h.cache.AbortIdempotentPurchase(r.Context(), idempotencyKey, code); err != nil {
+					log.Error("Failed to release idempotency key",
+						"error", err.Error(),
+						"code", code,
+					)
+				}
+			}
 			response.WriteDomainError(w, err)
 			return
 		}
 
-		h.log.Info("Purchase completed",
+		log.Info("Purchase completed",
 			"code", code,
 			"total_purchased", resp.TotalPurchased,
 			"failed_count", resp.FailedCount,
 		)
 
+		if claimed {
+			stored := &ports.IdempotentPurchase{Code: code, Response: resp}
+			if err := h.cache.CompleteIdempotentPurchase(r.Context(), idempotencyKey, stored, h.idempotencyTTL); err != nil {
+				log.Error("Failed to store idempotency result",
+					"error", err.Error(),
+					"code", code,
+				)
+			}
+		}
+
 		if resp.TotalPurchased > 0 {
 			metrics.RecordSuccess()
 		}
@@ -89,3 +174,46 @@ func (h *PurchaseHandler) HandlePurchase() http.HandlerFunc {
 		response.WriteSuccess(w, resp, "Purchase completed successfully")
 	}
 }
+
+// HandlePurchaseStatus answers GET /purchase/status?code=X with the stored
+// result of that checkout's purchase, or 404 if it has not completed. It is
+// safe to call any number of times.
+func (h *PurchaseHandler) HandlePurchaseStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		r = withCorrelationID(w, r)
+		log := h.log.FromContext(r.Context())
+
+		code := r.URL.Query().Get("code")
+		if code == "" {
+			response.WriteValidationError(w, "Validation failed", map[string]string{
+				"code": "checkout code is required",
+			})
+			return
+		}
+
+		handler := commands.NewPurchaseHandler(
+			h.purchaseUseCase,
+			h.codeGen,
+			h.log,
+		)
+
+		resp, err := handler.Status(r.Context(), commands.PurchaseCommand{CheckoutCode: code})
+		if err != nil {
+			if !errors.Is(err, domainErrors.ErrPurchaseResultNotFound) {
+				log.Error("Failed to get purchase status",
+					"code", code,
+					"error", err.Error(),
+				)
+			}
+			response.WriteDomainError(w, err)
+			return
+		}
+
+		response.WriteSuccess(w, resp)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/application/ports/mock"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// A repeated Idempotency-Key is answered from the cache without reaching
+// the purchase use case, which is nil here.
+func TestHandlePurchaseWithClaimedIdempotencyKey(t *testing.T) {
+	const code = "CHK-S1-0123456789abcdef-01234567"
+
+	tests := []struct {
+		name     string
+		stored   *ports.IdempotentPurchase
+		want     int
+		replayed bool
+	}{
+		{
+			name:   "still in flight",
+			stored: &ports.IdempotentPurchase{Code: code},
+			want:   http.StatusConflict,
+		},
+		{
+			name:   "different checkout code",
+			stored: &ports.IdempotentPurchase{Code: "CHK-S1-other", Response: &ports.PurchaseResponse{Success: true}},
+			want:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:     "completed",
+			stored:   &ports.IdempotentPurchase{Code: code, Response: &ports.PurchaseResponse{Success: true, TotalPurchased: 1}},
+			want:     http.StatusOK,
+			replayed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &mock.Cache{
+				OnBeginIdempotentPurchase: func(ctx context.Context, key, code string, ttl time.Duration) (*ports.IdempotentPurchase, bool, error) {
+					return tt.stored, false, nil
+				},
+			}
+			h := NewPurchaseHandler(nil, cache, time.Hour, nil, logger.NewLogger())
+
+			req := httptest.NewRequest(http.MethodPost, "/purchase?code="+code, nil)
+			req.Header.Set(idempotencyKeyHeader, "key-1")
+			rec := httptest.NewRecorder()
+			h.HandlePurchase()(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if got := rec.Header().Get("Idempotent-Replayed") == "true"; got != tt.replayed {
+				t.Errorf("Idempotent-Replayed = %v, want %v", got, tt.replayed)
+			}
+		})
+	}
+}
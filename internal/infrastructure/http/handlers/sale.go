@@ -1,42 +1,92 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
-	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
 type SaleHandler struct {
-	saleRepo *postgres.SaleRepository
+	saleRepo ports.SaleRepository
+	cache    ports.Cache
 	logger   *logger.Logger
 }
 
-func NewSaleHandler(saleRepo *postgres.SaleRepository, logger *logger.Logger) *SaleHandler {
+func NewSaleHandler(saleRepo ports.SaleRepository, cache ports.Cache, logger *logger.Logger) *SaleHandler {
 	return &SaleHandler{
 		saleRepo: saleRepo,
+		cache:    cache,
 		logger:   logger,
 	}
 }
 
+const (
+	defaultItemsLimit = 100
+	maxItemsLimit     = 1000
+)
+
 type SaleResponse struct {
 	ID         string `json:"id"`
+	Category   string `json:"category,omitempty"`
 	StartedAt  string `json:"started_at"`
 	EndedAt    string `json:"ended_at"`
 	TotalItems int    `json:"total_items"`
 	ItemsSold  int    `json:"items_sold"`
-	Active     bool   `json:"active"`
+	Status     string `json:"status"`
+
+	MaxItemsPerUser int `json:"max_items_per_user"`
+	MaxItemsPerSale int `json:"max_items_per_sale"`
+}
+
+type RemainingResponse struct {
+	SaleID    string `json:"sale_id"`
+	Remaining int    `json:"remaining"`
 }
 
 type ItemResponse struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	ImageURL string `json:"image_url"`
-	Sold     bool   `json:"sold"`
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	ImageURL    string                 `json:"image_url"`
+	Price       decimal.Decimal        `json:"price"`
+	Description string                 `json:"description,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	Sold        bool                   `json:"sold"`
+}
+
+// ItemListResponse is a page of a sale's items. The data array is the same as
+// before the metadata was added, so existing clients keep working.
+type ItemListResponse struct {
+	Data []ItemResponse `json:"data"`
+	Meta ItemListMeta   `json:"meta"`
+}
+
+type ItemListMeta struct {
+	TotalCount int `json:"total_count"`
+	// RemainingCount is the number of unsold items, for "N left" banners.
+	RemainingCount int `json:"remaining_count"`
+}
+
+type ItemDetailResponse struct {
+	ID           string                 `json:"id"`
+	SaleID       string                 `json:"sale_id"`
+	Name         string                 `json:"name"`
+	ImageURL     string                 `json:"image_url"`
+	Price        decimal.Decimal        `json:"price"`
+	Description  string                 `json:"description,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Sold         bool                   `json:"sold"`
+	SoldToUserID string                 `json:"sold_to_user_id,omitempty"`
+	SoldAt       string                 `json:"sold_at,omitempty"`
 }
 
 func (h *SaleHandler) HandleGetActiveSale(w http.ResponseWriter, r *http.Request) {
@@ -56,11 +106,15 @@ func (h *SaleHandler) HandleGetActiveSale(w http.ResponseWriter, r *http.Request
 
 	saleResponse := SaleResponse{
 		ID:         sale.ID,
+		Category:   sale.Category,
 		StartedAt:  sale.StartedAt.Format(time.RFC3339),
 		EndedAt:    sale.EndedAt.Format(time.RFC3339),
 		TotalItems: sale.TotalItems,
 		ItemsSold:  sale.ItemsSold,
-		Active:     true,
+		Status:     sale.Status(time.Now().UTC()),
+
+		MaxItemsPerUser: sale.MaxItemsPerUser,
+		MaxItemsPerSale: sale.MaxItemsPerSale,
 	}
 
 	response.WriteSuccess(w, saleResponse)
@@ -68,7 +122,7 @@ func (h *SaleHandler) HandleGetActiveSale(w http.ResponseWriter, r *http.Request
 
 func (h *SaleHandler) HandleGetSale(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/sales/")
+	path := strings.TrimPrefix(r.URL.Path, "/sales/")
 	parts := strings.Split(path, "/")
 	saleID := parts[0]
 
@@ -91,15 +145,17 @@ func (h *SaleHandler) HandleGetSale(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	active := sale.StartedAt.Before(time.Now().UTC()) && sale.EndedAt.After(time.Now().UTC())
-
 	saleResponse := SaleResponse{
 		ID:         sale.ID,
+		Category:   sale.Category,
 		StartedAt:  sale.StartedAt.Format(time.RFC3339),
 		EndedAt:    sale.EndedAt.Format(time.RFC3339),
 		TotalItems: sale.TotalItems,
 		ItemsSold:  sale.ItemsSold,
-		Active:     active,
+		Status:     sale.Status(time.Now().UTC()),
+
+		MaxItemsPerUser: sale.MaxItemsPerUser,
+		MaxItemsPerSale: sale.MaxItemsPerSale,
 	}
 
 	response.WriteSuccess(w, saleResponse)
@@ -107,7 +163,7 @@ func (h *SaleHandler) HandleGetSale(w http.ResponseWriter, r *http.Request) {
 
 func (h *SaleHandler) HandleGetSaleItems(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/sales/")
+	path := strings.TrimPrefix(r.URL.Path, "/sales/")
 	parts := strings.Split(path, "/")
 	saleID := parts[0]
 
@@ -118,7 +174,13 @@ func (h *SaleHandler) HandleGetSaleItems(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err := h.saleRepo.GetSaleByID(ctx, saleID)
+	limit, offset, validationErrors := parsePagination(r)
+	if len(validationErrors) > 0 {
+		response.WriteValidationError(w, "Validation failed", validationErrors)
+		return
+	}
+
+	saleEntity, err := h.saleRepo.GetSaleByID(ctx, saleID)
 	if err != nil {
 		if err == errors.ErrSaleNotFound {
 			response.WriteDomainError(w, err)
@@ -130,22 +192,195 @@ func (h *SaleHandler) HandleGetSaleItems(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	items, err := h.saleRepo.GetItemsBySaleID(ctx, saleID, 0, 100) // Default pagination: page 0, limit 100
+	// The list only changes when items are sold or added, so the sold and
+	// total counts make a cheap weak validator. It is checked before the
+	// items are loaded.
+	soldCount, err := h.saleRepo.GetSaleSoldCount(ctx, saleID)
+	if err != nil {
+		h.logger.Error("Failed to count sold items", "error", err.Error(), "sale_id", saleID)
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%d-%d"`, soldCount, saleEntity.TotalItems)
+	w.Header().Set("ETag", "W/"+etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	items, err := h.saleRepo.GetItemsBySaleID(ctx, saleID, limit, offset)
 	if err != nil {
 		h.logger.Error("Failed to get items", map[string]interface{}{"error": err.Error(), "sale_id": saleID})
 		response.WriteDomainError(w, err)
 		return
 	}
 
-	responses := make([]ItemResponse, 0, len(items))
+	totalCount, err := h.saleRepo.CountItemsBySaleID(ctx, saleID)
+	if err != nil {
+		h.logger.Error("Failed to count items", "error", err.Error(), "sale_id", saleID)
+		response.WriteDomainError(w, err)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(totalCount))
+
+	remaining, err := h.remainingItems(ctx, saleEntity)
+	if err != nil {
+		h.logger.Error("Failed to get remaining items", "error", err.Error(), "sale_id", saleID)
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	listResponse := ItemListResponse{
+		Data: make([]ItemResponse, 0, len(items)),
+		Meta: ItemListMeta{
+			TotalCount:     totalCount,
+			RemainingCount: remaining,
+		},
+	}
 	for _, item := range items {
-		responses = append(responses, ItemResponse{
-			ID:       item.ID,
-			Name:     item.Name,
-			ImageURL: item.ImageURL,
-			Sold:     item.Sold,
+		listResponse.Data = append(listResponse.Data, ItemResponse{
+			ID:          item.ID,
+			Name:        item.Name,
+			ImageURL:    item.ImageURL,
+			Price:       item.Price,
+			Description: item.Description,
+			Metadata:    item.Metadata,
+			Sold:        item.Sold,
 		})
 	}
 
-	response.WriteSuccess(w, responses)
+	response.WriteJSON(w, http.StatusOK, listResponse)
+}
+
+func (h *SaleHandler) HandleGetSaleRemaining(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/sales/")
+	parts := strings.Split(path, "/")
+	saleID := parts[0]
+
+	if saleID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"sale_id": "Sale ID is required",
+		})
+		return
+	}
+
+	remaining, found, err := h.cache.GetSaleRemaining(ctx, saleID)
+	if err != nil {
+		h.logger.Warn("Failed to read remaining items from cache", "error", err.Error(), "sale_id", saleID)
+	}
+
+	if !found {
+		saleEntity, err := h.saleRepo.GetSaleByID(ctx, saleID)
+		if err != nil {
+			if err != errors.ErrSaleNotFound {
+				h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+			}
+			response.WriteDomainError(w, err)
+			return
+		}
+
+		remaining, err = h.remainingItems(ctx, saleEntity)
+		if err != nil {
+			h.logger.Error("Failed to get remaining items", "error", err.Error(), "sale_id", saleID)
+			response.WriteDomainError(w, err)
+			return
+		}
+	}
+
+	response.WriteSuccess(w, RemainingResponse{
+		SaleID:    saleID,
+		Remaining: remaining,
+	})
+}
+
+func (h *SaleHandler) remainingItems(ctx context.Context, s *sale.Sale) (int, error) {
+	remaining, found, err := h.cache.GetSaleRemaining(ctx, s.ID)
+	if err == nil && found {
+		return remaining, nil
+	}
+
+	remaining = s.TotalItems - s.ItemsSold
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	if ttl := time.Until(s.EndedAt); ttl > 0 {
+		if err := h.cache.SetSaleRemaining(ctx, s.ID, remaining, ttl); err != nil {
+			h.logger.Warn("Failed to cache remaining items", "error", err.Error(), "sale_id", s.ID)
+		}
+	}
+
+	return remaining, nil
+}
+
+func (h *SaleHandler) HandleGetItem(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	itemID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/items/"), "/")
+
+	if itemID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"item_id": "Item ID is required",
+		})
+		return
+	}
+
+	item, err := h.saleRepo.GetItemByID(ctx, itemID)
+	if err != nil {
+		if err != errors.ErrItemNotFound {
+			h.logger.Error("Failed to get item", "error", err.Error(), "item_id", itemID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	itemResponse := ItemDetailResponse{
+		ID:          item.ID,
+		SaleID:      item.SaleID,
+		Name:        item.Name,
+		ImageURL:    item.ImageURL,
+		Price:       item.Price,
+		Description: item.Description,
+		Metadata:    item.Metadata,
+		Sold:        item.Sold,
+	}
+
+	if item.Sold {
+		itemResponse.SoldToUserID = item.SoldToUserID
+		if item.SoldAt != nil {
+			itemResponse.SoldAt = item.SoldAt.Format(time.RFC3339)
+		}
+	}
+
+	response.WriteSuccess(w, itemResponse)
+}
+
+func parsePagination(r *http.Request) (int, int, map[string]string) {
+	limit := defaultItemsLimit
+	offset := 0
+	validationErrors := make(map[string]string)
+
+	query := r.URL.Query()
+	if raw := query.Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			validationErrors["limit"] = "limit must be a positive integer"
+		} else if parsed > maxItemsLimit {
+			limit = maxItemsLimit
+		} else {
+			limit = parsed
+		}
+	}
+
+	if raw := query.Get("offset"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 0 {
+			validationErrors["offset"] = "offset must be a non-negative integer"
+		} else {
+			offset = parsed
+		}
+	}
+
+	return limit, offset, validationErrors
 }
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+)
+
+const saleEventsHeartbeat = 15 * time.Second
+
+// saleEventThresholds are the sold percentages that produce a
+// threshold_crossed event.
+var saleEventThresholds = []int{25, 50, 75, 90, 100}
+
+func (h *SaleHandler) HandleSaleEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	path := strings.TrimPrefix(r.URL.Path, "/sales/")
+	parts := strings.Split(path, "/")
+	saleID := parts[0]
+
+	if saleID == "" {
+		response.WriteValidationError(w, "Validation failed", map[string]string{
+			"sale_id": "Sale ID is required",
+		})
+		return
+	}
+
+	saleEntity, err := h.saleRepo.GetSaleByID(ctx, saleID)
+	if err != nil {
+		if err != errors.ErrSaleNotFound {
+			h.logger.Error("Failed to get sale", "error", err.Error(), "sale_id", saleID)
+		}
+		response.WriteDomainError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout by design.
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	// Sold items are relayed from every replica through Redis. While Redis
+	// is unreachable only this replica's sales, from the in-process bus,
+	// are streamed.
+	events := make(chan monitoring.SaleEvent)
+	itemsSoldIDs, err := h.cache.SubscribeItemSold(ctx, saleID)
+	if err != nil {
+		h.logger.Warn("Sold item subscription failed, streaming local sales only", "error", err.Error(), "sale_id", saleID)
+		events = monitoring.SaleEvents.Subscribe(saleID)
+		defer monitoring.SaleEvents.Unsubscribe(saleID, events)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &saleEventStream{w: w, rc: rc}
+	itemsSold := saleEntity.ItemsSold
+	threshold := crossedThreshold(saleEntity.TotalItems, itemsSold)
+
+	if err := stream.send(newSaleEvent(monitoring.SaleEventSnapshot, saleEntity, itemsSold)); err != nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	if !saleEntity.EndedAt.After(now) {
+		stream.send(newSaleEvent(monitoring.SaleEventSaleEnded, saleEntity, itemsSold))
+		return
+	}
+
+	saleEnded := time.NewTimer(saleEntity.EndedAt.Sub(now))
+	defer saleEnded.Stop()
+
+	heartbeat := time.NewTicker(saleEventsHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		var event monitoring.SaleEvent
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if err := stream.comment("ping"); err != nil {
+				return
+			}
+			continue
+		case <-saleEnded.C:
+			stream.send(newSaleEvent(monitoring.SaleEventSaleEnded, saleEntity, itemsSold))
+			return
+		case itemID, ok := <-itemsSoldIDs:
+			if !ok {
+				// The subscription broke; the client reconnects and gets a
+				// fresh snapshot.
+				return
+			}
+			itemsSold++
+			event = newSaleEvent(monitoring.SaleEventItemsSold, saleEntity, itemsSold)
+			event.ItemID = itemID
+			event.Count = 1
+		case event = <-events:
+			if event.ItemsSold > itemsSold {
+				itemsSold = event.ItemsSold
+			}
+			event.Remaining = remainingPtr(saleEntity.TotalItems, itemsSold)
+		}
+
+		if err := stream.send(event); err != nil {
+			return
+		}
+
+		if crossed := crossedThreshold(saleEntity.TotalItems, itemsSold); crossed > threshold {
+			threshold = crossed
+			thresholdEvent := newSaleEvent(monitoring.SaleEventThresholdCrossed, saleEntity, itemsSold)
+			thresholdEvent.Threshold = crossed
+			if err := stream.send(thresholdEvent); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type saleEventStream struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	nextID int
+}
+
+func (s *saleEventStream) send(event monitoring.SaleEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	s.nextID++
+	if _, err := fmt.Fprintf(s.w, "id: %d\nevent: %s\ndata: %s\n\n", s.nextID, event.Type, data); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func (s *saleEventStream) comment(text string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+func newSaleEvent(eventType string, s *sale.Sale, itemsSold int) monitoring.SaleEvent {
+	return monitoring.SaleEvent{
+		Type:      eventType,
+		SaleID:    s.ID,
+		ItemsSold: itemsSold,
+		Remaining: remainingPtr(s.TotalItems, itemsSold),
+		Timestamp: time.Now().UTC(),
+	}
+}
+
+func remainingPtr(totalItems, itemsSold int) *int {
+	remaining := totalItems - itemsSold
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// crossedThreshold returns the highest threshold the sold percentage has
+// reached, or 0 when none has been reached yet.
+func crossedThreshold(totalItems, itemsSold int) int {
+	if totalItems <= 0 {
+		return 0
+	}
+
+	percent := itemsSold * 100 / totalItems
+	crossed := 0
+	for _, threshold := range saleEventThresholds {
+		if percent >= threshold {
+			crossed = threshold
+		}
+	}
+	return crossed
+}
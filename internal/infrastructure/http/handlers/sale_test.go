@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports/mock"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+)
+
+func TestHandleGetSaleItemsConditional(t *testing.T) {
+	s := fixtures.NewSaleBuilder().WithID("S-etag001").WithItems(10).Build()
+	items := fixtures.NewSaleBuilder().WithID(s.ID).WithItems(10).WithItemsSold(3).BuildItems()
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{name: "no validator", want: http.StatusOK},
+		{name: "matching weak validator", ifNoneMatch: `W/"3-10"`, want: http.StatusNotModified},
+		{name: "matching strong validator", ifNoneMatch: `"3-10"`, want: http.StatusNotModified},
+		{name: "match among several", ifNoneMatch: `"1-10", W/"3-10"`, want: http.StatusNotModified},
+		{name: "wildcard", ifNoneMatch: "*", want: http.StatusNotModified},
+		{name: "stale validator", ifNoneMatch: `W/"2-10"`, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itemsLoaded := false
+			repo := &mock.SaleRepository{
+				OnGetSaleByID: func(ctx context.Context, id string) (*sale.Sale, error) {
+					return s, nil
+				},
+				OnGetSaleSoldCount: func(ctx context.Context, saleID string) (int, error) {
+					return 3, nil
+				},
+				OnGetItemsBySaleID: func(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error) {
+					itemsLoaded = true
+					return items, nil
+				},
+				OnCountItemsBySaleID: func(ctx context.Context, saleID string) (int, error) {
+					return len(items), nil
+				},
+			}
+			h := NewSaleHandler(repo, &mock.Cache{}, logger.NewLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/sales/"+s.ID+"/items", nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			h.HandleGetSaleItems(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.want, rec.Body.String())
+			}
+			if got := rec.Header().Get("ETag"); got != `W/"3-10"` {
+				t.Errorf("ETag = %q, want %q", got, `W/"3-10"`)
+			}
+			if tt.want == http.StatusNotModified {
+				if rec.Body.Len() != 0 {
+					t.Errorf("304 carried a body: %s", rec.Body.String())
+				}
+				if itemsLoaded {
+					t.Error("items were loaded for a 304")
+				}
+			}
+		})
+	}
+}
+
+// Calendar subscriptions poll the upcoming sales; a client repeating the
+// ETag it was given gets 304 in either format.
+func TestHandleGetUpcomingSalesNotModified(t *testing.T) {
+	upcoming := fixtures.NewSaleBuilder().
+		WithID("S-upcoming001").
+		Between(time.Now().Add(time.Hour), time.Now().Add(2*time.Hour)).
+		Build()
+	repo := &mock.SaleRepository{
+		OnGetUpcomingSales: func(ctx context.Context, until time.Time, limit int) ([]*sale.Sale, error) {
+			return []*sale.Sale{upcoming}, nil
+		},
+	}
+	h := NewSaleHandler(repo, &mock.Cache{}, logger.NewLogger())
+
+	for _, query := range []string{"", "?format=ics"} {
+		t.Run("query "+query, func(t *testing.T) {
+			first := httptest.NewRecorder()
+			h.HandleGetUpcomingSales(first, httptest.NewRequest(http.MethodGet, "/sales/upcoming"+query, nil))
+			if first.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200; body %s", first.Code, first.Body.String())
+			}
+			etag := first.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("no ETag on the first response")
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/sales/upcoming"+query, nil)
+			req.Header.Set("If-None-Match", etag)
+			second := httptest.NewRecorder()
+			h.HandleGetUpcomingSales(second, req)
+
+			if second.Code != http.StatusNotModified {
+				t.Fatalf("status = %d, want 304", second.Code)
+			}
+			if second.Body.Len() != 0 {
+				t.Errorf("304 carried a body: %s", second.Body.String())
+			}
+			if got := second.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q on the 304, want %q", got, etag)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{ifNoneMatch: "", want: false},
+		{ifNoneMatch: `"abc"`, want: true},
+		{ifNoneMatch: `W/"abc"`, want: true},
+		{ifNoneMatch: `"xyz", "abc"`, want: true},
+		{ifNoneMatch: `"abcd"`, want: false},
+		{ifNoneMatch: "*", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, `"abc"`); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+const (
+	apiKeyHeader    = "X-API-Key"
+	apiKeyPrefixLen = 8
+)
+
+func NewAPIKeyMiddleware(validKeys []string, log *logger.Logger) func(http.Handler) http.Handler {
+	keys := make([][]byte, 0, len(validKeys))
+	for _, key := range validKeys {
+		if key != "" {
+			keys = append(keys, []byte(key))
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(apiKeyHeader)
+			if key == "" {
+				log.Warn("Admin request without API key",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"remote_addr", r.RemoteAddr,
+				)
+				response.WriteError(w, http.StatusUnauthorized, response.StatusError, "Unauthorized", "missing "+apiKeyHeader+" header")
+				return
+			}
+
+			if !validAPIKey(keys, []byte(key)) {
+				log.Warn("Admin request with invalid API key",
+					"key_prefix", apiKeyPrefix(key),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"remote_addr", r.RemoteAddr,
+				)
+				response.WriteError(w, http.StatusForbidden, response.StatusError, "Forbidden", "invalid API key")
+				return
+			}
+
+			log.Info("Admin request authenticated",
+				"key_prefix", apiKeyPrefix(key),
+				"method", r.Method,
+				"path", r.URL.Path,
+			)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validAPIKey compares against every configured key in constant time so the
+// response latency does not reveal how much of a key matched.
+func validAPIKey(keys [][]byte, key []byte) bool {
+	valid := 0
+	for _, candidate := range keys {
+		valid |= subtle.ConstantTimeCompare(candidate, key)
+	}
+	return valid == 1
+}
+
+func apiKeyPrefix(key string) string {
+	if len(key) <= apiKeyPrefixLen {
+		return key
+	}
+	return key[:apiKeyPrefixLen]
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []string
+		header     string
+		wantStatus int
+	}{
+		{name: "missing key", keys: []string{"admin-key-1"}, header: "", wantStatus: http.StatusUnauthorized},
+		{name: "invalid key", keys: []string{"admin-key-1"}, header: "admin-key-2", wantStatus: http.StatusForbidden},
+		{name: "prefix of a valid key", keys: []string{"admin-key-1"}, header: "admin-key", wantStatus: http.StatusForbidden},
+		{name: "valid key", keys: []string{"admin-key-1"}, header: "admin-key-1", wantStatus: http.StatusOK},
+		{name: "second of several keys", keys: []string{"admin-key-1", "admin-key-2"}, header: "admin-key-2", wantStatus: http.StatusOK},
+		{name: "no keys configured", keys: nil, header: "admin-key-1", wantStatus: http.StatusForbidden},
+		{name: "empty configured key", keys: []string{""}, header: " ", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := NewAPIKeyMiddleware(tt.keys, logger.NewLogger())(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/sales", nil)
+			if tt.header != "" {
+				req.Header.Set(apiKeyHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if wantReached := tt.wantStatus == http.StatusOK; reached != wantReached {
+				t.Errorf("handler reached = %v, want %v", reached, wantReached)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+// NewBodyLimitMiddleware rejects requests whose declared Content-Length
+// exceeds maxBytes with 413, and caps the body of all others at maxBytes so
+// that a handler decoding it stops reading there. Routes that need a larger
+// limit must be wrapped with their own instance outside this one.
+func NewBodyLimitMiddleware(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				response.WriteJSON(w, http.StatusRequestEntityTooLarge, response.Error(
+					response.StatusValidationError,
+					response.CodePayloadTooLarge,
+					fmt.Sprintf("Request body exceeds %d bytes", maxBytes),
+				))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
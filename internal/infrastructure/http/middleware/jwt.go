@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+type contextKey string
+
+const userIDContextKey contextKey = "user_id"
+
+// UserIDFromContext returns the user ID authenticated by the JWT middleware.
+func UserIDFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(userIDContextKey).(string)
+	return userID, ok && userID != ""
+}
+
+// NewJWTMiddleware accepts HMAC-signed bearer tokens and makes their "sub"
+// claim the request's user ID. Tokens must carry an expiry.
+func NewJWTMiddleware(secret []byte) func(http.Handler) http.Handler {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	)
+
+	keyFunc := func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString, ok := bearerToken(r)
+			if !ok {
+				response.WriteError(w, http.StatusUnauthorized, response.StatusUnauthorized, "Unauthorized", "missing bearer token")
+				return
+			}
+
+			var claims jwt.RegisteredClaims
+			if _, err := parser.ParseWithClaims(tokenString, &claims, keyFunc); err != nil {
+				response.WriteError(w, http.StatusUnauthorized, response.StatusUnauthorized, "Unauthorized", "invalid token")
+				return
+			}
+
+			if claims.Subject == "" {
+				response.WriteError(w, http.StatusUnauthorized, response.StatusUnauthorized, "Unauthorized", "token has no subject")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userIDContextKey, claims.Subject)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -16,7 +16,7 @@ func NewLoggingMiddleware(log *logger.Logger) func(http.Handler) http.Handler {
 
 			next.ServeHTTP(wrw, r)
 
-			log.Info("HTTP Request",
+			log.WithContext(r.Context()).Info("HTTP Request",
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", wrw.statusCode,
@@ -37,3 +37,9 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 	w.statusCode = statusCode
 	w.ResponseWriter.WriteHeader(statusCode)
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController so that
+// streaming handlers can flush through this wrapper.
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
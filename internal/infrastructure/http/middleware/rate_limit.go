@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+	"golang.org/x/time/rate"
+)
+
+const maxTrackedLimiters = 100000
+
+type limiterEntry struct {
+	key     string
+	limiter *rate.Limiter
+}
+
+type userRateLimiter struct {
+	mu       sync.RWMutex
+	limiters map[string]*list.Element
+	lru      *list.List
+	rps      rate.Limit
+	burst    int
+	capacity int
+}
+
+func newUserRateLimiter(limit rate.Limit, burstSize, capacity int) *userRateLimiter {
+	return &userRateLimiter{
+		limiters: make(map[string]*list.Element),
+		lru:      list.New(),
+		rps:      limit,
+		burst:    burstSize,
+		capacity: capacity,
+	}
+}
+
+func (l *userRateLimiter) get(key string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if elem, ok := l.limiters[key]; ok {
+		l.lru.MoveToFront(elem)
+		return elem.Value.(*limiterEntry).limiter
+	}
+
+	limiter := rate.NewLimiter(l.rps, l.burst)
+	l.limiters[key] = l.lru.PushFront(&limiterEntry{key: key, limiter: limiter})
+
+	for l.lru.Len() > l.capacity {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.limiters, oldest.Value.(*limiterEntry).key)
+	}
+
+	return limiter
+}
+
+type throttledBucket struct {
+	handler   string
+	limitType string
+	refill    *time.Timer
+}
+
+// throttledBuckets keeps the ActiveRateLimitTokens gauge: a bucket counts
+// from the request it rejects until it has a token again.
+type throttledBuckets struct {
+	mu      sync.Mutex
+	buckets map[string]*throttledBucket
+}
+
+func newThrottledBuckets() *throttledBuckets {
+	return &throttledBuckets{buckets: make(map[string]*throttledBucket)}
+}
+
+// throttle counts the bucket under key as empty for refillIn.
+func (t *throttledBuckets) throttle(key, handler, limitType string, refillIn time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b, ok := t.buckets[key]; ok {
+		b.refill.Stop()
+		monitoring.RecordRateLimitBucketRefilled(b.handler, b.limitType)
+	}
+
+	b := &throttledBucket{handler: handler, limitType: limitType}
+	b.refill = time.AfterFunc(refillIn, func() { t.refilled(key, b) })
+	t.buckets[key] = b
+	monitoring.RecordRateLimitBucketThrottled(handler, limitType)
+}
+
+func (t *throttledBuckets) refilled(key string, b *throttledBucket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A later rejection replaced the bucket and counts it until its own
+	// refill.
+	if t.buckets[key] != b {
+		return
+	}
+	delete(t.buckets, key)
+	monitoring.RecordRateLimitBucketRefilled(b.handler, b.limitType)
+}
+
+// NewRateLimitMiddleware limits each user, or each client IP for anonymous
+// requests, to requestsPerSecond. A rate of 0 or less disables the limit.
+func NewRateLimitMiddleware(requestsPerSecond int, burstSize int) func(http.Handler) http.Handler {
+	if requestsPerSecond <= 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return newRateLimitMiddleware(rate.Limit(requestsPerSecond), burstSize, rateLimitKey)
+}
+
+// NewAdminRateLimitMiddleware allows each user one request per interval.
+// Admins share API keys, so users are told apart as by
+// NewRateLimitMiddleware: by their token, their user_id parameter or, for
+// neither, their client IP.
+func NewAdminRateLimitMiddleware(interval time.Duration) func(http.Handler) http.Handler {
+	return newRateLimitMiddleware(rate.Every(interval), 1, rateLimitKey)
+}
+
+func newRateLimitMiddleware(limit rate.Limit, burstSize int, keyFunc func(*http.Request) (string, string)) func(http.Handler) http.Handler {
+	limiters := newUserRateLimiter(limit, burstSize, maxTrackedLimiters)
+	throttled := newThrottledBuckets()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, limitType := keyFunc(r)
+			limiter := limiters.get(key)
+			handler := handlerName(r)
+
+			reservation := limiter.Reserve()
+			if !reservation.OK() {
+				throttled.throttle(key, handler, limitType, time.Second)
+				writeRateLimited(w, handler, limitType, time.Second)
+				return
+			}
+
+			if delay := reservation.Delay(); delay > 0 {
+				reservation.Cancel()
+				throttled.throttle(key, handler, limitType, delay)
+				writeRateLimited(w, handler, limitType, delay)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, handler, limitType string, retryAfter time.Duration) {
+	monitoring.RecordRateLimitExceeded(handler, limitType)
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	response.WriteError(w, http.StatusTooManyRequests, response.StatusError, "Too many requests", "rate limit exceeded")
+}
+
+const (
+	limitTypeUser = "user"
+	limitTypeIP   = "ip"
+)
+
+// rateLimitKey returns the bucket key for the request and whether it is
+// limited per user or, for anonymous requests, per client IP.
+func rateLimitKey(r *http.Request) (string, string) {
+	if userID, ok := UserIDFromContext(r.Context()); ok {
+		return "user:" + userID, limitTypeUser
+	}
+	if userID := r.URL.Query().Get("user_id"); userID != "" {
+		return "user:" + userID, limitTypeUser
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host, limitTypeIP
+}
+
+func handlerName(r *http.Request) string {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" {
+		return "root"
+	}
+	return strings.Split(path, "/")[0]
+}
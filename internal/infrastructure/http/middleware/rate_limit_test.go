@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+)
+
+func TestRateLimitCountsRejectionsByLimitType(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    string
+		limitType string
+	}{
+		{name: "per user", target: "/checkout?user_id=rate-limit-user", limitType: limitTypeUser},
+		{name: "per IP", target: "/checkout", limitType: limitTypeIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			handler := NewRateLimitMiddleware(1, 1)(next)
+			rejected := monitoring.RateLimitExceededTotal.WithLabelValues("checkout", tt.limitType)
+			before := testutil.ToFloat64(rejected)
+
+			codes := make([]int, 3)
+			for i := range codes {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.target, nil))
+				codes[i] = rec.Code
+			}
+
+			if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || codes[2] != http.StatusTooManyRequests {
+				t.Fatalf("status codes = %v, want one 200 then 429s", codes)
+			}
+			if got := testutil.ToFloat64(rejected) - before; got != 2 {
+				t.Errorf("rejections counted = %v, want 2", got)
+			}
+		})
+	}
+}
+
+// A bucket counts as throttled from the request it rejects until it has a
+// token again.
+func TestRateLimitTracksThrottledBuckets(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewRateLimitMiddleware(10, 1)(next)
+	throttled := monitoring.ActiveRateLimitTokens.WithLabelValues("throttle-test", limitTypeUser)
+	before := testutil.ToFloat64(throttled)
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/throttle-test?user_id=throttled-user", nil))
+	}
+	// Two rejections of one bucket count it once.
+	if got := testutil.ToFloat64(throttled) - before; got != 1 {
+		t.Fatalf("throttled buckets = %v more, want 1", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(throttled) != before {
+		if time.Now().After(deadline) {
+			t.Fatalf("throttled buckets = %v more after the refill, want 0", testutil.ToFloat64(throttled)-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Admins share API keys, so exports are limited per user rather than per
+// key: one admin's export does not block another's.
+func TestAdminRateLimitIsPerUser(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := NewAdminRateLimitMiddleware(time.Minute)(next)
+
+	serve := func(r *http.Request) int {
+		r.Header.Set(apiKeyHeader, "shared-admin-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	export := func(query string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, "/admin/sales/S-export001/purchases/export"+query, nil)
+	}
+	withToken := func(userID string) *http.Request {
+		r := export("")
+		return r.WithContext(context.WithValue(r.Context(), userIDContextKey, userID))
+	}
+
+	steps := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{name: "first export of alice", req: export("?user_id=alice"), want: http.StatusOK},
+		{name: "second export of alice", req: export("?user_id=alice"), want: http.StatusTooManyRequests},
+		{name: "bob with the same key", req: export("?user_id=bob"), want: http.StatusOK},
+		{name: "carol by token", req: withToken("carol"), want: http.StatusOK},
+		{name: "carol again by token", req: withToken("carol"), want: http.StatusTooManyRequests},
+	}
+
+	for _, step := range steps {
+		if got := serve(step.req); got != step.want {
+			t.Errorf("%s: status = %d, want %d", step.name, got, step.want)
+		}
+	}
+}
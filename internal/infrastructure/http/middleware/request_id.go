@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	traceIDHeader      = "X-Trace-ID"
+	maxRequestIDLength = 128
+)
+
+// NewRequestIDMiddleware keeps the caller's X-Request-ID, or generates one,
+// stores it in the request context for logging and sends it back. It also
+// sets X-Trace-ID to the request ID; the tracing middleware replaces that
+// with the real trace ID when the request is traced.
+func NewRequestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := r.Header.Get(requestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = uuid.NewString()
+			}
+
+			w.Header().Set(requestIDHeader, requestID)
+			w.Header().Set(traceIDHeader, requestID)
+
+			next.ServeHTTP(w, r.WithContext(logger.ContextWithRequestID(r.Context(), requestID)))
+		})
+	}
+}
+
+// validRequestID accepts printable ASCII only, so a client-supplied ID can
+// neither break the log format nor smuggle header content.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracingMiddleware continues the trace from an incoming traceparent
+// header, or starts a new one, and makes the request span available to
+// handlers through the request context.
+func NewTracingMiddleware(tracer trace.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("user_agent.original", r.UserAgent()),
+				),
+			)
+			defer span.End()
+
+			if spanContext := span.SpanContext(); spanContext.IsValid() {
+				w.Header().Set(traceIDHeader, spanContext.TraceID().String())
+			}
+
+			wrw := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
+
+			next.ServeHTTP(wrw, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", wrw.statusCode))
+			if wrw.statusCode >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(wrw.statusCode))
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package response
 import (
 	"errors"
 	"net/http"
+	"sort"
 
 	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
 )
@@ -10,100 +11,184 @@ import (
 type ErrorMapping struct {
 	HTTPStatus int
 	Status     Status
+	Code       string
 	Message    string
 }
 
+// CodeInternalError is sent for errors that have no domain mapping.
+const CodeInternalError = "INTERNAL_ERROR"
+
+// CodePayloadTooLarge is sent when a request body exceeds the size limit.
+const CodePayloadTooLarge = "PAYLOAD_TOO_LARGE"
+
 var errorMappings = map[error]ErrorMapping{
 	domainErrors.ErrSaleNotFound: {
 		HTTPStatus: http.StatusNotFound,
 		Status:     StatusNotFound,
+		Code:       domainErrors.ErrCodeSaleNotFound,
 		Message:    "Sale not found",
 	},
 	domainErrors.ErrSaleNotActive: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeSaleNotActive,
 		Message:    "Sale is not active",
 	},
+	domainErrors.ErrSaleNotYetStarted: {
+		HTTPStatus: http.StatusTooEarly,
+		Status:     StatusError,
+		Code:       domainErrors.ErrCodeSaleNotYetStarted,
+		Message:    "Sale has not started yet",
+	},
 	domainErrors.ErrSaleOutOfStock: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeSaleOutOfStock,
 		Message:    "Sale is out of stock",
 	},
 	domainErrors.ErrSaleLimitExceeded: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeSaleLimitExceeded,
 		Message:    "Purchase would exceed sale limit",
 	},
 	domainErrors.ErrNoItemsToPurchase: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeNoItemsToPurchase,
 		Message:    "No items to purchase",
 	},
 	domainErrors.ErrItemNotFound: {
 		HTTPStatus: http.StatusNotFound,
 		Status:     StatusNotFound,
+		Code:       domainErrors.ErrCodeItemNotFound,
 		Message:    "Item not found",
 	},
 	domainErrors.ErrItemAlreadySold: {
 		HTTPStatus: http.StatusConflict,
 		Status:     StatusConflict,
+		Code:       domainErrors.ErrCodeItemAlreadySold,
 		Message:    "Items already sold",
 	},
 	domainErrors.ErrItemNotInSale: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeItemNotInSale,
 		Message:    "Item not in current sale",
 	},
 	domainErrors.ErrAllItemsSold: {
 		HTTPStatus: http.StatusConflict,
 		Status:     StatusConflict,
+		Code:       domainErrors.ErrCodeAllItemsSold,
 		Message:    "All items from checkout already sold",
 	},
+	domainErrors.ErrItemNotSold: {
+		HTTPStatus: http.StatusConflict,
+		Status:     StatusConflict,
+		Code:       domainErrors.ErrCodeItemNotSold,
+		Message:    "Item has not been sold",
+	},
 	domainErrors.ErrCheckoutNotFound: {
 		HTTPStatus: http.StatusNotFound,
 		Status:     StatusNotFound,
+		Code:       domainErrors.ErrCodeCheckoutNotFound,
 		Message:    "Checkout not found",
 	},
+	domainErrors.ErrInvalidCheckoutCode: {
+		HTTPStatus: http.StatusBadRequest,
+		Status:     StatusValidationError,
+		Code:       domainErrors.ErrCodeInvalidCheckoutCode,
+		Message:    "Invalid checkout code",
+	},
 	domainErrors.ErrCheckoutExpired: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeCheckoutExpired,
 		Message:    "Checkout expired",
 	},
+	domainErrors.ErrCheckoutExpiredTTL: {
+		HTTPStatus: http.StatusGone,
+		Status:     StatusError,
+		Code:       domainErrors.ErrCodeCheckoutExpiredTTL,
+		Message:    "Checkout has expired",
+	},
 	domainErrors.ErrItemAlreadyInCheckout: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeItemAlreadyInCheckout,
 		Message:    "Item already in checkout",
 	},
 	domainErrors.ErrUserAlreadyCheckedOutItem: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeUserAlreadyCheckedOutItem,
 		Message:    "User already checked out this item",
 	},
 	domainErrors.ErrUserLimitExceeded: {
 		HTTPStatus: http.StatusBadRequest,
 		Status:     StatusError,
+		Code:       domainErrors.ErrCodeUserLimitExceeded,
 		Message:    "User has reached maximum items limit",
 	},
 	domainErrors.ErrCheckoutAlreadyProcessed: {
 		HTTPStatus: http.StatusConflict,
 		Status:     StatusConflict,
+		Code:       domainErrors.ErrCodeCheckoutAlreadyProcessed,
 		Message:    "Checkout code has already been processed",
 	},
+	domainErrors.ErrPurchaseResultNotFound: {
+		HTTPStatus: http.StatusNotFound,
+		Status:     StatusNotFound,
+		Code:       domainErrors.ErrCodePurchaseResultNotFound,
+		Message:    "Purchase result not found",
+	},
+	domainErrors.ErrInvalidPurchaseResult: {
+		HTTPStatus: http.StatusBadRequest,
+		Status:     StatusValidationError,
+		Code:       domainErrors.ErrCodeInvalidPurchaseResult,
+		Message:    "Purchase result is not valid JSON",
+	},
+	domainErrors.ErrRefundWindowClosed: {
+		HTTPStatus: http.StatusConflict,
+		Status:     StatusConflict,
+		Code:       domainErrors.ErrCodeRefundWindowClosed,
+		Message:    "Refund window has closed",
+	},
+	domainErrors.ErrItemNotOwnedByUser: {
+		HTTPStatus: http.StatusBadRequest,
+		Status:     StatusError,
+		Code:       domainErrors.ErrCodeItemNotOwnedByUser,
+		Message:    "Item was not sold to this user",
+	},
 	domainErrors.ErrTransactionFailed: {
 		HTTPStatus: http.StatusInternalServerError,
 		Status:     StatusInternalError,
+		Code:       domainErrors.ErrCodeTransactionFailed,
 		Message:    "Transaction failed",
 	},
 }
 
+// ErrorMappings returns every domain error mapping ordered by code, for
+// documenting the error responses the API can send.
+func ErrorMappings() []ErrorMapping {
+	mappings := make([]ErrorMapping, 0, len(errorMappings))
+	for _, mapping := range errorMappings {
+		mappings = append(mappings, mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Code < mappings[j].Code
+	})
+	return mappings
+}
+
 func MapDomainError(err error) (int, *ErrorResponse) {
 	for domainErr, mapping := range errorMappings {
 		if errors.Is(err, domainErr) {
-			return mapping.HTTPStatus, Error(mapping.Status, mapping.Message, err.Error())
+			return mapping.HTTPStatus, Error(mapping.Status, mapping.Code, mapping.Message, err.Error())
 		}
 	}
 
-	return http.StatusInternalServerError, Error(StatusInternalError, "Internal server error", err.Error())
+	return http.StatusInternalServerError, Error(StatusInternalError, CodeInternalError, "Internal server error", err.Error())
 }
 
 func WriteDomainError(w http.ResponseWriter, err error) {
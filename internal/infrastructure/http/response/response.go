@@ -2,6 +2,7 @@ package response
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -45,11 +46,12 @@ func Success[T any](data T, message ...string) *DataResponse[T] {
 	}
 }
 
-func Error(status Status, message string, errorDetails ...string) *ErrorResponse {
+func Error(status Status, code, message string, errorDetails ...string) *ErrorResponse {
 	return &ErrorResponse{
 		BaseResponse: BaseResponse{
 			Message: message,
 		},
+		Code: code,
 	}
 }
 
@@ -72,9 +74,20 @@ func WriteSuccess[T any](w http.ResponseWriter, data T, message ...string) {
 }
 
 func WriteError(w http.ResponseWriter, statusCode int, status Status, message string, errorDetails ...string) {
-	WriteJSON(w, statusCode, Error(status, message, errorDetails...))
+	WriteJSON(w, statusCode, Error(status, "", message, errorDetails...))
 }
 
 func WriteValidationError(w http.ResponseWriter, message string, errors map[string]string) {
 	WriteJSON(w, http.StatusBadRequest, ValidationError(message, errors))
 }
+
+// WriteBodyError reports a request body that could not be decoded, with 413
+// when it was cut off by the body size limit and 400 otherwise.
+func WriteBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteJSON(w, http.StatusRequestEntityTooLarge, Error(StatusValidationError, CodePayloadTooLarge, "Request body too large"))
+		return
+	}
+	WriteError(w, http.StatusBadRequest, StatusValidationError, "Invalid request body", err.Error())
+}
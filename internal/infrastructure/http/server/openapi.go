@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+	"github.com/yuzvak/flashsale-service/internal/pkg/openapi"
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIDocs renders the spec once, on the first request for it.
+var openAPIDocs = sync.OnceValues(func() (map[string][]byte, error) {
+	spec := openapi.GenerateSpec()
+
+	jsonDoc, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var yamlDoc bytes.Buffer
+	encoder := yaml.NewEncoder(&yamlDoc)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(spec); err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{
+		"application/json": jsonDoc,
+		"application/yaml": yamlDoc.Bytes(),
+	}, nil
+})
+
+func (s *Server) handleOpenAPI(contentType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		docs, err := openAPIDocs()
+		if err != nil {
+			s.logger.Error("Failed to render OpenAPI spec", "error", err)
+			response.WriteError(w, http.StatusInternalServerError, response.StatusInternalError, "Failed to render OpenAPI spec")
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(docs[contentType])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/yuzvak/flashsale-service/internal/config"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/middleware"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 )
@@ -14,26 +15,74 @@ func (s *Server) setupRoutes() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/openapi.json", s.handleOpenAPI("application/json"))
+	mux.HandleFunc("/openapi.yaml", s.handleOpenAPI("application/yaml"))
 
 	mux.HandleFunc("/health", s.healthHandler.HandleHealth())
+	mux.HandleFunc("/readiness", s.healthHandler.HandleReadiness())
+	mux.HandleFunc("/liveness", s.healthHandler.HandleLiveness())
 
 	mux.HandleFunc("/sales/active", s.saleHandler.HandleGetActiveSale)
+	mux.HandleFunc("/sales/upcoming", s.saleHandler.HandleGetUpcomingSales)
 	mux.HandleFunc("/sales/", s.handleSaleRoutes)
-	mux.HandleFunc("/checkout", s.checkoutHandler.HandleCheckout())
-	mux.HandleFunc("/purchase", s.purchaseHandler.HandlePurchase())
-	mux.HandleFunc("/admin/sales", s.adminHandler.HandleCreateSale)
+	mux.HandleFunc("/items/", s.handleItemRoutes)
+	var checkoutHandler http.Handler = s.checkoutHandler.HandleCheckout()
+	checkoutHandler = s.rateLimitMiddleware(s.rateLimit.CheckoutRPS)(checkoutHandler)
+	if len(s.jwtSecret) > 0 {
+		checkoutHandler = middleware.NewJWTMiddleware(s.jwtSecret)(checkoutHandler)
+	}
+	mux.Handle("/checkout", checkoutHandler)
+	mux.Handle("/purchase", s.rateLimitMiddleware(s.rateLimit.PurchaseRPS)(s.purchaseHandler.HandlePurchase()))
+	mux.HandleFunc("/purchase/status", s.purchaseHandler.HandlePurchaseStatus())
+
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("/admin/sales", s.handleAdminSalesCollection)
+	adminMux.HandleFunc("/admin/sales/", s.handleAdminSaleRoutes)
+	adminMux.HandleFunc("/admin/purchase-results/", s.handleAdminPurchaseResultRoutes)
+	adminMux.HandleFunc("/admin/refund", s.handleAdminRefund)
+	mux.Handle("/admin/", middleware.NewAPIKeyMiddleware(s.adminAPIKeys, s.logger)(adminMux))
 
-	handler := middleware.NewRecoveryMiddleware(s.logger)(mux)
+	// Internal endpoints are for operators and take the admin API keys.
+	internalMux := http.NewServeMux()
+	internalMux.HandleFunc("/internal/scheduler/status", s.internalHandler.HandleSchedulerStatus)
+	mux.Handle("/internal/", middleware.NewAPIKeyMiddleware(s.adminAPIKeys, s.logger)(internalMux))
+
+	handler := s.rateLimitMiddleware(s.rateLimit.GlobalRPS)(mux)
+	handler = s.bodyLimitMiddleware(handler)
+	handler = middleware.NewRecoveryMiddleware(s.logger)(handler)
 	handler = middleware.NewLoggingMiddleware(s.logger)(handler)
+	handler = middleware.NewTracingMiddleware(s.tracer)(handler)
+	handler = middleware.NewRequestIDMiddleware()(handler)
 	handler = monitoring.WrapHandler(handler)
-	handler = s.corsMiddleware(handler)
+	if s.cors.enabled() {
+		handler = s.corsMiddleware(handler)
+	}
 	handler = s.timeoutMiddleware(handler)
 
 	return handler
 }
 
+// bodyLimitMiddleware caps request bodies at the configured limit, except
+// item imports, which carry a whole catalog and get a limit of their own.
+func (s *Server) bodyLimitMiddleware(next http.Handler) http.Handler {
+	limited := middleware.NewBodyLimitMiddleware(s.maxBodyBytes)(next)
+	imports := middleware.NewBodyLimitMiddleware(s.maxImportBytes)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/admin/sales/") && strings.HasSuffix(r.URL.Path, "/items/import") {
+			imports.ServeHTTP(w, r)
+			return
+		}
+		limited.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) rateLimitMiddleware(rps int) func(http.Handler) http.Handler {
+	return middleware.NewRateLimitMiddleware(rps, s.rateLimit.Burst(rps))
+}
+
 func (s *Server) handleSaleRoutes(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/api/v1/sales/")
+	path := strings.TrimPrefix(r.URL.Path, "/sales/")
 	parts := strings.Split(path, "/")
 
 	if len(parts) == 1 && parts[0] != "" {
@@ -46,18 +95,199 @@ func (s *Server) handleSaleRoutes(w http.ResponseWriter, r *http.Request) {
 			s.saleHandler.HandleGetSaleItems(w, r)
 			return
 		}
+	} else if len(parts) == 2 && parts[1] == "remaining" {
+		if r.Method == http.MethodGet {
+			s.saleHandler.HandleGetSaleRemaining(w, r)
+			return
+		}
+	} else if len(parts) == 2 && parts[1] == "events" {
+		if r.Method == http.MethodGet {
+			s.saleHandler.HandleSaleEvents(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (s *Server) handleItemRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/items/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 1 && parts[0] != "" {
+		if r.Method == http.MethodGet {
+			s.saleHandler.HandleGetItem(w, r)
+			return
+		}
 	}
 
 	http.NotFound(w, r)
 }
 
+func (s *Server) handleAdminSalesCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.adminHandler.HandleListSales(w, r)
+	case http.MethodPost:
+		s.adminHandler.HandleCreateSale(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleAdminSaleRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/sales/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 1 && parts[0] != "" {
+		if r.Method == http.MethodPatch {
+			s.adminHandler.HandleUpdateSale(w, r)
+			return
+		}
+	} else if len(parts) == 2 && parts[1] == "items" {
+		if r.Method == http.MethodPost {
+			s.adminHandler.HandleAddItemsToSale(w, r)
+			return
+		}
+	} else if len(parts) == 3 && parts[0] != "" && parts[1] == "items" && parts[2] == "import" {
+		if r.Method == http.MethodPost {
+			s.adminHandler.HandleImportItems(w, r)
+			return
+		}
+	} else if len(parts) == 2 && parts[0] != "" && parts[1] == "stats" {
+		if r.Method == http.MethodGet {
+			s.adminHandler.HandleGetSaleStats(w, r)
+			return
+		}
+	} else if len(parts) == 2 && parts[1] == "cancel" {
+		if r.Method == http.MethodPost {
+			s.adminHandler.HandleCancelSale(w, r)
+			return
+		}
+	} else if len(parts) == 3 && parts[0] != "" && parts[1] == "purchases" {
+		if r.Method == http.MethodGet {
+			switch parts[2] {
+			case "stats":
+				s.adminHandler.HandleGetPurchaseStats(w, r)
+				return
+			case "timeseries":
+				s.adminHandler.HandleGetPurchaseTimeSeries(w, r)
+				return
+			case "export":
+				s.purchaseExport.ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func (s *Server) handleAdminRefund(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s.adminHandler.HandleRefund(w, r)
+}
+
+func (s *Server) handleAdminPurchaseResultRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/purchase-results/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 1 && parts[0] != "" {
+		switch r.Method {
+		case http.MethodGet:
+			s.adminHandler.HandleGetPurchaseResult(w, r)
+			return
+		case http.MethodPut:
+			s.adminHandler.HandleRepairPurchaseResult(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+const (
+	defaultCORSMethods = "GET, POST, PUT, PATCH, OPTIONS"
+	defaultCORSHeaders = "Accept, Authorization, Content-Type, Idempotency-Key, If-None-Match, X-API-Key, X-CSRF-Token, X-Correlation-ID, X-Request-ID"
+)
+
+type corsPolicy struct {
+	origins   map[string]struct{}
+	anyOrigin bool
+	methods   string
+	headers   string
+}
+
+func newCORSPolicy(cfg config.ServerConfig) corsPolicy {
+	policy := corsPolicy{
+		origins: make(map[string]struct{}, len(cfg.AllowedOrigins)),
+		methods: defaultCORSMethods,
+		headers: defaultCORSHeaders,
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			policy.anyOrigin = true
+			continue
+		}
+		policy.origins[strings.TrimSuffix(origin, "/")] = struct{}{}
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		policy.methods = strings.Join(cfg.AllowedMethods, ", ")
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		policy.headers = strings.Join(cfg.AllowedHeaders, ", ")
+	}
+	return policy
+}
+
+func (p corsPolicy) enabled() bool {
+	return p.anyOrigin || len(p.origins) > 0
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin and
+// whether credentials may be sent with it. Listed origins are echoed back;
+// any other origin only gets the literal "*", which browsers never combine
+// with credentials.
+func (p corsPolicy) allowOrigin(origin string) (string, bool) {
+	if _, ok := p.origins[origin]; ok {
+		return origin, true
+	}
+	if p.anyOrigin {
+		return "*", false
+	}
+	return "", false
+}
+
+// corsMiddleware echoes listed origins back and allows credentials for them.
+// With "*" configured, other origins get "*" and no credentials, so a page
+// from any site cannot make requests with the user's cookies. Requests from
+// origins that are not allowed get no CORS headers, so the browser blocks
+// them.
 func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, X-CSRF-Token")
-		w.Header().Set("Access-Control-Expose-Headers", "Link")
-		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowOrigin, credentials := s.cors.allowOrigin(origin)
+		if allowOrigin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", s.cors.methods)
+		w.Header().Set("Access-Control-Allow-Headers", s.cors.headers)
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, X-Correlation-ID, X-Request-ID, X-Trace-ID, X-Total-Count")
+		if credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
 		w.Header().Set("Access-Control-Max-Age", "300")
 
 		if r.Method == http.MethodOptions {
@@ -69,6 +299,28 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// timeoutMiddleware bounds every request except event streams and purchase
+// exports, which are long-lived by design and need a flushable response
+// writer.
 func (s *Server) timeoutMiddleware(next http.Handler) http.Handler {
-	return http.TimeoutHandler(next, 90*time.Second, "Request timeout")
+	timeout := http.TimeoutHandler(next, 90*time.Second, "Request timeout")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isEventStream(r) || isPurchaseExport(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		timeout.ServeHTTP(w, r)
+	})
+}
+
+func isEventStream(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/sales/") && strings.HasSuffix(r.URL.Path, "/events")
+}
+
+// isPurchaseExport reports whether r downloads a sale's purchases, which is
+// streamed and sets its own write deadline.
+func isPurchaseExport(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/admin/sales/") && strings.HasSuffix(r.URL.Path, "/purchases/export")
 }
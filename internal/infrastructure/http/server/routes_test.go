@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yuzvak/flashsale-service/internal/config"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		allowedOrigins  []string
+		origin          string
+		wantOrigin      string
+		wantCredentials bool
+	}{
+		{name: "listed origin is echoed", allowedOrigins: []string{"https://shop.example.com"}, origin: "https://shop.example.com", wantOrigin: "https://shop.example.com", wantCredentials: true},
+		{name: "trailing slash in config", allowedOrigins: []string{"https://shop.example.com/"}, origin: "https://shop.example.com", wantOrigin: "https://shop.example.com", wantCredentials: true},
+		{name: "unlisted origin", allowedOrigins: []string{"https://shop.example.com"}, origin: "https://evil.example.com"},
+		{name: "wildcard sends a literal star", allowedOrigins: []string{"*"}, origin: "https://evil.example.com", wantOrigin: "*"},
+		{name: "listed origin next to wildcard", allowedOrigins: []string{"*", "https://shop.example.com"}, origin: "https://shop.example.com", wantOrigin: "https://shop.example.com", wantCredentials: true},
+		{name: "wildcard without origin header", allowedOrigins: []string{"*"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{cors: newCORSPolicy(config.ServerConfig{AllowedOrigins: tt.allowedOrigins})}
+			handler := s.corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/sales", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			credentials := rec.Header().Get("Access-Control-Allow-Credentials") == "true"
+			if credentials != tt.wantCredentials {
+				t.Errorf("credentials allowed = %v, want %v", credentials, tt.wantCredentials)
+			}
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want the handler's %d", rec.Code, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	cfg, err := config.LoadConfig("../../../../config.json")
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if newCORSPolicy(cfg.Server).enabled() {
+		t.Errorf("bundled config enables CORS for %v", cfg.Server.AllowedOrigins)
+	}
+}
@@ -5,16 +5,27 @@ import (
 	"database/sql"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/application/use_cases"
 	"github.com/yuzvak/flashsale-service/internal/config"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/handlers"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/middleware"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/acme/autocert"
 )
 
+// purchaseExportInterval is how often each user may export a sale's
+// purchases; an export reads every purchase of the sale.
+const purchaseExportInterval = time.Minute
+
 type Server struct {
 	server          *http.Server
 	logger          *logger.Logger
@@ -23,18 +34,38 @@ type Server struct {
 	checkoutHandler *handlers.CheckoutHandler
 	purchaseHandler *handlers.PurchaseHandler
 	adminHandler    *handlers.AdminHandler
+	internalHandler *handlers.InternalHandler
+	purchaseExport  http.Handler
+	adminAPIKeys    []string
+	jwtSecret       []byte
+	cors            corsPolicy
+	maxBodyBytes    int64
+	maxImportBytes  int64
+	rateLimit       config.RateLimitConfig
+	tlsEnabled      bool
+	tlsCertFile     string
+	tlsKeyFile      string
+	autocert        *autocert.Manager
+	tracer          trace.Tracer
 }
 
-func NewServer(cfg *config.Config, db *sql.DB, redisConn *redis.Connection, logger *logger.Logger) *Server {
-	conn, err := postgres.NewConnection(cfg.Database)
+// NewServer wires the handlers to cache, which the caller shares with its
+// background jobs.
+func NewServer(
+	cfg *config.Config,
+	db *sql.DB,
+	redisConn *redis.Connection,
+	cache ports.Cache,
+	scheduler handlers.SchedulerStatusProvider,
+	logger *logger.Logger,
+) *Server {
+	conn, err := postgres.NewConnection(cfg.Database, logger)
 	if err != nil {
 		logger.Fatal("Failed to connect to database", "error", err)
 	}
 	saleRepo := postgres.NewSaleRepository(conn)
 	checkoutRepo := postgres.NewCheckoutRepository(conn)
 
-	cache := redis.NewCache(redisConn, logger)
-
 	purchaseUseCase := use_cases.NewPurchaseUseCase(
 		saleRepo,
 		checkoutRepo,
@@ -42,11 +73,21 @@ func NewServer(cfg *config.Config, db *sql.DB, redisConn *redis.Connection, logg
 		logger,
 	)
 
-	saleHandler := handlers.NewSaleHandler(saleRepo, logger)
-	checkoutHandler := handlers.NewCheckoutHandler(saleRepo, checkoutRepo, cache, logger)
-	purchaseHandler := handlers.NewPurchaseHandler(purchaseUseCase, logger)
-	adminHandler := handlers.NewAdminHandler(saleRepo, logger)
-	healthHandler := handlers.NewHealthHandler(db, redisConn.GetClient(), logger)
+	codeGen := generator.NewCodeGenerator([]byte(cfg.Cache.CheckoutHMACSecret), cfg.Cache.CheckoutCodePrefix)
+
+	saleHandler := handlers.NewSaleHandler(saleRepo, cache, logger)
+	checkoutHandler := handlers.NewCheckoutHandler(saleRepo, checkoutRepo, cache, cfg.Cache.CheckoutTTL(), codeGen, logger)
+	purchaseHandler := handlers.NewPurchaseHandler(purchaseUseCase, cache, cfg.Cache.IdempotencyTTL(), codeGen, logger)
+	adminHandler := handlers.NewAdminHandler(saleRepo, postgres.NewPurchaseRepository(conn), checkoutRepo, cache, cfg.Sale.RefundWindow(), logger)
+	healthHandler := handlers.NewHealthHandler(db, redisConn.GetClient(), cfg.Server.GoroutineLimit(), scheduler, logger)
+	internalHandler := handlers.NewInternalHandler(scheduler)
+
+	purchaseExport := middleware.NewAdminRateLimitMiddleware(purchaseExportInterval)(http.HandlerFunc(adminHandler.HandleExportPurchases))
+	if cfg.Auth.JWTSecret != "" {
+		// The export is limited per user, so with tokens enabled the caller
+		// has to present one rather than name themselves.
+		purchaseExport = middleware.NewJWTMiddleware([]byte(cfg.Auth.JWTSecret))(purchaseExport)
+	}
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port),
@@ -55,6 +96,18 @@ func NewServer(cfg *config.Config, db *sql.DB, redisConn *redis.Connection, logg
 		IdleTimeout:  120 * time.Second,
 	}
 
+	var certManager *autocert.Manager
+	if cfg.Server.TLSEnabled && cfg.Server.TLSAutoTLS {
+		// The manager answers tls-alpn-01 challenges on this listener, so
+		// port 80 does not need to be served.
+		certManager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(cfg.Server.AutocertCacheDir()),
+			HostPolicy: autocert.HostWhitelist(cfg.Server.TLSDomains...),
+		}
+		server.TLSConfig = certManager.TLSConfig()
+	}
+
 	return &Server{
 		server:          server,
 		logger:          logger,
@@ -63,6 +116,19 @@ func NewServer(cfg *config.Config, db *sql.DB, redisConn *redis.Connection, logg
 		checkoutHandler: checkoutHandler,
 		purchaseHandler: purchaseHandler,
 		adminHandler:    adminHandler,
+		internalHandler: internalHandler,
+		purchaseExport:  purchaseExport,
+		adminAPIKeys:    cfg.Admin.APIKeys,
+		jwtSecret:       []byte(cfg.Auth.JWTSecret),
+		cors:            newCORSPolicy(cfg.Server),
+		maxBodyBytes:    cfg.Server.RequestBodyLimit(),
+		maxImportBytes:  cfg.Server.ImportBodyLimit(),
+		rateLimit:       cfg.RateLimit,
+		tlsEnabled:      cfg.Server.TLSEnabled,
+		tlsCertFile:     cfg.Server.TLSCertFile,
+		tlsKeyFile:      cfg.Server.TLSKeyFile,
+		autocert:        certManager,
+		tracer:          tracing.Tracer(),
 	}
 }
 
@@ -71,9 +137,35 @@ func (s *Server) ListenAndServe() error {
 
 	s.logger.Info("Starting HTTP server", map[string]interface{}{
 		"address": s.server.Addr,
+		"tls":     s.tlsEnabled,
 	})
 
-	return s.server.ListenAndServe()
+	switch {
+	case s.autocert != nil:
+		return s.server.ListenAndServeTLS("", "")
+	case s.tlsEnabled:
+		if err := checkTLSFiles(s.tlsCertFile, s.tlsKeyFile); err != nil {
+			return err
+		}
+		return s.server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	default:
+		return s.server.ListenAndServe()
+	}
+}
+
+// checkTLSFiles fails before the port is bound if the certificate or key
+// cannot be read.
+func checkTLSFiles(files ...string) error {
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+		if info.IsDir() {
+			return fmt.Errorf("tls: %s is a directory", file)
+		}
+	}
+	return nil
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
@@ -6,10 +6,28 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v4/stdlib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const dbTracerName = "github.com/yuzvak/flashsale-service/db"
+
+// CheckoutCounter reads the checkouts held per sale from the database.
+type CheckoutCounter interface {
+	GetCheckoutSaleIDs(ctx context.Context) ([]string, error)
+	CountActiveCheckoutsBySale(ctx context.Context, saleID string) (int, error)
+	CountActiveCheckoutItemsBySale(ctx context.Context, saleID string) (int, error)
+}
+
 type DBMetricsCollector struct {
-	db *sql.DB
+	db       *sql.DB
+	checkout CheckoutCounter
+
+	// checkoutSales holds the sales whose checkout gauges were last set, so
+	// a sale whose checkouts are all gone is set back to zero.
+	checkoutSales map[string]bool
 }
 
 func NewDBMetricsCollector(db *sql.DB) *DBMetricsCollector {
@@ -18,6 +36,13 @@ func NewDBMetricsCollector(db *sql.DB) *DBMetricsCollector {
 	}
 }
 
+// WithCheckoutCounter makes each collection set the active checkout gauges
+// from the database, correcting any drift in the per-instance counts.
+func (c *DBMetricsCollector) WithCheckoutCounter(counter CheckoutCounter) *DBMetricsCollector {
+	c.checkout = counter
+	return c
+}
+
 func (c *DBMetricsCollector) StartCollecting(ctx context.Context, interval time.Duration) {
 	go func() {
 		ticker := time.NewTicker(interval)
@@ -28,17 +53,51 @@ func (c *DBMetricsCollector) StartCollecting(ctx context.Context, interval time.
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				c.collectMetrics()
+				c.collectMetrics(ctx)
 			}
 		}
 	}()
 }
 
-func (c *DBMetricsCollector) collectMetrics() {
+func (c *DBMetricsCollector) collectMetrics(ctx context.Context) {
 	stats := c.db.Stats()
 
 	DBConnectionsActive.Set(float64(stats.InUse))
 	DBConnectionsIdle.Set(float64(stats.Idle))
+
+	if c.checkout != nil {
+		c.collectCheckoutMetrics(ctx)
+	}
+}
+
+func (c *DBMetricsCollector) collectCheckoutMetrics(ctx context.Context) {
+	saleIDs, err := c.checkout.GetCheckoutSaleIDs(ctx)
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]bool, len(saleIDs))
+	for _, saleID := range saleIDs {
+		checkouts, err := c.checkout.CountActiveCheckoutsBySale(ctx, saleID)
+		if err != nil {
+			continue
+		}
+		items, err := c.checkout.CountActiveCheckoutItemsBySale(ctx, saleID)
+		if err != nil {
+			continue
+		}
+		ActiveCheckoutsGauge.WithLabelValues(saleID).Set(float64(checkouts))
+		CheckoutItemsGauge.WithLabelValues(saleID).Set(float64(items))
+		seen[saleID] = true
+	}
+
+	for saleID := range c.checkoutSales {
+		if !seen[saleID] {
+			ActiveCheckoutsGauge.WithLabelValues(saleID).Set(0)
+			CheckoutItemsGauge.WithLabelValues(saleID).Set(0)
+		}
+	}
+	c.checkoutSales = seen
 }
 
 type TracedConnector struct {
@@ -67,40 +126,86 @@ func InstrumentQuery(ctx context.Context, db *sql.DB, queryType, table, query st
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return db.QueryContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	rows, err := db.QueryContext(ctx, query, args...)
+	endDBSpan(span, err)
+
+	return rows, err
 }
 
 func InstrumentExec(ctx context.Context, db *sql.DB, queryType, table, query string, args ...interface{}) (sql.Result, error) {
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return db.ExecContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	result, err := db.ExecContext(ctx, query, args...)
+	endDBSpan(span, err)
+
+	return result, err
 }
 
 func InstrumentQueryRow(ctx context.Context, db *sql.DB, queryType, table, query string, args ...interface{}) *sql.Row {
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return db.QueryRowContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	row := db.QueryRowContext(ctx, query, args...)
+	endDBSpan(span, row.Err())
+
+	return row
 }
 
 func InstrumentTxQuery(ctx context.Context, tx *sql.Tx, queryType, table, query string, args ...interface{}) (*sql.Rows, error) {
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return tx.QueryContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	rows, err := tx.QueryContext(ctx, query, args...)
+	endDBSpan(span, err)
+
+	return rows, err
 }
 
 func InstrumentTxExec(ctx context.Context, tx *sql.Tx, queryType, table, query string, args ...interface{}) (sql.Result, error) {
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return tx.ExecContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	result, err := tx.ExecContext(ctx, query, args...)
+	endDBSpan(span, err)
+
+	return result, err
 }
 
 func InstrumentTxQueryRow(ctx context.Context, tx *sql.Tx, queryType, table, query string, args ...interface{}) *sql.Row {
 	end := TimeDBQuery(queryType, table)
 	defer end()
 
-	return tx.QueryRowContext(ctx, query, args...)
+	ctx, span := startDBSpan(ctx, queryType, table, query)
+	row := tx.QueryRowContext(ctx, query, args...)
+	endDBSpan(span, row.Err())
+
+	return row
+}
+
+// startDBSpan starts a client span for a query as a child of the request
+// span carried in ctx, if any.
+func startDBSpan(ctx context.Context, queryType, table, query string) (context.Context, trace.Span) {
+	return otel.Tracer(dbTracerName).Start(ctx, queryType+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", queryType),
+			attribute.String("db.sql.table", table),
+			attribute.String("db.statement", query),
+		),
+	)
+}
+
+func endDBSpan(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
 }
@@ -24,28 +24,50 @@ var (
 		},
 		[]string{"handler", "method", "status_code"},
 	)
+
+	RateLimitExceededTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_exceeded_total",
+			Help: "Total number of requests rejected by rate limiting, by handler and limit type (user, ip or api_key)",
+		},
+		[]string{"handler", "limit_type"},
+	)
+
+	// ActiveRateLimitTokens counts the token buckets that are empty, by the
+	// handler and limit type of the request they last rejected. Per-bucket
+	// token counts would give every user their own series.
+	ActiveRateLimitTokens = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rate_limit_throttled_buckets",
+			Help: "Number of rate limit buckets out of tokens, by handler and limit type of the request they last rejected",
+		},
+		[]string{"handler", "limit_type"},
+	)
 )
 
 var (
-	SaleItemsTotal = promauto.NewGauge(
+	SaleItemsTotal = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "sale_items_total",
 			Help: "Total number of items in sale",
 		},
+		[]string{"sale_id"},
 	)
 
-	SaleItemsSold = promauto.NewGauge(
+	SaleItemsSold = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "sale_items_sold",
 			Help: "Number of items sold in sale",
 		},
+		[]string{"sale_id"},
 	)
 
-	SaleItemsSoldTotal = promauto.NewCounter(
+	SaleItemsSoldTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "sale_items_sold_total",
 			Help: "Total number of items sold",
 		},
+		[]string{"sale_id"},
 	)
 
 	CheckoutAttemptsTotal = promauto.NewCounter(
@@ -70,6 +92,40 @@ var (
 		[]string{"reason"},
 	)
 
+	// Both gauges move as checkouts open and close on this instance, and the
+	// DB metrics collector resets them to the database counts on every
+	// collection. Between collections they can drift, so read them with max
+	// across instances rather than sum.
+	ActiveCheckoutsGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "checkouts_active",
+			Help: "Number of checkouts created but not yet purchased or expired",
+		},
+		[]string{"sale_id"},
+	)
+
+	CheckoutItemsGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "checkout_items_active",
+			Help: "Number of items held in active checkouts",
+		},
+		[]string{"sale_id"},
+	)
+
+	SchedulerLockConflictsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "scheduler_lock_conflicts_total",
+			Help: "Total number of scheduler ticks skipped because another instance held the sale creation lock",
+		},
+	)
+
+	ExpiredCheckoutsDeleted = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "expired_checkouts_deleted_total",
+			Help: "Total number of expired checkout attempts deleted by the cleanup job",
+		},
+	)
+
 	PurchaseAttemptsTotal = promauto.NewCounter(
 		prometheus.CounterOpts{
 			Name: "purchase_attempts_total",
@@ -91,6 +147,20 @@ var (
 		},
 		[]string{"reason"},
 	)
+
+	PurchaseResultCorruptionTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "purchase_result_corruption_total",
+			Help: "Total number of stored purchase results that failed to decode",
+		},
+	)
+
+	LogDroppedTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "log_dropped_total",
+			Help: "Total number of log entries that did not fit the async buffer and were written synchronously",
+		},
+	)
 )
 
 var (
@@ -160,6 +230,56 @@ var (
 		},
 		[]string{"lock_type"},
 	)
+
+	BloomFilterFPRGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bloom_filter_false_positive_rate",
+			Help: "Estimated false positive rate of a bloom filter",
+		},
+		[]string{"filter_name"},
+	)
+
+	BloomFilterLayersGauge = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "bloom_filter_layers",
+			Help: "Number of layers in a scalable bloom filter",
+		},
+		[]string{"filter_name"},
+	)
+)
+
+var (
+	QuotaLeaseQuota = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sale_quota_lease_quota",
+			Help: "Quota currently leased to a region for the active sale",
+		},
+		[]string{"region"},
+	)
+
+	QuotaLeaseUsed = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sale_quota_lease_used",
+			Help: "Quota used by a region for the active sale",
+		},
+		[]string{"region"},
+	)
+
+	QuotaLeaseUtilization = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "sale_quota_lease_utilization",
+			Help: "Ratio of used to leased quota for a region",
+		},
+		[]string{"region"},
+	)
+
+	QuotaTransferredTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "sale_quota_transferred_total",
+			Help: "Total quota units moved between regions",
+		},
+		[]string{"from_region", "to_region"},
+	)
 )
 
 func TimeHTTPRequest(handler, method string) func(statusCode string) {
@@ -208,6 +328,20 @@ func RecordCheckoutFailure(userID, itemID, reason string) {
 	CheckoutFailureTotal.WithLabelValues(reason).Inc()
 }
 
+func RecordCheckoutOpened(saleID string, itemCount int) {
+	ActiveCheckoutsGauge.WithLabelValues(saleID).Inc()
+	CheckoutItemsGauge.WithLabelValues(saleID).Add(float64(itemCount))
+}
+
+func RecordCheckoutItemAdded(saleID string) {
+	CheckoutItemsGauge.WithLabelValues(saleID).Inc()
+}
+
+func RecordCheckoutsClosed(saleID string, checkouts, items int) {
+	ActiveCheckoutsGauge.WithLabelValues(saleID).Sub(float64(checkouts))
+	CheckoutItemsGauge.WithLabelValues(saleID).Sub(float64(items))
+}
+
 func RecordPurchaseAttempt(checkoutCode string) {
 	PurchaseAttemptsTotal.Inc()
 }
@@ -221,12 +355,38 @@ func RecordPurchaseFailure(checkoutCode, reason string) {
 }
 
 func RecordItemSold(saleID, itemID string) {
-	SaleItemsSoldTotal.Inc()
+	SaleItemsSoldTotal.WithLabelValues(saleID).Inc()
 }
 
 func UpdateSaleItemsCount(saleID string, total, sold int) {
-	SaleItemsTotal.Set(float64(total))
-	SaleItemsSold.Set(float64(sold))
+	SaleItemsTotal.WithLabelValues(saleID).Set(float64(total))
+	SaleItemsSold.WithLabelValues(saleID).Set(float64(sold))
+}
+
+func UpdateBloomFilterFPR(filterName string, fpr float64) {
+	BloomFilterFPRGauge.WithLabelValues(filterName).Set(fpr)
+}
+
+func UpdateQuotaLease(region string, quota, used int, utilization float64) {
+	QuotaLeaseQuota.WithLabelValues(region).Set(float64(quota))
+	QuotaLeaseUsed.WithLabelValues(region).Set(float64(used))
+	QuotaLeaseUtilization.WithLabelValues(region).Set(utilization)
+}
+
+func RecordQuotaTransfer(fromRegion, toRegion string, amount int) {
+	QuotaTransferredTotal.WithLabelValues(fromRegion, toRegion).Add(float64(amount))
+}
+
+func RecordRateLimitExceeded(handler, limitType string) {
+	RateLimitExceededTotal.WithLabelValues(handler, limitType).Inc()
+}
+
+func RecordRateLimitBucketThrottled(handler, limitType string) {
+	ActiveRateLimitTokens.WithLabelValues(handler, limitType).Inc()
+}
+
+func RecordRateLimitBucketRefilled(handler, limitType string) {
+	ActiveRateLimitTokens.WithLabelValues(handler, limitType).Dec()
 }
 
 func RecordLockAttempt(lockKey string) {
@@ -0,0 +1,50 @@
+package monitoring
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsShutdownTimeout = 5 * time.Second
+
+// MetricsServer serves the Prometheus endpoint on an address of its own,
+// separate from the application listener.
+type MetricsServer struct {
+	server *http.Server
+}
+
+func NewMetricsServer(addr string) *MetricsServer {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	return &MetricsServer{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Start serves until ctx is cancelled or Shutdown is called, in which case
+// it returns nil.
+func (s *MetricsServer) Start(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		_ = s.server.Shutdown(shutdownCtx)
+	})
+	defer stop()
+
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -3,6 +3,7 @@ package monitoring
 import (
 	"context"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -70,8 +71,12 @@ func (RedisHook) DialHook(next redis.DialHook) redis.DialHook {
 	}
 }
 
-func InstrumentRedisClient(client *redis.Client) *redis.Client {
-	client.AddHook(&RedisHook{})
+var instrumentedClients sync.Map
+
+func InstrumentRedisClient(client redis.UniversalClient) redis.UniversalClient {
+	if _, loaded := instrumentedClients.LoadOrStore(client, struct{}{}); !loaded {
+		client.AddHook(&RedisHook{})
+	}
 	return client
 }
 
@@ -85,6 +90,14 @@ func NewBloomFilterMetrics(filterName string) *BloomFilterMetrics {
 	}
 }
 
+func (m *BloomFilterMetrics) UpdateFPR(fpr float64) {
+	UpdateBloomFilterFPR(m.filterName, fpr)
+}
+
+func (m *BloomFilterMetrics) UpdateLayers(layers int) {
+	BloomFilterLayersGauge.WithLabelValues(m.filterName).Set(float64(layers))
+}
+
 type DistributedLockMetrics struct {
 	lockKey string
 }
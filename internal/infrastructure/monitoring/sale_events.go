@@ -0,0 +1,99 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	SaleEventSnapshot          = "snapshot"
+	SaleEventItemsSold         = "items_sold"
+	SaleEventThresholdCrossed  = "threshold_crossed"
+	SaleEventSaleEnded         = "sale_ended"
+	saleEventSubscriberBacklog = 64
+)
+
+type SaleEvent struct {
+	Type      string    `json:"type"`
+	SaleID    string    `json:"sale_id"`
+	ItemID    string    `json:"item_id,omitempty"`
+	Count     int       `json:"count,omitempty"`
+	ItemsSold int       `json:"items_sold"`
+	Remaining *int      `json:"remaining,omitempty"`
+	Threshold int       `json:"threshold,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SaleEventBus fans sale events out to the subscribers of each sale. Slow
+// subscribers drop events rather than block the publisher, which sits on the
+// purchase path.
+type SaleEventBus struct {
+	mu          sync.Mutex
+	subscribers sync.Map // sale ID -> []chan SaleEvent
+}
+
+var SaleEvents = NewSaleEventBus()
+
+func NewSaleEventBus() *SaleEventBus {
+	return &SaleEventBus{}
+}
+
+func (b *SaleEventBus) Subscribe(saleID string) chan SaleEvent {
+	ch := make(chan SaleEvent, saleEventSubscriberBacklog)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var current []chan SaleEvent
+	if existing, ok := b.subscribers.Load(saleID); ok {
+		current = existing.([]chan SaleEvent)
+	}
+
+	next := make([]chan SaleEvent, 0, len(current)+1)
+	next = append(next, current...)
+	b.subscribers.Store(saleID, append(next, ch))
+
+	return ch
+}
+
+func (b *SaleEventBus) Unsubscribe(saleID string, ch chan SaleEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing, ok := b.subscribers.Load(saleID)
+	if !ok {
+		return
+	}
+
+	current := existing.([]chan SaleEvent)
+	next := make([]chan SaleEvent, 0, len(current))
+	for _, sub := range current {
+		if sub != ch {
+			next = append(next, sub)
+		}
+	}
+
+	if len(next) == 0 {
+		b.subscribers.Delete(saleID)
+	} else {
+		b.subscribers.Store(saleID, next)
+	}
+}
+
+func (b *SaleEventBus) Publish(event SaleEvent) {
+	existing, ok := b.subscribers.Load(event.SaleID)
+	if !ok {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	for _, ch := range existing.([]chan SaleEvent) {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
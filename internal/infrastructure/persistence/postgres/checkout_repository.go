@@ -3,7 +3,9 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/yuzvak/flashsale-service/internal/domain/errors"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
@@ -18,13 +20,14 @@ type CheckoutRepository struct {
 func NewCheckoutRepository(conn *Connection) *CheckoutRepository {
 	return &CheckoutRepository{
 		db:            conn.GetDB(),
-		codeGenerator: generator.NewCodeGenerator(),
+		codeGenerator: generator.NewCodeGenerator(nil, ""),
 	}
 }
 
 func (r *CheckoutRepository) GetCheckoutByCode(ctx context.Context, code string) (*sale.Checkout, error) {
 	checkoutQuery := `
-		SELECT checkout_code, sale_id, user_id, created_at
+		SELECT checkout_code, sale_id, user_id, created_at,
+			(SELECT MAX(expires_at) FROM checkout_attempts WHERE checkout_code = $1)
 		FROM checkout_attempts
 		WHERE checkout_code = $1
 		ORDER BY created_at DESC
@@ -32,9 +35,10 @@ func (r *CheckoutRepository) GetCheckoutByCode(ctx context.Context, code string)
 	`
 
 	var checkout sale.Checkout
+	var expiresAt sql.NullTime
 	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "checkout_attempts", checkoutQuery, code)
 	err := row.Scan(
-		&checkout.Code, &checkout.SaleID, &checkout.UserID, &checkout.CreatedAt,
+		&checkout.Code, &checkout.SaleID, &checkout.UserID, &checkout.CreatedAt, &expiresAt,
 	)
 
 	if err != nil {
@@ -44,6 +48,10 @@ func (r *CheckoutRepository) GetCheckoutByCode(ctx context.Context, code string)
 		return nil, err
 	}
 
+	if expiresAt.Valid {
+		checkout.ExpiresAt = expiresAt.Time.UTC()
+	}
+
 	itemsQuery := `
 		SELECT ci.item_id
 		FROM checkout_items ci
@@ -85,12 +93,17 @@ func (r *CheckoutRepository) CreateCheckout(ctx context.Context, checkout *sale.
 	defer tx.Rollback()
 
 	query := `
-		INSERT INTO checkout_attempts (id, checkout_code, sale_id, user_id, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO checkout_attempts (id, checkout_code, sale_id, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 
+	var expiresAt interface{}
+	if !checkout.ExpiresAt.IsZero() {
+		expiresAt = checkout.ExpiresAt
+	}
+
 	_, err = tx.ExecContext(ctx, query,
-		id, checkout.Code, checkout.SaleID, checkout.UserID, checkout.CreatedAt,
+		id, checkout.Code, checkout.SaleID, checkout.UserID, checkout.CreatedAt, expiresAt,
 	)
 	if err != nil {
 		return err
@@ -110,16 +123,21 @@ func (r *CheckoutRepository) CreateCheckout(ctx context.Context, checkout *sale.
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	monitoring.RecordCheckoutOpened(checkout.SaleID, len(checkout.ItemIDs))
+	return nil
 }
 
 func (r *CheckoutRepository) AddItemToCheckout(ctx context.Context, checkoutCode string, itemID string) error {
 	checkoutQuery := `
-		SELECT id FROM checkout_attempts WHERE checkout_code = $1
+		SELECT id, sale_id FROM checkout_attempts WHERE checkout_code = $1
 	`
-	var checkoutAttemptID string
+	var checkoutAttemptID, saleID string
 	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "checkout_attempts", checkoutQuery, checkoutCode)
-	err := row.Scan(&checkoutAttemptID)
+	err := row.Scan(&checkoutAttemptID, &saleID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return errors.ErrCheckoutNotFound
@@ -147,7 +165,19 @@ func (r *CheckoutRepository) AddItemToCheckout(ctx context.Context, checkoutCode
 	`
 	itemIDGen := r.codeGenerator.GenerateCheckoutID()
 	_, err = monitoring.InstrumentExec(ctx, r.db, "INSERT", "checkout_items", insertQuery, itemIDGen, checkoutAttemptID, itemID)
+	if err != nil {
+		return err
+	}
 
+	monitoring.RecordCheckoutItemAdded(saleID)
+	return nil
+}
+
+// RefreshCheckoutExpiry moves the expiry of every record of a checkout code,
+// mirroring the TTL refresh of the code in Redis.
+func (r *CheckoutRepository) RefreshCheckoutExpiry(ctx context.Context, checkoutCode string, expiresAt time.Time) error {
+	query := `UPDATE checkout_attempts SET expires_at = $2 WHERE checkout_code = $1`
+	_, err := monitoring.InstrumentExec(ctx, r.db, "UPDATE", "checkout_attempts", query, checkoutCode, expiresAt)
 	return err
 }
 
@@ -168,6 +198,66 @@ func (r *CheckoutRepository) GetUserCheckoutCount(ctx context.Context, saleID, u
 	return count, nil
 }
 
+// CountActiveCheckoutsBySale returns the number of checkouts a sale holds.
+// A checkout spans one attempt row per item added to it, so checkouts are
+// counted by code, the same way checkouts_active counts them.
+func (r *CheckoutRepository) CountActiveCheckoutsBySale(ctx context.Context, saleID string) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT checkout_code)
+		FROM checkout_attempts
+		WHERE sale_id = $1
+	`
+
+	var count int
+	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "checkout_attempts", query, saleID)
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// CountActiveCheckoutItemsBySale returns the number of items held in a
+// sale's checkouts, counting an item once per checkout.
+func (r *CheckoutRepository) CountActiveCheckoutItemsBySale(ctx context.Context, saleID string) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT ca.checkout_code || ':' || ci.item_id)
+		FROM checkout_items ci
+		JOIN checkout_attempts ca ON ci.checkout_attempt_id = ca.id
+		WHERE ca.sale_id = $1
+	`
+
+	var count int
+	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "checkout_items", query, saleID)
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetCheckoutSaleIDs returns the sales that currently hold checkouts.
+func (r *CheckoutRepository) GetCheckoutSaleIDs(ctx context.Context) ([]string, error) {
+	query := `SELECT DISTINCT sale_id FROM checkout_attempts`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.db, "SELECT", "checkout_attempts", query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var saleIDs []string
+	for rows.Next() {
+		var saleID string
+		if err := rows.Scan(&saleID); err != nil {
+			return nil, err
+		}
+		saleIDs = append(saleIDs, saleID)
+	}
+
+	return saleIDs, rows.Err()
+}
+
 func (r *CheckoutRepository) LogCheckoutAttempt(ctx context.Context, saleID, userID, checkoutCode string, itemID string) error {
 	monitoring.RecordCheckoutAttempt(userID, itemID)
 	id := r.codeGenerator.GenerateCheckoutID()
@@ -211,7 +301,101 @@ func (r *CheckoutRepository) LogCheckoutAttempt(ctx context.Context, saleID, use
 }
 
 func (r *CheckoutRepository) DeleteCheckout(ctx context.Context, checkoutCode string) error {
-	query := `DELETE FROM checkout_attempts WHERE checkout_code = $1`
-	_, err := r.db.ExecContext(ctx, query, checkoutCode)
+	_, err := r.deleteCheckouts(ctx, `checkout_code = $1`, checkoutCode)
 	return err
 }
+
+// expiredCheckoutCodes selects the codes whose checkout has expired. A code
+// can have several attempt rows and only some carry expires_at, so the latest
+// expiry of the code decides. Checkouts from before expires_at was recorded
+// count as expired once their newest row is older than $1 seconds.
+const expiredCheckoutCodes = `
+	SELECT checkout_code
+	FROM checkout_attempts
+	GROUP BY checkout_code
+	HAVING COALESCE(MAX(expires_at), MAX(created_at) + $1 * INTERVAL '1 second') < NOW()
+`
+
+// GetExpiredCheckouts returns the attempts of expired checkouts, with their
+// items. olderThan only applies to checkouts without a recorded expiry.
+func (r *CheckoutRepository) GetExpiredCheckouts(ctx context.Context, olderThan time.Duration) ([]*sale.Checkout, error) {
+	query := `
+		SELECT ca.checkout_code, ca.sale_id, ca.user_id, ca.created_at, ca.expires_at,
+			COALESCE(array_agg(ci.item_id ORDER BY ci.added_at) FILTER (WHERE ci.item_id IS NOT NULL), '{}')
+		FROM checkout_attempts ca
+		LEFT JOIN checkout_items ci ON ci.checkout_attempt_id = ca.id
+		WHERE ca.checkout_code IN (` + expiredCheckoutCodes + `)
+		GROUP BY ca.id
+		ORDER BY ca.created_at
+	`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.db, "SELECT", "checkout_attempts", query, olderThan.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkouts []*sale.Checkout
+	for rows.Next() {
+		var checkout sale.Checkout
+		var expiresAt sql.NullTime
+		if err := rows.Scan(
+			&checkout.Code, &checkout.SaleID, &checkout.UserID, &checkout.CreatedAt, &expiresAt, pq.Array(&checkout.ItemIDs),
+		); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			checkout.ExpiresAt = expiresAt.Time.UTC()
+		}
+		checkouts = append(checkouts, &checkout)
+	}
+
+	return checkouts, rows.Err()
+}
+
+// DeleteExpiredCheckouts removes the attempts of checkouts past their
+// expires_at; their items go with them through the cascade. olderThan only
+// applies to checkouts without a recorded expiry.
+func (r *CheckoutRepository) DeleteExpiredCheckouts(ctx context.Context, olderThan time.Duration) (int64, error) {
+	return r.deleteCheckouts(ctx, `checkout_code IN (`+expiredCheckoutCodes+`)`, olderThan.Seconds())
+}
+
+// deleteCheckouts deletes the checkout attempts matching where, takes the
+// checkouts and items they held off the active checkout gauges, and returns
+// the number of attempts deleted. The select runs on the snapshot from
+// before the delete, so it still sees the cascaded checkout items.
+func (r *CheckoutRepository) deleteCheckouts(ctx context.Context, where string, args ...interface{}) (int64, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM checkout_attempts WHERE ` + where + `
+			RETURNING id, checkout_code, sale_id
+		)
+		SELECT d.sale_id,
+			COUNT(DISTINCT d.id),
+			COUNT(DISTINCT d.checkout_code),
+			COUNT(DISTINCT d.checkout_code || ':' || ci.item_id)
+		FROM deleted d
+		LEFT JOIN checkout_items ci ON ci.checkout_attempt_id = d.id
+		GROUP BY d.sale_id
+	`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.db, "DELETE", "checkout_attempts", query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var deleted int64
+	for rows.Next() {
+		var saleID string
+		var attempts int64
+		var checkouts, items int
+		if err := rows.Scan(&saleID, &attempts, &checkouts, &items); err != nil {
+			return deleted, err
+		}
+		deleted += attempts
+		monitoring.RecordCheckoutsClosed(saleID, checkouts, items)
+	}
+
+	return deleted, rows.Err()
+}
@@ -0,0 +1,94 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+const legacyCheckoutAge = 24 * time.Hour
+
+// Checkouts go once their own expiry has passed, however recently they were
+// created; only those without a recorded expiry fall back to their age.
+func TestDeleteExpiredCheckouts(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	s, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Active(clock.NewRealClock()).
+		WithItems(5))
+	repo := postgres.NewCheckoutRepository(conn)
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		expiresAt time.Time
+		expired   bool
+	}{
+		{name: "expired a minute ago", createdAt: now.Add(-11 * time.Minute), expiresAt: now.Add(-time.Minute), expired: true},
+		{name: "expires in a minute", createdAt: now.Add(-9 * time.Minute), expiresAt: now.Add(time.Minute), expired: false},
+		{name: "old but refreshed", createdAt: now.Add(-2 * legacyCheckoutAge), expiresAt: now.Add(time.Minute), expired: false},
+		{name: "legacy past the age", createdAt: now.Add(-2 * legacyCheckoutAge), expired: true},
+		{name: "legacy within the age", createdAt: now.Add(-time.Hour), expired: false},
+	}
+
+	codes := make([]string, len(tests))
+	for i, tt := range tests {
+		codes[i] = fmt.Sprintf("CHK-%s-%016d", s.ID, i)
+		checkout := fixtures.NewCheckoutBuilder().
+			WithCode(codes[i]).
+			ForSale(s.ID).
+			ForUser(fmt.Sprintf("user_%d", i)).
+			WithItems(items[i].ID).
+			CreatedAt(tt.createdAt).
+			ExpiresAt(tt.expiresAt).
+			Build()
+		if tt.expiresAt.IsZero() {
+			checkout.ExpiresAt = time.Time{}
+		}
+		if err := repo.CreateCheckout(ctx, checkout); err != nil {
+			t.Fatalf("CreateCheckout %s: %v", tt.name, err)
+		}
+	}
+
+	listed, err := repo.GetExpiredCheckouts(ctx, legacyCheckoutAge)
+	if err != nil {
+		t.Fatalf("GetExpiredCheckouts: %v", err)
+	}
+	expiredCodes := make(map[string]bool)
+	for _, checkout := range listed {
+		expiredCodes[checkout.Code] = true
+	}
+
+	deleted, err := repo.DeleteExpiredCheckouts(ctx, legacyCheckoutAge)
+	if err != nil {
+		t.Fatalf("DeleteExpiredCheckouts: %v", err)
+	}
+	// Other tests share the database, so only a lower bound holds.
+	if deleted < 2 {
+		t.Errorf("deleted %d checkouts, want at least 2", deleted)
+	}
+
+	for i, tt := range tests {
+		if expiredCodes[codes[i]] != tt.expired {
+			t.Errorf("%s: listed as expired = %v, want %v", tt.name, expiredCodes[codes[i]], tt.expired)
+		}
+
+		_, err := repo.GetCheckoutByCode(ctx, codes[i])
+		gone := errors.Is(err, domainErrors.ErrCheckoutNotFound)
+		if err != nil && !gone {
+			t.Fatalf("GetCheckoutByCode %s: %v", tt.name, err)
+		}
+		if gone != tt.expired {
+			t.Errorf("%s: deleted = %v, want %v", tt.name, gone, tt.expired)
+		}
+	}
+}
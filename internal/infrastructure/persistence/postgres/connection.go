@@ -7,33 +7,96 @@ import (
 
 	_ "github.com/lib/pq"
 	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
 type Connection struct {
-	db *sql.DB
+	db     *sql.DB
+	readDB *sql.DB
 }
 
-func NewConnection(cfg config.DatabaseConfig) (*Connection, error) {
+// NewConnection opens the database and waits for it to answer, retrying the
+// first ping with exponential backoff since the database often comes up
+// after the service.
+func NewConnection(cfg config.DatabaseConfig, log *logger.Logger) (*Connection, error) {
 	connStr := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
+	// A SET after connecting would only reach one pooled connection; as a
+	// startup parameter the timeout applies to every connection opened.
+	if cfg.StatementTimeoutMs > 0 {
+		connStr += fmt.Sprintf(" statement_timeout=%d", cfg.StatementTimeoutMs)
+	}
 
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	if err := pingWithRetry(db.Ping, cfg.ConnectRetries(), cfg.RetryDelay(), log); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	configurePool(db, cfg)
+
+	conn := &Connection{db: db}
+
+	if cfg.ReplicaDSN != "" {
+		readDB, err := openReplica(cfg)
+		if err != nil {
+			// Reads can always be served by the primary, so a broken replica
+			// should not keep the service from starting.
+			log.Warn("Read replica unavailable, reading from primary", "error", err.Error())
+		} else {
+			conn.readDB = readDB
+		}
+	}
+
+	return conn, nil
+}
+
+func openReplica(cfg config.DatabaseConfig) (*sql.DB, error) {
+	readDB, err := sql.Open("postgres", cfg.ReplicaDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readDB.Ping(); err != nil {
+		readDB.Close()
 		return nil, err
 	}
 
-	db.SetMaxOpenConns(100)
-	db.SetMaxIdleConns(50)
-	db.SetConnMaxLifetime(time.Hour)
+	configurePool(readDB, cfg)
+	return readDB, nil
+}
+
+func configurePool(db *sql.DB, cfg config.DatabaseConfig) {
+	db.SetMaxOpenConns(cfg.OpenConnLimit())
+	db.SetMaxIdleConns(cfg.IdleConnLimit())
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime())
 	db.SetConnMaxIdleTime(30 * time.Minute)
+}
 
-	return &Connection{db: db}, nil
+func pingWithRetry(ping func() error, retries int, baseDelay time.Duration, log *logger.Logger) error {
+	err := ping()
+	for attempt := 0; err != nil && attempt < retries; attempt++ {
+		delay := baseDelay << attempt
+		log.Warn("Database not reachable, retrying",
+			"error", err.Error(),
+			"attempt", attempt+1,
+			"max_retries", retries,
+			"retry_in", delay.String(),
+		)
+		time.Sleep(delay)
+		err = ping()
+	}
+
+	if err != nil {
+		return fmt.Errorf("database unreachable after %d retries: %w", retries, err)
+	}
+	return nil
 }
 
 func NewConnectionFromDB(db *sql.DB) *Connection {
@@ -41,6 +104,9 @@ func NewConnectionFromDB(db *sql.DB) *Connection {
 }
 
 func (c *Connection) Close() error {
+	if c.readDB != nil {
+		c.readDB.Close()
+	}
 	return c.db.Close()
 }
 
@@ -48,6 +114,15 @@ func (c *Connection) GetDB() *sql.DB {
 	return c.db
 }
 
+// GetReadDB returns the read replica, or the primary when none is
+// configured. Replica reads may lag slightly behind the primary.
+func (c *Connection) GetReadDB() *sql.DB {
+	if c.readDB != nil {
+		return c.readDB
+	}
+	return c.db
+}
+
 func (c *Connection) BeginTx() (*sql.Tx, error) {
 	return c.db.Begin()
 }
@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// failingPing fails the first failures calls and succeeds afterwards.
+type failingPing struct {
+	failures int
+	calls    int
+	err      error
+}
+
+func (p *failingPing) ping() error {
+	p.calls++
+	if p.calls <= p.failures {
+		return p.err
+	}
+	return nil
+}
+
+func TestPingWithRetry(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	const baseDelay = 5 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		failures  int
+		retries   int
+		wantCalls int
+		wantErr   bool
+		// minWait is the backoff the retries must have slept through.
+		minWait time.Duration
+	}{
+		{name: "reachable at once", failures: 0, retries: 3, wantCalls: 1},
+		{name: "fails twice then succeeds", failures: 2, retries: 3, wantCalls: 3, minWait: baseDelay + 2*baseDelay},
+		{name: "succeeds on the last retry", failures: 3, retries: 3, wantCalls: 4, minWait: baseDelay + 2*baseDelay + 4*baseDelay},
+		{name: "never reachable", failures: 10, retries: 2, wantCalls: 3, wantErr: true, minWait: baseDelay + 2*baseDelay},
+		{name: "no retries", failures: 1, retries: 0, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &failingPing{failures: tt.failures, err: errRefused}
+
+			start := time.Now()
+			err := pingWithRetry(p.ping, tt.retries, baseDelay, logger.NewLogger())
+			elapsed := time.Since(start)
+
+			if tt.wantErr {
+				if !errors.Is(err, errRefused) {
+					t.Errorf("error = %v, want it to wrap the ping error", err)
+				}
+			} else if err != nil {
+				t.Errorf("pingWithRetry: %v", err)
+			}
+			if p.calls != tt.wantCalls {
+				t.Errorf("ping called %d times, want %d", p.calls, tt.wantCalls)
+			}
+			if elapsed < tt.minWait {
+				t.Errorf("returned after %v, want the backoff of at least %v", elapsed, tt.minWait)
+			}
+		})
+	}
+}
@@ -3,9 +3,9 @@ package postgres
 import (
 	"database/sql"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 
@@ -13,7 +13,11 @@ import (
 	"github.com/yuzvak/flashsale-service/internal/config"
 )
 
-func RunMigrations(cfg config.DatabaseConfig) error {
+// RunMigrations applies pending migrations from migrations, or from
+// cfg.MigrationsPath on disk when migrations is nil.
+func RunMigrations(cfg config.DatabaseConfig, migrations fs.FS) error {
+	migrations = migrationsFS(cfg, migrations)
+
 	log.Printf("Starting migrations with config: host=%s, port=%d, user=%s, dbname=%s, migrations_path=%s",
 		cfg.Host, cfg.Port, cfg.User, cfg.DBName, cfg.MigrationsPath)
 
@@ -38,106 +42,297 @@ func RunMigrations(cfg config.DatabaseConfig) error {
 	}
 	log.Printf("Database ping successful")
 
-	log.Printf("Creating migrations table if it doesn't exist")
-	_, dbErr = db.Exec(`
-		CREATE TABLE IF NOT EXISTS migrations (
-			id SERIAL PRIMARY KEY,
-			name VARCHAR(255) NOT NULL,
-			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)
-	`)
-	if dbErr != nil {
-		log.Printf("Failed to create migrations table: %v", dbErr)
-		return fmt.Errorf("failed to create migrations table: %v", dbErr)
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
 	}
-	log.Printf("Migrations table created or already exists")
 
 	log.Printf("Getting list of applied migrations")
-	rows, queryErr := db.Query("SELECT name FROM migrations")
-	if queryErr != nil {
-		log.Printf("Failed to query migrations table: %v", queryErr)
-		return fmt.Errorf("failed to query migrations table: %v", queryErr)
+	appliedMigrations, err := appliedMigrationNames(db, "SELECT name FROM migrations WHERE rolled_back_at IS NULL")
+	if err != nil {
+		log.Printf("Failed to query migrations table: %v", err)
+		return fmt.Errorf("failed to query migrations table: %v", err)
+	}
+
+	names, err := listMigrations(migrations)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Starting to apply migrations")
+	for _, migration := range names {
+		if appliedMigrations[migration] {
+			log.Printf("Migration %s already applied, skipping", migration)
+			continue
+		}
+
+		if err := RunMigration(db, migrations, MigrationUp, migration); err != nil {
+			return err
+		}
+
+		log.Printf("Successfully applied migration: %s", migration)
+		fmt.Printf("Applied migration: %s\n", migration)
+	}
+
+	log.Printf("All migrations completed successfully")
+	return nil
+}
+
+func appliedMigrationNames(db *sql.DB, query string) (map[string]bool, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	appliedMigrations := make(map[string]bool)
+	applied := make(map[string]bool)
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			return err
+			return nil, err
 		}
-		appliedMigrations[name] = true
+		applied[name] = true
 	}
 
-	log.Printf("Reading migrations from directory: %s", cfg.MigrationsPath)
-	files, err := os.ReadDir(cfg.MigrationsPath)
+	return applied, rows.Err()
+}
+
+func migrationsFS(cfg config.DatabaseConfig, migrations fs.FS) fs.FS {
+	if migrations != nil {
+		return migrations
+	}
+	return os.DirFS(cfg.MigrationsPath)
+}
+
+// listMigrations returns the up migration file names in the order they are
+// applied.
+func listMigrations(fsys fs.FS) ([]string, error) {
+	log.Printf("Reading migrations")
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
-		log.Printf("Failed to read migrations directory %s: %v", cfg.MigrationsPath, err)
-		return fmt.Errorf("failed to read migrations directory %s: %v", cfg.MigrationsPath, err)
+		log.Printf("Failed to read migrations directory: %v", err)
+		return nil, fmt.Errorf("failed to read migrations directory: %v", err)
 	}
 	log.Printf("Found %d files in migrations directory", len(files))
 
 	var migrations []string
+	downMigrations := make(map[string]bool)
 	for _, file := range files {
-		if !file.IsDir() && strings.HasSuffix(file.Name(), ".up.sql") {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(file.Name(), ".up.sql") {
 			log.Printf("Found migration file: %s", file.Name())
 			migrations = append(migrations, file.Name())
+		} else if strings.HasSuffix(file.Name(), ".down.sql") {
+			downMigrations[strings.TrimSuffix(file.Name(), ".down.sql")+".up.sql"] = true
 		}
 	}
 	sort.Strings(migrations)
-	log.Printf("Found %d migration files to process", len(migrations))
-
-	log.Printf("Starting to apply migrations")
 	for _, migration := range migrations {
-		if appliedMigrations[migration] {
-			log.Printf("Migration %s already applied, skipping", migration)
-			continue
+		if !downMigrations[migration] {
+			log.Printf("Migration %s has no down migration and cannot be rolled back", migration)
 		}
+	}
+	log.Printf("Found %d migration files to process", len(migrations))
 
-		log.Printf("Applying migration: %s", migration)
-		filePath := filepath.Join(cfg.MigrationsPath, migration)
-		log.Printf("Reading migration file: %s", filePath)
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			log.Printf("Failed to read migration file %s: %v", filePath, err)
-			return fmt.Errorf("failed to read migration file %s: %v", filePath, err)
-		}
-		log.Printf("Migration file read successfully, content length: %d bytes", len(content))
+	return migrations, nil
+}
 
-		log.Printf("Beginning transaction for migration %s", migration)
-		tx, err := db.Begin()
-		if err != nil {
-			log.Printf("Failed to begin transaction: %v", err)
-			return fmt.Errorf("failed to begin transaction: %v", err)
+const (
+	MigrationUp   = "up"
+	MigrationDown = "down"
+)
+
+func ensureMigrationsTable(db *sql.DB) error {
+	log.Printf("Creating migrations table if it doesn't exist")
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS migrations (
+			id SERIAL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		ALTER TABLE migrations ADD COLUMN IF NOT EXISTS rolled_back_at TIMESTAMP;
+	`)
+	if err != nil {
+		log.Printf("Failed to create migrations table: %v", err)
+		return fmt.Errorf("failed to create migrations table: %v", err)
+	}
+	log.Printf("Migrations table created or already exists")
+	return nil
+}
+
+// RunMigration applies or reverts a single migration in one transaction.
+// name is the up file name as recorded in the migrations table, e.g.
+// "001_initial_schema.up.sql"; reverting runs the matching .down.sql file
+// and marks the record as rolled back rather than deleting it.
+func RunMigration(db *sql.DB, migrations fs.FS, direction, name string) error {
+	fileName := name
+	switch direction {
+	case MigrationUp:
+	case MigrationDown:
+		fileName = strings.TrimSuffix(name, ".up.sql") + ".down.sql"
+	default:
+		return fmt.Errorf("unknown migration direction %q", direction)
+	}
+
+	log.Printf("Running migration %s (%s)", name, direction)
+	log.Printf("Reading migration file: %s", fileName)
+	content, err := fs.ReadFile(migrations, fileName)
+	if err != nil {
+		log.Printf("Failed to read migration file %s: %v", fileName, err)
+		return fmt.Errorf("failed to read migration file %s: %v", fileName, err)
+	}
+	log.Printf("Migration file read successfully, content length: %d bytes", len(content))
+
+	log.Printf("Beginning transaction for migration %s", name)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Failed to begin transaction: %v", err)
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+
+	log.Printf("Executing migration SQL for %s", fileName)
+	_, err = tx.Exec(string(content))
+	if err != nil {
+		log.Printf("Failed to execute migration %s: %v", fileName, err)
+		tx.Rollback()
+		return fmt.Errorf("error executing migration %s: %v", fileName, err)
+	}
+	log.Printf("Migration SQL executed successfully for %s", fileName)
+
+	if direction == MigrationUp {
+		log.Printf("Recording migration %s in migrations table", name)
+		_, err = tx.Exec("INSERT INTO migrations (name) VALUES ($1)", name)
+	} else {
+		log.Printf("Marking migration %s as rolled back", name)
+		_, err = tx.Exec(`
+			UPDATE migrations SET rolled_back_at = CURRENT_TIMESTAMP
+			WHERE id = (SELECT MAX(id) FROM migrations WHERE name = $1 AND rolled_back_at IS NULL)
+		`, name)
+	}
+	if err != nil {
+		log.Printf("Failed to record migration %s: %v", name, err)
+		tx.Rollback()
+		return fmt.Errorf("failed to record migration %s: %v", name, err)
+	}
+
+	log.Printf("Committing transaction for migration %s", name)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Failed to commit transaction for migration %s: %v", name, err)
+		return fmt.Errorf("failed to commit transaction for migration %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// RollbackLastN reverts the n most recently applied migrations, newest first.
+func RollbackLastN(db *sql.DB, migrations fs.FS, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+
+	if err := ensureMigrationsTable(db); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`
+		SELECT name FROM migrations
+		WHERE rolled_back_at IS NULL
+		ORDER BY id DESC
+		LIMIT $1
+	`, n)
+	if err != nil {
+		return fmt.Errorf("failed to query migrations table: %v", err)
+	}
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
 		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
-		log.Printf("Executing migration SQL for %s", migration)
-		_, err = tx.Exec(string(content))
-		if err != nil {
-			log.Printf("Failed to execute migration %s: %v", migration, err)
-			tx.Rollback()
-			return fmt.Errorf("error executing migration %s: %v", migration, err)
+	if len(names) < n {
+		log.Printf("Only %d applied migrations found, rolling back all of them", len(names))
+	}
+
+	for _, name := range names {
+		if err := RunMigration(db, migrations, MigrationDown, name); err != nil {
+			return err
 		}
-		log.Printf("Migration SQL executed successfully for %s", migration)
+		log.Printf("Successfully rolled back migration: %s", name)
+		fmt.Printf("Rolled back migration: %s\n", name)
+	}
 
-		log.Printf("Recording migration %s in migrations table", migration)
-		_, err = tx.Exec("INSERT INTO migrations (name) VALUES ($1)", migration)
+	return nil
+}
+
+type MigrationPlan struct {
+	Name           string `json:"name"`
+	SQL            string `json:"sql"`
+	AlreadyApplied bool   `json:"already_applied"`
+}
+
+// DryRunMigrations reads every up migration without executing anything.
+// The database is only consulted, read-only, to mark migrations that are
+// already applied; if it cannot be reached every migration is reported as
+// pending so the plan can still be reviewed offline.
+func DryRunMigrations(cfg config.DatabaseConfig, migrations fs.FS) ([]MigrationPlan, error) {
+	migrations = migrationsFS(cfg, migrations)
+
+	names, err := listMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := dryRunAppliedMigrations(cfg)
+
+	plans := make([]MigrationPlan, 0, len(names))
+	for _, migration := range names {
+		content, err := fs.ReadFile(migrations, migration)
 		if err != nil {
-			log.Printf("Failed to record migration %s: %v", migration, err)
-			tx.Rollback()
-			return fmt.Errorf("failed to record migration %s: %v", migration, err)
+			return nil, fmt.Errorf("failed to read migration file %s: %v", migration, err)
 		}
 
-		log.Printf("Committing transaction for migration %s", migration)
-		if err := tx.Commit(); err != nil {
-			log.Printf("Failed to commit transaction for migration %s: %v", migration, err)
-			return fmt.Errorf("failed to commit transaction for migration %s: %v", migration, err)
-		}
+		plans = append(plans, MigrationPlan{
+			Name:           migration,
+			SQL:            string(content),
+			AlreadyApplied: applied[migration],
+		})
+	}
 
-		log.Printf("Successfully applied migration: %s", migration)
-		fmt.Printf("Applied migration: %s\n", migration)
+	return plans, nil
+}
+
+func dryRunAppliedMigrations(cfg config.DatabaseConfig) map[string]bool {
+	db, err := sql.Open("postgres", cfg.GetDSN())
+	if err != nil {
+		log.Printf("Dry run: cannot open database, treating all migrations as pending: %v", err)
+		return nil
 	}
+	defer db.Close()
 
-	log.Printf("All migrations completed successfully")
-	return nil
+	if err := db.Ping(); err != nil {
+		log.Printf("Dry run: database unreachable, treating all migrations as pending: %v", err)
+		return nil
+	}
+
+	applied, err := appliedMigrationNames(db, "SELECT name FROM migrations WHERE rolled_back_at IS NULL")
+	if err != nil {
+		// Databases migrated before rollbacks existed lack rolled_back_at.
+		applied, err = appliedMigrationNames(db, "SELECT name FROM migrations")
+	}
+	if err != nil {
+		log.Printf("Dry run: cannot read migrations table, treating all migrations as pending: %v", err)
+		return nil
+	}
+
+	return applied
 }
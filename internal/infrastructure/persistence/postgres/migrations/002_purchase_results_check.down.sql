@@ -0,0 +1 @@
+ALTER TABLE purchase_results DROP CONSTRAINT IF EXISTS chk_purchase_results_object;
@@ -0,0 +1,11 @@
+-- Keep purchase results that are not JSON objects, so their checkout codes
+-- still count as processed, but flag them as corrupted until they are
+-- repaired through the admin API.
+UPDATE purchase_results
+SET result = jsonb_build_object('corrupted', true, 'original', result)
+WHERE jsonb_typeof(result) <> 'object';
+
+-- Reject purchase results that are not JSON objects
+ALTER TABLE purchase_results DROP CONSTRAINT IF EXISTS chk_purchase_results_object;
+ALTER TABLE purchase_results
+    ADD CONSTRAINT chk_purchase_results_object CHECK (jsonb_typeof(result) = 'object');
@@ -0,0 +1,12 @@
+-- Regional quota leases: each region may sell up to its leased quota of a sale
+CREATE TABLE IF NOT EXISTS sale_quota_leases (
+    sale_id VARCHAR(20) NOT NULL REFERENCES sales(id) ON DELETE CASCADE,
+    region VARCHAR(64) NOT NULL,
+    quota INTEGER NOT NULL CHECK (quota >= 0),
+    used INTEGER NOT NULL DEFAULT 0 CHECK (used >= 0),
+    expires_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (sale_id, region)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sale_quota_leases_expires ON sale_quota_leases(sale_id, expires_at);
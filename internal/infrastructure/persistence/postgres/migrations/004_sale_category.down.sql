@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_sales_category_time;
+
+ALTER TABLE sales DROP COLUMN IF EXISTS category;
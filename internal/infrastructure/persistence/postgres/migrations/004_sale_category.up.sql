@@ -0,0 +1,4 @@
+-- Categories allow several sales to run concurrently, one per category
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS category VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_sales_category_time ON sales(category, started_at, ended_at);
@@ -0,0 +1,2 @@
+-- Item prices, in the sale currency
+ALTER TABLE items ADD COLUMN IF NOT EXISTS price NUMERIC(12,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Free-form product information for items
+ALTER TABLE items ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE items ADD COLUMN IF NOT EXISTS metadata JSONB DEFAULT '{}';
@@ -0,0 +1,2 @@
+ALTER TABLE sales DROP COLUMN IF EXISTS max_items_per_sale;
+ALTER TABLE sales DROP COLUMN IF EXISTS max_items_per_user;
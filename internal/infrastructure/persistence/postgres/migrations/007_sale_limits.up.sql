@@ -0,0 +1,3 @@
+-- Purchase limits are set per sale rather than globally
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS max_items_per_user INTEGER NOT NULL DEFAULT 10;
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS max_items_per_sale INTEGER NOT NULL DEFAULT 10000;
@@ -0,0 +1 @@
+ALTER TABLE checkout_attempts DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,2 @@
+-- Explicit checkout expiry, kept in step with the checkout code TTL in Redis
+ALTER TABLE checkout_attempts ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+-- Fails while ULID sale IDs are still stored; delete or rename those sales first
+ALTER TABLE sale_quota_leases ALTER COLUMN sale_id TYPE VARCHAR(20);
+ALTER TABLE purchases ALTER COLUMN sale_id TYPE VARCHAR(20);
+ALTER TABLE checkout_attempts ALTER COLUMN sale_id TYPE VARCHAR(20);
+ALTER TABLE items ALTER COLUMN sale_id TYPE VARCHAR(20);
+ALTER TABLE sales ALTER COLUMN id TYPE VARCHAR(20);
@@ -0,0 +1,6 @@
+-- Sale IDs are now SALE_ followed by a 26 character ULID
+ALTER TABLE sales ALTER COLUMN id TYPE VARCHAR(32);
+ALTER TABLE items ALTER COLUMN sale_id TYPE VARCHAR(32);
+ALTER TABLE checkout_attempts ALTER COLUMN sale_id TYPE VARCHAR(32);
+ALTER TABLE purchases ALTER COLUMN sale_id TYPE VARCHAR(32);
+ALTER TABLE sale_quota_leases ALTER COLUMN sale_id TYPE VARCHAR(32);
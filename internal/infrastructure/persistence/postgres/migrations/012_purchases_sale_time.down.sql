@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_purchases_sale_purchased_at;
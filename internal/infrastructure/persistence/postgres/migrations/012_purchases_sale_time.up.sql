@@ -0,0 +1,2 @@
+-- Time-bucketed purchase analytics scan a sale's purchases by time
+CREATE INDEX IF NOT EXISTS idx_purchases_sale_purchased_at ON purchases(sale_id, purchased_at);
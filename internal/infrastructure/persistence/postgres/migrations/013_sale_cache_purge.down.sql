@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_sales_ended_unpurged;
+ALTER TABLE sales DROP COLUMN IF EXISTS cache_purged_at;
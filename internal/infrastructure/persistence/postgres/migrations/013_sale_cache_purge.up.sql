@@ -0,0 +1,4 @@
+-- When an ended sale's Redis keys were purged; NULL until the scheduler has done it
+ALTER TABLE sales ADD COLUMN IF NOT EXISTS cache_purged_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_sales_ended_unpurged ON sales(ended_at) WHERE cache_purged_at IS NULL;
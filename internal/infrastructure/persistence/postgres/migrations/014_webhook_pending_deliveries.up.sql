@@ -0,0 +1,13 @@
+-- Webhook deliveries not yet sent, so that queued deliveries survive a restart.
+-- A row is claimed by the instance sending it until claimed_until passes.
+CREATE TABLE IF NOT EXISTS webhook_pending_deliveries (
+    delivery_id VARCHAR(64) NOT NULL,
+    url TEXT NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    body BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    claimed_until TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (delivery_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_pending_deliveries_claimed ON webhook_pending_deliveries(claimed_until);
@@ -0,0 +1,19 @@
+package postgres
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// EmbeddedMigrations returns the migrations compiled into the binary, rooted
+// so that file names match those read from a migrations directory.
+func EmbeddedMigrations() fs.FS {
+	migrations, err := fs.Sub(embeddedMigrations, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
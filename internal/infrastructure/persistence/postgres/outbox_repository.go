@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+)
+
+type OutboxEvent struct {
+	ID        int64
+	EventType string
+	Payload   []byte
+	CreatedAt time.Time
+}
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(conn *Connection) *OutboxRepository {
+	return &OutboxRepository{
+		db: conn.GetDB(),
+	}
+}
+
+// PublishPending hands up to limit unpublished events to publish in the
+// order they were written and marks those it accepted as published. It stops
+// at the first event publish rejects, so that event is retried on the next
+// call ahead of anything written after it. Rows are locked for the duration,
+// letting several instances poll the same table.
+func (r *OutboxRepository) PublishPending(ctx context.Context, limit int, publish func(OutboxEvent) error) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, event_type, payload, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := monitoring.InstrumentTxQuery(ctx, tx, "SELECT", "outbox", query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	var pending []OutboxEvent
+	for rows.Next() {
+		var event OutboxEvent
+		if err := rows.Scan(&event.ID, &event.EventType, &event.Payload, &event.CreatedAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	published := make([]int64, 0, len(pending))
+	var publishErr error
+	for _, event := range pending {
+		if publishErr = publish(event); publishErr != nil {
+			break
+		}
+		published = append(published, event.ID)
+	}
+
+	if len(published) > 0 {
+		update := `
+			UPDATE outbox
+			SET published_at = NOW()
+			WHERE id = ANY($1)
+		`
+		if _, err := monitoring.InstrumentTxExec(ctx, tx, "UPDATE", "outbox", update, pq.Array(published)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(published), publishErr
+}
@@ -3,8 +3,10 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"time"
 
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 )
 
@@ -18,6 +20,41 @@ type Purchase struct {
 	CreatedAt    time.Time
 }
 
+// PurchaseStats summarises the purchases of one sale. TopItems and TopUsers
+// hold at most purchaseStatsTopN entries, most purchases first.
+type PurchaseStats struct {
+	TotalPurchases int
+	UniqueUsers    int
+	TopItems       []ItemPurchaseCount
+	TopUsers       []UserPurchaseCount
+	HourlyCounts   []HourlyPurchaseCount
+}
+
+type ItemPurchaseCount struct {
+	ItemID string `json:"item_id"`
+	Count  int    `json:"count"`
+}
+
+type UserPurchaseCount struct {
+	UserID string `json:"user_id"`
+	Count  int    `json:"count"`
+}
+
+type HourlyPurchaseCount struct {
+	Hour  time.Time `json:"hour"`
+	Count int       `json:"count"`
+}
+
+const purchaseStatsTopN = 10
+
+// PurchaseBucket counts the purchases made from BucketStart until the next
+// bucket starts.
+type PurchaseBucket struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Count       int       `json:"count"`
+	UniqueUsers int       `json:"unique_users"`
+}
+
 type PurchaseRepository struct {
 	conn *Connection
 }
@@ -107,3 +144,123 @@ func (r *PurchaseRepository) GetPurchasesByUserID(ctx context.Context, userID st
 
 	return purchases, rows.Err()
 }
+
+// GetPurchaseStats aggregates a sale's purchases in one round trip, with the
+// grouped lists returned as JSON arrays. A sale without purchases yields
+// zero counts and empty lists.
+func (r *PurchaseRepository) GetPurchaseStats(ctx context.Context, saleID string) (*PurchaseStats, error) {
+	query := `
+		WITH sale_purchases AS (
+			SELECT user_id, item_id, purchased_at
+			FROM purchases
+			WHERE sale_id = $1
+		), top_items AS (
+			SELECT item_id, COUNT(*) AS purchases
+			FROM sale_purchases
+			GROUP BY item_id
+			ORDER BY purchases DESC, item_id
+			LIMIT $2
+		), top_users AS (
+			SELECT user_id, COUNT(*) AS purchases
+			FROM sale_purchases
+			GROUP BY user_id
+			ORDER BY purchases DESC, user_id
+			LIMIT $2
+		), hourly AS (
+			SELECT date_trunc('hour', purchased_at) AT TIME ZONE 'UTC' AS hour, COUNT(*) AS purchases
+			FROM sale_purchases
+			GROUP BY 1
+		)
+		SELECT
+			(SELECT COUNT(*) FROM sale_purchases),
+			(SELECT COUNT(DISTINCT user_id) FROM sale_purchases),
+			COALESCE((SELECT json_agg(json_build_object('item_id', item_id, 'count', purchases) ORDER BY purchases DESC, item_id) FROM top_items), '[]'),
+			COALESCE((SELECT json_agg(json_build_object('user_id', user_id, 'count', purchases) ORDER BY purchases DESC, user_id) FROM top_users), '[]'),
+			COALESCE((SELECT json_agg(json_build_object('hour', hour, 'count', purchases) ORDER BY hour) FROM hourly), '[]')
+	`
+
+	var stats PurchaseStats
+	var topItems, topUsers, hourly []byte
+	row := monitoring.InstrumentQueryRow(ctx, r.conn.db, "SELECT", "purchases", query, saleID, purchaseStatsTopN)
+	if err := row.Scan(&stats.TotalPurchases, &stats.UniqueUsers, &topItems, &topUsers, &hourly); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(topItems, &stats.TopItems); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(topUsers, &stats.TopUsers); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(hourly, &stats.HourlyCounts); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// GetPurchasesInTimeRange buckets a sale's purchases made in [from, to) into
+// bucketMinutes wide buckets aligned to from. Empty buckets are left out.
+func (r *PurchaseRepository) GetPurchasesInTimeRange(ctx context.Context, saleID string, from, to time.Time, bucketMinutes int) ([]PurchaseBucket, error) {
+	query := `
+		SELECT date_bin(make_interval(mins => $4), purchased_at, $2) AS bucket_start,
+			COUNT(*),
+			COUNT(DISTINCT user_id)
+		FROM purchases
+		WHERE sale_id = $1 AND purchased_at >= $2 AND purchased_at < $3
+		GROUP BY bucket_start
+		ORDER BY bucket_start
+	`
+
+	// purchased_at is stored without a time zone, in UTC.
+	from, to = from.UTC(), to.UTC()
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.conn.db, "SELECT", "purchases", query, saleID, from, to, bucketMinutes)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := make([]PurchaseBucket, 0)
+	for rows.Next() {
+		var b PurchaseBucket
+		if err := rows.Scan(&b.BucketStart, &b.Count, &b.UniqueUsers); err != nil {
+			return nil, err
+		}
+		b.BucketStart = b.BucketStart.UTC()
+		buckets = append(buckets, b)
+	}
+
+	return buckets, rows.Err()
+}
+
+// ExportPurchases calls fn for each purchase of a sale in purchase order,
+// reading rows as fn consumes them so the whole sale is never held in
+// memory. It stops at the first error fn returns.
+func (r *PurchaseRepository) ExportPurchases(ctx context.Context, saleID string, fn func(ports.PurchaseExportRow) error) error {
+	query := `
+		SELECT p.id, p.user_id, p.item_id, i.name, i.price, p.purchased_at
+		FROM purchases p
+		JOIN items i ON i.id = p.item_id
+		WHERE p.sale_id = $1
+		ORDER BY p.purchased_at, p.id
+	`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.conn.db, "SELECT", "purchases", query, saleID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row ports.PurchaseExportRow
+		if err := rows.Scan(&row.PurchaseID, &row.UserID, &row.ItemID, &row.ItemName, &row.Price, &row.PurchasedAt); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
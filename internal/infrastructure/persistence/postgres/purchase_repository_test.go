@@ -0,0 +1,212 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+type testPurchase struct {
+	userID string
+	itemID string
+	at     time.Time
+}
+
+// insertPurchases stores purchases of the sale in a single statement.
+func insertPurchases(tb testing.TB, conn *postgres.Connection, saleID string, purchases []testPurchase) {
+	tb.Helper()
+
+	ids := make([]string, len(purchases))
+	userIDs := make([]string, len(purchases))
+	itemIDs := make([]string, len(purchases))
+	times := make([]string, len(purchases))
+	for i, p := range purchases {
+		ids[i] = fmt.Sprintf("%s-%d", saleID, i)
+		userIDs[i] = p.userID
+		itemIDs[i] = p.itemID
+		times[i] = p.at.UTC().Format(time.RFC3339Nano)
+	}
+
+	_, err := conn.GetDB().ExecContext(context.Background(), `
+		INSERT INTO purchases (id, sale_id, user_id, item_id, checkout_code, purchased_at)
+		SELECT p.id, $1, p.user_id, p.item_id, 'CHK-' || p.id, p.purchased_at::timestamptz AT TIME ZONE 'UTC'
+		FROM unnest($2::text[], $3::text[], $4::text[], $5::text[]) AS p(id, user_id, item_id, purchased_at)
+	`, saleID, pq.Array(ids), pq.Array(userIDs), pq.Array(itemIDs), pq.Array(times))
+	if err != nil {
+		tb.Fatalf("failed to insert purchases: %v", err)
+	}
+}
+
+func TestGetPurchaseStats(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewPurchaseRepository(conn)
+
+	s, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(3))
+	hour := fixtures.BaseTime
+	insertPurchases(t, conn, s.ID, []testPurchase{
+		{userID: "user_a", itemID: items[0].ID, at: hour.Add(5 * time.Minute)},
+		{userID: "user_a", itemID: items[0].ID, at: hour.Add(10 * time.Minute)},
+		{userID: "user_b", itemID: items[0].ID, at: hour.Add(59 * time.Minute)},
+		{userID: "user_c", itemID: items[1].ID, at: hour.Add(time.Hour)},
+		{userID: "user_c", itemID: items[1].ID, at: hour.Add(time.Hour + 20*time.Minute)},
+		{userID: "user_a", itemID: items[2].ID, at: hour.Add(time.Hour + 30*time.Minute)},
+	})
+
+	// Purchases of another sale are left out.
+	other, otherItems := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(1))
+	insertPurchases(t, conn, other.ID, []testPurchase{
+		{userID: "user_a", itemID: otherItems[0].ID, at: hour},
+	})
+
+	stats, err := repo.GetPurchaseStats(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("GetPurchaseStats: %v", err)
+	}
+
+	if stats.TotalPurchases != 6 {
+		t.Errorf("TotalPurchases = %d, want 6", stats.TotalPurchases)
+	}
+	if stats.UniqueUsers != 3 {
+		t.Errorf("UniqueUsers = %d, want 3", stats.UniqueUsers)
+	}
+
+	wantItems := []postgres.ItemPurchaseCount{
+		{ItemID: items[0].ID, Count: 3},
+		{ItemID: items[1].ID, Count: 2},
+		{ItemID: items[2].ID, Count: 1},
+	}
+	if !reflect.DeepEqual(stats.TopItems, wantItems) {
+		t.Errorf("TopItems = %+v, want %+v", stats.TopItems, wantItems)
+	}
+
+	wantUsers := []postgres.UserPurchaseCount{
+		{UserID: "user_a", Count: 3},
+		{UserID: "user_c", Count: 2},
+		{UserID: "user_b", Count: 1},
+	}
+	if !reflect.DeepEqual(stats.TopUsers, wantUsers) {
+		t.Errorf("TopUsers = %+v, want %+v", stats.TopUsers, wantUsers)
+	}
+
+	wantHours := []postgres.HourlyPurchaseCount{
+		{Hour: hour, Count: 3},
+		{Hour: hour.Add(time.Hour), Count: 3},
+	}
+	if len(stats.HourlyCounts) != len(wantHours) {
+		t.Fatalf("HourlyCounts = %+v, want %+v", stats.HourlyCounts, wantHours)
+	}
+	for i, want := range wantHours {
+		got := stats.HourlyCounts[i]
+		if !got.Hour.Equal(want.Hour) || got.Count != want.Count {
+			t.Errorf("HourlyCounts[%d] = %v: %d, want %v: %d", i, got.Hour, got.Count, want.Hour, want.Count)
+		}
+	}
+}
+
+func TestGetPurchaseStatsWithoutPurchases(t *testing.T) {
+	conn := integration.Postgres(t)
+	repo := postgres.NewPurchaseRepository(conn)
+	s, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(1))
+
+	stats, err := repo.GetPurchaseStats(context.Background(), s.ID)
+	if err != nil {
+		t.Fatalf("GetPurchaseStats: %v", err)
+	}
+
+	if stats.TotalPurchases != 0 || stats.UniqueUsers != 0 {
+		t.Errorf("counts = %d purchases, %d users, want zero", stats.TotalPurchases, stats.UniqueUsers)
+	}
+	// Empty lists rather than nil, so the response carries [] not null.
+	if stats.TopItems == nil || stats.TopUsers == nil || stats.HourlyCounts == nil {
+		t.Errorf("lists = %v, %v, %v, want empty and non-nil", stats.TopItems, stats.TopUsers, stats.HourlyCounts)
+	}
+	if len(stats.TopItems)+len(stats.TopUsers)+len(stats.HourlyCounts) != 0 {
+		t.Errorf("stats = %+v, want empty lists", stats)
+	}
+}
+
+// Only the ten busiest items and users are returned.
+func TestGetPurchaseStatsTopN(t *testing.T) {
+	conn := integration.Postgres(t)
+	repo := postgres.NewPurchaseRepository(conn)
+	s, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(15))
+
+	var purchases []testPurchase
+	for i, item := range items {
+		purchases = append(purchases, testPurchase{
+			userID: fmt.Sprintf("user_%02d", i),
+			itemID: item.ID,
+			at:     fixtures.BaseTime,
+		})
+	}
+	insertPurchases(t, conn, s.ID, purchases)
+
+	stats, err := repo.GetPurchaseStats(context.Background(), s.ID)
+	if err != nil {
+		t.Fatalf("GetPurchaseStats: %v", err)
+	}
+
+	if stats.TotalPurchases != 15 {
+		t.Errorf("TotalPurchases = %d, want 15", stats.TotalPurchases)
+	}
+	if len(stats.TopItems) != 10 || len(stats.TopUsers) != 10 {
+		t.Errorf("got %d top items and %d top users, want 10 each", len(stats.TopItems), len(stats.TopUsers))
+	}
+	// Ties are broken by ID.
+	if len(stats.TopItems) > 0 && stats.TopItems[0].ItemID != items[0].ID {
+		t.Errorf("first top item = %s, want %s", stats.TopItems[0].ItemID, items[0].ID)
+	}
+}
+
+// BenchmarkGetPurchaseStats aggregates a sale of 10k purchases spread over
+// 500 users and ten hours; a call has to stay under 100ms.
+func BenchmarkGetPurchaseStats(b *testing.B) {
+	const (
+		purchaseCount = 10000
+		itemCount     = 1000
+		userCount     = 500
+		maxLatency    = 100 * time.Millisecond
+	)
+
+	ctx := context.Background()
+	conn := integration.Postgres(b)
+	repo := postgres.NewPurchaseRepository(conn)
+
+	s, items := integration.SeedSale(b, conn, fixtures.NewSaleBuilder().WithItems(itemCount))
+	purchases := make([]testPurchase, purchaseCount)
+	for i := range purchases {
+		purchases[i] = testPurchase{
+			userID: fmt.Sprintf("user_%03d", i%userCount),
+			itemID: items[i%itemCount].ID,
+			at:     fixtures.BaseTime.Add(time.Duration(i) * 10 * time.Hour / purchaseCount),
+		}
+	}
+	insertPurchases(b, conn, s.ID, purchases)
+	if _, err := conn.GetDB().ExecContext(ctx, `ANALYZE purchases`); err != nil {
+		b.Fatalf("ANALYZE purchases: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats, err := repo.GetPurchaseStats(ctx, s.ID)
+		if err != nil {
+			b.Fatalf("GetPurchaseStats: %v", err)
+		}
+		if stats.TotalPurchases != purchaseCount {
+			b.Fatalf("TotalPurchases = %d, want %d", stats.TotalPurchases, purchaseCount)
+		}
+	}
+	b.StopTimer()
+
+	if perCall := b.Elapsed() / time.Duration(b.N); perCall > maxLatency {
+		b.Errorf("GetPurchaseStats took %v per call over %d purchases, want under %v", perCall, purchaseCount, maxLatency)
+	}
+}
@@ -0,0 +1,291 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+)
+
+type QuotaLeaseRepository struct {
+	db *sql.DB
+}
+
+func NewQuotaLeaseRepository(conn *Connection) *QuotaLeaseRepository {
+	return &QuotaLeaseRepository{
+		db: conn.GetDB(),
+	}
+}
+
+// EnsureLeases creates the sale's leases by splitting totalItems across
+// regions by weight. When the sale has grown since, for example because items
+// were added, only the difference is split and added to the existing
+// leases; quota is never taken back from a region here.
+func (r *QuotaLeaseRepository) EnsureLeases(ctx context.Context, saleID string, totalItems int, split map[string]float64, ttl time.Duration) error {
+	tx, leases, err := r.lockLeases(ctx, saleID)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	leased := 0
+	for _, lease := range leases {
+		leased += lease.Quota
+	}
+	if leases != nil && totalItems <= leased {
+		return tx.Commit()
+	}
+
+	// Leases created together may race another node creating them, which
+	// inserts nothing once the first commits. Later additions run with the
+	// existing leases locked; a region that joins the split then starts
+	// expired, so its share can be reclaimed if it never comes up.
+	query := `
+		INSERT INTO sale_quota_leases (sale_id, region, quota, used, expires_at, updated_at)
+		VALUES ($1, $2, $3, 0, $4, NOW())
+		ON CONFLICT (sale_id, region) DO NOTHING
+	`
+	expiresAt := time.Now().UTC().Add(ttl)
+	if leases != nil {
+		query = `
+			INSERT INTO sale_quota_leases (sale_id, region, quota, used, expires_at, updated_at)
+			VALUES ($1, $2, $3, 0, $4, NOW())
+			ON CONFLICT (sale_id, region) DO UPDATE
+			SET quota = sale_quota_leases.quota + EXCLUDED.quota, updated_at = NOW()
+		`
+		expiresAt = time.Now().UTC()
+	}
+
+	for region, quota := range sale.SplitQuota(totalItems-leased, split) {
+		if quota == 0 {
+			continue
+		}
+		if _, err := monitoring.InstrumentTxExec(ctx, tx, "INSERT", "sale_quota_leases", query, saleID, region, quota, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *QuotaLeaseRepository) GetLease(ctx context.Context, saleID, region string) (*sale.QuotaLease, error) {
+	query := `
+		SELECT sale_id, region, quota, used, expires_at, updated_at
+		FROM sale_quota_leases
+		WHERE sale_id = $1 AND region = $2
+	`
+
+	var lease sale.QuotaLease
+	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "sale_quota_leases", query, saleID, region)
+	err := row.Scan(&lease.SaleID, &lease.Region, &lease.Quota, &lease.Used, &lease.ExpiresAt, &lease.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domainErrors.ErrQuotaLeaseNotFound
+		}
+		return nil, err
+	}
+
+	return &lease, nil
+}
+
+func (r *QuotaLeaseRepository) GetLeasesBySaleID(ctx context.Context, saleID string) ([]*sale.QuotaLease, error) {
+	query := `
+		SELECT sale_id, region, quota, used, expires_at, updated_at
+		FROM sale_quota_leases
+		WHERE sale_id = $1
+		ORDER BY region
+	`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.db, "SELECT", "sale_quota_leases", query, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanLeases(rows)
+}
+
+// RenewLease records the region's current usage and extends its lease. Used
+// never decreases so that a stale heartbeat cannot free quota already sold.
+func (r *QuotaLeaseRepository) RenewLease(ctx context.Context, saleID, region string, used int, ttl time.Duration) error {
+	query := `
+		UPDATE sale_quota_leases
+		SET used = GREATEST(used, LEAST($3, quota)), expires_at = $4, updated_at = NOW()
+		WHERE sale_id = $1 AND region = $2
+	`
+
+	result, err := monitoring.InstrumentExec(ctx, r.db, "UPDATE", "sale_quota_leases", query,
+		saleID, region, used, time.Now().UTC().Add(ttl),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domainErrors.ErrQuotaLeaseNotFound
+	}
+
+	return nil
+}
+
+// ReclaimExpiredQuota moves the unused quota of every expired lease of the
+// sale to the given live region and returns the units moved per region.
+func (r *QuotaLeaseRepository) ReclaimExpiredQuota(ctx context.Context, saleID, toRegion string) (map[string]int, error) {
+	tx, leases, err := r.lockLeases(ctx, saleID)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var target *sale.QuotaLease
+	for _, lease := range leases {
+		if lease.Region == toRegion {
+			target = lease
+		}
+	}
+	if target == nil {
+		return nil, domainErrors.ErrQuotaLeaseNotFound
+	}
+	if target.IsExpired(now) {
+		return map[string]int{}, nil
+	}
+
+	moved := make(map[string]int)
+	for _, lease := range leases {
+		if lease.Region == toRegion || !lease.IsExpired(now) || lease.Unused() == 0 {
+			continue
+		}
+
+		unused := lease.Unused()
+		if err := r.transfer(ctx, tx, saleID, lease.Region, toRegion, unused); err != nil {
+			return nil, err
+		}
+		moved[lease.Region] = unused
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	for fromRegion, amount := range moved {
+		monitoring.RecordQuotaTransfer(fromRegion, toRegion, amount)
+	}
+
+	return moved, nil
+}
+
+// TransferQuota moves up to amount unused units from one live region to
+// another and returns how many were actually moved.
+func (r *QuotaLeaseRepository) TransferQuota(ctx context.Context, saleID, fromRegion, toRegion string, amount int) (int, error) {
+	tx, leases, err := r.lockLeases(ctx, saleID)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var from *sale.QuotaLease
+	for _, lease := range leases {
+		if lease.Region == fromRegion {
+			from = lease
+		}
+	}
+	if from == nil {
+		return 0, domainErrors.ErrQuotaLeaseNotFound
+	}
+
+	if amount > from.Unused() {
+		amount = from.Unused()
+	}
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	if err := r.transfer(ctx, tx, saleID, fromRegion, toRegion, amount); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	monitoring.RecordQuotaTransfer(fromRegion, toRegion, amount)
+	return amount, nil
+}
+
+func (r *QuotaLeaseRepository) lockLeases(ctx context.Context, saleID string) (*sql.Tx, []*sale.QuotaLease, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	query := `
+		SELECT sale_id, region, quota, used, expires_at, updated_at
+		FROM sale_quota_leases
+		WHERE sale_id = $1
+		ORDER BY region
+		FOR UPDATE
+	`
+
+	rows, err := monitoring.InstrumentTxQuery(ctx, tx, "SELECT", "sale_quota_leases", query, saleID)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	leases, err := scanLeases(rows)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	return tx, leases, nil
+}
+
+func (r *QuotaLeaseRepository) transfer(ctx context.Context, tx *sql.Tx, saleID, fromRegion, toRegion string, amount int) error {
+	query := `
+		UPDATE sale_quota_leases
+		SET quota = quota + $3, updated_at = NOW()
+		WHERE sale_id = $1 AND region = $2
+	`
+
+	for region, delta := range map[string]int{fromRegion: -amount, toRegion: amount} {
+		result, err := monitoring.InstrumentTxExec(ctx, tx, "UPDATE", "sale_quota_leases", query, saleID, region, delta)
+		if err != nil {
+			return err
+		}
+
+		// Without this check quota taken from one lease would vanish when
+		// the other has no row, and the caller would commit the loss.
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rowsAffected == 0 {
+			return domainErrors.ErrQuotaLeaseNotFound
+		}
+	}
+
+	return nil
+}
+
+func scanLeases(rows *sql.Rows) ([]*sale.QuotaLease, error) {
+	var leases []*sale.QuotaLease
+	for rows.Next() {
+		var lease sale.QuotaLease
+		if err := rows.Scan(&lease.SaleID, &lease.Region, &lease.Quota, &lease.Used, &lease.ExpiresAt, &lease.UpdatedAt); err != nil {
+			return nil, err
+		}
+		leases = append(leases, &lease)
+	}
+
+	return leases, rows.Err()
+}
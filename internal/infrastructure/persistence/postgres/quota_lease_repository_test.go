@@ -0,0 +1,202 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+const leaseTTL = time.Hour
+
+var twoRegions = map[string]float64{"eu": 1, "us": 1}
+
+func newLeasedSale(t *testing.T, totalItems int) (*postgres.QuotaLeaseRepository, string) {
+	t.Helper()
+
+	conn := integration.Postgres(t)
+	s, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Active(clock.NewRealClock()).
+		WithTotalItems(totalItems))
+
+	repo := postgres.NewQuotaLeaseRepository(conn)
+	if err := repo.EnsureLeases(context.Background(), s.ID, totalItems, twoRegions, leaseTTL); err != nil {
+		t.Fatalf("EnsureLeases: %v", err)
+	}
+	return repo, s.ID
+}
+
+func quotas(t *testing.T, repo *postgres.QuotaLeaseRepository, saleID string) map[string]int {
+	t.Helper()
+
+	leases, err := repo.GetLeasesBySaleID(context.Background(), saleID)
+	if err != nil {
+		t.Fatalf("GetLeasesBySaleID: %v", err)
+	}
+	out := make(map[string]int, len(leases))
+	for _, lease := range leases {
+		out[lease.Region] = lease.Quota
+	}
+	return out
+}
+
+func assertQuotas(t *testing.T, got, want map[string]int) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("quotas = %v, want %v", got, want)
+	}
+	for region, quota := range want {
+		if got[region] != quota {
+			t.Errorf("quota of %s = %d, want %d (all quotas %v)", region, got[region], quota, got)
+		}
+	}
+}
+
+// A region that stops heartbeating keeps what it sold; the rest moves to a
+// live region once its lease runs out, and no unit is lost or duplicated.
+func TestReclaimExpiredQuotaFromDownRegion(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	if err := repo.RenewLease(ctx, saleID, "us", 10, leaseTTL); err != nil {
+		t.Fatalf("RenewLease us: %v", err)
+	}
+	// eu sold 5 and then went down; its last heartbeat has expired.
+	if err := repo.RenewLease(ctx, saleID, "eu", 5, -time.Second); err != nil {
+		t.Fatalf("RenewLease eu: %v", err)
+	}
+
+	moved, err := repo.ReclaimExpiredQuota(ctx, saleID, "us")
+	if err != nil {
+		t.Fatalf("ReclaimExpiredQuota: %v", err)
+	}
+	if len(moved) != 1 || moved["eu"] != 45 {
+		t.Errorf("moved = %v, want map[eu:45]", moved)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 5, "us": 95})
+
+	// Nothing is left to reclaim a second time.
+	moved, err = repo.ReclaimExpiredQuota(ctx, saleID, "us")
+	if err != nil {
+		t.Fatalf("ReclaimExpiredQuota: %v", err)
+	}
+	if len(moved) != 0 {
+		t.Errorf("second reclaim moved %v", moved)
+	}
+}
+
+func TestReclaimExpiredQuotaLeavesLiveLeases(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	moved, err := repo.ReclaimExpiredQuota(ctx, saleID, "us")
+	if err != nil {
+		t.Fatalf("ReclaimExpiredQuota: %v", err)
+	}
+	if len(moved) != 0 {
+		t.Errorf("moved = %v from a live lease", moved)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 50, "us": 50})
+}
+
+// A region whose own lease has expired is down as far as the others know
+// and must not collect their quota.
+func TestReclaimExpiredQuotaIntoExpiredRegion(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	for _, region := range []string{"eu", "us"} {
+		if err := repo.RenewLease(ctx, saleID, region, 0, -time.Second); err != nil {
+			t.Fatalf("RenewLease %s: %v", region, err)
+		}
+	}
+
+	moved, err := repo.ReclaimExpiredQuota(ctx, saleID, "us")
+	if err != nil {
+		t.Fatalf("ReclaimExpiredQuota: %v", err)
+	}
+	if len(moved) != 0 {
+		t.Errorf("moved = %v into an expired region", moved)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 50, "us": 50})
+}
+
+func TestTransferQuotaToMissingRegion(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	_, err := repo.TransferQuota(ctx, saleID, "eu", "ap", 10)
+	if !errors.Is(err, domainErrors.ErrQuotaLeaseNotFound) {
+		t.Fatalf("TransferQuota error = %v, want ErrQuotaLeaseNotFound", err)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 50, "us": 50})
+}
+
+func TestTransferQuotaIsCappedAtUnused(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	if err := repo.RenewLease(ctx, saleID, "eu", 40, leaseTTL); err != nil {
+		t.Fatalf("RenewLease: %v", err)
+	}
+
+	moved, err := repo.TransferQuota(ctx, saleID, "eu", "us", 25)
+	if err != nil {
+		t.Fatalf("TransferQuota: %v", err)
+	}
+	if moved != 10 {
+		t.Errorf("moved = %d, want 10", moved)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 40, "us": 60})
+}
+
+func TestEnsureLeasesGrowsWithSale(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	if err := repo.EnsureLeases(ctx, saleID, 140, twoRegions, leaseTTL); err != nil {
+		t.Fatalf("EnsureLeases: %v", err)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 70, "us": 70})
+
+	// Every node runs this on each tick; repeating it must not add quota.
+	if err := repo.EnsureLeases(ctx, saleID, 140, twoRegions, leaseTTL); err != nil {
+		t.Fatalf("EnsureLeases: %v", err)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"eu": 70, "us": 70})
+}
+
+func TestEnsureLeasesAddsJoiningRegionExpired(t *testing.T) {
+	ctx := context.Background()
+	repo, saleID := newLeasedSale(t, 100)
+
+	split := map[string]float64{"eu": 1, "us": 1, "ap": 2}
+	if err := repo.EnsureLeases(ctx, saleID, 140, split, leaseTTL); err != nil {
+		t.Fatalf("EnsureLeases: %v", err)
+	}
+	assertQuotas(t, quotas(t, repo, saleID), map[string]int{"ap": 20, "eu": 60, "us": 60})
+
+	lease, err := repo.GetLease(ctx, saleID, "ap")
+	if err != nil {
+		t.Fatalf("GetLease: %v", err)
+	}
+	if !lease.IsExpired(time.Now()) {
+		t.Errorf("joining region's lease expires at %v, want already expired", lease.ExpiresAt)
+	}
+
+	// Until ap heartbeats, a live region can take its share.
+	moved, err := repo.ReclaimExpiredQuota(ctx, saleID, "eu")
+	if err != nil {
+		t.Fatalf("ReclaimExpiredQuota: %v", err)
+	}
+	if moved["ap"] != 20 {
+		t.Errorf("moved = %v, want ap's 20", moved)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/yuzvak/flashsale-service/internal/application/ports"
 	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
@@ -13,24 +17,39 @@ import (
 )
 
 type SaleRepository struct {
-	db   *sql.DB
-	tx   *sql.Tx
-	isTx bool
+	db     *sql.DB
+	readDB *sql.DB
+	tx     *sql.Tx
+	isTx   bool
 }
 
 func NewSaleRepository(conn *Connection) *SaleRepository {
 	return &SaleRepository{
-		db:   conn.GetDB(),
-		isTx: false,
+		db:     conn.GetDB(),
+		readDB: conn.GetReadDB(),
+		isTx:   false,
 	}
 }
 
+// GetActiveSale reads from the replica when one is configured, so a sale
+// created moments ago may be missing.
 func (r *SaleRepository) GetActiveSale(ctx context.Context) (*sale.Sale, error) {
+	return r.getActiveSale(ctx, r.readDB)
+}
+
+// GetActiveSaleFromPrimary is GetActiveSale for callers that decide on
+// writes by the answer, such as whether to create a sale, and so cannot
+// work with a lagging replica.
+func (r *SaleRepository) GetActiveSaleFromPrimary(ctx context.Context) (*sale.Sale, error) {
+	return r.getActiveSale(ctx, r.db)
+}
+
+func (r *SaleRepository) getActiveSale(ctx context.Context, db *sql.DB) (*sale.Sale, error) {
 	query := `
-		SELECT id, started_at, ended_at, total_items, items_sold, created_at
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
 		FROM sales
 		WHERE started_at <= NOW() AND ended_at > NOW()
-		ORDER BY started_at DESC
+		ORDER BY started_at DESC, id DESC
 		LIMIT 1
 	`
 
@@ -39,11 +58,44 @@ func (r *SaleRepository) GetActiveSale(ctx context.Context) (*sale.Sale, error)
 
 	if r.isTx {
 		err = r.tx.QueryRowContext(ctx, query).Scan(
-			&s.ID, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt,
+			&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale,
 		)
 	} else {
-		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "sales", query)
-		err = row.Scan(&s.ID, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt)
+		row := monitoring.InstrumentQueryRow(ctx, db, "SELECT", "sales", query)
+		err = row.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale)
+	}
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domainErrors.ErrSaleNotFound
+		}
+		return nil, err
+	}
+
+	monitoring.UpdateSaleItemsCount(s.ID, s.TotalItems, s.ItemsSold)
+
+	return &s, nil
+}
+
+func (r *SaleRepository) GetActiveSaleByCategory(ctx context.Context, category string) (*sale.Sale, error) {
+	query := `
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
+		FROM sales
+		WHERE category = $1 AND started_at <= NOW() AND ended_at > NOW()
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`
+
+	var s sale.Sale
+	var err error
+
+	if r.isTx {
+		err = r.tx.QueryRowContext(ctx, query, category).Scan(
+			&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale,
+		)
+	} else {
+		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "sales", query, category)
+		err = row.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale)
 	}
 
 	if err != nil {
@@ -60,7 +112,7 @@ func (r *SaleRepository) GetActiveSale(ctx context.Context) (*sale.Sale, error)
 
 func (r *SaleRepository) GetSaleByID(ctx context.Context, id string) (*sale.Sale, error) {
 	query := `
-		SELECT id, started_at, ended_at, total_items, items_sold, created_at
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
 		FROM sales
 		WHERE id = $1
 	`
@@ -70,11 +122,11 @@ func (r *SaleRepository) GetSaleByID(ctx context.Context, id string) (*sale.Sale
 
 	if r.isTx {
 		err = r.tx.QueryRowContext(ctx, query, id).Scan(
-			&s.ID, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt,
+			&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale,
 		)
 	} else {
 		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "sales", query, id)
-		err = row.Scan(&s.ID, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt)
+		err = row.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale)
 	}
 
 	if err != nil {
@@ -89,21 +141,199 @@ func (r *SaleRepository) GetSaleByID(ctx context.Context, id string) (*sale.Sale
 	return &s, nil
 }
 
+// GetSaleByIDForUpdate reads a sale and locks its row until the
+// transaction ends, so concurrent purchases see each other's items_sold
+// updates instead of the same stale count. It must be called on a
+// repository returned by BeginTx.
+func (r *SaleRepository) GetSaleByIDForUpdate(ctx context.Context, id string) (*sale.Sale, error) {
+	if !r.isTx {
+		return nil, errors.New("GetSaleByIDForUpdate requires a transaction")
+	}
+
+	query := `
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
+		FROM sales
+		WHERE id = $1
+		FOR UPDATE
+	`
+
+	var s sale.Sale
+	row := monitoring.InstrumentTxQueryRow(ctx, r.tx, "SELECT", "sales", query, id)
+	err := row.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domainErrors.ErrSaleNotFound
+		}
+		return nil, err
+	}
+
+	monitoring.UpdateSaleItemsCount(s.ID, s.TotalItems, s.ItemsSold)
+
+	return &s, nil
+}
+
+// GetUpcomingSales returns sales that start after now and no later than
+// until, ordered by start time.
+func (r *SaleRepository) GetUpcomingSales(ctx context.Context, until time.Time, limit int) ([]*sale.Sale, error) {
+	query := `
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
+		FROM sales
+		WHERE started_at > NOW() AND started_at <= $1
+		ORDER BY started_at
+		LIMIT $2
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query, until, limit)
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "sales", query, until, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []*sale.Sale
+
+	for rows.Next() {
+		var s sale.Sale
+		if err := rows.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale); err != nil {
+			return nil, err
+		}
+		sales = append(sales, &s)
+	}
+
+	return sales, rows.Err()
+}
+
+// GetEndedUnpurgedSaleIDs returns up to limit sales that have ended but
+// whose cache keys have not been purged yet, longest ended first.
+func (r *SaleRepository) GetEndedUnpurgedSaleIDs(ctx context.Context, limit int) ([]string, error) {
+	query := `
+		SELECT id
+		FROM sales
+		WHERE ended_at <= NOW() AND cache_purged_at IS NULL
+		ORDER BY ended_at
+		LIMIT $1
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query, limit)
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "sales", query, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// MarkSaleCachePurged records that the sale's cache keys are gone. Moving the
+// sale's end with UpdateSale clears the mark again.
+func (r *SaleRepository) MarkSaleCachePurged(ctx context.Context, saleID string) error {
+	query := `UPDATE sales SET cache_purged_at = NOW() WHERE id = $1`
+
+	var err error
+	if r.isTx {
+		_, err = r.tx.ExecContext(ctx, query, saleID)
+	} else {
+		_, err = monitoring.InstrumentExec(ctx, r.db, "UPDATE", "sales", query, saleID)
+	}
+	return err
+}
+
+const (
+	SaleStatusActive   = sale.StatusActive
+	SaleStatusUpcoming = sale.StatusUpcoming
+	SaleStatusEnded    = sale.StatusEnded
+)
+
+// ListSales pages through sales in ID order using the last ID of the previous
+// page as the cursor, so concurrent inserts cannot shift rows between pages.
+// An empty status lists every sale.
+func (r *SaleRepository) ListSales(ctx context.Context, status string, afterID string, limit int) ([]*sale.Sale, error) {
+	var statusFilter string
+	switch status {
+	case "":
+	case SaleStatusActive:
+		statusFilter = "AND started_at <= NOW() AND ended_at > NOW()"
+	case SaleStatusUpcoming:
+		statusFilter = "AND started_at > NOW()"
+	case SaleStatusEnded:
+		statusFilter = "AND ended_at <= NOW()"
+	default:
+		return nil, fmt.Errorf("unknown sale status %q", status)
+	}
+
+	query := `
+		SELECT id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
+		FROM sales
+		WHERE id > $1 ` + statusFilter + `
+		ORDER BY id
+		LIMIT $2
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query, afterID, limit)
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "sales", query, afterID, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sales []*sale.Sale
+
+	for rows.Next() {
+		var s sale.Sale
+		if err := rows.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale); err != nil {
+			return nil, err
+		}
+		sales = append(sales, &s)
+	}
+
+	return sales, rows.Err()
+}
+
 func (r *SaleRepository) CreateSale(ctx context.Context, s *sale.Sale) error {
 	query := `
-		INSERT INTO sales (id, started_at, ended_at, total_items, items_sold, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO sales (id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	var err error
 
 	if r.isTx {
 		_, err = r.tx.ExecContext(ctx, query,
-			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.CreatedAt,
+			s.ID, s.Category, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.CreatedAt, s.MaxItemsPerUser, s.MaxItemsPerSale,
 		)
 	} else {
 		_, err = monitoring.InstrumentExec(ctx, r.db, "INSERT", "sales", query,
-			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.CreatedAt,
+			s.ID, s.Category, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.CreatedAt, s.MaxItemsPerUser, s.MaxItemsPerSale,
 		)
 	}
 
@@ -113,7 +343,9 @@ func (r *SaleRepository) CreateSale(ctx context.Context, s *sale.Sale) error {
 func (r *SaleRepository) UpdateSale(ctx context.Context, s *sale.Sale) error {
 	query := `
 		UPDATE sales
-		SET started_at = $2, ended_at = $3, total_items = $4, items_sold = $5
+		SET started_at = $2, ended_at = $3, total_items = $4, items_sold = $5,
+			max_items_per_user = $6, max_items_per_sale = $7,
+			cache_purged_at = CASE WHEN ended_at = $3 THEN cache_purged_at END
 		WHERE id = $1
 	`
 
@@ -121,11 +353,11 @@ func (r *SaleRepository) UpdateSale(ctx context.Context, s *sale.Sale) error {
 
 	if r.isTx {
 		_, err = r.tx.ExecContext(ctx, query,
-			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold,
+			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.MaxItemsPerUser, s.MaxItemsPerSale,
 		)
 	} else {
 		_, err = monitoring.InstrumentExec(ctx, r.db, "UPDATE", "sales", query,
-			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold,
+			s.ID, s.StartedAt, s.EndedAt, s.TotalItems, s.ItemsSold, s.MaxItemsPerUser, s.MaxItemsPerSale,
 		)
 	}
 
@@ -136,26 +368,61 @@ func (r *SaleRepository) UpdateSale(ctx context.Context, s *sale.Sale) error {
 	return err
 }
 
+// IncrementSaleTotalItems adds count to a sale's total in place and returns
+// the updated sale, so concurrent additions and purchases cannot overwrite
+// each other's counts. Within a transaction the row stays locked until it
+// ends.
+func (r *SaleRepository) IncrementSaleTotalItems(ctx context.Context, id string, count int) (*sale.Sale, error) {
+	query := `
+		UPDATE sales
+		SET total_items = total_items + $2
+		WHERE id = $1
+		RETURNING id, category, started_at, ended_at, total_items, items_sold, created_at, max_items_per_user, max_items_per_sale
+	`
+
+	var row *sql.Row
+	if r.isTx {
+		row = monitoring.InstrumentTxQueryRow(ctx, r.tx, "UPDATE", "sales", query, id, count)
+	} else {
+		row = monitoring.InstrumentQueryRow(ctx, r.db, "UPDATE", "sales", query, id, count)
+	}
+
+	var s sale.Sale
+	err := row.Scan(&s.ID, &s.Category, &s.StartedAt, &s.EndedAt, &s.TotalItems, &s.ItemsSold, &s.CreatedAt, &s.MaxItemsPerUser, &s.MaxItemsPerSale)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domainErrors.ErrSaleNotFound
+		}
+		return nil, err
+	}
+
+	monitoring.UpdateSaleItemsCount(s.ID, s.TotalItems, s.ItemsSold)
+
+	return &s, nil
+}
+
 func (r *SaleRepository) GetItemByID(ctx context.Context, id string) (*sale.Item, error) {
 	query := `
-		SELECT id, sale_id, name, image_url, sold, sold_to_user_id, sold_at, created_at
+		SELECT id, sale_id, name, image_url, price, description, metadata, sold, sold_to_user_id, sold_at, created_at
 		FROM items
 		WHERE id = $1
 	`
 
 	var item sale.Item
+	var description sql.NullString
+	var metadata []byte
 	var soldToUserID sql.NullString
 	var soldAt sql.NullTime
 	var err error
 
 	if r.isTx {
 		err = r.tx.QueryRowContext(ctx, query, id).Scan(
-			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Sold,
+			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Price, &description, &metadata, &item.Sold,
 			&soldToUserID, &soldAt, &item.CreatedAt,
 		)
 	} else {
-		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "items", query, id)
-		err = row.Scan(&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Sold,
+		row := monitoring.InstrumentQueryRow(ctx, r.readDB, "SELECT", "items", query, id)
+		err = row.Scan(&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Price, &description, &metadata, &item.Sold,
 			&soldToUserID, &soldAt, &item.CreatedAt,
 		)
 	}
@@ -167,6 +434,11 @@ func (r *SaleRepository) GetItemByID(ctx context.Context, id string) (*sale.Item
 		return nil, err
 	}
 
+	item.Description = description.String
+	if err := decodeItemMetadata(metadata, &item); err != nil {
+		return nil, err
+	}
+
 	if soldToUserID.Valid {
 		item.SoldToUserID = soldToUserID.String
 	}
@@ -180,7 +452,7 @@ func (r *SaleRepository) GetItemByID(ctx context.Context, id string) (*sale.Item
 
 func (r *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error) {
 	query := `
-		SELECT id, sale_id, name, image_url, sold, sold_to_user_id, sold_at, created_at
+		SELECT id, sale_id, name, image_url, price, description, metadata, sold, sold_to_user_id, sold_at, created_at
 		FROM items
 		WHERE sale_id = $1
 		ORDER BY created_at
@@ -193,7 +465,7 @@ func (r *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, li
 	if r.isTx {
 		rows, err = r.tx.QueryContext(ctx, query, saleID, limit, offset)
 	} else {
-		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "items", query, saleID, limit, offset)
+		rows, err = monitoring.InstrumentQuery(ctx, r.readDB, "SELECT", "items", query, saleID, limit, offset)
 	}
 
 	if err != nil {
@@ -205,17 +477,24 @@ func (r *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, li
 
 	for rows.Next() {
 		var item sale.Item
+		var description sql.NullString
+		var metadata []byte
 		var soldToUserID sql.NullString
 		var soldAt sql.NullTime
 
 		err := rows.Scan(
-			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Sold,
+			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Price, &description, &metadata, &item.Sold,
 			&soldToUserID, &soldAt, &item.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		item.Description = description.String
+		if err := decodeItemMetadata(metadata, &item); err != nil {
+			return nil, err
+		}
+
 		if soldToUserID.Valid {
 			item.SoldToUserID = soldToUserID.String
 		}
@@ -225,9 +504,9 @@ func (r *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, li
 		}
 
 		if item.Sold {
-			monitoring.SaleItemsSold.Add(1)
+			monitoring.SaleItemsSold.WithLabelValues(item.SaleID).Add(1)
 		} else {
-			monitoring.SaleItemsTotal.Add(1)
+			monitoring.SaleItemsTotal.WithLabelValues(item.SaleID).Add(1)
 		}
 
 		items = append(items, &item)
@@ -236,9 +515,58 @@ func (r *SaleRepository) GetItemsBySaleID(ctx context.Context, saleID string, li
 	return items, nil
 }
 
+func (r *SaleRepository) CountItemsBySaleID(ctx context.Context, saleID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM items
+		WHERE sale_id = $1
+	`
+
+	var count int
+	var err error
+
+	if r.isTx {
+		err = r.tx.QueryRowContext(ctx, query, saleID).Scan(&count)
+	} else {
+		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "items", query, saleID)
+		err = row.Scan(&count)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetSaleSoldCount counts the sale's sold items without loading them.
+func (r *SaleRepository) GetSaleSoldCount(ctx context.Context, saleID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM items
+		WHERE sale_id = $1 AND sold = TRUE
+	`
+
+	var count int
+	var err error
+
+	if r.isTx {
+		err = r.tx.QueryRowContext(ctx, query, saleID).Scan(&count)
+	} else {
+		row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "items", query, saleID)
+		err = row.Scan(&count)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
 func (r *SaleRepository) GetAvailableItemsBySaleID(ctx context.Context, saleID string, limit, offset int) ([]*sale.Item, error) {
 	query := `
-		SELECT id, sale_id, name, image_url, sold, sold_to_user_id, sold_at, created_at
+		SELECT id, sale_id, name, image_url, price, description, metadata, sold, sold_to_user_id, sold_at, created_at
 		FROM items
 		WHERE sale_id = $1 AND sold = FALSE
 		ORDER BY created_at
@@ -263,17 +591,24 @@ func (r *SaleRepository) GetAvailableItemsBySaleID(ctx context.Context, saleID s
 
 	for rows.Next() {
 		var item sale.Item
+		var description sql.NullString
+		var metadata []byte
 		var soldToUserID sql.NullString
 		var soldAt sql.NullTime
 
 		err := rows.Scan(
-			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Sold,
+			&item.ID, &item.SaleID, &item.Name, &item.ImageURL, &item.Price, &description, &metadata, &item.Sold,
 			&soldToUserID, &soldAt, &item.CreatedAt,
 		)
 		if err != nil {
 			return nil, err
 		}
 
+		item.Description = description.String
+		if err := decodeItemMetadata(metadata, &item); err != nil {
+			return nil, err
+		}
+
 		if soldToUserID.Valid {
 			item.SoldToUserID = soldToUserID.String
 		}
@@ -283,9 +618,9 @@ func (r *SaleRepository) GetAvailableItemsBySaleID(ctx context.Context, saleID s
 		}
 
 		if item.Sold {
-			monitoring.SaleItemsSold.Add(1)
+			monitoring.SaleItemsSold.WithLabelValues(item.SaleID).Add(1)
 		} else {
-			monitoring.SaleItemsTotal.Add(1)
+			monitoring.SaleItemsTotal.WithLabelValues(item.SaleID).Add(1)
 		}
 
 		items = append(items, &item)
@@ -294,21 +629,90 @@ func (r *SaleRepository) GetAvailableItemsBySaleID(ctx context.Context, saleID s
 	return items, nil
 }
 
-func (r *SaleRepository) CreateItem(ctx context.Context, item *sale.Item) error {
+func (r *SaleRepository) GetSoldItemIDs(ctx context.Context) ([]string, error) {
 	query := `
-		INSERT INTO items (id, sale_id, name, image_url, sold, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		SELECT id
+		FROM items
+		WHERE sold = TRUE
 	`
 
+	var rows *sql.Rows
 	var err error
 
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query)
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "items", query)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var itemIDs []string
+	for rows.Next() {
+		var itemID string
+		if err := rows.Scan(&itemID); err != nil {
+			return nil, err
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+
+	return itemIDs, rows.Err()
+}
+
+func (r *SaleRepository) GetSoldItemIDsBySaleID(ctx context.Context, saleID string) ([]string, error) {
+	query := `
+		SELECT id
+		FROM items
+		WHERE sale_id = $1 AND sold = TRUE
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query, saleID)
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "SELECT", "items", query, saleID)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var itemIDs []string
+	for rows.Next() {
+		var itemID string
+		if err := rows.Scan(&itemID); err != nil {
+			return nil, err
+		}
+		itemIDs = append(itemIDs, itemID)
+	}
+
+	return itemIDs, rows.Err()
+}
+
+func (r *SaleRepository) CreateItem(ctx context.Context, item *sale.Item) error {
+	query := `
+		INSERT INTO items (id, sale_id, name, image_url, price, description, metadata, sold, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	metadata, err := encodeItemMetadata(item.Metadata)
+	if err != nil {
+		return err
+	}
+
 	if r.isTx {
 		_, err = r.tx.ExecContext(ctx, query,
-			item.ID, item.SaleID, item.Name, item.ImageURL, item.Sold, item.CreatedAt,
+			item.ID, item.SaleID, item.Name, item.ImageURL, item.Price, item.Description, metadata, item.Sold, item.CreatedAt,
 		)
 	} else {
 		_, err = monitoring.InstrumentExec(ctx, r.db, "INSERT", "items", query,
-			item.ID, item.SaleID, item.Name, item.ImageURL, item.Sold, item.CreatedAt,
+			item.ID, item.SaleID, item.Name, item.ImageURL, item.Price, item.Description, metadata, item.Sold, item.CreatedAt,
 		)
 	}
 
@@ -338,8 +742,8 @@ func (r *SaleRepository) CreateItems(ctx context.Context, items []*sale.Item) er
 	}
 
 	stmt, err := tx.PrepareContext(ctx, `
-		INSERT INTO items (id, sale_id, name, image_url, sold, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO items (id, sale_id, name, image_url, price, description, metadata, sold, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`)
 	if err != nil {
 		return err
@@ -347,8 +751,14 @@ func (r *SaleRepository) CreateItems(ctx context.Context, items []*sale.Item) er
 	defer stmt.Close()
 
 	for _, item := range items {
+		var metadata string
+		metadata, err = encodeItemMetadata(item.Metadata)
+		if err != nil {
+			return err
+		}
+
 		_, err = stmt.ExecContext(ctx,
-			item.ID, item.SaleID, item.Name, item.ImageURL, item.Sold, item.CreatedAt,
+			item.ID, item.SaleID, item.Name, item.ImageURL, item.Price, item.Description, metadata, item.Sold, item.CreatedAt,
 		)
 		if err != nil {
 			return err
@@ -362,6 +772,141 @@ func (r *SaleRepository) CreateItems(ctx context.Context, items []*sale.Item) er
 	return nil
 }
 
+// MarkItemAsUnsold reverses userID's purchase of an item: the item becomes
+// available again and the sale's sold count drops by one, in a single
+// statement. An item sold to someone else is left alone, so a refund checked
+// against a stale read cannot undo another user's purchase.
+func (r *SaleRepository) MarkItemAsUnsold(ctx context.Context, itemID, userID string) error {
+	query := `
+		WITH refunded AS (
+			UPDATE items
+			SET sold = FALSE, sold_to_user_id = NULL, sold_at = NULL
+			WHERE id = $1 AND sold = TRUE AND sold_to_user_id = $2
+			RETURNING id, sale_id
+		), removed AS (
+			DELETE FROM purchases
+			WHERE item_id IN (SELECT id FROM refunded)
+		)
+		UPDATE sales
+		SET items_sold = GREATEST(items_sold - 1, 0)
+		WHERE id = (SELECT sale_id FROM refunded)
+	`
+
+	var result sql.Result
+	var err error
+
+	if r.isTx {
+		result, err = r.tx.ExecContext(ctx, query, itemID, userID)
+	} else {
+		result, err = monitoring.InstrumentExec(ctx, r.db, "UPDATE", "items", query, itemID, userID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domainErrors.ErrItemNotSold
+	}
+
+	return nil
+}
+
+// encodeItemMetadata renders item metadata for the JSONB column, storing an
+// empty object rather than null when there is none.
+func encodeItemMetadata(metadata map[string]interface{}) (string, error) {
+	if len(metadata) == 0 {
+		return "{}", nil
+	}
+
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode item metadata: %w", err)
+	}
+	return string(encoded), nil
+}
+
+func decodeItemMetadata(raw []byte, item *sale.Item) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, &item.Metadata); err != nil {
+		return fmt.Errorf("failed to decode metadata of item %s: %w", item.ID, err)
+	}
+	return nil
+}
+
+// CopyInsertThreshold is the batch size above which callers should prefer
+// CreateItemsWithCopy over CreateItems.
+const CopyInsertThreshold = 100
+
+// CreateItemsWithCopy bulk loads items with COPY FROM STDIN, which is much
+// faster than row by row inserts for the item counts of a whole sale.
+func (r *SaleRepository) CreateItemsWithCopy(ctx context.Context, items []*sale.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	var tx *sql.Tx
+	var err error
+
+	if r.isTx {
+		tx = r.tx
+	} else {
+		tx, err = r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				tx.Rollback()
+			}
+		}()
+	}
+
+	defer monitoring.TimeDBQuery("COPY", "items")()
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("items", "id", "sale_id", "name", "image_url", "price", "description", "metadata", "sold", "created_at"))
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var metadata string
+		metadata, err = encodeItemMetadata(item.Metadata)
+		if err == nil {
+			_, err = stmt.ExecContext(ctx,
+				item.ID, item.SaleID, item.Name, item.ImageURL, item.Price, item.Description, metadata, item.Sold, item.CreatedAt,
+			)
+		}
+		if err != nil {
+			stmt.Close()
+			return err
+		}
+	}
+
+	// The final Exec without arguments flushes the buffered rows.
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		stmt.Close()
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		return err
+	}
+
+	if !r.isTx {
+		err = tx.Commit()
+		return err
+	}
+
+	return nil
+}
+
 func (r *SaleRepository) MarkItemAsSold(ctx context.Context, id string, userID string) (bool, error) {
 	query := `
 		UPDATE items
@@ -394,7 +939,7 @@ func (r *SaleRepository) MarkItemAsSold(ctx context.Context, id string, userID s
 		if r.isTx {
 			err = r.tx.QueryRowContext(ctx, getSaleQuery, id).Scan(&saleID)
 		} else {
-			err = r.db.QueryRowContext(ctx, getSaleQuery, id).Scan(&saleID)
+			err = monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "items", getSaleQuery, id).Scan(&saleID)
 		}
 		if err == nil {
 			monitoring.RecordItemSold(saleID, id)
@@ -404,6 +949,75 @@ func (r *SaleRepository) MarkItemAsSold(ctx context.Context, id string, userID s
 	return success, nil
 }
 
+// BatchMarkItemsAsSold marks every unsold item in itemIDs as sold to userID
+// in a single statement and returns the IDs it actually updated.
+func (r *SaleRepository) BatchMarkItemsAsSold(ctx context.Context, itemIDs []string, userID string) ([]string, error) {
+	if len(itemIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		UPDATE items
+		SET sold = TRUE, sold_to_user_id = $1, sold_at = NOW()
+		WHERE id = ANY($2) AND sold = FALSE
+		RETURNING id, sale_id
+	`
+
+	var rows *sql.Rows
+	var err error
+
+	if r.isTx {
+		rows, err = r.tx.QueryContext(ctx, query, userID, pq.Array(itemIDs))
+	} else {
+		rows, err = monitoring.InstrumentQuery(ctx, r.db, "UPDATE", "items", query, userID, pq.Array(itemIDs))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updated := make([]string, 0, len(itemIDs))
+	for rows.Next() {
+		var id, saleID string
+		if err := rows.Scan(&id, &saleID); err != nil {
+			return nil, err
+		}
+		updated = append(updated, id)
+		monitoring.RecordItemSold(saleID, id)
+	}
+
+	return updated, rows.Err()
+}
+
+// RecordPurchases adds a purchases row for each item sold to userID by the
+// checkout, for the purchase analytics and exports.
+func (r *SaleRepository) RecordPurchases(ctx context.Context, saleID, userID, checkoutCode string, itemIDs []string) error {
+	if len(itemIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO purchases (id, sale_id, user_id, item_id, checkout_code, purchased_at)
+		SELECT purchase.id, $3, $4, purchase.item_id, $5, NOW()
+		FROM unnest($1::text[], $2::text[]) AS purchase(id, item_id)
+	`
+
+	ids := make([]string, len(itemIDs))
+	for i := range itemIDs {
+		ids[i] = uuid.NewString()
+	}
+
+	var err error
+	if r.isTx {
+		_, err = r.tx.ExecContext(ctx, query, pq.Array(ids), pq.Array(itemIDs), saleID, userID, checkoutCode)
+	} else {
+		_, err = monitoring.InstrumentExec(ctx, r.db, "INSERT", "purchases", query, pq.Array(ids), pq.Array(itemIDs), saleID, userID, checkoutCode)
+	}
+
+	return err
+}
+
 func (r *SaleRepository) BeginTx(ctx context.Context) (ports.SaleRepository, error) {
 	if r.isTx {
 		return nil, errors.New("transaction already started")
@@ -417,9 +1031,10 @@ func (r *SaleRepository) BeginTx(ctx context.Context) (ports.SaleRepository, err
 	}
 
 	return &SaleRepository{
-		db:   r.db,
-		tx:   tx,
-		isTx: true,
+		db:     r.db,
+		readDB: r.readDB,
+		tx:     tx,
+		isTx:   true,
 	}, nil
 }
 
@@ -446,7 +1061,7 @@ func (r *SaleRepository) SavePurchaseResult(ctx context.Context, checkoutCode st
 		ON CONFLICT (checkout_code) DO NOTHING
 	`
 
-	resultJSON, err := json.Marshal(result)
+	resultJSON, err := encodePurchaseResult(result)
 	if err != nil {
 		return err
 	}
@@ -484,10 +1099,101 @@ func (r *SaleRepository) GetPurchaseResult(ctx context.Context, checkoutCode str
 	}
 
 	var result sale.PurchaseResult
-	err = json.Unmarshal(resultJSON, &result)
+	if err := json.Unmarshal(resultJSON, &result); err != nil {
+		// The row exists, so the checkout was processed; keep idempotency
+		// intact instead of failing every retry on a corrupted payload.
+		monitoring.PurchaseResultCorruptionTotal.Inc()
+		return &sale.PurchaseResult{Corrupted: true, CorruptionError: err.Error()}, nil
+	}
+
+	return &result, nil
+}
+
+// AppendOutboxEvent stores an event for the outbox publisher. Called on a
+// transactional repository, the event is only published if the transaction
+// commits.
+func (r *SaleRepository) AppendOutboxEvent(ctx context.Context, eventType string, payload interface{}) error {
+	query := `
+		INSERT INTO outbox (event_type, payload, created_at)
+		VALUES ($1, $2, NOW())
+	`
+
+	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	if r.isTx {
+		_, err = r.tx.ExecContext(ctx, query, eventType, payloadJSON)
+	} else {
+		_, err = monitoring.InstrumentExec(ctx, r.db, "INSERT", "outbox", query, eventType, payloadJSON)
+	}
+
+	return err
+}
+
+func (r *SaleRepository) GetRawPurchaseResult(ctx context.Context, checkoutCode string) ([]byte, error) {
+	query := `
+		SELECT result FROM purchase_results
+		WHERE checkout_code = $1
+	`
+
+	var resultJSON []byte
+	row := monitoring.InstrumentQueryRow(ctx, r.db, "SELECT", "purchase_results", query, checkoutCode)
+	if err := row.Scan(&resultJSON); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domainErrors.ErrPurchaseResultNotFound
+		}
 		return nil, err
 	}
 
-	return &result, nil
+	return resultJSON, nil
+}
+
+func (r *SaleRepository) ReplacePurchaseResult(ctx context.Context, checkoutCode string, result *sale.PurchaseResult) error {
+	query := `
+		UPDATE purchase_results
+		SET result = $2
+		WHERE checkout_code = $1
+	`
+
+	resultJSON, err := encodePurchaseResult(result)
+	if err != nil {
+		return err
+	}
+
+	res, err := monitoring.InstrumentExec(ctx, r.db, "UPDATE", "purchase_results", query, checkoutCode, resultJSON)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return domainErrors.ErrPurchaseResultNotFound
+	}
+
+	return nil
+}
+
+// encodePurchaseResult marshals the result and round-trips it so that only
+// payloads the read path can decode are ever written.
+func encodePurchaseResult(result *sale.PurchaseResult) ([]byte, error) {
+	if result == nil {
+		return nil, domainErrors.ErrInvalidPurchaseResult
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded sale.PurchaseResult
+	if err := json.Unmarshal(resultJSON, &decoded); err != nil {
+		return nil, fmt.Errorf("%w: %v", domainErrors.ErrInvalidPurchaseResult, err)
+	}
+
+	return resultJSON, nil
 }
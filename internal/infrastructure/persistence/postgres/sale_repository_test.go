@@ -0,0 +1,696 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+func containsSale(sales []*sale.Sale, id string) bool {
+	for _, s := range sales {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGetUpcomingSalesHorizonAndLimit(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC()
+
+	soon, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(time.Hour), now.Add(2*time.Hour)))
+	later, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(3*time.Hour), now.Add(4*time.Hour)))
+	beyond, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(10*24*time.Hour), now.Add(10*24*time.Hour+time.Hour)))
+	running, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(-time.Hour), now.Add(time.Hour)))
+
+	sales, err := repo.GetUpcomingSales(ctx, now.Add(7*24*time.Hour), 100)
+	if err != nil {
+		t.Fatalf("GetUpcomingSales: %v", err)
+	}
+	if !containsSale(sales, soon.ID) || !containsSale(sales, later.ID) {
+		t.Errorf("sales within the horizon are missing")
+	}
+	if containsSale(sales, beyond.ID) {
+		t.Errorf("sale beyond the horizon was returned")
+	}
+	if containsSale(sales, running.ID) {
+		t.Errorf("sale that already started was returned")
+	}
+	for i := 1; i < len(sales); i++ {
+		if sales[i].StartedAt.Before(sales[i-1].StartedAt) {
+			t.Fatalf("sales are not ordered by start: %v before %v", sales[i-1].StartedAt, sales[i].StartedAt)
+		}
+	}
+
+	// Other tests may have upcoming sales of their own, so only check the
+	// window ending with ours.
+	limited, err := repo.GetUpcomingSales(ctx, now.Add(90*time.Minute), 1)
+	if err != nil {
+		t.Fatalf("GetUpcomingSales: %v", err)
+	}
+	if len(limited) != 1 {
+		t.Fatalf("limit 1 returned %d sales", len(limited))
+	}
+	if containsSale(limited, later.ID) {
+		t.Errorf("sale after the horizon was returned with limit 1")
+	}
+}
+
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestEndedUnpurgedSales(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC()
+
+	ended, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(-2*time.Hour), now.Add(-time.Hour)))
+	running, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(-time.Hour), now.Add(time.Hour)))
+
+	// Other tests leave ended sales of their own behind while they run.
+	const limit = 10000
+	unpurged := func() []string {
+		t.Helper()
+		ids, err := repo.GetEndedUnpurgedSaleIDs(ctx, limit)
+		if err != nil {
+			t.Fatalf("GetEndedUnpurgedSaleIDs: %v", err)
+		}
+		return ids
+	}
+
+	ids := unpurged()
+	if !containsID(ids, ended.ID) {
+		t.Errorf("ended sale is not listed")
+	}
+	if containsID(ids, running.ID) {
+		t.Errorf("running sale is listed")
+	}
+
+	if err := repo.MarkSaleCachePurged(ctx, ended.ID); err != nil {
+		t.Fatalf("MarkSaleCachePurged: %v", err)
+	}
+	if containsID(unpurged(), ended.ID) {
+		t.Errorf("purged sale is still listed")
+	}
+
+	// Reopening and ending the sale again needs another purge.
+	reopened, err := repo.GetSaleByID(ctx, ended.ID)
+	if err != nil {
+		t.Fatalf("GetSaleByID: %v", err)
+	}
+	reopened.EndedAt = now.Add(-time.Minute)
+	if err := repo.UpdateSale(ctx, reopened); err != nil {
+		t.Fatalf("UpdateSale: %v", err)
+	}
+	if !containsID(unpurged(), ended.ID) {
+		t.Errorf("sale with a new end is not listed again")
+	}
+
+	// Updates that keep the end leave the mark alone.
+	if err := repo.MarkSaleCachePurged(ctx, ended.ID); err != nil {
+		t.Fatalf("MarkSaleCachePurged: %v", err)
+	}
+	reopened.TotalItems++
+	if err := repo.UpdateSale(ctx, reopened); err != nil {
+		t.Fatalf("UpdateSale: %v", err)
+	}
+	if containsID(unpurged(), ended.ID) {
+		t.Errorf("an update that kept the end cleared the purge mark")
+	}
+}
+
+// listAllSales pages through ListSales until a short page and returns every
+// sale in the order the pages returned them.
+func listAllSales(t *testing.T, repo *postgres.SaleRepository, status string, pageSize int) []*sale.Sale {
+	t.Helper()
+
+	var all []*sale.Sale
+	cursor := ""
+	for {
+		page, err := repo.ListSales(context.Background(), status, cursor, pageSize)
+		if err != nil {
+			t.Fatalf("ListSales(%q, %q): %v", status, cursor, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("page of %d sales exceeds the limit %d", len(page), pageSize)
+		}
+		all = append(all, page...)
+		if len(page) < pageSize {
+			return all
+		}
+		cursor = page[len(page)-1].ID
+	}
+}
+
+func TestListSalesPagesByID(t *testing.T) {
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC()
+
+	var ours []string
+	for i := 0; i < 5; i++ {
+		s, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+			Between(now.Add(-time.Hour), now.Add(time.Hour)))
+		ours = append(ours, s.ID)
+	}
+
+	all := listAllSales(t, repo, "", 2)
+
+	seen := make(map[string]int)
+	for i, s := range all {
+		seen[s.ID]++
+		if i > 0 && all[i-1].ID >= s.ID {
+			t.Fatalf("sales are not in ID order: %s before %s", all[i-1].ID, s.ID)
+		}
+	}
+	for _, id := range ours {
+		if seen[id] != 1 {
+			t.Errorf("sale %s was listed %d times, want once", id, seen[id])
+		}
+	}
+}
+
+func TestListSalesFiltersByStatus(t *testing.T) {
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC()
+
+	active, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(-time.Hour), now.Add(time.Hour)))
+	upcoming, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(time.Hour), now.Add(2*time.Hour)))
+	ended, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Between(now.Add(-2*time.Hour), now.Add(-time.Hour)))
+
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{status: postgres.SaleStatusActive, want: active.ID},
+		{status: postgres.SaleStatusUpcoming, want: upcoming.ID},
+		{status: postgres.SaleStatusEnded, want: ended.ID},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			sales := listAllSales(t, repo, tt.status, 100)
+			for _, id := range []string{active.ID, upcoming.ID, ended.ID} {
+				if got := containsSale(sales, id); got != (id == tt.want) {
+					t.Errorf("sale %s listed = %v", id, got)
+				}
+			}
+		})
+	}
+
+	if _, err := repo.ListSales(context.Background(), "cancelled", "", 10); err == nil {
+		t.Error("ListSales accepted an unknown status")
+	}
+}
+
+// newItemsForEmptySale stores a sale without items and returns count unsaved
+// items belonging to it.
+func newItemsForEmptySale(tb testing.TB, conn *postgres.Connection, count int) []*sale.Item {
+	tb.Helper()
+
+	builder := fixtures.NewSaleBuilder()
+	integration.SeedSale(tb, conn, builder)
+	return builder.WithItems(count).BuildItems()
+}
+
+func TestCreateItemsWithCopy(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+
+	items := newItemsForEmptySale(t, conn, postgres.CopyInsertThreshold+50)
+	items[0].Metadata = map[string]interface{}{"color": "red"}
+
+	if err := repo.CreateItemsWithCopy(ctx, items); err != nil {
+		t.Fatalf("CreateItemsWithCopy: %v", err)
+	}
+
+	count, err := repo.CountItemsBySaleID(ctx, items[0].SaleID)
+	if err != nil {
+		t.Fatalf("CountItemsBySaleID: %v", err)
+	}
+	if count != len(items) {
+		t.Errorf("stored %d items, want %d", count, len(items))
+	}
+
+	got, err := repo.GetItemByID(ctx, items[0].ID)
+	if err != nil {
+		t.Fatalf("GetItemByID: %v", err)
+	}
+	if got.Name != items[0].Name || !got.Price.Equal(items[0].Price) || got.Sold {
+		t.Errorf("stored item = %+v, want %+v", got, items[0])
+	}
+	if got.Metadata["color"] != "red" {
+		t.Errorf("stored metadata = %v, want color red", got.Metadata)
+	}
+}
+
+// BenchmarkCreateItems compares loading a whole sale's items with COPY
+// against the prepared statement loop; COPY should be at least five times
+// faster at 10k rows.
+func BenchmarkCreateItems(b *testing.B) {
+	const itemCount = 10000
+
+	conn := integration.Postgres(b)
+	repo := postgres.NewSaleRepository(conn)
+
+	benchmarks := []struct {
+		name   string
+		create func(context.Context, []*sale.Item) error
+	}{
+		{name: "PreparedStatement", create: repo.CreateItems},
+		{name: "Copy", create: repo.CreateItemsWithCopy},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				items := newItemsForEmptySale(b, conn, itemCount)
+				b.StartTimer()
+
+				if err := bm.create(ctx, items); err != nil {
+					b.Fatalf("create items: %v", err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*itemCount), "ns/item")
+		})
+	}
+}
+
+func TestCreateSaleAndGetActiveSale(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	s := fixtures.NewSaleBuilder().
+		WithID(integration.NewSaleID()).
+		Between(now, now.Add(time.Hour)).
+		WithLimits(3, 500).
+		Build()
+	integration.DeleteSaleOnCleanup(t, conn, s.ID)
+
+	if err := repo.CreateSale(ctx, s); err != nil {
+		t.Fatalf("CreateSale: %v", err)
+	}
+	if err := repo.CreateSale(ctx, s); err == nil {
+		t.Error("CreateSale stored the same ID twice")
+	}
+
+	stored, err := repo.GetSaleByID(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("GetSaleByID: %v", err)
+	}
+	if !stored.StartedAt.Equal(s.StartedAt) || !stored.EndedAt.Equal(s.EndedAt) ||
+		stored.TotalItems != s.TotalItems || stored.MaxItemsPerUser != 3 || stored.MaxItemsPerSale != 500 {
+		t.Errorf("stored sale = %+v, want %+v", stored, s)
+	}
+
+	// Other packages' tests share the database and may start a sale after
+	// ours, so ours only has to win against sales that started earlier.
+	for name, get := range map[string]func(context.Context) (*sale.Sale, error){
+		"GetActiveSale":            repo.GetActiveSale,
+		"GetActiveSaleFromPrimary": repo.GetActiveSaleFromPrimary,
+	} {
+		active, err := get(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if active.ID != s.ID && active.StartedAt.Before(s.StartedAt) {
+			t.Errorf("%s = %s started at %v, want %s started at %v", name, active.ID, active.StartedAt, s.ID, s.StartedAt)
+		}
+	}
+
+	if _, err := repo.GetSaleByID(ctx, integration.NewSaleID()); !errors.Is(err, domainErrors.ErrSaleNotFound) {
+		t.Errorf("GetSaleByID of an unknown sale: error = %v, want ErrSaleNotFound", err)
+	}
+}
+
+func TestCreateItems(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+
+	items := newItemsForEmptySale(t, conn, 20)
+	if err := repo.CreateItems(ctx, items); err != nil {
+		t.Fatalf("CreateItems: %v", err)
+	}
+
+	count, err := repo.CountItemsBySaleID(ctx, items[0].SaleID)
+	if err != nil {
+		t.Fatalf("CountItemsBySaleID: %v", err)
+	}
+	if count != len(items) {
+		t.Errorf("stored %d items, want %d", count, len(items))
+	}
+
+	// A duplicate ID fails the whole batch.
+	more := newItemsForEmptySale(t, conn, 3)
+	more[2].ID = items[0].ID
+	if err := repo.CreateItems(ctx, more); err == nil {
+		t.Fatal("CreateItems accepted a duplicate item ID")
+	}
+	if count, err := repo.CountItemsBySaleID(ctx, more[0].SaleID); err != nil || count != 0 {
+		t.Errorf("failed batch left %d items (error %v), want none", count, err)
+	}
+}
+
+func TestMarkItemAsSold(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	_, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(1))
+
+	sold, err := repo.MarkItemAsSold(ctx, items[0].ID, "user_1")
+	if err != nil || !sold {
+		t.Fatalf("MarkItemAsSold = %v, %v; want true", sold, err)
+	}
+	sold, err = repo.MarkItemAsSold(ctx, items[0].ID, "user_2")
+	if err != nil || sold {
+		t.Fatalf("second MarkItemAsSold = %v, %v; want false", sold, err)
+	}
+
+	item, err := repo.GetItemByID(ctx, items[0].ID)
+	if err != nil {
+		t.Fatalf("GetItemByID: %v", err)
+	}
+	if !item.Sold || item.SoldToUserID != "user_1" || item.SoldAt == nil {
+		t.Errorf("item = %+v, want sold to user_1", item)
+	}
+}
+
+// Only the buyer's refund makes an item available again.
+func TestMarkItemAsUnsold(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	_, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(1))
+
+	if sold, err := repo.MarkItemAsSold(ctx, items[0].ID, "user_1"); err != nil || !sold {
+		t.Fatalf("MarkItemAsSold = %v, %v; want true", sold, err)
+	}
+
+	if err := repo.MarkItemAsUnsold(ctx, items[0].ID, "user_2"); !errors.Is(err, domainErrors.ErrItemNotSold) {
+		t.Fatalf("MarkItemAsUnsold by another user = %v, want ErrItemNotSold", err)
+	}
+	item, err := repo.GetItemByID(ctx, items[0].ID)
+	if err != nil {
+		t.Fatalf("GetItemByID: %v", err)
+	}
+	if !item.Sold || item.SoldToUserID != "user_1" {
+		t.Fatalf("item = %+v, want still sold to user_1", item)
+	}
+
+	if err := repo.MarkItemAsUnsold(ctx, items[0].ID, "user_1"); err != nil {
+		t.Fatalf("MarkItemAsUnsold: %v", err)
+	}
+	item, err = repo.GetItemByID(ctx, items[0].ID)
+	if err != nil {
+		t.Fatalf("GetItemByID: %v", err)
+	}
+	if item.Sold || item.SoldToUserID != "" {
+		t.Errorf("item = %+v, want available", item)
+	}
+	if err := repo.MarkItemAsUnsold(ctx, items[0].ID, "user_1"); !errors.Is(err, domainErrors.ErrItemNotSold) {
+		t.Errorf("second MarkItemAsUnsold = %v, want ErrItemNotSold", err)
+	}
+}
+
+// Two buyers racing for the same item: the conditional UPDATE lets exactly
+// one of them have it.
+func TestMarkItemAsSoldConcurrently(t *testing.T) {
+	const rounds = 20
+
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	_, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(rounds))
+
+	for _, item := range items {
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		results := make([]bool, 2)
+		errs := make([]error, 2)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				results[i], errs[i] = repo.MarkItemAsSold(ctx, item.ID, fmt.Sprintf("user_%d", i))
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("MarkItemAsSold %s: %v", item.ID, err)
+			}
+		}
+		if results[0] == results[1] {
+			t.Fatalf("item %s: both calls returned %v, want exactly one success", item.ID, results[0])
+		}
+
+		stored, err := repo.GetItemByID(ctx, item.ID)
+		if err != nil {
+			t.Fatalf("GetItemByID: %v", err)
+		}
+		winner := "user_0"
+		if results[1] {
+			winner = "user_1"
+		}
+		if stored.SoldToUserID != winner {
+			t.Errorf("item %s sold to %s, but %s was told it won", item.ID, stored.SoldToUserID, winner)
+		}
+	}
+}
+
+func TestSaleRepositoryTransactions(t *testing.T) {
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name    string
+		finish  func(ctx context.Context, tx ports.SaleRepository) error
+		visible bool
+	}{
+		{name: "commit", finish: func(ctx context.Context, tx ports.SaleRepository) error { return tx.CommitTx(ctx) }, visible: true},
+		{name: "rollback", finish: func(ctx context.Context, tx ports.SaleRepository) error { return tx.RollbackTx(ctx) }, visible: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := fixtures.NewSaleBuilder().
+				WithID(integration.NewSaleID()).
+				Between(now.Add(time.Hour), now.Add(2*time.Hour)).
+				Build()
+			integration.DeleteSaleOnCleanup(t, conn, s.ID)
+
+			tx, err := repo.BeginTx(ctx)
+			if err != nil {
+				t.Fatalf("BeginTx: %v", err)
+			}
+			if _, err := tx.BeginTx(ctx); err == nil {
+				t.Error("BeginTx nested a transaction")
+			}
+			if err := tx.CreateSale(ctx, s); err != nil {
+				t.Fatalf("CreateSale: %v", err)
+			}
+			if _, err := tx.GetSaleByID(ctx, s.ID); err != nil {
+				t.Errorf("transaction cannot read its own sale: %v", err)
+			}
+			if _, err := repo.GetSaleByID(ctx, s.ID); !errors.Is(err, domainErrors.ErrSaleNotFound) {
+				t.Errorf("uncommitted sale read outside the transaction: error = %v", err)
+			}
+
+			if err := tt.finish(ctx, tx); err != nil {
+				t.Fatalf("finishing the transaction: %v", err)
+			}
+
+			_, err = repo.GetSaleByID(ctx, s.ID)
+			if visible := err == nil; visible != tt.visible {
+				t.Errorf("sale visible after %s = %v (error %v), want %v", tt.name, visible, err, tt.visible)
+			}
+		})
+	}
+
+	ctx := context.Background()
+	if err := repo.CommitTx(ctx); err == nil {
+		t.Error("CommitTx succeeded without a transaction")
+	}
+	if err := repo.RollbackTx(ctx); err == nil {
+		t.Error("RollbackTx succeeded without a transaction")
+	}
+}
+
+// A second transaction locking the sale waits for the first to finish and
+// then either reads its items_sold or fails to serialize; it never goes on
+// with the count the first transaction replaced.
+func TestGetSaleByIDForUpdate(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+	s, _ := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().WithItems(10).WithItemsSold(3))
+
+	if _, err := repo.GetSaleByIDForUpdate(ctx, s.ID); err == nil {
+		t.Error("GetSaleByIDForUpdate succeeded without a transaction")
+	}
+
+	first, err := repo.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	defer func() { _ = first.RollbackTx(ctx) }()
+	locked, err := first.GetSaleByIDForUpdate(ctx, s.ID)
+	if err != nil {
+		t.Fatalf("GetSaleByIDForUpdate: %v", err)
+	}
+
+	type read struct {
+		sale *sale.Sale
+		err  error
+	}
+	second := make(chan read, 1)
+	go func() {
+		tx, err := repo.BeginTx(ctx)
+		if err != nil {
+			second <- read{err: err}
+			return
+		}
+		defer func() { _ = tx.RollbackTx(ctx) }()
+		s, err := tx.GetSaleByIDForUpdate(ctx, s.ID)
+		second <- read{sale: s, err: err}
+	}()
+
+	select {
+	case r := <-second:
+		t.Fatalf("second transaction read the locked sale: %+v, error %v", r.sale, r.err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	locked.ItemsSold++
+	if err := first.UpdateSale(ctx, locked); err != nil {
+		t.Fatalf("UpdateSale: %v", err)
+	}
+	if err := first.CommitTx(ctx); err != nil {
+		t.Fatalf("CommitTx: %v", err)
+	}
+
+	select {
+	case r := <-second:
+		if r.err == nil && r.sale.ItemsSold != 4 {
+			t.Errorf("second transaction read items_sold %d, want 4", r.sale.ItemsSold)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second transaction still waits after the first committed")
+	}
+}
+
+func TestPurchaseResultRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+
+	code := "CHK-" + integration.NewSaleID() + "-result"
+	integration.DeletePurchaseResultsOnCleanup(t, conn, code)
+
+	missing, err := repo.GetPurchaseResult(ctx, code)
+	if err != nil || missing != nil {
+		t.Fatalf("GetPurchaseResult before saving = %+v, %v; want nil, nil", missing, err)
+	}
+
+	result := &sale.PurchaseResult{
+		Success: true,
+		Items: []sale.PurchaseItemResult{
+			{ID: "item_1", Name: "First", Price: decimal.New(1999, -2), Sold: true},
+			{ID: "item_2", Name: "Second", Price: decimal.New(500, -2), Sold: false},
+		},
+		TotalPurchased: 1,
+		FailedCount:    1,
+	}
+	if err := repo.SavePurchaseResult(ctx, code, result); err != nil {
+		t.Fatalf("SavePurchaseResult: %v", err)
+	}
+	// The first result stays: a retried purchase must replay it.
+	if err := repo.SavePurchaseResult(ctx, code, &sale.PurchaseResult{Success: false}); err != nil {
+		t.Fatalf("second SavePurchaseResult: %v", err)
+	}
+
+	got, err := repo.GetPurchaseResult(ctx, code)
+	if err != nil {
+		t.Fatalf("GetPurchaseResult: %v", err)
+	}
+	if !got.Success || got.TotalPurchased != 1 || got.FailedCount != 1 || len(got.Items) != 2 {
+		t.Fatalf("GetPurchaseResult = %+v, want %+v", got, result)
+	}
+	for i, item := range got.Items {
+		want := result.Items[i]
+		if item.ID != want.ID || item.Name != want.Name || !item.Price.Equal(want.Price) || item.Sold != want.Sold {
+			t.Errorf("item %d = %+v, want %+v", i, item, want)
+		}
+	}
+}
+
+// A stored result that is valid JSON but no PurchaseResult reads as
+// corrupted rather than failing, so the checkout still counts as processed.
+func TestGetPurchaseResultCorrupted(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewSaleRepository(conn)
+
+	code := "CHK-" + integration.NewSaleID() + "-corrupted"
+	integration.DeletePurchaseResultsOnCleanup(t, conn, code)
+	if _, err := conn.GetDB().ExecContext(ctx,
+		`INSERT INTO purchase_results (checkout_code, result) VALUES ($1, $2)`, code, `{"items":"x"}`); err != nil {
+		t.Fatalf("failed to insert purchase result: %v", err)
+	}
+
+	before := testutil.ToFloat64(monitoring.PurchaseResultCorruptionTotal)
+	got, err := repo.GetPurchaseResult(ctx, code)
+	if err != nil {
+		t.Fatalf("GetPurchaseResult: %v", err)
+	}
+	if got == nil || !got.Corrupted || got.CorruptionError == "" {
+		t.Fatalf("GetPurchaseResult = %+v, want a corrupted result", got)
+	}
+	if diff := testutil.ToFloat64(monitoring.PurchaseResultCorruptionTotal) - before; diff != 1 {
+		t.Errorf("purchase_result_corruption_total grew by %v, want 1", diff)
+	}
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+)
+
+// WebhookDeliveryAttempt is one POST of an event to a webhook endpoint.
+// StatusCode is 0 and Error is set when no response was received.
+type WebhookDeliveryAttempt struct {
+	DeliveryID string
+	URL        string
+	EventType  string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// PendingWebhookDelivery is an event still to be POSTed to one endpoint.
+type PendingWebhookDelivery struct {
+	DeliveryID string
+	URL        string
+	EventType  string
+	Body       []byte
+}
+
+type WebhookDeliveryRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookDeliveryRepository(conn *Connection) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{
+		db: conn.GetDB(),
+	}
+}
+
+func (r *WebhookDeliveryRepository) RecordAttempt(ctx context.Context, attempt WebhookDeliveryAttempt) error {
+	query := `
+		INSERT INTO webhook_deliveries (delivery_id, url, event_type, attempt, status_code, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+	`
+
+	var statusCode sql.NullInt64
+	if attempt.StatusCode != 0 {
+		statusCode = sql.NullInt64{Int64: int64(attempt.StatusCode), Valid: true}
+	}
+	var errText sql.NullString
+	if attempt.Error != "" {
+		errText = sql.NullString{String: attempt.Error, Valid: true}
+	}
+
+	_, err := monitoring.InstrumentExec(ctx, r.db, "INSERT", "webhook_deliveries", query,
+		attempt.DeliveryID, attempt.URL, attempt.EventType, attempt.Attempt, statusCode, errText, attempt.Duration.Milliseconds())
+	return err
+}
+
+// SavePending stores deliveries claimed for claimTTL, in one statement so
+// that either all or none are stored. A delivery stored before, e.g. when
+// the event is published again, keeps its body and has its claim renewed.
+func (r *WebhookDeliveryRepository) SavePending(ctx context.Context, deliveries []PendingWebhookDelivery, claimTTL time.Duration) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	query := `
+		INSERT INTO webhook_pending_deliveries (delivery_id, url, event_type, body, created_at, claimed_until)
+		SELECT d.delivery_id, d.url, d.event_type, d.body, NOW(), NOW() + make_interval(secs => $5)
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::bytea[]) AS d(delivery_id, url, event_type, body)
+		ON CONFLICT (delivery_id, url) DO UPDATE SET claimed_until = EXCLUDED.claimed_until
+	`
+
+	ids := make([]string, len(deliveries))
+	urls := make([]string, len(deliveries))
+	eventTypes := make([]string, len(deliveries))
+	bodies := make([][]byte, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.DeliveryID
+		urls[i] = d.URL
+		eventTypes[i] = d.EventType
+		bodies[i] = d.Body
+	}
+
+	_, err := monitoring.InstrumentExec(ctx, r.db, "INSERT", "webhook_pending_deliveries", query,
+		pq.Array(ids), pq.Array(urls), pq.Array(eventTypes), pq.ByteaArray(bodies), claimTTL.Seconds())
+	return err
+}
+
+// ClaimPending claims up to limit deliveries whose claim has run out, the
+// oldest first, for claimTTL. Rows are claimed atomically, so instances
+// sweeping at the same time never take the same delivery.
+func (r *WebhookDeliveryRepository) ClaimPending(ctx context.Context, limit int, claimTTL time.Duration) ([]PendingWebhookDelivery, error) {
+	query := `
+		UPDATE webhook_pending_deliveries p
+		SET claimed_until = NOW() + make_interval(secs => $2)
+		FROM (
+			SELECT delivery_id, url
+			FROM webhook_pending_deliveries
+			WHERE claimed_until < NOW()
+			ORDER BY created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		) expired
+		WHERE p.delivery_id = expired.delivery_id AND p.url = expired.url
+		RETURNING p.delivery_id, p.url, p.event_type, p.body
+	`
+
+	rows, err := monitoring.InstrumentQuery(ctx, r.db, "UPDATE", "webhook_pending_deliveries", query, limit, claimTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []PendingWebhookDelivery
+	for rows.Next() {
+		var d PendingWebhookDelivery
+		if err := rows.Scan(&d.DeliveryID, &d.URL, &d.EventType, &d.Body); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// DeletePending removes a delivery that was sent or gave up.
+func (r *WebhookDeliveryRepository) DeletePending(ctx context.Context, deliveryID, url string) error {
+	query := `
+		DELETE FROM webhook_pending_deliveries
+		WHERE delivery_id = $1 AND url = $2
+	`
+
+	_, err := monitoring.InstrumentExec(ctx, r.db, "DELETE", "webhook_pending_deliveries", query, deliveryID, url)
+	return err
+}
+
+// ReleasePending ends the claim on a delivery that was not sent, so the
+// next sweep of any instance picks it up.
+func (r *WebhookDeliveryRepository) ReleasePending(ctx context.Context, deliveryID, url string) error {
+	query := `
+		UPDATE webhook_pending_deliveries
+		SET claimed_until = NOW()
+		WHERE delivery_id = $1 AND url = $2
+	`
+
+	_, err := monitoring.InstrumentExec(ctx, r.db, "UPDATE", "webhook_pending_deliveries", query, deliveryID, url)
+	return err
+}
@@ -0,0 +1,98 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+// claimOurs claims every expired delivery and returns those of deliveryID.
+// Deliveries of other tests that get claimed along the way are released.
+func claimOurs(t *testing.T, repo *postgres.WebhookDeliveryRepository, deliveryID string) map[string]postgres.PendingWebhookDelivery {
+	t.Helper()
+
+	ctx := context.Background()
+	claimed, err := repo.ClaimPending(ctx, 1000, time.Hour)
+	if err != nil {
+		t.Fatalf("ClaimPending: %v", err)
+	}
+
+	ours := make(map[string]postgres.PendingWebhookDelivery)
+	for _, d := range claimed {
+		if d.DeliveryID == deliveryID {
+			ours[d.URL] = d
+			continue
+		}
+		if err := repo.ReleasePending(ctx, d.DeliveryID, d.URL); err != nil {
+			t.Fatalf("ReleasePending: %v", err)
+		}
+	}
+	return ours
+}
+
+func TestPendingWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	repo := postgres.NewWebhookDeliveryRepository(conn)
+
+	deliveryID := integration.NewSaleID()
+	t.Cleanup(func() {
+		if _, err := conn.GetDB().ExecContext(context.Background(), `DELETE FROM webhook_pending_deliveries WHERE delivery_id = $1`, deliveryID); err != nil {
+			t.Errorf("failed to delete pending deliveries: %v", err)
+		}
+	})
+
+	pending := []postgres.PendingWebhookDelivery{
+		{DeliveryID: deliveryID, URL: "https://a.example/hook", EventType: "purchase.completed", Body: []byte(`{"id":"a"}`)},
+		{DeliveryID: deliveryID, URL: "https://b.example/hook", EventType: "purchase.completed", Body: []byte{0, 1, 2}},
+	}
+	if err := repo.SavePending(ctx, pending, time.Hour); err != nil {
+		t.Fatalf("SavePending: %v", err)
+	}
+
+	// Freshly saved deliveries belong to the instance that saved them.
+	if got := claimOurs(t, repo, deliveryID); len(got) != 0 {
+		t.Fatalf("claimed %d deliveries still claimed by their sender", len(got))
+	}
+
+	// Saving again, as when the event is published twice, keeps one row per
+	// endpoint.
+	if err := repo.SavePending(ctx, pending, time.Hour); err != nil {
+		t.Fatalf("SavePending again: %v", err)
+	}
+
+	for _, d := range pending {
+		if err := repo.ReleasePending(ctx, d.DeliveryID, d.URL); err != nil {
+			t.Fatalf("ReleasePending: %v", err)
+		}
+	}
+	got := claimOurs(t, repo, deliveryID)
+	if len(got) != len(pending) {
+		t.Fatalf("claimed %d released deliveries, want %d", len(got), len(pending))
+	}
+	for _, want := range pending {
+		d := got[want.URL]
+		if d.EventType != want.EventType || string(d.Body) != string(want.Body) {
+			t.Errorf("delivery to %s = %+v, want %+v", want.URL, d, want)
+		}
+	}
+
+	// A claimed delivery is not handed out twice.
+	if got := claimOurs(t, repo, deliveryID); len(got) != 0 {
+		t.Errorf("claimed %d deliveries a second time", len(got))
+	}
+
+	if err := repo.DeletePending(ctx, deliveryID, pending[0].URL); err != nil {
+		t.Fatalf("DeletePending: %v", err)
+	}
+	if err := repo.ReleasePending(ctx, deliveryID, pending[1].URL); err != nil {
+		t.Fatalf("ReleasePending: %v", err)
+	}
+	got = claimOurs(t, repo, deliveryID)
+	if _, ok := got[pending[0].URL]; ok || len(got) != 1 {
+		t.Errorf("claimed %v after deleting %s, want only %s", got, pending[0].URL, pending[1].URL)
+	}
+}
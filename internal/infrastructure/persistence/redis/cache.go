@@ -2,54 +2,302 @@ package redis
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/config"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/bloom"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
+const defaultBloomFPRInterval = 500
+
+// Cache keys that scripts and transactions touch together carry the sale ID
+// (or filter name) as a {hash tag} so they map to one slot in cluster mode.
 type Cache struct {
-	client      *redis.Client
-	bloomFilter *bloom.RedisBloomFilter
-	logger      *logger.Logger
+	client    redis.UniversalClient
+	bloomAdds atomic.Uint64
+	logger    *logger.Logger
+
+	// Each sale has its own sold items filter, created on first use, so
+	// items of earlier sales cannot cause false positives in later ones.
+	bloomConfig  config.CacheConfig
+	bloomSize    config.BloomFilterConfig
+	bloomM       uint64
+	bloomK       uint64
+	bloomSource  SoldItemsRepository
+	bloomMu      sync.Mutex
+	bloomFilters map[string]soldItemsFilter
+
+	// bloomFPRInterval is how many additions pass between false positive
+	// rate estimates; each estimate costs a BITCOUNT over the whole filter.
+	bloomFPRInterval uint64
+	bloomMetrics     *monitoring.BloomFilterMetrics
+
+	// checkoutCodePrefix and checkoutTTL match what the checkout handler
+	// issues codes with.
+	checkoutCodePrefix string
+	checkoutTTL        time.Duration
 
 	purchaseScript  *redis.Script
 	userLimitScript *redis.Script
 	saleLimitScript *redis.Script
+	remainingScript *redis.Script
+
+	checkoutReserveScript *redis.Script
+	checkoutReleaseScript *redis.Script
+
+	lockRenewScript   *redis.Script
+	lockReleaseScript *redis.Script
+
+	purgeScript *redis.Script
+
+	idempotencyBeginScript *redis.Script
+	idempotencyAbortScript *redis.Script
+}
+
+// soldItemsFilter is satisfied by both bloom filter variants. The counting
+// variant additionally supports removal; see RemoveItemFromBloomFilter.
+type soldItemsFilter interface {
+	SetSource(source bloom.SoldItemsSource)
+	Parameters() (m, k uint64)
+	ParametersMatch(ctx context.Context) (bool, error)
+	EnsureParameters(ctx context.Context) error
+	Add(ctx context.Context, element string) error
+	AddBatch(ctx context.Context, elements []string) error
+	Contains(ctx context.Context, element string) (bool, error)
+	ContainsBatch(ctx context.Context, elements []string) (map[string]bool, error)
+	EstimateElementCount(ctx context.Context) (uint64, error)
+	EstimateFalsePositiveRate(elementsAdded uint64) float64
+	Clear(ctx context.Context) error
+}
+
+// SoldItemsRepository is where a sale's bloom filter is rebuilt from when
+// its stored parameters do not match.
+type SoldItemsRepository interface {
+	GetSoldItemIDsBySaleID(ctx context.Context, saleID string) ([]string, error)
 }
 
-func NewCache(conn *Connection, log *logger.Logger) *Cache {
+type saleSoldItems struct {
+	repo   SoldItemsRepository
+	saleID string
+}
+
+func (s saleSoldItems) GetSoldItemIDs(ctx context.Context) ([]string, error) {
+	return s.repo.GetSoldItemIDsBySaleID(ctx, s.saleID)
+}
+
+func NewCache(conn *Connection, cfg config.CacheConfig, bloomCfg config.BloomFilterConfig, log *logger.Logger) *Cache {
 	client := monitoring.InstrumentRedisClient(conn.GetClient())
 
-	m, k := bloom.GetOptimalParameters(100000, 0.01)
-	bloomFilter := bloom.NewRedisBloomFilter(client, "bloom:sold_items", m, k)
+	m, k := bloom.GetOptimalParameters(bloomCfg.Capacity(), bloomCfg.TargetFalsePositiveRate())
+	log.Info("Bloom filter sized",
+		"expected_elements", bloomCfg.Capacity(),
+		"false_positive_rate", bloomCfg.TargetFalsePositiveRate(),
+		"m", m,
+		"k", k,
+	)
+
+	checkoutCodePrefix := cfg.CheckoutCodePrefix
+	if checkoutCodePrefix == "" {
+		checkoutCodePrefix = generator.DefaultCheckoutCodePrefix
+	}
 
 	return &Cache{
 		client:          client,
-		bloomFilter:     bloomFilter,
 		logger:          log,
+		bloomConfig:     cfg,
+		bloomSize:       bloomCfg,
+		bloomM:          m,
+		bloomK:          k,
+		bloomFilters:    make(map[string]soldItemsFilter),
 		purchaseScript:  redis.NewScript(purchaseLuaScript),
 		userLimitScript: redis.NewScript(userLimitLuaScript),
 		saleLimitScript: redis.NewScript(saleLimitLuaScript),
+		remainingScript: redis.NewScript(remainingLuaScript),
+
+		checkoutReserveScript: redis.NewScript(checkoutReserveLuaScript),
+		checkoutReleaseScript: redis.NewScript(checkoutReleaseLuaScript),
+
+		lockRenewScript:   redis.NewScript(lockRenewLuaScript),
+		lockReleaseScript: redis.NewScript(lockReleaseLuaScript),
+
+		purgeScript: redis.NewScript(purgeLuaScript),
+
+		idempotencyBeginScript: redis.NewScript(idempotencyBeginLuaScript),
+		idempotencyAbortScript: redis.NewScript(idempotencyAbortLuaScript),
+
+		bloomFPRInterval: defaultBloomFPRInterval,
+		bloomMetrics:     monitoring.NewBloomFilterMetrics("sold_items"),
+
+		checkoutCodePrefix: checkoutCodePrefix,
+		checkoutTTL:        cfg.CheckoutTTL(),
 	}
 }
 
 
-func (c *Cache) AddItemToBloomFilter(ctx context.Context, itemID string) error {
-	return c.bloomFilter.Add(ctx, itemID)
+// SetBloomFilterSource sets where sale filters are rebuilt from when their
+// stored parameters are out of date.
+func (c *Cache) SetBloomFilterSource(source SoldItemsRepository) {
+	c.bloomMu.Lock()
+	defer c.bloomMu.Unlock()
+
+	c.bloomSource = source
+}
+
+// bloomFilter returns the sold items filter of a sale, creating it and
+// checking its stored parameters the first time the sale is seen.
+func (c *Cache) bloomFilter(ctx context.Context, saleID string) soldItemsFilter {
+	c.bloomMu.Lock()
+	filter, ok := c.bloomFilters[saleID]
+	if ok {
+		c.bloomMu.Unlock()
+		return filter
+	}
+
+	filter = c.newBloomFilter(saleID)
+	if c.bloomSource != nil {
+		filter.SetSource(saleSoldItems{repo: c.bloomSource, saleID: saleID})
+	}
+	c.bloomFilters[saleID] = filter
+	c.bloomMu.Unlock()
+
+	match, err := filter.ParametersMatch(ctx)
+	if err == nil && !match {
+		m, k := filter.Parameters()
+		c.logger.Warn("Bloom filter parameters mismatch, rebuilding", "sale_id", saleID, "m", m, "k", k)
+	}
+	if err := filter.EnsureParameters(ctx); err != nil {
+		c.logger.Error("Failed to ensure bloom filter parameters", "error", err, "sale_id", saleID)
+	}
+
+	return filter
+}
+
+func (c *Cache) newBloomFilter(saleID string) soldItemsFilter {
+	key := fmt.Sprintf("bloom:sold_items:{%s}", saleID)
+
+	switch {
+	case c.bloomConfig.CountingBloomFilter:
+		// A separate key, so switching modes never reads a bitmap as a hash.
+		return bloom.NewRedisCountingBloomFilter(c.client, key+":counting", c.bloomM, c.bloomK)
+	case c.bloomConfig.ScalableBloomFilter:
+		return bloom.NewScalableBloomFilter(c.client, key+":scalable", c.bloomSize.Capacity(), c.bloomSize.TargetFalsePositiveRate())
+	default:
+		return bloom.NewRedisBloomFilter(c.client, key, c.bloomM, c.bloomK)
+	}
+}
+
+// ResetBloomFilterForSale deletes the sale's filter so that it starts out
+// empty, e.g. when the sale is (re)started or has been cleaned up.
+func (c *Cache) ResetBloomFilterForSale(ctx context.Context, saleID string) error {
+	c.bloomMu.Lock()
+	filter, ok := c.bloomFilters[saleID]
+	if !ok {
+		filter = c.newBloomFilter(saleID)
+	}
+	delete(c.bloomFilters, saleID)
+	c.bloomMu.Unlock()
+
+	return filter.Clear(ctx)
+}
+
+func (c *Cache) AddItemToBloomFilter(ctx context.Context, saleID, itemID string) error {
+	filter := c.bloomFilter(ctx, saleID)
+	if err := filter.Add(ctx, itemID); err != nil {
+		return err
+	}
+
+	c.recordBloomAdds(ctx, filter, 1)
+	return nil
+}
+
+func (c *Cache) AddItemsToBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	filter := c.bloomFilter(ctx, saleID)
+	if err := filter.AddBatch(ctx, itemIDs); err != nil {
+		return err
+	}
+
+	c.recordBloomAdds(ctx, filter, uint64(len(itemIDs)))
+	return nil
+}
+
+// WarmBloomFilter loads items already sold in a sale into its filter. The
+// plain filter does so in one transaction; the others add them as a batch.
+func (c *Cache) WarmBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	filter := c.bloomFilter(ctx, saleID)
+
+	var err error
+	if plain, ok := filter.(*bloom.RedisBloomFilter); ok {
+		err = plain.WarmFromDB(ctx, itemIDs)
+	} else {
+		err = filter.AddBatch(ctx, itemIDs)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.recordBloomAdds(ctx, filter, uint64(len(itemIDs)))
+	return nil
+}
+
+// recordBloomAdds refreshes the false positive rate gauge whenever the
+// running add count crosses a multiple of bloomFPRInterval.
+func (c *Cache) recordBloomAdds(ctx context.Context, filter soldItemsFilter, n uint64) {
+	if n == 0 || c.bloomFPRInterval == 0 {
+		return
+	}
+
+	total := c.bloomAdds.Add(n)
+	if total/c.bloomFPRInterval == (total-n)/c.bloomFPRInterval {
+		return
+	}
+
+	count, err := filter.EstimateElementCount(ctx)
+	if err != nil {
+		c.logger.Warn("Failed to estimate bloom filter element count", "error", err)
+		return
+	}
+
+	c.bloomMetrics.UpdateFPR(filter.EstimateFalsePositiveRate(count))
+	if scalable, ok := filter.(*bloom.ScalableBloomFilter); ok {
+		c.bloomMetrics.UpdateLayers(scalable.LayerCount())
+	}
+}
+
+// RemoveItemFromBloomFilter takes a refunded item out of the filter. With
+// the plain filter this is a no-op and the item keeps reporting as
+// probably sold until the filter is rebuilt.
+func (c *Cache) RemoveItemFromBloomFilter(ctx context.Context, saleID, itemID string) error {
+	counting, ok := c.bloomFilter(ctx, saleID).(*bloom.RedisCountingBloomFilter)
+	if !ok {
+		return nil
+	}
+
+	_, err := counting.Remove(ctx, itemID)
+	return err
 }
 
-func (c *Cache) ItemExistsInBloomFilter(ctx context.Context, itemID string) (bool, error) {
-	return c.bloomFilter.Contains(ctx, itemID)
+func (c *Cache) ItemExistsInBloomFilter(ctx context.Context, saleID, itemID string) (bool, error) {
+	return c.bloomFilter(ctx, saleID).Contains(ctx, itemID)
 }
 
+func (c *Cache) ItemsExistInBloomFilter(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error) {
+	return c.bloomFilter(ctx, saleID).ContainsBatch(ctx, itemIDs)
+}
 
 func (c *Cache) GetUserItemCount(ctx context.Context, saleID, userID string) (int, error) {
-	key := fmt.Sprintf("user:%s:sale:%s:count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID)
 	result, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -67,13 +315,13 @@ func (c *Cache) GetUserItemCount(ctx context.Context, saleID, userID string) (in
 }
 
 func (c *Cache) IncrementUserItemCount(ctx context.Context, saleID, userID string) error {
-	key := fmt.Sprintf("user:%s:sale:%s:count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID)
 	_, err := c.client.Incr(ctx, key).Result()
 	return err
 }
 
 func (c *Cache) GetUserCheckoutCount(ctx context.Context, saleID, userID string) (int, error) {
-	key := fmt.Sprintf("user:%s:sale:%s:checkout_count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)
 	result, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -91,13 +339,13 @@ func (c *Cache) GetUserCheckoutCount(ctx context.Context, saleID, userID string)
 }
 
 func (c *Cache) IncrementUserCheckoutCount(ctx context.Context, saleID, userID string) error {
-	key := fmt.Sprintf("user:%s:sale:%s:checkout_count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)
 	_, err := c.client.Incr(ctx, key).Result()
 	return err
 }
 
 func (c *Cache) SetUserCheckoutCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
-	key := fmt.Sprintf("user:%s:sale:%s:checkout_count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)
 	return c.client.Set(ctx, key, count, expiration).Err()
 }
 
@@ -115,14 +363,55 @@ func (c *Cache) GetAvailableCheckoutSlots(ctx context.Context, saleID, userID st
 	return maxItems - purchasedCount - checkoutCount, nil
 }
 
+// AtomicCheckoutReserve claims count checkout slots for the user if their
+// purchased plus checked out items stay within maxItems. The claimed slots
+// expire after expiration, which should match the checkout code's TTL, so a
+// checkout that is never purchased gives its slots back when it lapses.
+func (c *Cache) AtomicCheckoutReserve(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (bool, error) {
+	_, reserved, err := c.reserveCheckoutSlots(ctx, saleID, userID, count, maxItems, expiration)
+	return reserved, err
+}
+
+// AtomicReserveCheckoutSlot claims one checkout slot like
+// AtomicCheckoutReserve and also returns how many slots the user has left
+// afterwards, or has left at all when the claim is refused.
+func (c *Cache) AtomicReserveCheckoutSlot(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (int, bool, error) {
+	return c.reserveCheckoutSlots(ctx, saleID, userID, 1, maxItems, expiration)
+}
+
+func (c *Cache) reserveCheckoutSlots(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (int, bool, error) {
+	keys := []string{
+		fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID),
+		fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID),
+	}
+	args := []interface{}{count, maxItems, expiration.Milliseconds()}
+
+	result, err := c.checkoutReserveScript.Run(ctx, c.client, keys, args...).Int64Slice()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result) != 2 {
+		return 0, false, fmt.Errorf("unexpected checkout reserve result: %v", result)
+	}
+
+	return int(result[1]), result[0] == 1, nil
+}
+
+func (c *Cache) ReleaseCheckoutReservation(ctx context.Context, saleID, userID string, count int) error {
+	keys := []string{fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)}
+	args := []interface{}{count}
+
+	return c.checkoutReleaseScript.Run(ctx, c.client, keys, args...).Err()
+}
+
 func (c *Cache) SetUserItemCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
-	key := fmt.Sprintf("user:%s:sale:%s:count", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID)
 	return c.client.Set(ctx, key, count, expiration).Err()
 }
 
 
 func (c *Cache) GetUserCheckoutCode(ctx context.Context, saleID, userID string) (string, error) {
-	key := fmt.Sprintf("user:%s:sale:%s:checkout", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checkout", userID, saleID)
 	result, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -135,13 +424,13 @@ func (c *Cache) GetUserCheckoutCode(ctx context.Context, saleID, userID string)
 }
 
 func (c *Cache) SetUserCheckoutCode(ctx context.Context, saleID, userID, code string, expiration time.Duration) error {
-	key := fmt.Sprintf("user:%s:sale:%s:checkout", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checkout", userID, saleID)
 	return c.client.Set(ctx, key, code, expiration).Err()
 }
 
 func (c *Cache) RemoveUserCheckoutCode(ctx context.Context, saleID, userID string) error {
-	checkoutKey := fmt.Sprintf("user:%s:sale:%s:checkout", userID, saleID)
-	checkoutCountKey := fmt.Sprintf("user:%s:sale:%s:checkout_count", userID, saleID)
+	checkoutKey := fmt.Sprintf("user:%s:sale:{%s}:checkout", userID, saleID)
+	checkoutCountKey := fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)
 
 	pipe := c.client.Pipeline()
 	pipe.Del(ctx, checkoutKey)
@@ -170,8 +459,152 @@ func (c *Cache) RemoveCheckoutCode(ctx context.Context, code string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
+// ExtendSaleCheckoutTTLs moves the expiry of a sale's checkout keys after
+// its end changed from oldExpiry to newExpiry. Checked item sets follow the
+// sale end. Checkout codes keep their own TTL: they are only shortened when
+// they would outlive the sale, and codes that were capped at the old end are
+// lifted to a fresh checkout TTL, still capped at the new end.
+func (c *Cache) ExtendSaleCheckoutTTLs(ctx context.Context, saleID string, oldExpiry, newExpiry time.Time) error {
+	codePatterns := []string{
+		fmt.Sprintf("checkout:%s-%s-*", c.checkoutCodePrefix, saleID),
+		fmt.Sprintf("user:*:sale:{%s}:checkout", saleID),
+	}
+	itemsPattern := fmt.Sprintf("user:*:sale:{%s}:checked_items", saleID)
+
+	return c.forEachNode(ctx, func(ctx context.Context, node redis.UniversalClient) error {
+		for _, pattern := range codePatterns {
+			if err := c.scanKeys(ctx, node, pattern, func(keys []string) error {
+				return c.adjustCheckoutCodeTTLs(ctx, keys, oldExpiry, newExpiry)
+			}); err != nil {
+				return err
+			}
+		}
+
+		return c.scanKeys(ctx, node, itemsPattern, func(keys []string) error {
+			pipe := c.client.Pipeline()
+			for _, key := range keys {
+				pipe.ExpireAt(ctx, key, newExpiry)
+			}
+			_, err := pipe.Exec(ctx)
+			return err
+		})
+	})
+}
+
+// adjustCheckoutCodeTTLs applies the rule of ExtendSaleCheckoutTTLs to one
+// page of checkout code keys.
+func (c *Cache) adjustCheckoutCodeTTLs(ctx context.Context, keys []string, oldExpiry, newExpiry time.Time) error {
+	pipe := c.client.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	lifted := now.Add(c.checkoutTTL)
+	if lifted.After(newExpiry) {
+		lifted = newExpiry
+	}
+
+	pipe = c.client.Pipeline()
+	for i, key := range keys {
+		ttl := ttls[i].Val()
+		if ttl <= 0 {
+			// Expired in the meantime, or stored without a TTL.
+			continue
+		}
+		expiry := now.Add(ttl)
+		switch {
+		case expiry.After(newExpiry):
+			pipe.ExpireAt(ctx, key, newExpiry)
+		case newExpiry.After(oldExpiry) && oldExpiry.Sub(expiry) < time.Second && lifted.After(expiry):
+			pipe.ExpireAt(ctx, key, lifted)
+		}
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// scanKeys calls fn with each page of keys on node that match pattern.
+func (c *Cache) scanKeys(ctx context.Context, node redis.UniversalClient, pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := node.Scan(ctx, cursor, pattern, 1000).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+const purgeBatchSize = 100
+
+// PurgeSaleData deletes the sale's counters, bloom filter and every user's
+// per-sale keys.
+// Each script call handles one SCAN page so Redis is never blocked for long.
+// All matched keys share the sale's hash tag, so the anchor key routes the
+// script to the node that holds them in cluster mode.
+func (c *Cache) PurgeSaleData(ctx context.Context, saleID string) error {
+	anchor := fmt.Sprintf("sale:{%s}:items_sold", saleID)
+	patterns := []string{
+		fmt.Sprintf("sale:{%s}:*", saleID),
+		fmt.Sprintf("user:*:sale:{%s}:*", saleID),
+	}
+
+	deleted := 0
+	for _, pattern := range patterns {
+		cursor := "0"
+		for {
+			result, err := c.purgeScript.Run(ctx, c.client, []string{anchor}, cursor, pattern, purgeBatchSize).Slice()
+			if err != nil {
+				return fmt.Errorf("failed to purge keys matching %s: %w", pattern, err)
+			}
+			if len(result) != 2 {
+				return fmt.Errorf("unexpected purge script result: %v", result)
+			}
+
+			cursor, _ = result[0].(string)
+			count, _ := result[1].(int64)
+			deleted += int(count)
+
+			if cursor == "0" || cursor == "" {
+				break
+			}
+		}
+	}
+
+	if err := c.ResetBloomFilterForSale(ctx, saleID); err != nil {
+		return fmt.Errorf("failed to delete bloom filter: %w", err)
+	}
+
+	c.logger.Info("Purged sale data from cache", "sale_id", saleID, "keys_deleted", deleted)
+	return nil
+}
+
+// forEachNode runs fn against every master in cluster mode, since SCAN only
+// covers the node it is sent to, and against the client itself otherwise.
+func (c *Cache) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.UniversalClient) error) error {
+	if cluster, ok := c.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return fn(ctx, node)
+		})
+	}
+	return fn(ctx, c.client)
+}
+
 func (c *Cache) HasUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string) (bool, error) {
-	key := fmt.Sprintf("user:%s:sale:%s:checked_items", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checked_items", userID, saleID)
 	result, err := c.client.SIsMember(ctx, key, itemID).Result()
 	if err != nil {
 		return false, err
@@ -180,7 +613,7 @@ func (c *Cache) HasUserCheckedOutItem(ctx context.Context, saleID, userID, itemI
 }
 
 func (c *Cache) AddUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string, expiration time.Duration) error {
-	key := fmt.Sprintf("user:%s:sale:%s:checked_items", userID, saleID)
+	key := fmt.Sprintf("user:%s:sale:{%s}:checked_items", userID, saleID)
 
 	pipe := c.client.Pipeline()
 	pipe.SAdd(ctx, key, itemID)
@@ -192,13 +625,13 @@ func (c *Cache) AddUserCheckedOutItem(ctx context.Context, saleID, userID, itemI
 
 
 func (c *Cache) IncrementSaleItemsSold(ctx context.Context, saleID string, count int) error {
-	key := fmt.Sprintf("sale:%s:items_sold", saleID)
+	key := fmt.Sprintf("sale:{%s}:items_sold", saleID)
 	_, err := c.client.IncrBy(ctx, key, int64(count)).Result()
 	return err
 }
 
 func (c *Cache) GetSaleItemsSold(ctx context.Context, saleID string) (int, error) {
-	key := fmt.Sprintf("sale:%s:items_sold", saleID)
+	key := fmt.Sprintf("sale:{%s}:items_sold", saleID)
 	result, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
@@ -215,13 +648,98 @@ func (c *Cache) GetSaleItemsSold(ctx context.Context, saleID string) (int, error
 	return count, nil
 }
 
+func (c *Cache) SetSaleItemCount(ctx context.Context, saleID string, count int, expiration time.Duration) error {
+	key := fmt.Sprintf("sale:{%s}:items_sold", saleID)
+	return c.client.Set(ctx, key, count, expiration).Err()
+}
+
+func (c *Cache) GetSaleTotalItems(ctx context.Context, saleID string) (int, bool, error) {
+	key := fmt.Sprintf("sale:{%s}:total_items", saleID)
+	result, err := c.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	total, err := strconv.Atoi(result)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return total, true, nil
+}
+
+func (c *Cache) SetSaleTotalItems(ctx context.Context, saleID string, totalItems int, expiration time.Duration) error {
+	key := fmt.Sprintf("sale:{%s}:total_items", saleID)
+	return c.client.Set(ctx, key, totalItems, expiration).Err()
+}
+
+func (c *Cache) GetSaleQuota(ctx context.Context, saleID string) (int, bool, error) {
+	key := fmt.Sprintf("sale:{%s}:quota", saleID)
+	result, err := c.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	quota, err := strconv.Atoi(result)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return quota, true, nil
+}
+
+func (c *Cache) SetSaleQuota(ctx context.Context, saleID string, quota int, expiration time.Duration) error {
+	key := fmt.Sprintf("sale:{%s}:quota", saleID)
+	return c.client.Set(ctx, key, quota, expiration).Err()
+}
+
+func (c *Cache) GetSaleRemaining(ctx context.Context, saleID string) (int, bool, error) {
+	key := fmt.Sprintf("sale:{%s}:remaining", saleID)
+	result, err := c.client.Get(ctx, key).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	remaining, err := strconv.Atoi(result)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return remaining, true, nil
+}
+
+func (c *Cache) SetSaleRemaining(ctx context.Context, saleID string, remaining int, expiration time.Duration) error {
+	key := fmt.Sprintf("sale:{%s}:remaining", saleID)
+	return c.client.Set(ctx, key, remaining, expiration).Err()
+}
+
+func (c *Cache) DecrementSaleRemaining(ctx context.Context, saleID string, count int) error {
+	keys := []string{fmt.Sprintf("sale:{%s}:remaining", saleID)}
+	args := []interface{}{count}
+
+	return c.remainingScript.Run(ctx, c.client, keys, args...).Err()
+}
+
 func (c *Cache) AtomicPurchaseCheck(ctx context.Context, saleID, userID string, itemCount int, maxSaleItems, maxUserItems int) (bool, error) {
 	keys := []string{
-		fmt.Sprintf("sale:%s:items_sold", saleID),
-		fmt.Sprintf("user:%s:sale:%s:count", userID, saleID),
+		fmt.Sprintf("sale:{%s}:items_sold", saleID),
+		fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID),
 	}
-	args := []interface{}{itemCount, maxSaleItems, maxUserItems}
-	c.logger.Info("AtomicPurchaseCheck input", "keys", keys, "args", args)
+	debug := 0
+	if c.logger.IsDebug() {
+		debug = 1
+		c.logger.Debug("AtomicPurchaseCheck input", "keys", keys, "item_count", itemCount, "max_sale_items", maxSaleItems, "max_user_items", maxUserItems)
+	}
+	args := []interface{}{itemCount, maxSaleItems, maxUserItems, debug}
 
 	result, err := c.purchaseScript.Run(ctx, c.client, keys, args...).Result()
 	if err != nil {
@@ -230,13 +748,13 @@ func (c *Cache) AtomicPurchaseCheck(ctx context.Context, saleID, userID string,
 	}
 
 	resultInt := result.(int64)
-	c.logger.Info("AtomicPurchaseCheck result", "lua_result", resultInt, "can_purchase", resultInt == 1)
+	c.logger.Debug("AtomicPurchaseCheck result", "lua_result", resultInt, "can_purchase", resultInt == 1)
 
 	return resultInt == 1, nil
 }
 
 func (c *Cache) AtomicUserLimitCheck(ctx context.Context, saleID, userID string, itemCount, maxItems int) (bool, error) {
-	keys := []string{fmt.Sprintf("user:%s:sale:%s:count", userID, saleID)}
+	keys := []string{fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID)}
 	args := []interface{}{itemCount, maxItems}
 
 	result, err := c.userLimitScript.Run(ctx, c.client, keys, args...).Result()
@@ -248,7 +766,7 @@ func (c *Cache) AtomicUserLimitCheck(ctx context.Context, saleID, userID string,
 }
 
 func (c *Cache) AtomicSaleLimitCheck(ctx context.Context, saleID string, itemCount, maxItems int) (bool, error) {
-	keys := []string{fmt.Sprintf("sale:%s:items_sold", saleID)}
+	keys := []string{fmt.Sprintf("sale:{%s}:items_sold", saleID)}
 	args := []interface{}{itemCount, maxItems}
 
 	result, err := c.saleLimitScript.Run(ctx, c.client, keys, args...).Result()
@@ -259,6 +777,52 @@ func (c *Cache) AtomicSaleLimitCheck(ctx context.Context, saleID string, itemCou
 	return result.(int64) == 1, nil
 }
 
+// BeginIdempotentPurchase sets an in-flight marker under key unless
+// something is stored there already, in which case that is returned.
+func (c *Cache) BeginIdempotentPurchase(ctx context.Context, key, code string, ttl time.Duration) (*ports.IdempotentPurchase, bool, error) {
+	marker, err := json.Marshal(ports.IdempotentPurchase{Code: code})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encode idempotency marker: %w", err)
+	}
+
+	keys := []string{idempotentPurchaseKey(key)}
+	data, err := c.idempotencyBeginScript.Run(ctx, c.client, keys, marker, ttl.Milliseconds()).Text()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+
+	var stored ports.IdempotentPurchase
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, false, fmt.Errorf("failed to decode idempotency result: %w", err)
+	}
+	return &stored, false, nil
+}
+
+func (c *Cache) CompleteIdempotentPurchase(ctx context.Context, key string, purchase *ports.IdempotentPurchase, ttl time.Duration) error {
+	data, err := json.Marshal(purchase)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency result: %w", err)
+	}
+
+	return c.client.Set(ctx, idempotentPurchaseKey(key), data, ttl).Err()
+}
+
+func (c *Cache) AbortIdempotentPurchase(ctx context.Context, key, code string) error {
+	marker, err := json.Marshal(ports.IdempotentPurchase{Code: code})
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency marker: %w", err)
+	}
+
+	return c.idempotencyAbortScript.Run(ctx, c.client, []string{idempotentPurchaseKey(key)}, marker).Err()
+}
+
+func idempotentPurchaseKey(key string) string {
+	return fmt.Sprintf("idempotency:purchase:%s", key)
+}
+
 func (c *Cache) DistributedLock(ctx context.Context, key string, expiration time.Duration) (bool, error) {
 	lockKey := fmt.Sprintf("lock:%s", key)
 	result, err := c.client.SetNX(ctx, lockKey, "1", expiration).Result()
@@ -280,40 +844,179 @@ func (c *Cache) ReleaseLock(ctx context.Context, key string) error {
 	return err
 }
 
+// TryLockWithHeartbeat acquires the lock and keeps extending it to ttl every
+// ttl/3 until the returned CancelFunc is called, which also releases it. The
+// lock value is a random token so that a holder whose lock already expired
+// can neither extend nor delete a lock that someone else now owns.
+//
+// The returned context is cancelled with ports.ErrLockLost once the lock is
+// gone, whether someone else took it over or renewals kept failing until
+// it expired, so the holder stops working under a lock it no longer has.
+func (c *Cache) TryLockWithHeartbeat(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error) {
+	lockKey := fmt.Sprintf("lock:%s", key)
+
+	token, err := lockToken()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acquired, err := c.client.SetNX(ctx, lockKey, token, ttl).Result()
+	if err != nil {
+		monitoring.RedisLockFailureTotal.WithLabelValues(key, "redis_error").Inc()
+		return nil, nil, err
+	}
+	if !acquired {
+		monitoring.RedisLockFailureTotal.WithLabelValues(key, "already_locked").Inc()
+		return nil, nil, ports.ErrLockNotAcquired
+	}
+	monitoring.RedisLockSuccessTotal.WithLabelValues(key).Inc()
+
+	lockCtx, loseLock := context.WithCancelCause(ctx)
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		expiresAt := time.Now().Add(ttl)
+		for {
+			select {
+			case <-heartbeatCtx.Done():
+				return
+			case <-ticker.C:
+				renewedAt := time.Now()
+				extended, err := c.lockRenewScript.Run(heartbeatCtx, c.client, []string{lockKey}, token, ttl.Milliseconds()).Int()
+				if err != nil {
+					if heartbeatCtx.Err() != nil {
+						return
+					}
+					if !time.Now().Before(expiresAt) {
+						c.logger.Error("Lock expired while it could not be extended", "error", err, "lock_key", lockKey)
+						loseLock(ports.ErrLockLost)
+						return
+					}
+					c.logger.Warn("Failed to extend lock", "error", err, "lock_key", lockKey)
+					continue
+				}
+				if extended == 0 {
+					c.logger.Error("Lock lost before release", "lock_key", lockKey)
+					loseLock(ports.ErrLockLost)
+					return
+				}
+				expiresAt = renewedAt.Add(ttl)
+			}
+		}
+	}()
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			stopHeartbeat()
+			<-done
+			loseLock(context.Canceled)
+
+			releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if err := c.lockReleaseScript.Run(releaseCtx, c.client, []string{lockKey}, token).Err(); err != nil {
+				c.logger.Error("Failed to release lock", "error", err, "lock_key", lockKey)
+			}
+		})
+	}
+
+	return lockCtx, release, nil
+}
+
+func lockToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+const lockRenewLuaScript = `
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return 0
+`
+
+const lockReleaseLuaScript = `
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`
+
+const idempotencyBeginLuaScript = `
+	if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+		return nil
+	end
+	return redis.call('GET', KEYS[1])
+`
+
+const idempotencyAbortLuaScript = `
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`
+
+const purgeLuaScript = `
+	local result = redis.call('SCAN', ARGV[1], 'MATCH', ARGV[2], 'COUNT', ARGV[3])
+	local keys = result[2]
+
+	if #keys > 0 then
+		redis.call('DEL', unpack(keys))
+	end
+
+	return {result[1], #keys}
+`
+
 const purchaseLuaScript = `
 	local sale_key = KEYS[1]
 	local user_key = KEYS[2]
 	local item_count = tonumber(ARGV[1])
 	local max_sale_items = tonumber(ARGV[2])
 	local max_user_items = tonumber(ARGV[3])
+	local debug_enabled = ARGV[4] == '1'
+
+	local function log_debug(message)
+		if debug_enabled then
+			redis.log(redis.LOG_WARNING, 'LUA DEBUG: ' .. message)
+		end
+	end
 
 	-- Get current counts
 	local current_sale_count = tonumber(redis.call('GET', sale_key) or 0)
 	local current_user_count = tonumber(redis.call('GET', user_key) or 0)
 
 	-- Log debug info
-	redis.log(redis.LOG_WARNING, 'LUA DEBUG: sale_key=' .. sale_key .. ', user_key=' .. user_key)
-	redis.log(redis.LOG_WARNING, 'LUA DEBUG: item_count=' .. item_count .. ', max_sale_items=' .. max_sale_items .. ', max_user_items=' .. max_user_items)
-	redis.log(redis.LOG_WARNING, 'LUA DEBUG: current_sale_count=' .. current_sale_count .. ', current_user_count=' .. current_user_count)
+	log_debug('sale_key=' .. sale_key .. ', user_key=' .. user_key)
+	log_debug('item_count=' .. item_count .. ', max_sale_items=' .. max_sale_items .. ', max_user_items=' .. max_user_items)
+	log_debug('current_sale_count=' .. current_sale_count .. ', current_user_count=' .. current_user_count)
 
 	-- Check limits
 	if current_sale_count + item_count > max_sale_items then
-		redis.log(redis.LOG_WARNING, 'LUA DEBUG: Sale limit exceeded: ' .. (current_sale_count + item_count) .. ' > ' .. max_sale_items)
+		log_debug('Sale limit exceeded: ' .. (current_sale_count + item_count) .. ' > ' .. max_sale_items)
 		return 0  -- Sale limit exceeded
 	end
 
 	-- For user limit, check if user has enough remaining capacity
 	local remaining_user_capacity = max_user_items - current_user_count
-	redis.log(redis.LOG_WARNING, 'LUA DEBUG: remaining_user_capacity=' .. remaining_user_capacity)
+	log_debug('remaining_user_capacity=' .. remaining_user_capacity)
 	if item_count > remaining_user_capacity then
-		redis.log(redis.LOG_WARNING, 'LUA DEBUG: User limit exceeded: ' .. item_count .. ' > ' .. remaining_user_capacity)
+		log_debug('User limit exceeded: ' .. item_count .. ' > ' .. remaining_user_capacity)
 		return 0  -- User limit exceeded
 	end
 
 	-- Increment both sale and user counters
 	redis.call('INCRBY', sale_key, item_count)
 	redis.call('INCRBY', user_key, item_count)
-	redis.log(redis.LOG_WARNING, 'LUA DEBUG: Purchase successful, incremented sale counter by ' .. item_count .. ' and user counter by ' .. item_count)
+	log_debug('Purchase successful, incremented sale counter by ' .. item_count .. ' and user counter by ' .. item_count)
 
 	return 1  -- Success
 	`
@@ -351,10 +1054,66 @@ const saleLimitLuaScript = `
 	return 1  -- Success
 `
 
+const remainingLuaScript = `
+	local remaining_key = KEYS[1]
+	local item_count = tonumber(ARGV[1])
+
+	-- Only adjust an initialized counter; a missing key is rebuilt from the database
+	local current = redis.call('GET', remaining_key)
+	if not current then
+		return -1
+	end
+
+	local new_remaining = math.max(0, tonumber(current) - item_count)
+	redis.call('SET', remaining_key, new_remaining, 'KEEPTTL')
+
+	return new_remaining
+`
+
+const checkoutReserveLuaScript = `
+	local purchased_key = KEYS[1]
+	local checkout_key = KEYS[2]
+	local item_count = tonumber(ARGV[1])
+	local max_items = tonumber(ARGV[2])
+	local ttl_ms = tonumber(ARGV[3])
+
+	local purchased = tonumber(redis.call('GET', purchased_key) or 0)
+	local checked_out = tonumber(redis.call('GET', checkout_key) or 0)
+
+	local remaining = max_items - purchased - checked_out
+	if item_count > remaining then
+		return {0, math.max(remaining, 0)}  -- No slots left
+	end
+
+	redis.call('INCRBY', checkout_key, item_count)
+	-- Each checkout refreshes the user's code, so the slots held by it
+	-- lapse together with the code.
+	if ttl_ms > 0 then
+		redis.call('PEXPIRE', checkout_key, ttl_ms)
+	end
+
+	return {1, remaining - item_count}  -- Success
+`
+
+const checkoutReleaseLuaScript = `
+	local checkout_key = KEYS[1]
+	local item_count = tonumber(ARGV[1])
+
+	local current = redis.call('GET', checkout_key)
+	if not current then
+		return 0
+	end
+
+	local new_count = math.max(0, tonumber(current) - item_count)
+	redis.call('SET', checkout_key, new_count, 'KEEPTTL')
+
+	return new_count
+`
+
 func (c *Cache) DecrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
 	keys := []string{
-		fmt.Sprintf("sale:%s:items_sold", saleID),
-		fmt.Sprintf("user:%s:sale:%s:count", userID, saleID),
+		fmt.Sprintf("sale:{%s}:items_sold", saleID),
+		fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID),
 	}
 	args := []interface{}{itemCount}
 
@@ -381,7 +1140,7 @@ func (c *Cache) DecrementCounters(ctx context.Context, saleID, userID string, it
 }
 
 func (c *Cache) GetSaleItemCount(ctx context.Context, saleID string) (int, error) {
-	key := fmt.Sprintf("sale:%s:items_sold", saleID)
+	key := fmt.Sprintf("sale:{%s}:items_sold", saleID)
 	result, err := c.client.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return 0, nil
@@ -398,10 +1157,58 @@ func (c *Cache) GetSaleItemCount(ctx context.Context, saleID string) (int, error
 	return count, nil
 }
 
+func itemSoldChannel(saleID string) string {
+	return fmt.Sprintf("items_sold:{%s}", saleID)
+}
+
+// PublishItemSold announces a sold item to every replica subscribed to the
+// sale through SubscribeItemSold.
+func (c *Cache) PublishItemSold(ctx context.Context, saleID, itemID string) error {
+	return c.client.Publish(ctx, itemSoldChannel(saleID), itemID).Err()
+}
+
+// SubscribeItemSold returns the IDs of the sale's items as they are sold on
+// any replica. The channel is closed once ctx is done or the subscription
+// breaks.
+func (c *Cache) SubscribeItemSold(ctx context.Context, saleID string) (<-chan string, error) {
+	pubsub := c.client.Subscribe(ctx, itemSoldChannel(saleID))
+	// Waiting for the confirmation surfaces connection errors here rather
+	// than as a silently closed channel.
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	itemIDs := make(chan string)
+	go func() {
+		defer close(itemIDs)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				select {
+				case itemIDs <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return itemIDs, nil
+}
+
 func (c *Cache) IncrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
 	keys := []string{
-		fmt.Sprintf("sale:%s:items_sold", saleID),
-		fmt.Sprintf("user:%s:sale:%s:count", userID, saleID),
+		fmt.Sprintf("sale:{%s}:items_sold", saleID),
+		fmt.Sprintf("user:%s:sale:{%s}:count", userID, saleID),
 	}
 	args := []interface{}{itemCount}
 
@@ -411,13 +1218,24 @@ func (c *Cache) IncrementCounters(ctx context.Context, saleID, userID string, it
 		local item_count = tonumber(ARGV[1])
 
 		-- Increment both counters
-		redis.call('INCRBY', sale_key, item_count)
+		local sale_count = redis.call('INCRBY', sale_key, item_count)
 		redis.call('INCRBY', user_key, item_count)
 		redis.call('EXPIRE', user_key, 86400)  -- 24 hours
 
-		return 1
+		return sale_count
 	`)
 
-	_, err := incrementScript.Run(ctx, c.client, keys, args...).Result()
-	return err
+	result, err := incrementScript.Run(ctx, c.client, keys, args...).Result()
+	if err != nil {
+		return err
+	}
+
+	monitoring.SaleEvents.Publish(monitoring.SaleEvent{
+		Type:      monitoring.SaleEventItemsSold,
+		SaleID:    saleID,
+		Count:     itemCount,
+		ItemsSold: int(result.(int64)),
+	})
+
+	return nil
 }
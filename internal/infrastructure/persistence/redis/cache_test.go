@@ -0,0 +1,729 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+// newMiniredisCache runs the cache against an in-process Redis, which
+// evaluates the Lua scripts and lets tests move time forward.
+func newMiniredisCache(t testing.TB) (*redis.Cache, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	host, rawPort, err := net.SplitHostPort(server.Addr())
+	if err != nil {
+		t.Fatalf("invalid miniredis address: %v", err)
+	}
+	port, _ := strconv.Atoi(rawPort)
+
+	conn, err := redis.NewConnection(config.RedisConfig{Host: host, Port: port})
+	if err != nil {
+		t.Fatalf("failed to connect to miniredis: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return newTestCache(conn), server
+}
+
+func newTestCache(conn *redis.Connection) *redis.Cache {
+	return redis.NewCache(conn, config.CacheConfig{}, config.BloomFilterConfig{}, logger.NewLogger())
+}
+
+func checkoutCountKey(saleID, userID string) string {
+	return fmt.Sprintf("user:%s:sale:{%s}:checkout_count", userID, saleID)
+}
+
+func TestCheckoutReservationExpiresWithCheckout(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+	const saleID, userID, maxItems = "S-reserve", "user-1", 2
+	ttl := 10 * time.Minute
+
+	for i := 0; i < maxItems; i++ {
+		if _, reserved, err := cache.AtomicReserveCheckoutSlot(ctx, saleID, userID, maxItems, ttl); err != nil || !reserved {
+			t.Fatalf("reservation %d: reserved=%v err=%v", i+1, reserved, err)
+		}
+	}
+	if _, reserved, err := cache.AtomicReserveCheckoutSlot(ctx, saleID, userID, maxItems, ttl); err != nil || reserved {
+		t.Fatalf("reservation over the limit: reserved=%v err=%v", reserved, err)
+	}
+
+	if got := server.TTL(checkoutCountKey(saleID, userID)); got <= 0 || got > ttl {
+		t.Fatalf("checkout count TTL = %v, want up to %v", got, ttl)
+	}
+
+	// The user abandons the checkout and its code lapses.
+	server.FastForward(ttl + time.Second)
+
+	remaining, reserved, err := cache.AtomicReserveCheckoutSlot(ctx, saleID, userID, maxItems, ttl)
+	if err != nil || !reserved {
+		t.Fatalf("reservation after expiry: reserved=%v err=%v", reserved, err)
+	}
+	if remaining != maxItems-1 {
+		t.Errorf("remaining after expiry = %d, want %d", remaining, maxItems-1)
+	}
+}
+
+func TestCheckoutReservationRefreshesTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+	const saleID, userID = "S-reserve", "user-1"
+	ttl := 10 * time.Minute
+
+	if ok, err := cache.AtomicCheckoutReserve(ctx, saleID, userID, 1, 10, ttl); err != nil || !ok {
+		t.Fatalf("AtomicCheckoutReserve: ok=%v err=%v", ok, err)
+	}
+	server.FastForward(8 * time.Minute)
+	if ok, err := cache.AtomicCheckoutReserve(ctx, saleID, userID, 1, 10, ttl); err != nil || !ok {
+		t.Fatalf("AtomicCheckoutReserve: ok=%v err=%v", ok, err)
+	}
+	server.FastForward(8 * time.Minute)
+
+	count, err := cache.GetUserCheckoutCount(ctx, saleID, userID)
+	if err != nil {
+		t.Fatalf("GetUserCheckoutCount: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("checkout count = %d, want 2 while the refreshed checkout is live", count)
+	}
+}
+
+func TestReleaseCheckoutReservationKeepsTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+	const saleID, userID = "S-reserve", "user-1"
+	ttl := 10 * time.Minute
+
+	if ok, err := cache.AtomicCheckoutReserve(ctx, saleID, userID, 2, 10, ttl); err != nil || !ok {
+		t.Fatalf("AtomicCheckoutReserve: ok=%v err=%v", ok, err)
+	}
+	if err := cache.ReleaseCheckoutReservation(ctx, saleID, userID, 1); err != nil {
+		t.Fatalf("ReleaseCheckoutReservation: %v", err)
+	}
+
+	count, err := cache.GetUserCheckoutCount(ctx, saleID, userID)
+	if err != nil {
+		t.Fatalf("GetUserCheckoutCount: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("checkout count = %d, want 1", count)
+	}
+	if got := server.TTL(checkoutCountKey(saleID, userID)); got <= 0 {
+		t.Errorf("release dropped the checkout count TTL")
+	}
+}
+
+func TestRemoveUserCheckoutCodeReleasesReservation(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+	const saleID, userID = "S-reserve", "user-1"
+
+	if ok, err := cache.AtomicCheckoutReserve(ctx, saleID, userID, 3, 3, time.Hour); err != nil || !ok {
+		t.Fatalf("AtomicCheckoutReserve: ok=%v err=%v", ok, err)
+	}
+	if err := cache.RemoveUserCheckoutCode(ctx, saleID, userID); err != nil {
+		t.Fatalf("RemoveUserCheckoutCode: %v", err)
+	}
+	if server.Exists(checkoutCountKey(saleID, userID)) {
+		t.Error("checkout count survived the checkout's cleanup")
+	}
+}
+
+func TestIdempotentPurchaseLifecycle(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newMiniredisCache(t)
+	const key, code = "key-1", "CHK-1"
+
+	if _, begun, err := cache.BeginIdempotentPurchase(ctx, key, code, time.Minute); err != nil || !begun {
+		t.Fatalf("first BeginIdempotentPurchase: begun=%v err=%v", begun, err)
+	}
+
+	// A concurrent retry sees the marker and must not run the purchase.
+	stored, begun, err := cache.BeginIdempotentPurchase(ctx, key, code, time.Minute)
+	if err != nil || begun {
+		t.Fatalf("second BeginIdempotentPurchase: begun=%v err=%v", begun, err)
+	}
+	if stored.Code != code || stored.Response != nil {
+		t.Errorf("stored = %+v, want an in-flight marker for %s", stored, code)
+	}
+
+	resp := &ports.PurchaseResponse{Success: true, TotalPurchased: 2}
+	if err := cache.CompleteIdempotentPurchase(ctx, key, &ports.IdempotentPurchase{Code: code, Response: resp}, time.Hour); err != nil {
+		t.Fatalf("CompleteIdempotentPurchase: %v", err)
+	}
+	// Aborting after completion must not throw the result away.
+	if err := cache.AbortIdempotentPurchase(ctx, key, code); err != nil {
+		t.Fatalf("AbortIdempotentPurchase: %v", err)
+	}
+
+	stored, begun, err = cache.BeginIdempotentPurchase(ctx, key, code, time.Minute)
+	if err != nil || begun {
+		t.Fatalf("BeginIdempotentPurchase after completion: begun=%v err=%v", begun, err)
+	}
+	if stored.Response == nil || stored.Response.TotalPurchased != 2 {
+		t.Errorf("stored response = %+v, want the completed purchase", stored.Response)
+	}
+}
+
+func TestIdempotentPurchaseAbortAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+
+	if _, begun, err := cache.BeginIdempotentPurchase(ctx, "aborted", "CHK-1", time.Minute); err != nil || !begun {
+		t.Fatalf("BeginIdempotentPurchase: begun=%v err=%v", begun, err)
+	}
+	if err := cache.AbortIdempotentPurchase(ctx, "aborted", "CHK-1"); err != nil {
+		t.Fatalf("AbortIdempotentPurchase: %v", err)
+	}
+	if _, begun, err := cache.BeginIdempotentPurchase(ctx, "aborted", "CHK-1", time.Minute); err != nil || !begun {
+		t.Errorf("retry after abort: begun=%v err=%v, want a fresh claim", begun, err)
+	}
+
+	if _, begun, err := cache.BeginIdempotentPurchase(ctx, "abandoned", "CHK-2", time.Minute); err != nil || !begun {
+		t.Fatalf("BeginIdempotentPurchase: begun=%v err=%v", begun, err)
+	}
+	server.FastForward(2 * time.Minute)
+	if _, begun, err := cache.BeginIdempotentPurchase(ctx, "abandoned", "CHK-2", time.Minute); err != nil || !begun {
+		t.Errorf("retry after the marker expired: begun=%v err=%v, want a fresh claim", begun, err)
+	}
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+	const saleID, userID = "S-legacy", "user-1"
+
+	server.Set("sale:S-legacy:items_sold", "7")
+	server.Set("sale:S-legacy:total_items", "100")
+	server.Set("user:user-1:sale:S-legacy:count", "2")
+	server.SetTTL("user:user-1:sale:S-legacy:count", time.Hour)
+	server.Set("user:user-1:sale:S-legacy:checkout", "CHK-S-legacy-1")
+	server.SAdd("user:user-1:sale:S-legacy:checked_items", "item-1", "item-2")
+	// A new instance already counted a sale under the new name.
+	server.Set("sale:{S-legacy}:items_sold", "1")
+	// Not a legacy per-sale key.
+	server.Set("sale:{S-other}:quota", "5")
+
+	moved, err := cache.MigrateLegacyKeys(ctx)
+	if err != nil {
+		t.Fatalf("MigrateLegacyKeys: %v", err)
+	}
+	if moved != 5 {
+		t.Errorf("moved = %d, want 5", moved)
+	}
+
+	sold, err := cache.GetSaleItemCount(ctx, saleID)
+	if err != nil || sold != 8 {
+		t.Errorf("items sold = %d (err %v), want the legacy and new counts summed to 8", sold, err)
+	}
+	if total, found, err := cache.GetSaleTotalItems(ctx, saleID); err != nil || !found || total != 100 {
+		t.Errorf("total items = %d, found %v (err %v), want 100", total, found, err)
+	}
+	if count, err := cache.GetUserItemCount(ctx, saleID, userID); err != nil || count != 2 {
+		t.Errorf("user item count = %d (err %v), want 2", count, err)
+	}
+	if ttl := server.TTL("user:user-1:sale:{S-legacy}:count"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("user item count TTL = %v, want the legacy TTL", ttl)
+	}
+	if code, err := cache.GetUserCheckoutCode(ctx, saleID, userID); err != nil || code != "CHK-S-legacy-1" {
+		t.Errorf("checkout code = %q (err %v)", code, err)
+	}
+	if ok, err := cache.HasUserCheckedOutItem(ctx, saleID, userID, "item-2"); err != nil || !ok {
+		t.Errorf("checked out item-2 = %v (err %v), want true", ok, err)
+	}
+
+	for _, key := range server.Keys() {
+		if !strings.Contains(key, "{") {
+			t.Errorf("legacy key %s survived the migration", key)
+		}
+	}
+
+	// Running again finds nothing to move.
+	if moved, err := cache.MigrateLegacyKeys(ctx); err != nil || moved != 0 {
+		t.Errorf("second run moved %d (err %v), want 0", moved, err)
+	}
+}
+
+func TestTryLockWithHeartbeatCancelsOnLoss(t *testing.T) {
+	ctx := context.Background()
+	cache, server := newMiniredisCache(t)
+
+	lockCtx, unlock, err := cache.TryLockWithHeartbeat(ctx, "purchase:CHK-1", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TryLockWithHeartbeat: %v", err)
+	}
+	defer unlock()
+
+	// Someone else owns the lock now, as after an expiry under a long pause.
+	server.Set("lock:purchase:CHK-1", "other-token")
+
+	select {
+	case <-lockCtx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("lock context was not cancelled after the lock was lost")
+	}
+	if cause := context.Cause(lockCtx); !errors.Is(cause, ports.ErrLockLost) {
+		t.Errorf("cause = %v, want ErrLockLost", cause)
+	}
+
+	unlock()
+	if got, _ := server.Get("lock:purchase:CHK-1"); got != "other-token" {
+		t.Errorf("release deleted the new owner's lock, value now %q", got)
+	}
+}
+
+func TestTryLockWithHeartbeatKeepsContextWhileHeld(t *testing.T) {
+	ctx := context.Background()
+	cache, _ := newMiniredisCache(t)
+
+	lockCtx, unlock, err := cache.TryLockWithHeartbeat(ctx, "purchase:CHK-2", 150*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TryLockWithHeartbeat: %v", err)
+	}
+
+	// Several TTLs pass; the heartbeat keeps the lock and its context alive.
+	time.Sleep(500 * time.Millisecond)
+	if err := lockCtx.Err(); err != nil {
+		t.Fatalf("lock context ended while the lock was held: %v", context.Cause(lockCtx))
+	}
+
+	unlock()
+	if context.Cause(lockCtx) == ports.ErrLockLost {
+		t.Error("releasing the lock reported it as lost")
+	}
+}
+
+type cacheBackend struct {
+	cache *redis.Cache
+	// advance lets time pass for key expiry: miniredis only expires keys
+	// when told to, a real Redis needs the wait.
+	advance func(time.Duration)
+}
+
+// onEachBackend runs fn against miniredis and, when FLASHSALE_TEST_REDIS_ADDR
+// is set, against a real Redis, whose Lua engine is the one production runs.
+func onEachBackend(t *testing.T, fn func(t *testing.T, b cacheBackend)) {
+	t.Run("miniredis", func(t *testing.T) {
+		cache, server := newMiniredisCache(t)
+		fn(t, cacheBackend{cache: cache, advance: server.FastForward})
+	})
+	t.Run("redis", func(t *testing.T) {
+		fn(t, cacheBackend{cache: newTestCache(integration.Redis(t)), advance: time.Sleep})
+	})
+}
+
+// newTestSaleID returns a sale ID no other test uses and purges the sale's
+// keys when the test ends, since a real Redis is shared.
+func newTestSaleID(t testing.TB, cache *redis.Cache) string {
+	t.Helper()
+
+	saleID := integration.NewSaleID()
+	t.Cleanup(func() {
+		if err := cache.PurgeSaleData(context.Background(), saleID); err != nil {
+			t.Errorf("failed to purge sale %s: %v", saleID, err)
+		}
+	})
+	return saleID
+}
+
+func assertCounts(t *testing.T, cache *redis.Cache, saleID, userID string, wantSale, wantUser int) {
+	t.Helper()
+
+	ctx := context.Background()
+	saleCount, err := cache.GetSaleItemCount(ctx, saleID)
+	if err != nil {
+		t.Fatalf("GetSaleItemCount: %v", err)
+	}
+	userCount, err := cache.GetUserItemCount(ctx, saleID, userID)
+	if err != nil {
+		t.Fatalf("GetUserItemCount: %v", err)
+	}
+	if saleCount != wantSale || userCount != wantUser {
+		t.Errorf("counts = sale %d, user %d; want sale %d, user %d", saleCount, userCount, wantSale, wantUser)
+	}
+}
+
+func TestAtomicPurchaseCheck(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+		const userID, maxSale, maxUser = "user-1", 10, 4
+
+		// Other buyers have taken 7 of the sale's 10 items.
+		if err := b.cache.IncrementSaleItemsSold(ctx, saleID, 7); err != nil {
+			t.Fatalf("IncrementSaleItemsSold: %v", err)
+		}
+
+		steps := []struct {
+			name      string
+			itemCount int
+			want      bool
+			wantSale  int
+			wantUser  int
+		}{
+			{name: "within both limits", itemCount: 2, want: true, wantSale: 9, wantUser: 2},
+			{name: "over the sale limit", itemCount: 2, want: false, wantSale: 9, wantUser: 2},
+			{name: "exactly the sale limit", itemCount: 1, want: true, wantSale: 10, wantUser: 3},
+			{name: "sale sold out", itemCount: 1, want: false, wantSale: 10, wantUser: 3},
+		}
+		for _, step := range steps {
+			ok, err := b.cache.AtomicPurchaseCheck(ctx, saleID, userID, step.itemCount, maxSale, maxUser)
+			if err != nil {
+				t.Fatalf("%s: AtomicPurchaseCheck: %v", step.name, err)
+			}
+			if ok != step.want {
+				t.Errorf("%s: AtomicPurchaseCheck = %v, want %v", step.name, ok, step.want)
+			}
+			assertCounts(t, b.cache, saleID, userID, step.wantSale, step.wantUser)
+		}
+
+		// The user limit rejects on its own and leaves the sale untouched.
+		other := newTestSaleID(t, b.cache)
+		if ok, err := b.cache.AtomicPurchaseCheck(ctx, other, userID, maxUser+1, maxSale, maxUser); err != nil || ok {
+			t.Errorf("AtomicPurchaseCheck over the user limit = %v, %v; want false", ok, err)
+		}
+		assertCounts(t, b.cache, other, userID, 0, 0)
+	})
+}
+
+func TestAtomicUserLimitCheck(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+		const userID, maxItems = "user-1", 3
+
+		for i, step := range []struct {
+			itemCount int
+			want      bool
+		}{
+			{itemCount: 2, want: true},
+			{itemCount: 2, want: false},
+			{itemCount: 1, want: true},
+			{itemCount: 1, want: false},
+		} {
+			ok, err := b.cache.AtomicUserLimitCheck(ctx, saleID, userID, step.itemCount, maxItems)
+			if err != nil {
+				t.Fatalf("step %d: AtomicUserLimitCheck: %v", i, err)
+			}
+			if ok != step.want {
+				t.Errorf("step %d: AtomicUserLimitCheck(%d) = %v, want %v", i, step.itemCount, ok, step.want)
+			}
+		}
+		assertCounts(t, b.cache, saleID, userID, 0, maxItems)
+
+		// Another user's count is separate.
+		if ok, err := b.cache.AtomicUserLimitCheck(ctx, saleID, "user-2", maxItems, maxItems); err != nil || !ok {
+			t.Errorf("AtomicUserLimitCheck for another user = %v, %v; want true", ok, err)
+		}
+	})
+}
+
+func TestAtomicSaleLimitCheck(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+		const maxItems = 5
+
+		for i, step := range []struct {
+			itemCount int
+			want      bool
+		}{
+			{itemCount: 3, want: true},
+			{itemCount: 3, want: false},
+			{itemCount: 2, want: true},
+			{itemCount: 1, want: false},
+		} {
+			ok, err := b.cache.AtomicSaleLimitCheck(ctx, saleID, step.itemCount, maxItems)
+			if err != nil {
+				t.Fatalf("step %d: AtomicSaleLimitCheck: %v", i, err)
+			}
+			if ok != step.want {
+				t.Errorf("step %d: AtomicSaleLimitCheck(%d) = %v, want %v", i, step.itemCount, ok, step.want)
+			}
+		}
+		if count, err := b.cache.GetSaleItemCount(ctx, saleID); err != nil || count != maxItems {
+			t.Errorf("sale count = %d (err %v), want %d", count, err, maxItems)
+		}
+	})
+}
+
+// A hundred buyers arrive at once for fifty items; the script must let
+// exactly fifty through.
+func TestAtomicPurchaseCheckPreventsOverselling(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		const buyers, maxSale, maxUser = 100, 50, 5
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+
+		var wg sync.WaitGroup
+		var granted atomic.Int32
+		start := make(chan struct{})
+		errs := make(chan error, buyers)
+		for i := 0; i < buyers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				ok, err := b.cache.AtomicPurchaseCheck(ctx, saleID, fmt.Sprintf("user-%d", i), 1, maxSale, maxUser)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if ok {
+					granted.Add(1)
+				}
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Fatalf("AtomicPurchaseCheck: %v", err)
+		}
+		if got := granted.Load(); got != maxSale {
+			t.Errorf("%d purchases were granted, want exactly %d", got, maxSale)
+		}
+		if count, err := b.cache.GetSaleItemCount(ctx, saleID); err != nil || count != maxSale {
+			t.Errorf("sale count = %d (err %v), want %d", count, err, maxSale)
+		}
+	})
+}
+
+func TestDecrementCounters(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+		const userID = "user-1"
+
+		if ok, err := b.cache.AtomicPurchaseCheck(ctx, saleID, userID, 3, 10, 10); err != nil || !ok {
+			t.Fatalf("AtomicPurchaseCheck = %v, %v", ok, err)
+		}
+
+		if err := b.cache.DecrementCounters(ctx, saleID, userID, 2); err != nil {
+			t.Fatalf("DecrementCounters: %v", err)
+		}
+		assertCounts(t, b.cache, saleID, userID, 1, 1)
+
+		// Counters never go below zero.
+		if err := b.cache.DecrementCounters(ctx, saleID, userID, 5); err != nil {
+			t.Fatalf("DecrementCounters: %v", err)
+		}
+		assertCounts(t, b.cache, saleID, userID, 0, 0)
+	})
+}
+
+func TestDistributedLock(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		key := "test:" + integration.NewSaleID()
+		t.Cleanup(func() { _ = b.cache.ReleaseLock(context.Background(), key) })
+
+		// Two replicas try to take the lock at the same moment.
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		acquired := make([]bool, 2)
+		errs := make([]error, 2)
+		for i := range acquired {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				acquired[i], errs[i] = b.cache.DistributedLock(ctx, key, 200*time.Millisecond)
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Fatalf("DistributedLock: %v", err)
+			}
+		}
+		if acquired[0] == acquired[1] {
+			t.Fatalf("acquired = %v, want exactly one holder", acquired)
+		}
+
+		if err := b.cache.ReleaseLock(ctx, key); err != nil {
+			t.Fatalf("ReleaseLock: %v", err)
+		}
+		if ok, err := b.cache.DistributedLock(ctx, key, 200*time.Millisecond); err != nil || !ok {
+			t.Fatalf("DistributedLock after release = %v, %v; want true", ok, err)
+		}
+
+		// A holder that never releases loses the lock when it expires.
+		b.advance(300 * time.Millisecond)
+		if ok, err := b.cache.DistributedLock(ctx, key, 200*time.Millisecond); err != nil || !ok {
+			t.Errorf("DistributedLock after expiry = %v, %v; want true", ok, err)
+		}
+	})
+}
+
+func TestBloomFilterAddAndContains(t *testing.T) {
+	onEachBackend(t, func(t *testing.T, b cacheBackend) {
+		ctx := context.Background()
+		saleID := newTestSaleID(t, b.cache)
+
+		if err := b.cache.AddItemToBloomFilter(ctx, saleID, "item-0"); err != nil {
+			t.Fatalf("AddItemToBloomFilter: %v", err)
+		}
+		sold := []string{"item-0"}
+		for i := 1; i < 50; i++ {
+			sold = append(sold, fmt.Sprintf("item-%d", i))
+		}
+		if err := b.cache.AddItemsToBloomFilter(ctx, saleID, sold[1:]); err != nil {
+			t.Fatalf("AddItemsToBloomFilter: %v", err)
+		}
+
+		for _, itemID := range sold {
+			found, err := b.cache.ItemExistsInBloomFilter(ctx, saleID, itemID)
+			if err != nil {
+				t.Fatalf("ItemExistsInBloomFilter: %v", err)
+			}
+			if !found {
+				t.Errorf("sold item %s is missing from the filter", itemID)
+			}
+		}
+
+		unsold := make([]string, 100)
+		for i := range unsold {
+			unsold[i] = fmt.Sprintf("unsold-%d", i)
+		}
+		found, err := b.cache.ItemsExistInBloomFilter(ctx, saleID, append(unsold, sold...))
+		if err != nil {
+			t.Fatalf("ItemsExistInBloomFilter: %v", err)
+		}
+		falsePositives := 0
+		for _, itemID := range unsold {
+			if found[itemID] {
+				falsePositives++
+			}
+		}
+		if falsePositives > 5 {
+			t.Errorf("%d of %d unsold items reported as sold", falsePositives, len(unsold))
+		}
+		for _, itemID := range sold {
+			if !found[itemID] {
+				t.Errorf("batch lookup missed sold item %s", itemID)
+			}
+		}
+
+		// Another sale's filter is separate.
+		other := newTestSaleID(t, b.cache)
+		if found, err := b.cache.ItemExistsInBloomFilter(ctx, other, "item-0"); err != nil || found {
+			t.Errorf("item of one sale found in another sale's filter: %v, %v", found, err)
+		}
+	})
+}
+
+// noLimit is a sale or user limit the benchmarks never reach.
+const noLimit = math.MaxInt32
+
+// benchmarkCache returns a cache on the real Redis when
+// FLASHSALE_TEST_REDIS_ADDR is set, since in-process miniredis timings say
+// little about production, and on miniredis otherwise.
+func benchmarkCache(b *testing.B) *redis.Cache {
+	b.Helper()
+
+	if os.Getenv(integration.EnvRedisAddr) != "" {
+		return newTestCache(integration.Redis(b))
+	}
+	cache, _ := newMiniredisCache(b)
+	return cache
+}
+
+// runPurchases calls purchase from parallel goroutines, each as a user of
+// its own.
+func runPurchases(b *testing.B, purchase func(ctx context.Context, userID string) error) {
+	var users atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		userID := fmt.Sprintf("user-%d", users.Add(1))
+		for pb.Next() {
+			if err := purchase(ctx, userID); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkAtomicPurchaseCheck measures the purchase script when the limits
+// are far away, so every call takes the increment path.
+func BenchmarkAtomicPurchaseCheck(b *testing.B) {
+	cache := benchmarkCache(b)
+	saleID := newTestSaleID(b, cache)
+	if err := cache.IncrementSaleItemsSold(context.Background(), saleID, 1000); err != nil {
+		b.Fatalf("IncrementSaleItemsSold: %v", err)
+	}
+
+	runPurchases(b, func(ctx context.Context, userID string) error {
+		_, err := cache.AtomicPurchaseCheck(ctx, saleID, userID, 1, noLimit, noLimit)
+		return err
+	})
+}
+
+// BenchmarkAtomicPurchaseCheck_ContendedSaleLimit measures the fast reject
+// path: the sale is one item short of its limit, so after the first call
+// every purchase is turned away.
+func BenchmarkAtomicPurchaseCheck_ContendedSaleLimit(b *testing.B) {
+	const current = 1000
+
+	cache := benchmarkCache(b)
+	saleID := newTestSaleID(b, cache)
+	if err := cache.IncrementSaleItemsSold(context.Background(), saleID, current); err != nil {
+		b.Fatalf("IncrementSaleItemsSold: %v", err)
+	}
+
+	runPurchases(b, func(ctx context.Context, userID string) error {
+		_, err := cache.AtomicPurchaseCheck(ctx, saleID, userID, 1, current+1, noLimit)
+		return err
+	})
+
+	b.StopTimer()
+	if count, err := cache.GetSaleItemCount(context.Background(), saleID); err != nil || count != current+1 {
+		b.Errorf("sale count = %d (err %v), want %d", count, err, current+1)
+	}
+}
+
+// BenchmarkNonAtomicPurchaseCheck is the read-then-increment pattern the
+// script replaces, for comparison: two round trips, and concurrent buyers
+// can all pass the read before any of them increments.
+func BenchmarkNonAtomicPurchaseCheck(b *testing.B) {
+	cache := benchmarkCache(b)
+	saleID := newTestSaleID(b, cache)
+	if err := cache.IncrementSaleItemsSold(context.Background(), saleID, 1000); err != nil {
+		b.Fatalf("IncrementSaleItemsSold: %v", err)
+	}
+
+	runPurchases(b, func(ctx context.Context, userID string) error {
+		count, err := cache.GetSaleItemCount(ctx, saleID)
+		if err != nil {
+			return err
+		}
+		if count+1 > noLimit {
+			return nil
+		}
+		return cache.IncrementCounters(ctx, saleID, userID, 1)
+	})
+}
@@ -2,6 +2,7 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 
 	"github.com/redis/go-redis/v9"
@@ -9,19 +10,58 @@ import (
 )
 
 type Connection struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
 func NewConnection(cfg config.RedisConfig) (*Connection, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-		PoolSize: 100, // Connection pool size
-	})
+	var client redis.UniversalClient
+
+	tlsConfig := newTLSConfig(cfg)
+
+	switch cfg.Mode {
+	case "", config.RedisModeSingle:
+		client = redis.NewClient(&redis.Options{
+			Addr:            fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+			Password:        cfg.Password,
+			DB:              cfg.DB,
+			PoolSize:        100, // Connection pool size
+			TLSConfig:       tlsConfig,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff(),
+		})
+	case config.RedisModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires at least one address")
+		}
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:           cfg.Addrs,
+			Password:        cfg.Password,
+			PoolSize:        100,
+			TLSConfig:       tlsConfig,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff(),
+		})
+	case config.RedisModeSentinel:
+		if len(cfg.Addrs) == 0 || cfg.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel mode requires sentinel addresses and a master name")
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:      cfg.MasterName,
+			SentinelAddrs:   cfg.Addrs,
+			Password:        cfg.Password,
+			DB:              cfg.DB,
+			PoolSize:        100,
+			TLSConfig:       tlsConfig,
+			MaxRetries:      cfg.MaxRetries,
+			MinRetryBackoff: cfg.MinRetryBackoff(),
+		})
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Mode)
+	}
 
 	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, err
 	}
 
@@ -30,10 +70,22 @@ func NewConnection(cfg config.RedisConfig) (*Connection, error) {
 	}, nil
 }
 
+// newTLSConfig returns nil when TLS is off, which the client takes as a
+// plain TCP connection. The server name is derived from each address.
+func newTLSConfig(cfg config.RedisConfig) *tls.Config {
+	if !cfg.TLSEnabled {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+	}
+}
+
 func (c *Connection) Close() error {
 	return c.client.Close()
 }
 
-func (c *Connection) GetClient() *redis.Client {
+func (c *Connection) GetClient() redis.UniversalClient {
 	return c.client
 }
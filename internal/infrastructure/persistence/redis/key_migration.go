@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Before cluster support, per-sale keys had no hash tag: sale:<id>:items_sold
+// rather than sale:{<id>}:items_sold. The bloom filters were global then and
+// are rebuilt per sale from the database, so only these keys are moved.
+var (
+	legacySaleKey = regexp.MustCompile(`^sale:([^{}:]+):(items_sold|total_items|quota|remaining)$`)
+	legacyUserKey = regexp.MustCompile(`^user:([^:]+):sale:([^{}:]+):(count|checkout_count|checkout|checked_items)$`)
+)
+
+// legacyCounters are added to a key the current code already wrote, since
+// during a rolling deploy both old and new instances count sales.
+var legacyCounters = map[string]bool{
+	"items_sold":     true,
+	"count":          true,
+	"checkout_count": true,
+}
+
+// MigrateLegacyKeys moves per-sale keys written under the old names to their
+// hash-tagged names and returns how many were moved. It is safe to run on
+// every start, and a write an old instance makes during a rolling deploy
+// recreates the legacy key for the next run to pick up.
+func (c *Cache) MigrateLegacyKeys(ctx context.Context) (int, error) {
+	moved := 0
+	err := c.forEachNode(ctx, func(ctx context.Context, node redis.UniversalClient) error {
+		for _, pattern := range []string{"sale:*", "user:*:sale:*"} {
+			err := c.scanKeys(ctx, node, pattern, func(keys []string) error {
+				for _, key := range keys {
+					newKey, field, ok := hashTaggedKey(key)
+					if !ok {
+						continue
+					}
+					if err := c.migrateKey(ctx, key, newKey, legacyCounters[field]); err != nil {
+						return fmt.Errorf("failed to migrate %s: %w", key, err)
+					}
+					moved++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if moved > 0 {
+		c.logger.Info("Migrated legacy cache keys", "keys", moved)
+	}
+	return moved, err
+}
+
+// hashTaggedKey returns the current name of a legacy key and the field it
+// holds, or false if key is not a legacy per-sale key.
+func hashTaggedKey(key string) (string, string, bool) {
+	if m := legacySaleKey.FindStringSubmatch(key); m != nil {
+		return fmt.Sprintf("sale:{%s}:%s", m[1], m[2]), m[2], true
+	}
+	if m := legacyUserKey.FindStringSubmatch(key); m != nil {
+		return fmt.Sprintf("user:%s:sale:{%s}:%s", m[1], m[2], m[3]), m[3], true
+	}
+	return "", "", false
+}
+
+// migrateKey moves oldKey's value to newKey with its TTL. The two may hash to
+// different slots, so this cannot be a RENAME; instead the value is taken out
+// of oldKey atomically so no concurrent write to it is lost. A value the
+// current code already wrote wins, except for counters, which are summed.
+func (c *Cache) migrateKey(ctx context.Context, oldKey, newKey string, counter bool) error {
+	keyType, err := c.client.Type(ctx, oldKey).Result()
+	if err != nil {
+		return err
+	}
+	ttl, err := c.client.PTTL(ctx, oldKey).Result()
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	switch keyType {
+	case "none":
+		// Expired or migrated by another instance since the scan.
+		return nil
+	case "string":
+		value, err := c.client.GetDel(ctx, oldKey).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		created, err := c.client.SetNX(ctx, newKey, value, ttl).Result()
+		if err != nil {
+			return err
+		}
+		if !created && counter {
+			var count int64
+			if _, err := fmt.Sscan(value, &count); err != nil {
+				return fmt.Errorf("invalid counter value %q: %w", value, err)
+			}
+			if err := c.client.IncrBy(ctx, newKey, count).Err(); err != nil {
+				return err
+			}
+		}
+	case "set":
+		members, err := c.client.SMembers(ctx, oldKey).Result()
+		if err != nil {
+			return err
+		}
+		exists, err := c.client.Exists(ctx, newKey).Result()
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			return nil
+		}
+		if err := c.client.SAdd(ctx, newKey, toInterfaces(members)...).Err(); err != nil {
+			return err
+		}
+		if exists == 0 && ttl > 0 {
+			if err := c.client.PExpire(ctx, newKey, ttl).Err(); err != nil {
+				return err
+			}
+		}
+		// Removing only what was copied keeps members added meanwhile; the
+		// set disappears once it is empty.
+		return c.client.SRem(ctx, oldKey, toInterfaces(members)...).Err()
+	default:
+		return fmt.Errorf("unexpected key type %s", keyType)
+	}
+
+	return nil
+}
+
+func toInterfaces(values []string) []interface{} {
+	out := make([]interface{}, len(values))
+	for i, v := range values {
+		out[i] = v
+	}
+	return out
+}
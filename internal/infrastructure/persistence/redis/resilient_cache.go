@@ -0,0 +1,359 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// ResilientCache keeps checkout and purchase working while Redis is down.
+// Bloom filter and checkout code lookups fall back to process-local maps;
+// counters and scripts cannot be emulated safely across instances, so they
+// return errors wrapping ports.ErrCacheUnavailable instead. Every method is
+// spelled out, so a method added to ports.Cache cannot reach Redis without
+// its outage handling being decided here.
+type ResilientCache struct {
+	cache *Cache
+
+	soldItems     sync.Map // item ID -> struct{}
+	checkoutCodes sync.Map // code -> expiry time.Time
+	logger        *logger.Logger
+}
+
+var _ ports.Cache = (*ResilientCache)(nil)
+
+func NewResilientCache(cache *Cache, log *logger.Logger) *ResilientCache {
+	return &ResilientCache{
+		cache:  cache,
+		logger: log,
+	}
+}
+
+func (c *ResilientCache) AddItemToBloomFilter(ctx context.Context, saleID, itemID string) error {
+	err := c.cache.AddItemToBloomFilter(ctx, saleID, itemID)
+	if !isConnectionError(err) {
+		return err
+	}
+
+	c.logger.Warn("Redis unavailable, recording sold item locally", "error", err.Error(), "item_id", itemID)
+	c.soldItems.Store(itemID, struct{}{})
+	return nil
+}
+
+func (c *ResilientCache) AddItemsToBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	err := c.cache.AddItemsToBloomFilter(ctx, saleID, itemIDs)
+	if !isConnectionError(err) {
+		return err
+	}
+
+	c.logger.Warn("Redis unavailable, recording sold items locally", "error", err.Error(), "count", len(itemIDs))
+	for _, itemID := range itemIDs {
+		c.soldItems.Store(itemID, struct{}{})
+	}
+	return nil
+}
+
+func (c *ResilientCache) RemoveItemFromBloomFilter(ctx context.Context, saleID, itemID string) error {
+	c.soldItems.Delete(itemID)
+	return c.cache.RemoveItemFromBloomFilter(ctx, saleID, itemID)
+}
+
+// ItemExistsInBloomFilter also consults items recorded locally during an
+// outage, since Redis never saw them.
+func (c *ResilientCache) ItemExistsInBloomFilter(ctx context.Context, saleID, itemID string) (bool, error) {
+	_, soldLocally := c.soldItems.Load(itemID)
+
+	exists, err := c.cache.ItemExistsInBloomFilter(ctx, saleID, itemID)
+	if isConnectionError(err) {
+		return soldLocally, unavailable(err)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return exists || soldLocally, nil
+}
+
+func (c *ResilientCache) ItemsExistInBloomFilter(ctx context.Context, saleID string, itemIDs []string) (map[string]bool, error) {
+	exists, err := c.cache.ItemsExistInBloomFilter(ctx, saleID, itemIDs)
+	if err != nil && !isConnectionError(err) {
+		return nil, err
+	}
+
+	if exists == nil {
+		exists = make(map[string]bool, len(itemIDs))
+	}
+	for _, itemID := range itemIDs {
+		if _, soldLocally := c.soldItems.Load(itemID); soldLocally {
+			exists[itemID] = true
+		}
+	}
+
+	if err != nil {
+		return exists, unavailable(err)
+	}
+	return exists, nil
+}
+
+func (c *ResilientCache) SetCheckoutCode(ctx context.Context, code string, expiration time.Duration) error {
+	err := c.cache.SetCheckoutCode(ctx, code, expiration)
+	if !isConnectionError(err) {
+		return err
+	}
+
+	c.logger.Warn("Redis unavailable, storing checkout code locally", "error", err.Error(), "code", code)
+	c.checkoutCodes.Store(code, time.Now().Add(expiration))
+	return nil
+}
+
+func (c *ResilientCache) CheckoutCodeExists(ctx context.Context, code string) (bool, error) {
+	exists, err := c.cache.CheckoutCodeExists(ctx, code)
+	if !isConnectionError(err) {
+		return exists, err
+	}
+
+	c.logger.Warn("Redis unavailable, checking checkout code locally", "error", err.Error(), "code", code)
+
+	expiry, ok := c.checkoutCodes.Load(code)
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(expiry.(time.Time)) {
+		c.checkoutCodes.Delete(code)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (c *ResilientCache) RemoveCheckoutCode(ctx context.Context, code string) error {
+	c.checkoutCodes.Delete(code)
+	return wrapUnavailable(c.cache.RemoveCheckoutCode(ctx, code))
+}
+
+func (c *ResilientCache) GetUserItemCount(ctx context.Context, saleID, userID string) (int, error) {
+	count, err := c.cache.GetUserItemCount(ctx, saleID, userID)
+	return count, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) IncrementUserItemCount(ctx context.Context, saleID, userID string) error {
+	return wrapUnavailable(c.cache.IncrementUserItemCount(ctx, saleID, userID))
+}
+
+func (c *ResilientCache) GetUserCheckoutCount(ctx context.Context, saleID, userID string) (int, error) {
+	count, err := c.cache.GetUserCheckoutCount(ctx, saleID, userID)
+	return count, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) IncrementUserCheckoutCount(ctx context.Context, saleID, userID string) error {
+	return wrapUnavailable(c.cache.IncrementUserCheckoutCount(ctx, saleID, userID))
+}
+
+func (c *ResilientCache) GetAvailableCheckoutSlots(ctx context.Context, saleID, userID string, maxItems int) (int, error) {
+	slots, err := c.cache.GetAvailableCheckoutSlots(ctx, saleID, userID, maxItems)
+	return slots, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) AtomicCheckoutReserve(ctx context.Context, saleID, userID string, count, maxItems int, expiration time.Duration) (bool, error) {
+	reserved, err := c.cache.AtomicCheckoutReserve(ctx, saleID, userID, count, maxItems, expiration)
+	return reserved, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) AtomicReserveCheckoutSlot(ctx context.Context, saleID, userID string, maxItems int, expiration time.Duration) (int, bool, error) {
+	remaining, reserved, err := c.cache.AtomicReserveCheckoutSlot(ctx, saleID, userID, maxItems, expiration)
+	return remaining, reserved, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) ReleaseCheckoutReservation(ctx context.Context, saleID, userID string, count int) error {
+	return wrapUnavailable(c.cache.ReleaseCheckoutReservation(ctx, saleID, userID, count))
+}
+
+func (c *ResilientCache) PublishItemSold(ctx context.Context, saleID, itemID string) error {
+	return wrapUnavailable(c.cache.PublishItemSold(ctx, saleID, itemID))
+}
+
+func (c *ResilientCache) SubscribeItemSold(ctx context.Context, saleID string) (<-chan string, error) {
+	itemIDs, err := c.cache.SubscribeItemSold(ctx, saleID)
+	return itemIDs, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) WarmBloomFilter(ctx context.Context, saleID string, itemIDs []string) error {
+	return wrapUnavailable(c.cache.WarmBloomFilter(ctx, saleID, itemIDs))
+}
+
+func (c *ResilientCache) ResetBloomFilterForSale(ctx context.Context, saleID string) error {
+	return wrapUnavailable(c.cache.ResetBloomFilterForSale(ctx, saleID))
+}
+
+func (c *ResilientCache) PurgeSaleData(ctx context.Context, saleID string) error {
+	return wrapUnavailable(c.cache.PurgeSaleData(ctx, saleID))
+}
+
+func (c *ResilientCache) IncrementSaleItemsSold(ctx context.Context, saleID string, count int) error {
+	return wrapUnavailable(c.cache.IncrementSaleItemsSold(ctx, saleID, count))
+}
+
+func (c *ResilientCache) GetSaleItemsSold(ctx context.Context, saleID string) (int, error) {
+	count, err := c.cache.GetSaleItemsSold(ctx, saleID)
+	return count, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetSaleItemCount(ctx context.Context, saleID string, count int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetSaleItemCount(ctx, saleID, count, expiration))
+}
+
+func (c *ResilientCache) GetSaleItemCount(ctx context.Context, saleID string) (int, error) {
+	count, err := c.cache.GetSaleItemCount(ctx, saleID)
+	return count, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) IncrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
+	return wrapUnavailable(c.cache.IncrementCounters(ctx, saleID, userID, itemCount))
+}
+
+func (c *ResilientCache) DecrementCounters(ctx context.Context, saleID, userID string, itemCount int) error {
+	return wrapUnavailable(c.cache.DecrementCounters(ctx, saleID, userID, itemCount))
+}
+
+func (c *ResilientCache) DecrementSaleRemaining(ctx context.Context, saleID string, count int) error {
+	return wrapUnavailable(c.cache.DecrementSaleRemaining(ctx, saleID, count))
+}
+
+func (c *ResilientCache) AtomicPurchaseCheck(ctx context.Context, saleID, userID string, itemCount int, maxSaleItems, maxUserItems int) (bool, error) {
+	ok, err := c.cache.AtomicPurchaseCheck(ctx, saleID, userID, itemCount, maxSaleItems, maxUserItems)
+	return ok, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) AtomicUserLimitCheck(ctx context.Context, saleID, userID string, itemCount, maxItems int) (bool, error) {
+	ok, err := c.cache.AtomicUserLimitCheck(ctx, saleID, userID, itemCount, maxItems)
+	return ok, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) AtomicSaleLimitCheck(ctx context.Context, saleID string, itemCount, maxItems int) (bool, error) {
+	ok, err := c.cache.AtomicSaleLimitCheck(ctx, saleID, itemCount, maxItems)
+	return ok, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetUserItemCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetUserItemCount(ctx, saleID, userID, count, expiration))
+}
+
+func (c *ResilientCache) SetUserCheckoutCount(ctx context.Context, saleID, userID string, count int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetUserCheckoutCount(ctx, saleID, userID, count, expiration))
+}
+
+func (c *ResilientCache) GetUserCheckoutCode(ctx context.Context, saleID, userID string) (string, error) {
+	code, err := c.cache.GetUserCheckoutCode(ctx, saleID, userID)
+	return code, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetUserCheckoutCode(ctx context.Context, saleID, userID, code string, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetUserCheckoutCode(ctx, saleID, userID, code, expiration))
+}
+
+func (c *ResilientCache) RemoveUserCheckoutCode(ctx context.Context, saleID, userID string) error {
+	return wrapUnavailable(c.cache.RemoveUserCheckoutCode(ctx, saleID, userID))
+}
+
+func (c *ResilientCache) ExtendSaleCheckoutTTLs(ctx context.Context, saleID string, oldExpiry, newExpiry time.Time) error {
+	return wrapUnavailable(c.cache.ExtendSaleCheckoutTTLs(ctx, saleID, oldExpiry, newExpiry))
+}
+
+func (c *ResilientCache) HasUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string) (bool, error) {
+	checkedOut, err := c.cache.HasUserCheckedOutItem(ctx, saleID, userID, itemID)
+	return checkedOut, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) AddUserCheckedOutItem(ctx context.Context, saleID, userID, itemID string, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.AddUserCheckedOutItem(ctx, saleID, userID, itemID, expiration))
+}
+
+func (c *ResilientCache) GetSaleTotalItems(ctx context.Context, saleID string) (int, bool, error) {
+	total, found, err := c.cache.GetSaleTotalItems(ctx, saleID)
+	return total, found, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetSaleTotalItems(ctx context.Context, saleID string, totalItems int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetSaleTotalItems(ctx, saleID, totalItems, expiration))
+}
+
+func (c *ResilientCache) GetSaleQuota(ctx context.Context, saleID string) (int, bool, error) {
+	quota, found, err := c.cache.GetSaleQuota(ctx, saleID)
+	return quota, found, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetSaleQuota(ctx context.Context, saleID string, quota int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetSaleQuota(ctx, saleID, quota, expiration))
+}
+
+func (c *ResilientCache) GetSaleRemaining(ctx context.Context, saleID string) (int, bool, error) {
+	remaining, found, err := c.cache.GetSaleRemaining(ctx, saleID)
+	return remaining, found, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) SetSaleRemaining(ctx context.Context, saleID string, remaining int, expiration time.Duration) error {
+	return wrapUnavailable(c.cache.SetSaleRemaining(ctx, saleID, remaining, expiration))
+}
+
+func (c *ResilientCache) BeginIdempotentPurchase(ctx context.Context, key, code string, ttl time.Duration) (*ports.IdempotentPurchase, bool, error) {
+	stored, begun, err := c.cache.BeginIdempotentPurchase(ctx, key, code, ttl)
+	return stored, begun, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) CompleteIdempotentPurchase(ctx context.Context, key string, purchase *ports.IdempotentPurchase, ttl time.Duration) error {
+	return wrapUnavailable(c.cache.CompleteIdempotentPurchase(ctx, key, purchase, ttl))
+}
+
+func (c *ResilientCache) AbortIdempotentPurchase(ctx context.Context, key, code string) error {
+	return wrapUnavailable(c.cache.AbortIdempotentPurchase(ctx, key, code))
+}
+
+// DistributedLock, ReleaseLock and TryLockWithHeartbeat have no local
+// fallback: a lock only one instance can see would not exclude the others.
+func (c *ResilientCache) DistributedLock(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	acquired, err := c.cache.DistributedLock(ctx, key, expiration)
+	return acquired, wrapUnavailable(err)
+}
+
+func (c *ResilientCache) ReleaseLock(ctx context.Context, key string) error {
+	return wrapUnavailable(c.cache.ReleaseLock(ctx, key))
+}
+
+func (c *ResilientCache) TryLockWithHeartbeat(ctx context.Context, key string, ttl time.Duration) (context.Context, context.CancelFunc, error) {
+	lockCtx, unlock, err := c.cache.TryLockWithHeartbeat(ctx, key, ttl)
+	return lockCtx, unlock, wrapUnavailable(err)
+}
+
+func wrapUnavailable(err error) error {
+	if isConnectionError(err) {
+		return unavailable(err)
+	}
+	return err
+}
+
+func unavailable(err error) error {
+	return fmt.Errorf("%w: %v", ports.ErrCacheUnavailable, err)
+}
+
+func isConnectionError(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, redis.ErrClosed) ||
+		errors.Is(err, redis.ErrPoolTimeout)
+}
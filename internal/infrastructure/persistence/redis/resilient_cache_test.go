@@ -0,0 +1,96 @@
+package redis_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// Methods without a local fallback must report the outage as
+// ports.ErrCacheUnavailable, which callers check to degrade gracefully.
+func TestResilientCacheReportsOutage(t *testing.T) {
+	ctx := context.Background()
+	inner, server := newMiniredisCache(t)
+	cache := redis.NewResilientCache(inner, logger.NewLogger())
+	server.Close()
+
+	const saleID, userID = "S-outage", "user-1"
+	calls := map[string]func() error{
+		"TryLockWithHeartbeat": func() error {
+			_, _, err := cache.TryLockWithHeartbeat(ctx, "purchase:CHK-1", time.Second)
+			return err
+		},
+		"DistributedLock": func() error {
+			_, err := cache.DistributedLock(ctx, "scheduler", time.Second)
+			return err
+		},
+		"ReleaseLock": func() error {
+			return cache.ReleaseLock(ctx, "scheduler")
+		},
+		"BeginIdempotentPurchase": func() error {
+			_, _, err := cache.BeginIdempotentPurchase(ctx, "key", "CHK-1", time.Minute)
+			return err
+		},
+		"CompleteIdempotentPurchase": func() error {
+			return cache.CompleteIdempotentPurchase(ctx, "key", &ports.IdempotentPurchase{Code: "CHK-1"}, time.Minute)
+		},
+		"GetUserCheckoutCode": func() error {
+			_, err := cache.GetUserCheckoutCode(ctx, saleID, userID)
+			return err
+		},
+		"SetUserCheckoutCode": func() error {
+			return cache.SetUserCheckoutCode(ctx, saleID, userID, "CHK-1", time.Minute)
+		},
+		"HasUserCheckedOutItem": func() error {
+			_, err := cache.HasUserCheckedOutItem(ctx, saleID, userID, "item-1")
+			return err
+		},
+		"GetSaleRemaining": func() error {
+			_, _, err := cache.GetSaleRemaining(ctx, saleID)
+			return err
+		},
+		"AtomicPurchaseCheck": func() error {
+			_, err := cache.AtomicPurchaseCheck(ctx, saleID, userID, 1, 10, 10)
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, ports.ErrCacheUnavailable) {
+				t.Errorf("error = %v, want ErrCacheUnavailable", err)
+			}
+		})
+	}
+}
+
+func TestResilientCacheFallsBackLocally(t *testing.T) {
+	ctx := context.Background()
+	inner, server := newMiniredisCache(t)
+	cache := redis.NewResilientCache(inner, logger.NewLogger())
+	server.Close()
+
+	if err := cache.AddItemToBloomFilter(ctx, "S-outage", "item-1"); err != nil {
+		t.Fatalf("AddItemToBloomFilter: %v", err)
+	}
+	sold, err := cache.ItemExistsInBloomFilter(ctx, "S-outage", "item-1")
+	if !sold {
+		t.Error("item recorded during the outage is not reported as sold")
+	}
+	if !ports.IsTemporaryError(err) {
+		t.Errorf("error = %v, want a temporary error", err)
+	}
+
+	if err := cache.SetCheckoutCode(ctx, "CHK-1", time.Minute); err != nil {
+		t.Fatalf("SetCheckoutCode: %v", err)
+	}
+	exists, err := cache.CheckoutCodeExists(ctx, "CHK-1")
+	if err != nil || !exists {
+		t.Errorf("CheckoutCodeExists = %v, %v; want the locally stored code", exists, err)
+	}
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/events"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// OutboxPublisher delivers the events stored in the outbox table to the
+// event bus. Delivery is at least once: an event whose row could not be
+// marked published is sent again on a later poll.
+type OutboxPublisher struct {
+	outboxRepo *postgres.OutboxRepository
+	bus        ports.EventBus
+	logger     *logger.Logger
+	interval   time.Duration
+	batchSize  int
+	stopChan   chan struct{}
+}
+
+func NewOutboxPublisher(
+	outboxRepo *postgres.OutboxRepository,
+	bus ports.EventBus,
+	logger *logger.Logger,
+	interval time.Duration,
+	batchSize int,
+) *OutboxPublisher {
+	return &OutboxPublisher{
+		outboxRepo: outboxRepo,
+		bus:        bus,
+		logger:     logger,
+		interval:   interval,
+		batchSize:  batchSize,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+func (p *OutboxPublisher) Start(ctx context.Context) {
+	p.logger.Info("Starting outbox publisher", "interval", p.interval.String(), "batch_size", p.batchSize)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("Outbox publisher stopped")
+			return
+		case <-p.stopChan:
+			p.logger.Info("Outbox publisher stopped")
+			return
+		case <-ticker.C:
+			if err := p.drain(ctx); err != nil {
+				p.logger.Error("Failed to publish outbox events", "error", err)
+			}
+		}
+	}
+}
+
+func (p *OutboxPublisher) Stop() {
+	close(p.stopChan)
+}
+
+// drain publishes full batches back to back so a backlog clears without
+// waiting a poll interval per batch.
+func (p *OutboxPublisher) drain(ctx context.Context) error {
+	for {
+		published, err := p.outboxRepo.PublishPending(ctx, p.batchSize, func(row postgres.OutboxEvent) error {
+			return p.publish(ctx, row)
+		})
+		if published > 0 {
+			p.logger.Debug("Published outbox events", "count", published)
+		}
+		if err != nil || published < p.batchSize {
+			return err
+		}
+	}
+}
+
+func (p *OutboxPublisher) publish(ctx context.Context, row postgres.OutboxEvent) error {
+	event, err := events.Decode(row.EventType, row.Payload)
+	if err != nil {
+		// A row that can never be decoded would block every event behind
+		// it, so it is logged and marked published.
+		p.logger.Error("Dropping undecodable outbox event", "id", row.ID, "event_type", row.EventType, "error", err)
+		return nil
+	}
+
+	if err := p.bus.Publish(ctx, event); err != nil {
+		return fmt.Errorf("outbox event %d: %w", row.ID, err)
+	}
+	return nil
+}
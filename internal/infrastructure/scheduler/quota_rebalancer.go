@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/config"
+	domainErrors "github.com/yuzvak/flashsale-service/internal/domain/errors"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+// QuotaRebalancer keeps this region's quota lease alive and pulls unused
+// quota from other regions when the local lease is nearly exhausted.
+type QuotaRebalancer struct {
+	saleRepo  *postgres.SaleRepository
+	leaseRepo *postgres.QuotaLeaseRepository
+	cache     ports.Cache
+	logger    *logger.Logger
+	cfg       config.RegionConfig
+	stopChan  chan struct{}
+}
+
+func NewQuotaRebalancer(
+	saleRepo *postgres.SaleRepository,
+	leaseRepo *postgres.QuotaLeaseRepository,
+	cache ports.Cache,
+	logger *logger.Logger,
+	cfg config.RegionConfig,
+) *QuotaRebalancer {
+	if cfg.LeaseTTLSeconds <= 0 {
+		cfg.LeaseTTLSeconds = 60
+	}
+	if cfg.RebalanceIntervalSeconds <= 0 {
+		cfg.RebalanceIntervalSeconds = 10
+	}
+	if cfg.RebalanceThreshold <= 0 {
+		cfg.RebalanceThreshold = 0.8
+	}
+	if cfg.RebalanceChunk <= 0 {
+		cfg.RebalanceChunk = 500
+	}
+
+	return &QuotaRebalancer{
+		saleRepo:  saleRepo,
+		leaseRepo: leaseRepo,
+		cache:     cache,
+		logger:    logger,
+		cfg:       cfg,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+func (q *QuotaRebalancer) Start(ctx context.Context) {
+	q.logger.Info("Starting quota rebalancer", "region", q.cfg.ID)
+
+	if err := q.rebalance(ctx); err != nil {
+		q.logger.Error("Failed to rebalance quota", "error", err)
+	}
+
+	ticker := time.NewTicker(time.Duration(q.cfg.RebalanceIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.logger.Info("Quota rebalancer stopped")
+			return
+		case <-q.stopChan:
+			q.logger.Info("Quota rebalancer stopped")
+			return
+		case <-ticker.C:
+			if err := q.rebalance(ctx); err != nil {
+				q.logger.Error("Failed to rebalance quota", "error", err)
+			}
+		}
+	}
+}
+
+func (q *QuotaRebalancer) Stop() {
+	close(q.stopChan)
+}
+
+func (q *QuotaRebalancer) rebalance(ctx context.Context) error {
+	activeSale, err := q.saleRepo.GetActiveSaleFromPrimary(ctx)
+	if err != nil {
+		if errors.Is(err, domainErrors.ErrSaleNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	ttl := time.Duration(q.cfg.LeaseTTLSeconds) * time.Second
+	region := q.cfg.ID
+
+	if err := q.leaseRepo.EnsureLeases(ctx, activeSale.ID, activeSale.TotalItems, q.cfg.Split, ttl); err != nil {
+		return err
+	}
+
+	used, err := q.cache.GetSaleItemCount(ctx, activeSale.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := q.leaseRepo.RenewLease(ctx, activeSale.ID, region, used, ttl); err != nil {
+		return err
+	}
+
+	reclaimed, err := q.leaseRepo.ReclaimExpiredQuota(ctx, activeSale.ID, region)
+	if err != nil {
+		return err
+	}
+	for fromRegion, amount := range reclaimed {
+		q.logger.Warn("Reclaimed quota from expired lease", "sale_id", activeSale.ID, "from_region", fromRegion, "amount", amount)
+	}
+
+	leases, err := q.leaseRepo.GetLeasesBySaleID(ctx, activeSale.ID)
+	if err != nil {
+		return err
+	}
+
+	own := findLease(leases, region)
+	if own == nil {
+		return domainErrors.ErrQuotaLeaseNotFound
+	}
+
+	if own.Utilization() >= q.cfg.RebalanceThreshold {
+		if donor := q.pickDonor(leases); donor != nil {
+			amount := donor.Unused() / 2
+			if amount > q.cfg.RebalanceChunk {
+				amount = q.cfg.RebalanceChunk
+			}
+
+			moved, err := q.leaseRepo.TransferQuota(ctx, activeSale.ID, donor.Region, region, amount)
+			if err != nil {
+				return err
+			}
+			if moved > 0 {
+				q.logger.Info("Moved quota between regions", "sale_id", activeSale.ID, "from_region", donor.Region, "to_region", region, "amount", moved)
+
+				own, err = q.leaseRepo.GetLease(ctx, activeSale.ID, region)
+				if err != nil {
+					return err
+				}
+				leases, err = q.leaseRepo.GetLeasesBySaleID(ctx, activeSale.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := q.cache.SetSaleQuota(ctx, activeSale.ID, own.Quota, time.Until(activeSale.EndedAt)); err != nil {
+		return err
+	}
+
+	for _, lease := range leases {
+		monitoring.UpdateQuotaLease(lease.Region, lease.Quota, lease.Used, lease.Utilization())
+	}
+
+	return nil
+}
+
+func (q *QuotaRebalancer) pickDonor(leases []*sale.QuotaLease) *sale.QuotaLease {
+	now := time.Now().UTC()
+
+	var donor *sale.QuotaLease
+	for _, lease := range leases {
+		if lease.Region == q.cfg.ID || lease.IsExpired(now) {
+			continue
+		}
+		if lease.Utilization() >= q.cfg.RebalanceThreshold || lease.Unused() < 2 {
+			continue
+		}
+		if donor == nil || lease.Unused() > donor.Unused() {
+			donor = lease
+		}
+	}
+
+	return donor
+}
+
+func findLease(leases []*sale.QuotaLease, region string) *sale.QuotaLease {
+	for _, lease := range leases {
+		if lease.Region == region {
+			return lease
+		}
+	}
+	return nil
+}
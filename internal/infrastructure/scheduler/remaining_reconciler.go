@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+type RemainingReconciler struct {
+	saleRepo *postgres.SaleRepository
+	cache    ports.Cache
+	logger   *logger.Logger
+	interval time.Duration
+	stopChan chan struct{}
+}
+
+func NewRemainingReconciler(
+	saleRepo *postgres.SaleRepository,
+	cache ports.Cache,
+	logger *logger.Logger,
+	interval time.Duration,
+) *RemainingReconciler {
+	return &RemainingReconciler{
+		saleRepo: saleRepo,
+		cache:    cache,
+		logger:   logger,
+		interval: interval,
+		stopChan: make(chan struct{}),
+	}
+}
+
+func (r *RemainingReconciler) Start(ctx context.Context) {
+	r.logger.Info("Starting remaining items reconciler", "interval", r.interval.String())
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Remaining items reconciler stopped")
+			return
+		case <-r.stopChan:
+			r.logger.Info("Remaining items reconciler stopped")
+			return
+		case <-ticker.C:
+			if err := r.reconcile(ctx); err != nil {
+				r.logger.Error("Failed to reconcile remaining items", "error", err)
+			}
+		}
+	}
+}
+
+func (r *RemainingReconciler) Stop() {
+	close(r.stopChan)
+}
+
+// reconcilePageSize is how many active sales are read per query.
+const reconcilePageSize = 100
+
+// reconcile refreshes the cached remaining count of every active sale. A
+// sale that fails is logged and skipped so the others are still corrected.
+func (r *RemainingReconciler) reconcile(ctx context.Context) error {
+	afterID := ""
+	for {
+		sales, err := r.saleRepo.ListSales(ctx, postgres.SaleStatusActive, afterID, reconcilePageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, activeSale := range sales {
+			if err := r.reconcileSale(ctx, activeSale); err != nil {
+				r.logger.Error("Failed to reconcile remaining items", "error", err, "sale_id", activeSale.ID)
+			}
+		}
+
+		if len(sales) < reconcilePageSize {
+			return nil
+		}
+		afterID = sales[len(sales)-1].ID
+	}
+}
+
+func (r *RemainingReconciler) reconcileSale(ctx context.Context, activeSale *sale.Sale) error {
+	remaining := activeSale.TotalItems - activeSale.ItemsSold
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	cached, found, err := r.cache.GetSaleRemaining(ctx, activeSale.ID)
+	if err != nil {
+		return err
+	}
+
+	if found && cached != remaining {
+		r.logger.Warn("Remaining items drift detected", "sale_id", activeSale.ID, "cached", cached, "actual", remaining)
+	}
+
+	return r.cache.SetSaleRemaining(ctx, activeSale.ID, remaining, time.Until(activeSale.EndedAt))
+}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/use_cases"
+	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/redis"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/fixtures"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+// The cached remaining count follows concurrent purchases, and the
+// reconciler keeps it in line with the sale's row.
+func TestRemainingCountAfterConcurrentPurchases(t *testing.T) {
+	const buyers = 10
+
+	ctx := context.Background()
+	conn := integration.Postgres(t)
+	cache := redis.NewCache(integration.Redis(t), config.CacheConfig{}, config.BloomFilterConfig{}, logger.NewLogger())
+	saleRepo := postgres.NewSaleRepository(conn)
+	checkoutRepo := postgres.NewCheckoutRepository(conn)
+
+	s, items := integration.SeedSale(t, conn, fixtures.NewSaleBuilder().
+		Active(clock.NewRealClock()).
+		WithItems(buyers).
+		WithLimits(1, buyers))
+	t.Cleanup(func() { _ = cache.PurgeSaleData(context.Background(), s.ID) })
+
+	if err := cache.SetSaleRemaining(ctx, s.ID, s.TotalItems, time.Until(s.EndedAt)); err != nil {
+		t.Fatalf("SetSaleRemaining: %v", err)
+	}
+
+	codes := make([]string, buyers)
+	for i, item := range items {
+		codes[i] = fmt.Sprintf("CHK-%s-%016d", s.ID, i)
+		checkout := fixtures.NewCheckoutBuilder().
+			WithCode(codes[i]).
+			ForSale(s.ID).
+			ForUser(fmt.Sprintf("user_%d", i)).
+			WithItems(item.ID).
+			CreatedAt(time.Now().UTC()).
+			Build()
+		if err := checkoutRepo.CreateCheckout(ctx, checkout); err != nil {
+			t.Fatalf("CreateCheckout: %v", err)
+		}
+	}
+	integration.DeletePurchaseResultsOnCleanup(t, conn, codes...)
+
+	uc := use_cases.NewPurchaseUseCase(saleRepo, checkoutRepo, cache, logger.NewLogger())
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, code := range codes {
+		wg.Add(1)
+		go func(code string) {
+			defer wg.Done()
+			<-start
+			// Purchases that fail to serialize leave the count alone; the
+			// count is checked against what the database holds.
+			_, _ = uc.ExecutePurchase(ctx, code)
+		}(code)
+	}
+	close(start)
+	wg.Wait()
+
+	assertRemaining := func(when string) {
+		t.Helper()
+
+		stored, err := saleRepo.GetSaleByID(ctx, s.ID)
+		if err != nil {
+			t.Fatalf("GetSaleByID: %v", err)
+		}
+		if stored.ItemsSold == 0 {
+			t.Fatal("no purchase went through")
+		}
+		remaining, found, err := cache.GetSaleRemaining(ctx, s.ID)
+		if err != nil || !found {
+			t.Fatalf("GetSaleRemaining %s = %d, %v, %v", when, remaining, found, err)
+		}
+		if want := stored.TotalItems - stored.ItemsSold; remaining != want {
+			t.Errorf("remaining %s = %d, want %d (%d items, %d sold)", when, remaining, want, stored.TotalItems, stored.ItemsSold)
+		}
+	}
+	assertRemaining("after the purchases")
+
+	// Drift is corrected on the reconciler's next run.
+	if err := cache.SetSaleRemaining(ctx, s.ID, s.TotalItems, time.Until(s.EndedAt)); err != nil {
+		t.Fatalf("SetSaleRemaining: %v", err)
+	}
+	reconciler := NewRemainingReconciler(saleRepo, cache, logger.NewLogger(), time.Minute)
+	if err := reconciler.reconcile(ctx); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	assertRemaining("after reconciling")
+}
@@ -2,48 +2,101 @@ package scheduler
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
 	"time"
 
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/config"
 	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
 	"github.com/yuzvak/flashsale-service/internal/pkg/generator"
 	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
 )
 
+const (
+	expiredCheckoutCleanupInterval = 15 * time.Minute
+	// expiredCheckoutAge is when checkouts created before expires_at was
+	// recorded are deleted. It is well past any checkout code TTL, so none
+	// of them can still be purchased.
+	expiredCheckoutAge = 24 * time.Hour
+	// endedSaleCleanupBatch caps how many ended sales one tick purges, so a
+	// backlog after downtime is worked off over several ticks.
+	endedSaleCleanupBatch = 20
+
+	// schedulerLockID is the Postgres advisory lock key shared by the
+	// scheduler of every replica.
+	schedulerLockID = 12345
+
+	// preWarmSaleLimit caps how many upcoming sales are warmed per tick.
+	preWarmSaleLimit = 100
+
+	createSaleLockKey = "scheduler:create_sale"
+	createSaleLockTTL = 30 * time.Second
+)
+
 type SaleScheduler struct {
+	db            *sql.DB
 	saleRepo      *postgres.SaleRepository
+	checkoutRepo  ports.CheckoutRepository
+	cache         ports.Cache
 	itemGenerator *generator.ItemGenerator
 	codeGenerator *generator.CodeGenerator
 	logger        *logger.Logger
+	interval      time.Duration
 	totalItems    int
+	saleDuration  time.Duration
+	preWarm       time.Duration
 	stopChan      chan struct{}
+	state         schedulerState
+
+	// lockConn pins the session holding the advisory lock, since the lock
+	// belongs to a single connection rather than to the pool.
+	lockConn *sql.Conn
 }
 
 func NewSaleScheduler(
+	cfg *config.Config,
+	db *sql.DB,
 	saleRepo *postgres.SaleRepository,
+	checkoutRepo ports.CheckoutRepository,
+	cache ports.Cache,
 	logger *logger.Logger,
-	totalItems int,
 ) *SaleScheduler {
 	return &SaleScheduler{
+		db:            db,
 		saleRepo:      saleRepo,
+		checkoutRepo:  checkoutRepo,
+		cache:         cache,
 		itemGenerator: generator.NewItemGenerator(),
-		codeGenerator: generator.NewCodeGenerator(),
+		codeGenerator: generator.NewCodeGenerator(nil, ""),
 		logger:        logger,
-		totalItems:    totalItems,
+		interval:      cfg.Scheduler.Interval(),
+		totalItems:    cfg.Scheduler.ItemsPerSale(),
+		saleDuration:  cfg.Scheduler.SaleDuration(),
+		preWarm:       cfg.Scheduler.PreWarmWindow(),
 		stopChan:      make(chan struct{}),
+		state:         schedulerState{status: SchedulerStatus{Interval: cfg.Scheduler.Interval()}},
 	}
 }
 
 func (s *SaleScheduler) Start(ctx context.Context) {
 	s.logger.Info("Starting sale scheduler")
-	
-	if err := s.createSaleIfNeeded(ctx); err != nil {
+	s.state.setRunning(true, time.Time{})
+	defer s.state.setRunning(false, time.Time{})
+
+	if err := s.runCreateSale(ctx); err != nil {
 		s.logger.Error("Failed to create initial sale", "error", err)
 	}
+	s.preWarmUpcomingSales(ctx)
 
-	ticker := time.NewTicker(time.Hour)
+	ticker := time.NewTicker(s.interval)
 	defer ticker.Stop()
 
+	cleanupTicker := time.NewTicker(expiredCheckoutCleanupInterval)
+	defer cleanupTicker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -53,9 +106,13 @@ func (s *SaleScheduler) Start(ctx context.Context) {
 			s.logger.Info("Sale scheduler stopped")
 			return
 		case <-ticker.C:
-			if err := s.createSaleIfNeeded(ctx); err != nil {
+			s.cleanupEndedSales(ctx)
+			if err := s.runCreateSale(ctx); err != nil {
 				s.logger.Error("Failed to create scheduled sale", "error", err)
 			}
+			s.preWarmUpcomingSales(ctx)
+		case <-cleanupTicker.C:
+			s.deleteExpiredCheckouts(ctx)
 		}
 	}
 }
@@ -64,16 +121,109 @@ func (s *SaleScheduler) Stop() {
 	close(s.stopChan)
 }
 
+// Status reports whether the scheduler is running and how its latest sale
+// creation run went. It is safe to call from any goroutine.
+func (s *SaleScheduler) Status() SchedulerStatus {
+	return s.state.snapshot()
+}
+
+func (s *SaleScheduler) runCreateSale(ctx context.Context) error {
+	now := time.Now().UTC()
+	err := s.createSaleWithLock(ctx)
+	s.state.recordRun(now, err, now.Add(s.interval))
+	return err
+}
+
+// createSaleWithLock runs createSaleIfNeeded on at most one replica at a
+// time; the others skip the tick instead of racing on the active sale check.
+// The Redis lock turns most conflicts away without touching the database.
+// It is not required: when Redis is down the advisory lock alone decides.
+func (s *SaleScheduler) createSaleWithLock(ctx context.Context) error {
+	lockCtx, unlock, err := s.cache.TryLockWithHeartbeat(ctx, createSaleLockKey, createSaleLockTTL)
+	switch {
+	case err == ports.ErrLockNotAcquired:
+		monitoring.SchedulerLockConflictsTotal.Inc()
+		s.logger.Debug("Sale creation lock held by another instance, skipping sale creation")
+		return nil
+	case err != nil:
+		s.logger.Warn("Failed to acquire sale creation lock, relying on the advisory lock", "error", err)
+	default:
+		defer unlock()
+		ctx = lockCtx
+	}
+
+	acquired, err := s.acquireSchedulerLock(ctx)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		monitoring.SchedulerLockConflictsTotal.Inc()
+		s.logger.Info("Scheduler lock held by another instance, skipping sale creation")
+		return nil
+	}
+	defer s.releaseSchedulerLock()
+
+	return s.createSaleIfNeeded(ctx)
+}
+
+func (s *SaleScheduler) acquireSchedulerLock(ctx context.Context) (bool, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", schedulerLockID).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	s.lockConn = conn
+	return true, nil
+}
+
+func (s *SaleScheduler) releaseSchedulerLock() {
+	conn := s.lockConn
+	s.lockConn = nil
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", schedulerLockID); err != nil {
+		s.logger.Error("Failed to release scheduler lock", "error", err)
+		// Drop the connection rather than return a session still holding
+		// the lock to the pool; closing it releases the lock server-side.
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+}
+
+// saleWindow returns when a sale created at now runs. Sales start on the
+// interval's boundary, unless a sale shorter than the interval would then
+// have ended already; those start on the current minute instead.
+func saleWindow(now time.Time, interval, duration time.Duration) (time.Time, time.Time) {
+	startedAt := now.Truncate(interval)
+	if !startedAt.Add(duration).After(now) {
+		startedAt = now.Truncate(time.Minute)
+	}
+	return startedAt, startedAt.Add(duration)
+}
+
 func (s *SaleScheduler) createSaleIfNeeded(ctx context.Context) error {
-	activeSale, err := s.saleRepo.GetActiveSale(ctx)
+	activeSale, err := s.saleRepo.GetActiveSaleFromPrimary(ctx)
 	if err == nil && activeSale != nil {
 		s.logger.Info("Active sale already exists", "sale_id", activeSale.ID)
+
+		// After a restart the sale's filter may be empty or missing items
+		// sold while Redis was unavailable.
+		if _, err := s.warmBloomFilter(ctx, activeSale); err != nil {
+			s.logger.Error("Failed to warm bloom filter for active sale", "error", err, "sale_id", activeSale.ID)
+		}
 		return nil
 	}
 
-	now := time.Now().UTC()
-	startedAt := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, time.UTC)
-	endedAt := startedAt.Add(time.Hour)
+	startedAt, endedAt := saleWindow(time.Now().UTC(), s.interval, s.saleDuration)
 
 	saleID := s.codeGenerator.GenerateSaleID()
 
@@ -84,6 +234,9 @@ func (s *SaleScheduler) createSaleIfNeeded(ctx context.Context) error {
 		TotalItems: s.totalItems,
 		ItemsSold:  0,
 		CreatedAt:  time.Now(),
+
+		MaxItemsPerUser: sale.DefaultMaxItemsPerUser,
+		MaxItemsPerSale: sale.DefaultMaxItemsPerSale,
 	}
 
 	err = s.saleRepo.CreateSale(ctx, &newSale)
@@ -98,15 +251,134 @@ func (s *SaleScheduler) createSaleIfNeeded(ctx context.Context) error {
 			newSale.ID,
 			s.itemGenerator.GenerateName(),
 			s.itemGenerator.GenerateImageURL(),
+			s.itemGenerator.GeneratePrice(),
 		)
 		items = append(items, item)
 	}
 
-	err = s.saleRepo.CreateItems(ctx, items)
+	err = s.saleRepo.CreateItemsWithCopy(ctx, items)
 	if err != nil {
 		return err
 	}
 
+	// Leftovers under this sale's key, e.g. from a partially failed earlier
+	// attempt, would otherwise report its items as sold.
+	if err := s.cache.ResetBloomFilterForSale(ctx, newSale.ID); err != nil {
+		s.logger.Error("Failed to reset bloom filter for new sale", "error", err, "sale_id", saleID)
+	}
+
+	if err := s.warmCache(ctx, &newSale); err != nil {
+		s.logger.Error("Failed to warm cache for new sale", "error", err, "sale_id", saleID)
+	}
+
 	s.logger.Info("Created new sale", "sale_id", saleID, "started_at", startedAt, "ended_at", endedAt, "total_items", s.totalItems)
 	return nil
-}
\ No newline at end of file
+}
+
+// warmCache seeds the sale's Redis counters and bloom filter so the first
+// requests of a sale do not all fall through to the database. Counters are
+// written explicitly, including zero, rather than left missing.
+func (s *SaleScheduler) warmCache(ctx context.Context, newSale *sale.Sale) error {
+	ttl := time.Until(newSale.EndedAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	soldItemIDs, err := s.warmBloomFilter(ctx, newSale)
+	if err != nil {
+		return err
+	}
+
+	if err := s.cache.SetSaleItemCount(ctx, newSale.ID, len(soldItemIDs), ttl); err != nil {
+		return err
+	}
+
+	if err := s.cache.SetSaleTotalItems(ctx, newSale.ID, newSale.TotalItems, ttl); err != nil {
+		return err
+	}
+
+	remaining := newSale.TotalItems - len(soldItemIDs)
+	if remaining < 0 {
+		remaining = 0
+	}
+	if err := s.cache.SetSaleRemaining(ctx, newSale.ID, remaining, ttl); err != nil {
+		return err
+	}
+
+	s.logger.Info("Warmed cache for sale", "sale_id", newSale.ID, "sold_items", len(soldItemIDs))
+	return nil
+}
+
+// preWarmUpcomingSales warms the cache of sales starting within the
+// pre-warm window, so their opening burst does not land on the database.
+func (s *SaleScheduler) preWarmUpcomingSales(ctx context.Context) {
+	upcoming, err := s.saleRepo.GetUpcomingSales(ctx, time.Now().UTC().Add(s.preWarm), preWarmSaleLimit)
+	if err != nil {
+		s.logger.Error("Failed to get upcoming sales to pre-warm", "error", err)
+		return
+	}
+
+	for _, upcomingSale := range upcoming {
+		if err := s.warmCache(ctx, upcomingSale); err != nil {
+			s.logger.Error("Failed to pre-warm cache for upcoming sale", "error", err, "sale_id", upcomingSale.ID)
+		}
+	}
+}
+
+// warmBloomFilter loads the sale's sold items from the database into its
+// bloom filter and returns them.
+func (s *SaleScheduler) warmBloomFilter(ctx context.Context, saleEntity *sale.Sale) ([]string, error) {
+	soldItemIDs, err := s.saleRepo.GetSoldItemIDsBySaleID(ctx, saleEntity.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(soldItemIDs) == 0 && saleEntity.ItemsSold > 0 {
+		s.logger.Warn("Sale reports sold items but none were found to warm the bloom filter",
+			"sale_id", saleEntity.ID, "items_sold", saleEntity.ItemsSold)
+	}
+
+	if err := s.cache.WarmBloomFilter(ctx, saleEntity.ID, soldItemIDs); err != nil {
+		return nil, err
+	}
+	return soldItemIDs, nil
+}
+
+func (s *SaleScheduler) deleteExpiredCheckouts(ctx context.Context) {
+	deleted, err := s.checkoutRepo.DeleteExpiredCheckouts(ctx, expiredCheckoutAge)
+	if err != nil {
+		s.logger.Error("Failed to delete expired checkouts", "error", err)
+		return
+	}
+
+	monitoring.ExpiredCheckoutsDeleted.Add(float64(deleted))
+	if deleted > 0 {
+		s.logger.Info("Deleted expired checkouts", "count", deleted)
+	}
+}
+
+// cleanupEndedSales purges the cache of sales that have ended. Which sales
+// are done is kept in the database, so sales that ended while no scheduler
+// ran, or that another instance created, are cleaned up as well.
+func (s *SaleScheduler) cleanupEndedSales(ctx context.Context) {
+	saleIDs, err := s.saleRepo.GetEndedUnpurgedSaleIDs(ctx, endedSaleCleanupBatch)
+	if err != nil {
+		s.logger.Error("Failed to list ended sales", "error", err)
+		return
+	}
+
+	for _, saleID := range saleIDs {
+		if err := s.cleanupExpiredSale(ctx, saleID); err != nil {
+			s.logger.Error("Failed to clean up ended sale", "error", err, "sale_id", saleID)
+		}
+	}
+}
+
+// cleanupExpiredSale removes the Redis keys of a finished sale instead of
+// waiting for their TTLs to run out.
+func (s *SaleScheduler) cleanupExpiredSale(ctx context.Context, saleID string) error {
+	if err := s.cache.PurgeSaleData(ctx, saleID); err != nil {
+		return err
+	}
+	return s.saleRepo.MarkSaleCachePurged(ctx, saleID)
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSaleWindow(t *testing.T) {
+	day := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute, second int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		interval  time.Duration
+		duration  time.Duration
+		wantStart time.Time
+	}{
+		{name: "duration equals interval", now: at(13, 30, 0), interval: time.Hour, duration: time.Hour, wantStart: at(13, 0, 0)},
+		{name: "duration longer than interval", now: at(13, 30, 0), interval: time.Hour, duration: 2 * time.Hour, wantStart: at(13, 0, 0)},
+		{name: "interval longer, still running", now: at(12, 30, 0), interval: 2 * time.Hour, duration: time.Hour, wantStart: at(12, 0, 0)},
+		{name: "interval longer, would have ended", now: at(13, 30, 45), interval: 2 * time.Hour, duration: time.Hour, wantStart: at(13, 30, 0)},
+		{name: "interval longer, ends exactly now", now: at(13, 0, 0), interval: 2 * time.Hour, duration: time.Hour, wantStart: at(13, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := saleWindow(tt.now, tt.interval, tt.duration)
+
+			if !start.Equal(tt.wantStart) {
+				t.Errorf("start = %v, want %v", start, tt.wantStart)
+			}
+			if !end.Equal(start.Add(tt.duration)) {
+				t.Errorf("end = %v, want start + %v", end, tt.duration)
+			}
+			if start.After(tt.now) || !end.After(tt.now) {
+				t.Errorf("window %v–%v is not running at %v", start, end, tt.now)
+			}
+		})
+	}
+}
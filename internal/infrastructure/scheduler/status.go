@@ -0,0 +1,53 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// SchedulerStatus is a snapshot of the sale scheduler's state. LastRunAt and
+// LastRunError describe the latest sale creation run.
+type SchedulerStatus struct {
+	Running      bool
+	LastRunAt    time.Time
+	LastRunError error
+	NextRunAt    time.Time
+	Interval     time.Duration
+}
+
+// Degraded reports whether the last run failed and no run has happened
+// for more than two intervals since.
+func (st SchedulerStatus) Degraded(now time.Time) bool {
+	return st.LastRunError != nil && now.Sub(st.LastRunAt) > 2*st.Interval
+}
+
+// schedulerState is written by the Start goroutine and read by Status from
+// request handlers.
+type schedulerState struct {
+	mu     sync.RWMutex
+	status SchedulerStatus
+}
+
+func (s *schedulerState) setRunning(running bool, nextRunAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.Running = running
+	s.status.NextRunAt = nextRunAt
+}
+
+func (s *schedulerState) recordRun(at time.Time, err error, nextRunAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.LastRunAt = at
+	s.status.LastRunError = err
+	s.status.NextRunAt = nextRunAt
+}
+
+func (s *schedulerState) snapshot() SchedulerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.status
+}
@@ -12,7 +12,7 @@ import (
 	"github.com/yuzvak/flashsale-service/internal/infrastructure/monitoring"
 )
 
-func SetupMetrics(mux *http.ServeMux, db *sql.DB, redisClient *redis.Client) *monitoring.MetricsServer {
+func SetupMetrics(mux *http.ServeMux, db *sql.DB, redisClient redis.UniversalClient) *monitoring.MetricsServer {
 	mux.Handle("/metrics", promhttp.Handler())
 
 	dbCollector := monitoring.NewDBMetricsCollector(db)
@@ -71,7 +71,7 @@ func ExampleDatabaseMetricsIntegration(db *sql.DB) {
 	*/
 }
 
-func ExampleRedisMetricsIntegration(redisClient *redis.Client) {
+func ExampleRedisMetricsIntegration(redisClient redis.UniversalClient) {
 
 	/*
 		bloomMetrics := monitoring.NewBloomFilterMetrics("items_sold")
@@ -0,0 +1,444 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/domain/events"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+)
+
+const (
+	SignatureHeader  = "X-Flashsale-Signature"
+	EventTypeHeader  = "X-Flashsale-Event"
+	DeliveryIDHeader = "X-Flashsale-Delivery"
+
+	requestTimeout = 10 * time.Second
+	queueSize      = 1024
+	workerCount    = 4
+	initialBackoff = time.Second
+	maxBackoff     = 5 * time.Minute
+
+	// pendingClaimTTL is how long a queued delivery belongs to the instance
+	// that queued it before a sweep may send it again. It outlasts a run of
+	// retries.
+	pendingClaimTTL = time.Hour
+	// pendingSweepInterval is how often deliveries left by a restart, a
+	// shutdown or another instance are picked up.
+	pendingSweepInterval = time.Minute
+	storeTimeout         = 5 * time.Second
+)
+
+// ErrQueueFull is returned to the event bus when deliveries back up, so the
+// outbox keeps the event and offers it again later.
+var ErrQueueFull = errors.New("webhook delivery queue is full")
+
+// Payload is the body POSTed to every endpoint. ID is the same every time
+// an event is delivered, so receivers can drop repeats.
+type Payload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type delivery struct {
+	endpoint config.WebhookConfig
+	id       string
+	event    string
+	body     []byte
+}
+
+// DeliveryService POSTs domain events to the configured webhook endpoints.
+// Events are queued by the bus handler and sent by background workers, so a
+// slow endpoint never holds up the publisher. Queued deliveries are stored
+// until sent, so they outlive a restart.
+type DeliveryService struct {
+	endpoints  []config.WebhookConfig
+	deliveries *postgres.WebhookDeliveryRepository
+	client     *http.Client
+	logger     *logger.Logger
+
+	// mu makes checking the queue's room and filling it one step, so a
+	// batch of deliveries is queued whole or not at all.
+	mu       sync.Mutex
+	queue    chan delivery
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewDeliveryService(
+	endpoints []config.WebhookConfig,
+	deliveries *postgres.WebhookDeliveryRepository,
+	logger *logger.Logger,
+) *DeliveryService {
+	return &DeliveryService{
+		endpoints:  endpoints,
+		deliveries: deliveries,
+		client:     &http.Client{Timeout: requestTimeout},
+		logger:     logger,
+		queue:      make(chan delivery, queueSize),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Subscribe registers the service for every event type an endpoint wants.
+func (s *DeliveryService) Subscribe(bus ports.EventBus) error {
+	subscribed := make(map[string]bool)
+	for _, endpoint := range s.endpoints {
+		for _, eventType := range endpointEvents(endpoint) {
+			if subscribed[eventType] {
+				continue
+			}
+			if err := bus.Subscribe(eventType, s.handle); err != nil {
+				return fmt.Errorf("subscribe to %s: %w", eventType, err)
+			}
+			subscribed[eventType] = true
+		}
+	}
+	return nil
+}
+
+func (s *DeliveryService) Start(ctx context.Context) {
+	s.logger.Info("Starting webhook delivery", "endpoints", len(s.endpoints), "workers", workerCount)
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-s.stopChan:
+		}
+		cancel()
+	}()
+
+	for i := 0; i < workerCount; i++ {
+		s.wg.Add(1)
+		go s.worker(ctx)
+	}
+	s.wg.Add(1)
+	go s.sweep(ctx)
+	s.wg.Wait()
+
+	s.releaseQueued()
+	s.logger.Info("Webhook delivery stopped")
+}
+
+func (s *DeliveryService) Stop() {
+	close(s.stopChan)
+}
+
+// handle stores and queues the event's delivery to every endpoint that
+// wants it. When the queue lacks room for all of them nothing is queued, so
+// the outbox offers the event again later without any endpoint getting it
+// twice in the meantime.
+func (s *DeliveryService) handle(event interface{}) error {
+	eventType := events.TypeOf(event)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode webhook event: %w", err)
+	}
+	payload := Payload{
+		ID:        deliveryID(eventType, data),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		Data:      json.RawMessage(data),
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	var deliveries []delivery
+	var pending []postgres.PendingWebhookDelivery
+	for _, endpoint := range s.endpoints {
+		if !subscribes(endpoint, eventType) {
+			continue
+		}
+		deliveries = append(deliveries, delivery{endpoint: endpoint, id: payload.ID, event: eventType, body: body})
+		pending = append(pending, postgres.PendingWebhookDelivery{DeliveryID: payload.ID, URL: endpoint.URL, EventType: eventType, Body: body})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cap(s.queue)-len(s.queue) < len(deliveries) {
+		return ErrQueueFull
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.deliveries.SavePending(ctx, pending, pendingClaimTTL); err != nil {
+		return fmt.Errorf("store webhook deliveries: %w", err)
+	}
+
+	// Only handle and the sweep fill the queue, both under mu, so the room
+	// checked above is still there.
+	for _, d := range deliveries {
+		s.queue <- d
+	}
+	return nil
+}
+
+// deliveryID identifies an event by its type and content. The outbox
+// stores the event once and decodes the same content on every attempt to
+// publish it, so the ID holds across redeliveries and restarts.
+func deliveryID(eventType string, data []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(eventType))
+	sum.Write([]byte{0})
+	sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func (s *DeliveryService) worker(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-s.queue:
+			if s.deliver(ctx, d) {
+				s.finish(ctx, d)
+			} else {
+				s.release(ctx, d)
+			}
+		}
+	}
+}
+
+// sweep queues stored deliveries whose claim has run out, as far as the
+// queue has room for them.
+func (s *DeliveryService) sweep(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(pendingSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		s.requeuePending(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DeliveryService) requeuePending(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := cap(s.queue) - len(s.queue)
+	if room == 0 {
+		return
+	}
+
+	pending, err := s.deliveries.ClaimPending(ctx, room, pendingClaimTTL)
+	if err != nil {
+		s.logger.Error("Failed to claim pending webhook deliveries", "error", err)
+		return
+	}
+
+	for _, p := range pending {
+		endpoint, ok := s.endpoint(p.URL)
+		if !ok {
+			s.logger.Warn("Dropping webhook delivery to an endpoint no longer configured", "delivery_id", p.DeliveryID, "url", p.URL)
+			s.finish(ctx, delivery{id: p.DeliveryID, endpoint: config.WebhookConfig{URL: p.URL}})
+			continue
+		}
+		s.queue <- delivery{endpoint: endpoint, id: p.DeliveryID, event: p.EventType, body: p.Body}
+	}
+	if len(pending) > 0 {
+		s.logger.Info("Queued pending webhook deliveries", "count", len(pending))
+	}
+}
+
+// finish forgets a delivery that was sent or gave up.
+func (s *DeliveryService) finish(ctx context.Context, d delivery) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := s.deliveries.DeletePending(ctx, d.id, d.endpoint.URL); err != nil {
+		s.logger.Warn("Failed to remove pending webhook delivery", "delivery_id", d.id, "url", d.endpoint.URL, "error", err)
+	}
+}
+
+// release hands a delivery that was not sent back to the sweep of any
+// instance.
+func (s *DeliveryService) release(ctx context.Context, d delivery) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), storeTimeout)
+	defer cancel()
+	if err := s.deliveries.ReleasePending(ctx, d.id, d.endpoint.URL); err != nil {
+		s.logger.Warn("Failed to release pending webhook delivery", "delivery_id", d.id, "url", d.endpoint.URL, "error", err)
+	}
+}
+
+// releaseQueued releases the deliveries still queued at shutdown, so they
+// are sent without waiting for their claims to run out.
+func (s *DeliveryService) releaseQueued() {
+	for {
+		select {
+		case d := <-s.queue:
+			s.release(context.Background(), d)
+		default:
+			return
+		}
+	}
+}
+
+func (s *DeliveryService) endpoint(url string) (config.WebhookConfig, bool) {
+	for _, endpoint := range s.endpoints {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+	return config.WebhookConfig{}, false
+}
+
+// deliver sends d until the endpoint answers 2xx or the endpoint's retries
+// run out, and reports whether it got that far rather than being stopped.
+// Retries back off exponentially unless the endpoint asks for a specific
+// delay with Retry-After.
+func (s *DeliveryService) deliver(ctx context.Context, d delivery) bool {
+	log := s.logger.WithField("delivery_id", d.id).WithField("url", d.endpoint.URL)
+	retries := d.endpoint.RetryLimit()
+	backoff := initialBackoff
+
+	for attempt := 1; attempt <= retries+1; attempt++ {
+		statusCode, retryAfter, err := s.post(ctx, d, attempt)
+		if err == nil {
+			log.Debug("Webhook delivered", "event_type", d.event, "attempt", attempt)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		if attempt > retries {
+			log.Error("Webhook delivery failed", "event_type", d.event, "attempts", attempt, "status", statusCode, "error", err)
+			return true
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		log.Warn("Webhook delivery attempt failed", "attempt", attempt, "status", statusCode, "error", err, "retry_in", wait.String())
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+	return true
+}
+
+// post makes a single attempt and records it. It returns the response
+// status, the delay requested by Retry-After, and an error unless the
+// endpoint answered 2xx.
+func (s *DeliveryService) post(ctx context.Context, d delivery, attempt int) (int, time.Duration, error) {
+	start := time.Now()
+	statusCode, retryAfter, err := s.send(ctx, d)
+
+	record := postgres.WebhookDeliveryAttempt{
+		DeliveryID: d.id,
+		URL:        d.endpoint.URL,
+		EventType:  d.event,
+		Attempt:    attempt,
+		StatusCode: statusCode,
+		Duration:   time.Since(start),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if recordErr := s.deliveries.RecordAttempt(ctx, record); recordErr != nil {
+		s.logger.Warn("Failed to record webhook delivery attempt", "delivery_id", d.id, "error", recordErr)
+	}
+
+	return statusCode, retryAfter, err
+}
+
+func (s *DeliveryService) send(ctx context.Context, d delivery) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.endpoint.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, d.event)
+	req.Header.Set(DeliveryIDHeader, d.id)
+	req.Header.Set(SignatureHeader, Sign(d.endpoint.Secret, d.body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp.StatusCode, 0, nil
+	}
+	return resp.StatusCode, parseRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseRetryAfter accepts both forms of Retry-After: delay seconds or an
+// HTTP date. It returns 0 when the header is absent or unusable.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+func endpointEvents(endpoint config.WebhookConfig) []string {
+	if len(endpoint.Events) == 0 {
+		return []string{events.TypePurchaseCompleted}
+	}
+	return endpoint.Events
+}
+
+func subscribes(endpoint config.WebhookConfig, eventType string) bool {
+	for _, subscribed := range endpointEvents(endpoint) {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
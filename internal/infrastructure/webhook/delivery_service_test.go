@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/config"
+	"github.com/yuzvak/flashsale-service/internal/domain/events"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/persistence/postgres"
+	"github.com/yuzvak/flashsale-service/internal/pkg/logger"
+	"github.com/yuzvak/flashsale-service/internal/testutil/integration"
+)
+
+func TestDeliveryIDHoldsAcrossRedeliveries(t *testing.T) {
+	event := events.PurchaseCompletedEvent{
+		SaleID:       "S-1",
+		UserID:       "user_1",
+		CheckoutCode: "CHK-1",
+		CompletedAt:  time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+	data, _ := json.Marshal(event)
+
+	// The outbox decodes the stored payload again for every attempt.
+	decoded, err := events.Decode(events.TypePurchaseCompleted, data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	redelivered, _ := json.Marshal(decoded)
+
+	id := deliveryID(events.TypePurchaseCompleted, data)
+	if again := deliveryID(events.TypePurchaseCompleted, redelivered); again != id {
+		t.Errorf("redelivered event has ID %s, want %s", again, id)
+	}
+	if len(id) > 64 {
+		t.Errorf("ID %s is longer than the 64 characters stored", id)
+	}
+
+	event.CheckoutCode = "CHK-2"
+	other, _ := json.Marshal(event)
+	if deliveryID(events.TypePurchaseCompleted, other) == id {
+		t.Error("another event got the same ID")
+	}
+}
+
+// An event is queued for all its endpoints or, when the queue lacks room,
+// for none, so retrying it never sends it to an endpoint twice.
+func TestHandleQueuesAllEndpointsOrNone(t *testing.T) {
+	conn := integration.Postgres(t)
+	endpoints := []config.WebhookConfig{
+		{URL: "https://a.example/hook", Secret: "a"},
+		{URL: "https://b.example/hook", Secret: "b"},
+		{URL: "https://c.example/hook", Secret: "c", Events: []string{events.TypeSaleStarted}},
+	}
+	s := NewDeliveryService(endpoints, postgres.NewWebhookDeliveryRepository(conn), logger.NewLogger())
+
+	event := events.PurchaseCompletedEvent{SaleID: integration.NewSaleID(), UserID: "user_1", CheckoutCode: "CHK-1"}
+	data, _ := json.Marshal(event)
+	id := deliveryID(event.EventType(), data)
+	t.Cleanup(func() {
+		if _, err := conn.GetDB().ExecContext(context.Background(), `DELETE FROM webhook_pending_deliveries WHERE delivery_id = $1`, id); err != nil {
+			t.Errorf("failed to delete pending deliveries: %v", err)
+		}
+	})
+
+	// Leave room for one of the two subscribed endpoints.
+	for len(s.queue) < cap(s.queue)-1 {
+		s.queue <- delivery{}
+	}
+	if err := s.handle(event); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("handle with room for one = %v, want ErrQueueFull", err)
+	}
+	if len(s.queue) != cap(s.queue)-1 {
+		t.Fatalf("handle queued %d of the event's deliveries, want none", len(s.queue)-(cap(s.queue)-1))
+	}
+	var stored int
+	if err := conn.GetDB().QueryRow(`SELECT COUNT(*) FROM webhook_pending_deliveries WHERE delivery_id = $1`, id).Scan(&stored); err != nil {
+		t.Fatalf("count pending deliveries: %v", err)
+	}
+	if stored != 0 {
+		t.Fatalf("handle stored %d deliveries without queueing them, want none", stored)
+	}
+
+	<-s.queue
+	if err := s.handle(event); err != nil {
+		t.Fatalf("handle with room for both: %v", err)
+	}
+	if len(s.queue) != cap(s.queue) {
+		t.Errorf("queue holds %d deliveries, want %d", len(s.queue), cap(s.queue))
+	}
+	if err := conn.GetDB().QueryRow(`SELECT COUNT(*) FROM webhook_pending_deliveries WHERE delivery_id = $1`, id).Scan(&stored); err != nil {
+		t.Fatalf("count pending deliveries: %v", err)
+	}
+	if stored != 2 {
+		t.Errorf("handle stored %d deliveries, want 2", stored)
+	}
+}
@@ -1,9 +1,10 @@
 package bloom
 
 import (
-	"hash/fnv"
 	"math"
 	"sync"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/hashing"
 )
 
 type BloomFilter struct {
@@ -32,8 +33,7 @@ func (bf *BloomFilter) Add(item string) {
 	bf.mutex.Lock()
 	defer bf.mutex.Unlock()
 
-	for i := uint(0); i < bf.hashCount; i++ {
-		position := bf.hash(item, i)
+	for _, position := range bf.locations(item) {
 		bf.bitset[position] = true
 	}
 }
@@ -42,8 +42,7 @@ func (bf *BloomFilter) Contains(item string) bool {
 	bf.mutex.RLock()
 	defer bf.mutex.RUnlock()
 
-	for i := uint(0); i < bf.hashCount; i++ {
-		position := bf.hash(item, i)
+	for _, position := range bf.locations(item) {
 		if !bf.bitset[position] {
 			return false
 		}
@@ -59,11 +58,16 @@ func (bf *BloomFilter) Clear() {
 	bf.bitset = make([]bool, bf.size)
 }
 
-func (bf *BloomFilter) hash(item string, seed uint) uint {
-	h := fnv.New64a()
-	h.Write([]byte(item))
-	h.Write([]byte{byte(seed)})
-	return uint(h.Sum64() % uint64(bf.size))
+func (bf *BloomFilter) Size() uint {
+	return bf.size
+}
+
+func (bf *BloomFilter) HashCount() uint {
+	return bf.hashCount
+}
+
+func (bf *BloomFilter) locations(item string) []uint64 {
+	return hashing.Locations(item, uint64(bf.size), uint64(bf.hashCount))
 }
 
 func optimalSize(expectedItems uint, falsePositiveProb float64) uint {
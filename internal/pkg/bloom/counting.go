@@ -0,0 +1,93 @@
+package bloom
+
+import (
+	"sync"
+
+	"github.com/yuzvak/flashsale-service/internal/pkg/hashing"
+)
+
+// CountingBloomFilter keeps a counter per position instead of a bit, so
+// elements can be removed again. Removing an element that was never added
+// corrupts the filter, which is why Remove checks membership first.
+type CountingBloomFilter struct {
+	counters  []uint32
+	size      uint
+	hashCount uint
+	mutex     sync.RWMutex
+}
+
+func NewCountingBloomFilter(size, hashCount uint) *CountingBloomFilter {
+	return &CountingBloomFilter{
+		counters:  make([]uint32, size),
+		size:      size,
+		hashCount: hashCount,
+	}
+}
+
+func NewCountingBloomFilterWithExpectedItems(expectedItems uint, falsePositiveProb float64) *CountingBloomFilter {
+	size := optimalSize(expectedItems, falsePositiveProb)
+	hashCount := optimalHashCount(size, expectedItems)
+
+	return NewCountingBloomFilter(size, hashCount)
+}
+
+func (bf *CountingBloomFilter) Add(item string) {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	for _, position := range bf.locations(item) {
+		bf.counters[position]++
+	}
+}
+
+// Remove decrements the counters of item and reports whether it was
+// possibly present; an item that is definitely absent is left alone.
+func (bf *CountingBloomFilter) Remove(item string) bool {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	positions := bf.locations(item)
+	for _, position := range positions {
+		if bf.counters[position] == 0 {
+			return false
+		}
+	}
+
+	for _, position := range positions {
+		bf.counters[position]--
+	}
+
+	return true
+}
+
+func (bf *CountingBloomFilter) Contains(item string) bool {
+	bf.mutex.RLock()
+	defer bf.mutex.RUnlock()
+
+	for _, position := range bf.locations(item) {
+		if bf.counters[position] == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (bf *CountingBloomFilter) Clear() {
+	bf.mutex.Lock()
+	defer bf.mutex.Unlock()
+
+	bf.counters = make([]uint32, bf.size)
+}
+
+func (bf *CountingBloomFilter) Size() uint {
+	return bf.size
+}
+
+func (bf *CountingBloomFilter) HashCount() uint {
+	return bf.hashCount
+}
+
+func (bf *CountingBloomFilter) locations(item string) []uint64 {
+	return hashing.Locations(item, uint64(bf.size), uint64(bf.hashCount))
+}
@@ -1,17 +1,56 @@
 package generator
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oklog/ulid"
+)
+
+const (
+	SaleIDPrefix     = "SALE_"
+	CheckoutIDPrefix = "CHK_"
+
+	DefaultCheckoutCodePrefix = "CHK"
+
+	// signatureBytes of the HMAC are kept, giving 8 hex characters.
+	signatureBytes = 4
+)
+
+// ulidEntropy is shared by every generator so that IDs created in the same
+// millisecond still sort in creation order. Monotonic readers are not safe
+// for concurrent use, hence the mutex.
+var (
+	ulidMu      sync.Mutex
+	ulidEntropy = ulid.Monotonic(rand.Reader, 0)
 )
 
-type CodeGenerator struct{}
+// CodeGenerator signs checkout codes with secret so that codes can be
+// checked for tampering without a lookup. Generators that only produce IDs
+// can be created with a nil secret.
+type CodeGenerator struct {
+	secret []byte
+	prefix string
+}
 
-func NewCodeGenerator() *CodeGenerator {
-	return &CodeGenerator{}
+func NewCodeGenerator(secret []byte, prefix string) *CodeGenerator {
+	if prefix == "" {
+		prefix = DefaultCheckoutCodePrefix
+	}
+	return &CodeGenerator{
+		secret: secret,
+		prefix: prefix,
+	}
 }
 
+// GenerateCheckoutCode returns a code of the form
+// <prefix>-<saleID>-<random>-<signature>.
 func (g *CodeGenerator) GenerateCheckoutCode(saleID, userID string) (string, error) {
 	randomBytes := make([]byte, 8)
 	_, err := rand.Read(randomBytes)
@@ -21,23 +60,69 @@ func (g *CodeGenerator) GenerateCheckoutCode(saleID, userID string) (string, err
 
 	randomHex := hex.EncodeToString(randomBytes)
 
-	return fmt.Sprintf("CHK-%s-%s", saleID, randomHex), nil
+	unsigned := fmt.Sprintf("%s-%s-%s", g.prefix, saleID, randomHex)
+	return unsigned + "-" + g.sign(unsigned), nil
 }
 
-func (g *CodeGenerator) GenerateSaleID() string {
-	randomBytes := make([]byte, 5) // 5 bytes will give us 10 hex chars
-	if _, err := rand.Read(randomBytes); err != nil {
-		return ""
+// VerifyCheckoutCode reports whether code carries this generator's prefix
+// and a valid signature.
+func (g *CodeGenerator) VerifyCheckoutCode(code string) bool {
+	if !strings.HasPrefix(code, g.prefix+"-") {
+		return false
+	}
+
+	sep := strings.LastIndexByte(code, '-')
+	if sep < 0 {
+		return false
 	}
-	randomId := hex.EncodeToString(randomBytes)
-	return fmt.Sprintf("S-%s", randomId)
+	unsigned, signature := code[:sep], code[sep+1:]
+
+	return hmac.Equal([]byte(signature), []byte(g.sign(unsigned)))
 }
 
+func (g *CodeGenerator) sign(unsigned string) string {
+	mac := hmac.New(sha256.New, g.secret)
+	mac.Write([]byte(unsigned))
+	return hex.EncodeToString(mac.Sum(nil)[:signatureBytes])
+}
+
+// GenerateSaleID returns a sale ID that sorts lexicographically by creation
+// time, e.g. SALE_01ARZ3NDEKTSV4RRFFQ69G5FAV.
+func (g *CodeGenerator) GenerateSaleID() string {
+	return SaleIDPrefix + newULID()
+}
+
+// GenerateCheckoutID returns a checkout row ID that sorts by creation time.
 func (g *CodeGenerator) GenerateCheckoutID() string {
-	randomBytes := make([]byte, 5) // 5 bytes will give us 10 hex chars
+	return CheckoutIDPrefix + newULID()
+}
+
+func (g *CodeGenerator) GenerateCorrelationID() string {
+	randomBytes := make([]byte, 16)
 	if _, err := rand.Read(randomBytes); err != nil {
 		return ""
 	}
-	randomId := hex.EncodeToString(randomBytes)
-	return fmt.Sprintf("C-%s", randomId)
+	return hex.EncodeToString(randomBytes)
+}
+
+func newULID() string {
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+	return ulid.MustNew(ulid.Timestamp(time.Now().UTC()), ulidEntropy).String()
+}
+
+// ParseULIDTime returns the creation time encoded in an ID produced by
+// GenerateSaleID or GenerateCheckoutID. IDs from before the switch to ULIDs
+// are rejected.
+func ParseULIDTime(id string) (time.Time, error) {
+	encoded := id
+	if _, rest, found := strings.Cut(id, "_"); found {
+		encoded = rest
+	}
+
+	parsed, err := ulid.Parse(encoded)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("id %q does not contain a ULID: %w", id, err)
+	}
+	return ulid.Time(parsed.Time()).UTC(), nil
 }
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var urlSafe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Checkout codes end up in URLs, Redis keys and SQL parameters, so every code
+// must verify against the generator that made it and stay URL-safe whenever
+// the sale ID is.
+func FuzzGenerateCheckoutCode(f *testing.F) {
+	g := NewCodeGenerator([]byte("fuzz-secret"), "")
+	other := NewCodeGenerator([]byte("other-secret"), "")
+
+	for i := 0; i < 4; i++ {
+		f.Add(g.GenerateSaleID(), "user_"+g.GenerateCorrelationID())
+	}
+	code, err := g.GenerateCheckoutCode(g.GenerateSaleID(), "user_1")
+	if err != nil {
+		f.Fatalf("GenerateCheckoutCode: %v", err)
+	}
+	f.Add(code, "user_1")
+	f.Add("S-fixture001", "")
+	f.Add("", "user_1")
+
+	f.Fuzz(func(t *testing.T, saleID, userID string) {
+		code, err := g.GenerateCheckoutCode(saleID, userID)
+		if err != nil {
+			t.Fatalf("GenerateCheckoutCode(%q, %q): %v", saleID, userID, err)
+		}
+
+		if !strings.HasPrefix(code, DefaultCheckoutCodePrefix+"-") {
+			t.Errorf("code %q lacks the %q prefix", code, DefaultCheckoutCodePrefix)
+		}
+		if urlSafe.MatchString(saleID) && !urlSafe.MatchString(code) {
+			t.Errorf("code %q for sale %q is not URL-safe", code, saleID)
+		}
+		if !g.VerifyCheckoutCode(code) {
+			t.Errorf("code %q does not verify", code)
+		}
+		if other.VerifyCheckoutCode(code) {
+			t.Errorf("code %q verifies under another secret", code)
+		}
+
+		// Arbitrary input reaching the purchase endpoint must not panic or
+		// pass as a code.
+		if g.VerifyCheckoutCode(saleID) && !strings.HasPrefix(saleID, DefaultCheckoutCodePrefix+"-") {
+			t.Errorf("%q verifies without the prefix", saleID)
+		}
+		if g.VerifyCheckoutCode(code[:len(code)-1]) {
+			t.Errorf("truncated code %q verifies", code[:len(code)-1])
+		}
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/shopspring/decimal"
 )
 
 type ItemGenerator struct {
@@ -43,6 +45,12 @@ func (g *ItemGenerator) GenerateImageURL() string {
 	return fmt.Sprintf("https://picsum.photos/%d/%d", width, height)
 }
 
+// GeneratePrice returns a random price between 5.00 and 500.00.
+func (g *ItemGenerator) GeneratePrice() decimal.Decimal {
+	cents := 500 + g.random.Int63n(49501)
+	return decimal.New(cents, -2)
+}
+
 func (g *ItemGenerator) GenerateItemID() string {
 	return fmt.Sprintf("item_%d_%d", time.Now().UTC().UnixNano(), rand.Intn(10000))
 }
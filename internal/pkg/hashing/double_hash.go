@@ -0,0 +1,36 @@
+package hashing
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Locations returns k bit positions in [0, m) for element using the
+// Kirsch-Mitzenmacher double hashing scheme: h1 + i*h2 (mod m).
+func Locations(element string, m, k uint64) []uint64 {
+	locations := make([]uint64, k)
+	if m == 0 {
+		return locations
+	}
+
+	h1 := Hash1(element)
+	h2 := Hash2(element)
+
+	for i := uint64(0); i < k; i++ {
+		locations[i] = (h1 + i*h2) % m
+	}
+
+	return locations
+}
+
+func Hash1(element string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(element))
+	return h.Sum64()
+}
+
+func Hash2(element string) uint64 {
+	h := sha256.Sum256([]byte(element))
+	return binary.BigEndian.Uint64(h[:8])
+}
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"bufio"
+	"os"
+	"sync"
+)
+
+// maxBatchSize caps how many buffered entries are written per flush.
+const maxBatchSize = 256
+
+// asyncWriter moves log output off the caller's goroutine. Entries are
+// queued on a channel and written in batches by a single goroutine.
+type asyncWriter struct {
+	output  *os.File
+	entries chan []byte
+	done    chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+
+	onOverflow func()
+}
+
+// NewAsyncLogger returns a logger that buffers up to bufferSize entries
+// and writes them to stdout in the background. When the buffer is full
+// the entry is written synchronously instead of being lost. Call Close
+// before exiting to flush what is still buffered.
+func NewAsyncLogger(bufferSize int) *Logger {
+	l := NewLogger()
+	l.async = &asyncWriter{
+		output:  l.output,
+		entries: make(chan []byte, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.async.run()
+	return l
+}
+
+// OnBufferFull registers fn to be called each time an entry has to be
+// written synchronously because the async buffer is full.
+func (l *Logger) OnBufferFull(fn func()) {
+	if l.async != nil {
+		l.async.onOverflow = fn
+	}
+}
+
+// Close flushes buffered entries and stops the background writer. Entries
+// logged afterwards are written synchronously. It is a no-op for a
+// synchronous logger.
+func (l *Logger) Close() {
+	if l.async == nil {
+		return
+	}
+
+	l.async.mu.Lock()
+	if l.async.closed {
+		l.async.mu.Unlock()
+		return
+	}
+	l.async.closed = true
+	close(l.async.entries)
+	l.async.mu.Unlock()
+
+	<-l.async.done
+}
+
+// write queues data, or writes it directly when the buffer is full or the
+// writer has been closed. It reports false when it did not queue.
+func (w *asyncWriter) write(data []byte) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return false
+	}
+
+	select {
+	case w.entries <- data:
+		return true
+	default:
+		if w.onOverflow != nil {
+			w.onOverflow()
+		}
+		return false
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	out := bufio.NewWriter(w.output)
+	for data := range w.entries {
+		out.Write(data)
+
+		// Drain whatever else is already queued so a burst costs one write.
+	batch:
+		for i := 1; i < maxBatchSize; i++ {
+			select {
+			case next, ok := <-w.entries:
+				if !ok {
+					break batch
+				}
+				out.Write(next)
+			default:
+				break batch
+			}
+		}
+
+		out.Flush()
+	}
+}
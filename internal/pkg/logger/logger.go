@@ -1,15 +1,42 @@
 package logger
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	LevelDebug = "DEBUG"
+	LevelInfo  = "INFO"
+	LevelWarn  = "WARN"
+	LevelError = "ERROR"
+	LevelFatal = "FATAL"
 )
 
+var levelOrder = map[string]int32{
+	LevelDebug: 0,
+	LevelInfo:  1,
+	LevelWarn:  2,
+	LevelError: 3,
+	LevelFatal: 4,
+}
+
 type Logger struct {
-	output *os.File
+	output     *os.File
+	baseFields map[string]interface{}
+	// minLevel is shared with every logger derived through With*, so
+	// SetLevel on the root logger applies to all of them.
+	minLevel *atomic.Int32
+	// async is nil for a synchronous logger.
+	async *asyncWriter
 }
 
 type LogEntry struct {
@@ -23,11 +50,36 @@ type LogEntry struct {
 
 func NewLogger() *Logger {
 	return &Logger{
-		output: os.Stdout,
+		output:   os.Stdout,
+		minLevel: new(atomic.Int32),
 	}
 }
 
+// SetLevel drops entries below level, one of DEBUG, INFO, WARN or ERROR.
+func (l *Logger) SetLevel(level string) error {
+	order, ok := levelOrder[strings.ToUpper(level)]
+	if !ok || order == levelOrder[LevelFatal] {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+	l.minLevel.Store(order)
+	return nil
+}
+
+// IsDebug reports whether debug entries are written, so callers can skip
+// building expensive debug fields.
+func (l *Logger) IsDebug() bool {
+	return l.enabled(LevelDebug)
+}
+
+func (l *Logger) enabled(level string) bool {
+	return levelOrder[level] >= l.minLevel.Load()
+}
+
 func (l *Logger) log(level, msg string, fields ...interface{}) {
+	if !l.enabled(level) {
+		return
+	}
+
 	_, file, line, ok := runtime.Caller(2)
 	if !ok {
 		file = "unknown"
@@ -42,14 +94,19 @@ func (l *Logger) log(level, msg string, fields ...interface{}) {
 		Line:      line,
 	}
 
+	fieldMap := make(map[string]interface{}, len(l.baseFields)+len(fields)/2)
+	for key, value := range l.baseFields {
+		fieldMap[key] = value
+	}
 	if len(fields) > 0 && len(fields)%2 == 0 {
-		fieldMap := make(map[string]interface{})
 		for i := 0; i < len(fields); i += 2 {
 			key, ok := fields[i].(string)
 			if ok {
 				fieldMap[key] = fields[i+1]
 			}
 		}
+	}
+	if len(fieldMap) > 0 {
 		entry.Fields = fieldMap
 	}
 
@@ -59,34 +116,98 @@ func (l *Logger) log(level, msg string, fields ...interface{}) {
 		return
 	}
 
-	fmt.Fprintln(l.output, string(jsonData))
+	jsonData = append(jsonData, '\n')
+	if l.async != nil && l.async.write(jsonData) {
+		return
+	}
+	l.output.Write(jsonData)
 }
 
 func (l *Logger) Debug(msg string, fields ...interface{}) {
-	l.log("DEBUG", msg, fields...)
+	l.log(LevelDebug, msg, fields...)
 }
 
 func (l *Logger) Info(msg string, fields ...interface{}) {
-	l.log("INFO", msg, fields...)
+	l.log(LevelInfo, msg, fields...)
 }
 
 func (l *Logger) Warn(msg string, fields ...interface{}) {
-	l.log("WARN", msg, fields...)
+	l.log(LevelWarn, msg, fields...)
 }
 
 func (l *Logger) Error(msg string, fields ...interface{}) {
-	l.log("ERROR", msg, fields...)
+	l.log(LevelError, msg, fields...)
 }
 
 func (l *Logger) Fatal(msg string, fields ...interface{}) {
-	l.log("FATAL", msg, fields...)
+	l.log(LevelFatal, msg, fields...)
+	l.Close()
 	os.Exit(1)
 }
 
 func (l *Logger) WithCorrelationID(correlationID string) *Logger {
-	return l
+	return l.WithField("correlation_id", correlationID)
 }
 
+// WithField returns a copy of the logger that adds key to every entry it
+// writes. Fields passed to an individual call take precedence.
 func (l *Logger) WithField(key string, value interface{}) *Logger {
-	return l
+	fields := make(map[string]interface{}, len(l.baseFields)+1)
+	for k, v := range l.baseFields {
+		fields[k] = v
+	}
+	fields[key] = value
+
+	return &Logger{
+		output:     l.output,
+		baseFields: fields,
+		minLevel:   l.minLevel,
+		async:      l.async,
+	}
+}
+
+type correlationIDKey struct{}
+
+func ContextWithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+type requestIDKey struct{}
+
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithContext returns the logger enriched with the request and correlation
+// IDs and the trace and span IDs carried by ctx, or the logger itself when
+// there are none.
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	enriched := l
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		enriched = enriched.WithField("request_id", requestID)
+	}
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		enriched = enriched.WithCorrelationID(correlationID)
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		enriched = enriched.
+			WithField("trace_id", spanContext.TraceID().String()).
+			WithField("span_id", spanContext.SpanID().String())
+	}
+	return enriched
+}
+
+// FromContext is kept for existing callers; it is the same as WithContext.
+func (l *Logger) FromContext(ctx context.Context) *Logger {
+	return l.WithContext(ctx)
 }
@@ -0,0 +1,521 @@
+package openapi
+
+//go:generate go run ../../../cmd/openapi -out ../../../api/openapi.yaml
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/application/commands"
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/handlers"
+	"github.com/yuzvak/flashsale-service/internal/infrastructure/http/response"
+)
+
+const (
+	Title   = "Flash Sale Service API"
+	Version = "1.0.0"
+
+	apiKeySecurity = "ApiKeyAuth"
+	bearerSecurity = "BearerAuth"
+)
+
+var decimalType = reflect.TypeOf(decimal.Decimal{})
+
+// GenerateSpec builds the OpenAPI document for every route registered by
+// the HTTP server. Schemas are reflected from the request and response
+// structs, so they follow the JSON the handlers actually send.
+func GenerateSpec() *openapi3.T {
+	b := &builder{
+		doc: &openapi3.T{
+			OpenAPI: "3.0.3",
+			Info: &openapi3.Info{
+				Title:       Title,
+				Version:     Version,
+				Description: "Checkout and purchase of flash sale items, plus the admin API used to run sales.",
+			},
+			Paths: openapi3.NewPaths(),
+			Components: &openapi3.Components{
+				Schemas:   openapi3.Schemas{},
+				Responses: openapi3.ResponseBodies{},
+				SecuritySchemes: openapi3.SecuritySchemes{
+					apiKeySecurity: &openapi3.SecuritySchemeRef{Value: openapi3.NewSecurityScheme().
+						WithType("apiKey").WithIn("header").WithName("X-API-Key")},
+					bearerSecurity: &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+				},
+			},
+		},
+	}
+
+	b.schemas()
+	b.errorResponses()
+	b.publicPaths()
+	b.adminPaths()
+
+	return b.doc
+}
+
+type builder struct {
+	doc *openapi3.T
+}
+
+func (b *builder) schemas() {
+	b.schema("ErrorResponse", response.ErrorResponse{})
+	b.schema("ValidationErrorResponse", response.ValidationErrorResponse{})
+
+	b.schema("SaleResponse", handlers.SaleResponse{})
+	b.schema("UpcomingSalesResponse", handlers.UpcomingSalesResponse{})
+	b.schema("RemainingResponse", handlers.RemainingResponse{})
+	b.schema("ItemResponse", handlers.ItemResponse{})
+	b.schema("ItemListResponse", handlers.ItemListResponse{})
+	b.schema("ItemDetailResponse", handlers.ItemDetailResponse{})
+	b.schema("CheckoutResponse", commands.CheckoutResponse{})
+	b.schema("PurchaseResponse", commands.PurchaseResponse{})
+	b.schema("PurchaseResult", sale.PurchaseResult{})
+
+	b.schema("HealthData", handlers.HealthData{})
+	b.schema("ReadinessData", handlers.ReadinessData{})
+	b.schema("LivenessData", handlers.LivenessData{})
+	b.schema("SchedulerStatusResponse", handlers.SchedulerStatusResponse{})
+
+	b.schema("CreateSaleRequest", handlers.CreateSaleRequest{})
+	b.schema("CreateSaleResponse", response.DataResponse[handlers.CreateSaleResponse]{})
+	b.schema("UpdateSaleRequest", handlers.UpdateSaleRequest{})
+	b.schema("UpdateSaleResponse", handlers.UpdateSaleResponse{})
+	b.schema("ListSalesResponse", handlers.ListSalesResponse{})
+	b.schema("CancelSaleResponse", handlers.CancelSaleResponse{})
+	b.schema("RefundResponse", handlers.RefundResponse{})
+	b.schema("ItemDefinition", handlers.ItemDefinition{})
+	b.schema("AddItemsResponse", response.DataResponse[handlers.AddItemsResponse]{})
+	b.schema("ImportItemRow", handlers.ImportItemRow{})
+	b.schema("ImportItemsResponse", response.DataResponse[handlers.ImportItemsResponse]{})
+	b.schema("PurchaseResultDetailResponse", handlers.PurchaseResultDetailResponse{})
+	b.schema("SaleStatsResponse", handlers.SaleStatsResponse{})
+	b.schema("PurchaseStatsResponse", handlers.PurchaseStatsResponse{})
+	b.schema("PurchaseTimeSeriesResponse", handlers.PurchaseTimeSeriesResponse{})
+	b.schema("PurchaseExportRow", ports.PurchaseExportRow{})
+
+	// AddItemsRequest is decoded by hand: either a count of generated items
+	// or an array of item definitions.
+	count := openapi3.NewObjectSchema().
+		WithProperty("count", openapi3.NewIntegerSchema().WithMin(1)).
+		WithRequired([]string{"count"})
+	definitions := openapi3.NewArraySchema()
+	definitions.Items = b.ref("ItemDefinition")
+	b.doc.Components.Schemas["AddItemsRequest"] = openapi3.NewSchemaRef("", openapi3.NewOneOfSchema(count, definitions))
+
+	rows := openapi3.NewArraySchema().WithMaxItems(50000)
+	rows.Items = b.ref("ImportItemRow")
+	b.doc.Components.Schemas["ImportItemsRequest"] = openapi3.NewSchemaRef("", rows)
+}
+
+func (b *builder) schema(name string, value interface{}) {
+	schemaRef, err := openapi3gen.NewSchemaRefForValue(value, b.doc.Components.Schemas,
+		openapi3gen.SchemaCustomizer(customizeSchema))
+	if err != nil {
+		panic(fmt.Sprintf("openapi: schema %s: %v", name, err))
+	}
+	b.doc.Components.Schemas[name] = schemaRef
+}
+
+// customizeSchema describes decimals the way they are encoded: as strings.
+func customizeSchema(_ string, t reflect.Type, _ reflect.StructTag, schema *openapi3.Schema) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == decimalType {
+		*schema = *openapi3.NewStringSchema().WithFormat("decimal").WithPattern(`^-?\d+(\.\d+)?$`)
+	}
+	return nil
+}
+
+// errorResponses adds one reusable response per domain error code and lists
+// every code in the ErrorResponse schema.
+func (b *builder) errorResponses() {
+	mappings := response.ErrorMappings()
+	codes := make([]interface{}, 0, len(mappings)+2)
+
+	for _, mapping := range mappings {
+		codes = append(codes, mapping.Code)
+
+		content := openapi3.NewContentWithJSONSchemaRef(b.ref("ErrorResponse"))
+		content.Get("application/json").Example = map[string]interface{}{
+			"message": mapping.Message,
+			"code":    mapping.Code,
+		}
+
+		b.doc.Components.Responses[mapping.Code] = &openapi3.ResponseRef{Value: openapi3.NewResponse().
+			WithDescription(fmt.Sprintf("%s (HTTP %d %s)", mapping.Message, mapping.HTTPStatus, http.StatusText(mapping.HTTPStatus))).
+			WithContent(content)}
+	}
+	codes = append(codes, response.CodeInternalError, response.CodePayloadTooLarge)
+
+	errorSchema := b.doc.Components.Schemas["ErrorResponse"].Value
+	if code := errorSchema.Properties["code"]; code != nil {
+		code.Value.Enum = codes
+	}
+}
+
+func (b *builder) publicPaths() {
+	b.get("/health", "Health", "Service and dependency status").
+		ok("HealthData")
+	b.get("/readiness", "Health", "Readiness probe").
+		ok("ReadinessData").
+		failure(http.StatusServiceUnavailable, "A dependency is down")
+	b.get("/liveness", "Health", "Liveness probe").
+		ok("LivenessData").
+		failure(http.StatusServiceUnavailable, "Too many goroutines")
+
+	b.get("/sales/active", "Sales", "Get the active sale").
+		query("category", "Only consider sales of this category", false).
+		ok("SaleResponse").
+		errors(http.StatusNotFound)
+	b.get("/sales/upcoming", "Sales", "List upcoming sales").
+		query("limit", "Maximum number of sales", false).
+		query("horizon_hours", "How far ahead to look, in hours", false).
+		query("format", "ics returns an iCalendar feed instead of JSON", false).
+		ok("UpcomingSalesResponse").
+		validation()
+	b.get("/sales/{id}", "Sales", "Get a sale").
+		path("id", "Sale ID").
+		ok("SaleResponse").
+		errors(http.StatusNotFound)
+	b.get("/sales/{id}/items", "Sales", "List a sale's items").
+		path("id", "Sale ID").
+		query("limit", "Page size, at most 1000", false).
+		query("offset", "Items to skip", false).
+		ok("ItemListResponse").
+		validation().
+		errors(http.StatusNotFound)
+	b.get("/sales/{id}/remaining", "Sales", "Count a sale's unsold items").
+		path("id", "Sale ID").
+		ok("RemainingResponse").
+		errors(http.StatusNotFound)
+	b.get("/sales/{id}/events", "Sales", "Stream sale events").
+		path("id", "Sale ID").
+		stream("Server-sent events with snapshot, items_sold, threshold_crossed and sale_ended events").
+		errors(http.StatusNotFound)
+	b.get("/items/{id}", "Sales", "Get an item").
+		path("id", "Item ID").
+		ok("ItemDetailResponse").
+		errors(http.StatusNotFound)
+
+	b.post("/checkout", "Purchases", "Reserve an item for purchase").
+		query("id", "Item ID", true).
+		query("sale_id", "Sale ID; defaults to the active sale", false).
+		query("user_id", "User ID, used when JWT authentication is disabled", false).
+		security(bearerSecurity).
+		ok("CheckoutResponse").
+		validation().
+		failure(http.StatusUnauthorized, "No user ID or token").
+		failure(http.StatusTooManyRequests, "Rate limit exceeded").
+		errors(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusTooEarly)
+	b.post("/purchase", "Purchases", "Purchase the items of a checkout").
+		query("code", "Checkout code", true).
+		header("Idempotency-Key", "Replays the stored response for a repeated key").
+		ok("PurchaseResponse").
+		validation().
+		failure(http.StatusTooManyRequests, "Rate limit exceeded").
+		errors(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusGone)
+	b.get("/purchase/status", "Purchases", "Get the result of a processed checkout").
+		query("code", "Checkout code", true).
+		ok("PurchaseResponse").
+		validation().
+		errors(http.StatusNotFound)
+}
+
+func (b *builder) adminPaths() {
+	b.get("/admin/sales", "Admin", "List sales").
+		query("status", "active, upcoming or ended", false).
+		query("limit", "Page size, at most 1000", false).
+		query("cursor", "next_cursor of the previous page", false).
+		admin().
+		ok("ListSalesResponse").
+		validation()
+	b.post("/admin/sales", "Admin", "Create a sale").
+		admin().
+		body("CreateSaleRequest").
+		created("CreateSaleResponse").
+		validation()
+	b.patch("/admin/sales/{id}", "Admin", "Update a sale").
+		path("id", "Sale ID").
+		admin().
+		body("UpdateSaleRequest").
+		ok("UpdateSaleResponse").
+		validation().
+		errors(http.StatusNotFound)
+	b.post("/admin/sales/{id}/items", "Admin", "Add items to a sale").
+		path("id", "Sale ID").
+		admin().
+		body("AddItemsRequest").
+		created("AddItemsResponse").
+		validation().
+		errors(http.StatusNotFound)
+	b.post("/admin/sales/{id}/items/import", "Admin", "Import a product catalog into a sale").
+		path("id", "Sale ID").
+		admin().
+		body("ImportItemsRequest").
+		csv("A header row naming name, image_url, price and optionally description, then one row per item").
+		created("ImportItemsResponse").
+		ok("ImportItemsResponse").
+		validation().
+		failure(http.StatusUnsupportedMediaType, "Content-Type is neither application/json nor text/csv").
+		errors(http.StatusNotFound, http.StatusConflict)
+	b.post("/admin/sales/{id}/cancel", "Admin", "End a sale now").
+		path("id", "Sale ID").
+		admin().
+		ok("CancelSaleResponse").
+		errors(http.StatusNotFound)
+	b.get("/admin/sales/{id}/stats", "Admin", "Report a sale's progress and active checkouts").
+		path("id", "Sale ID").
+		admin().
+		ok("SaleStatsResponse").
+		errors(http.StatusNotFound)
+	b.get("/admin/sales/{id}/purchases/stats", "Admin", "Aggregate a sale's purchases").
+		path("id", "Sale ID").
+		admin().
+		ok("PurchaseStatsResponse").
+		errors(http.StatusNotFound)
+	b.get("/admin/sales/{id}/purchases/timeseries", "Admin", "Count a sale's purchases per time bucket").
+		path("id", "Sale ID").
+		query("from", "RFC 3339 start of the range; defaults to the sale start", false).
+		query("to", "RFC 3339 end of the range; defaults to the sale end", false).
+		query("bucket_minutes", "Bucket width in minutes; defaults to 5", false).
+		admin().
+		ok("PurchaseTimeSeriesResponse").
+		validation().
+		errors(http.StatusNotFound)
+	b.get("/admin/sales/{id}/purchases/export", "Admin", "Download a sale's purchases").
+		path("id", "Sale ID").
+		query("format", "csv (default) or json", false).
+		query("user_id", "User the export is rate limited for, used when JWT authentication is disabled", false).
+		admin().
+		okArray("PurchaseExportRow").
+		csvResponse("purchase_id, user_id, item_id, item_name, price and purchased_at columns after a header row").
+		validation().
+		failure(http.StatusTooManyRequests, "Only one export per minute is allowed for each user").
+		errors(http.StatusNotFound)
+	b.post("/admin/refund", "Admin", "Refund a sold item").
+		query("item_id", "Item ID", true).
+		query("user_id", "User the item was sold to", true).
+		admin().
+		ok("RefundResponse").
+		validation().
+		errors(http.StatusBadRequest, http.StatusNotFound, http.StatusConflict)
+	b.get("/admin/purchase-results/{code}", "Admin", "Inspect a stored purchase result").
+		path("code", "Checkout code").
+		admin().
+		ok("PurchaseResultDetailResponse").
+		errors(http.StatusNotFound)
+	b.put("/admin/purchase-results/{code}", "Admin", "Replace a corrupted purchase result").
+		path("code", "Checkout code").
+		admin().
+		body("PurchaseResult").
+		ok("PurchaseResult").
+		validation().
+		errors(http.StatusNotFound)
+
+	b.get("/internal/scheduler/status", "Internal", "Sale scheduler status").
+		admin().
+		ok("SchedulerStatusResponse")
+}
+
+type operationBuilder struct {
+	b  *builder
+	op *openapi3.Operation
+}
+
+func (b *builder) get(path, tag, summary string) *operationBuilder {
+	return b.operation(http.MethodGet, path, tag, summary)
+}
+
+func (b *builder) post(path, tag, summary string) *operationBuilder {
+	return b.operation(http.MethodPost, path, tag, summary)
+}
+
+func (b *builder) put(path, tag, summary string) *operationBuilder {
+	return b.operation(http.MethodPut, path, tag, summary)
+}
+
+func (b *builder) patch(path, tag, summary string) *operationBuilder {
+	return b.operation(http.MethodPatch, path, tag, summary)
+}
+
+func (b *builder) operation(method, path, tag, summary string) *operationBuilder {
+	op := openapi3.NewOperation()
+	op.Summary = summary
+	op.Tags = []string{tag}
+	op.Responses = openapi3.NewResponses()
+	op.Responses.Delete("default")
+	op.AddResponse(http.StatusInternalServerError, openapi3.NewResponse().
+		WithDescription("Unexpected error").
+		WithJSONSchemaRef(b.ref("ErrorResponse")))
+
+	item := b.doc.Paths.Value(path)
+	if item == nil {
+		item = &openapi3.PathItem{}
+		b.doc.Paths.Set(path, item)
+	}
+	item.SetOperation(method, op)
+
+	return &operationBuilder{b: b, op: op}
+}
+
+func (o *operationBuilder) path(name, description string) *operationBuilder {
+	o.op.AddParameter(openapi3.NewPathParameter(name).
+		WithDescription(description).
+		WithSchema(openapi3.NewStringSchema()))
+	return o
+}
+
+func (o *operationBuilder) query(name, description string, required bool) *operationBuilder {
+	o.op.AddParameter(openapi3.NewQueryParameter(name).
+		WithDescription(description).
+		WithRequired(required).
+		WithSchema(openapi3.NewStringSchema()))
+	return o
+}
+
+func (o *operationBuilder) header(name, description string) *operationBuilder {
+	o.op.AddParameter(openapi3.NewHeaderParameter(name).
+		WithDescription(description).
+		WithSchema(openapi3.NewStringSchema()))
+	return o
+}
+
+func (o *operationBuilder) body(schema string) *operationBuilder {
+	o.op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+		WithRequired(true).
+		WithContent(openapi3.NewContentWithJSONSchemaRef(o.b.ref(schema)))}
+	o.op.AddResponse(http.StatusRequestEntityTooLarge, openapi3.NewResponse().
+		WithDescription("Request body too large").
+		WithJSONSchemaRef(o.b.ref("ErrorResponse")))
+	return o
+}
+
+// csv lets the request body also be sent as CSV text.
+func (o *operationBuilder) csv(description string) *operationBuilder {
+	schema := openapi3.NewStringSchema()
+	schema.Description = description
+	o.op.RequestBody.Value.Content["text/csv"] = openapi3.NewMediaType().WithSchema(schema)
+	return o
+}
+
+// csvResponse lets the OK response also be a CSV download.
+func (o *operationBuilder) csvResponse(description string) *operationBuilder {
+	schema := openapi3.NewStringSchema()
+	schema.Description = description
+	o.op.Responses.Status(http.StatusOK).Value.Content["text/csv"] = openapi3.NewMediaType().WithSchema(schema)
+	return o
+}
+
+func (o *operationBuilder) security(scheme string) *operationBuilder {
+	requirement := openapi3.NewSecurityRequirement().Authenticate(scheme)
+	o.op.Security = openapi3.NewSecurityRequirements().With(requirement)
+	return o
+}
+
+func (o *operationBuilder) admin() *operationBuilder {
+	o.security(apiKeySecurity)
+	return o.failure(http.StatusUnauthorized, "Missing or unknown API key")
+}
+
+func (o *operationBuilder) ok(schema string) *operationBuilder {
+	o.op.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("OK").
+		WithJSONSchemaRef(o.b.ref(schema)))
+	return o
+}
+
+func (o *operationBuilder) okArray(schema string) *operationBuilder {
+	items := openapi3.NewArraySchema()
+	items.Items = o.b.ref(schema)
+	o.op.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription("OK").
+		WithJSONSchema(items))
+	return o
+}
+
+func (o *operationBuilder) created(schema string) *operationBuilder {
+	o.op.AddResponse(http.StatusCreated, openapi3.NewResponse().
+		WithDescription("Created").
+		WithJSONSchemaRef(o.b.ref(schema)))
+	return o
+}
+
+func (o *operationBuilder) stream(description string) *operationBuilder {
+	o.op.AddResponse(http.StatusOK, openapi3.NewResponse().
+		WithDescription(description).
+		WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema(), []string{"text/event-stream"})))
+	return o
+}
+
+func (o *operationBuilder) validation() *operationBuilder {
+	o.op.AddResponse(http.StatusBadRequest, openapi3.NewResponse().
+		WithDescription("Invalid request parameters").
+		WithJSONSchemaRef(o.b.ref("ValidationErrorResponse")))
+	return o
+}
+
+func (o *operationBuilder) failure(status int, description string) *operationBuilder {
+	o.op.AddResponse(status, openapi3.NewResponse().
+		WithDescription(description).
+		WithJSONSchemaRef(o.b.ref("ErrorResponse")))
+	return o
+}
+
+// errors documents the domain errors the operation can answer with for each
+// status, naming their codes in the description.
+func (o *operationBuilder) errors(statuses ...int) *operationBuilder {
+	for _, status := range statuses {
+		var codes string
+		for _, mapping := range response.ErrorMappings() {
+			if mapping.HTTPStatus != status {
+				continue
+			}
+			if codes != "" {
+				codes += ", "
+			}
+			codes += mapping.Code
+		}
+
+		description := http.StatusText(status)
+		if codes != "" {
+			description += ": one of " + codes
+		}
+
+		key := strconv.Itoa(status)
+		if existing := o.op.Responses.Value(key); existing != nil && existing.Value != nil {
+			if existing.Value.Description != nil {
+				description = *existing.Value.Description + "; or " + description
+			}
+			// Validation failures and domain errors share 400, with
+			// different bodies.
+			content := openapi3.NewContentWithSchemaRef(openapi3.NewSchemaRef("", openapi3.NewOneOfSchema()), []string{"application/json"})
+			content.Get("application/json").Schema.Value.OneOf = openapi3.SchemaRefs{o.b.ref("ValidationErrorResponse"), o.b.ref("ErrorResponse")}
+			existing.Value.WithDescription(description).WithContent(content)
+			continue
+		}
+
+		o.op.AddResponse(status, openapi3.NewResponse().
+			WithDescription(description).
+			WithJSONSchemaRef(o.b.ref("ErrorResponse")))
+	}
+	return o
+}
+
+// ref points at a component schema, resolved so the document validates
+// without a loader pass.
+func (b *builder) ref(schema string) *openapi3.SchemaRef {
+	component, ok := b.doc.Components.Schemas[schema]
+	if !ok {
+		panic("openapi: unknown schema " + schema)
+	}
+	return openapi3.NewSchemaRef("#/components/schemas/"+schema, component.Value)
+}
@@ -0,0 +1,76 @@
+package fixtures
+
+import (
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+)
+
+// defaultCheckoutTTL matches the service's default checkout code TTL.
+const defaultCheckoutTTL = 10 * time.Minute
+
+type CheckoutBuilder struct {
+	code      string
+	saleID    string
+	userID    string
+	itemIDs   []string
+	createdAt time.Time
+	expiresAt time.Time
+}
+
+func NewCheckoutBuilder() *CheckoutBuilder {
+	return &CheckoutBuilder{
+		code:      "CHK-S-fixture001-0000000000000000",
+		saleID:    "S-fixture001",
+		userID:    "user_fixture",
+		createdAt: BaseTime,
+	}
+}
+
+func (b *CheckoutBuilder) WithCode(code string) *CheckoutBuilder {
+	b.code = code
+	return b
+}
+
+func (b *CheckoutBuilder) ForSale(saleID string) *CheckoutBuilder {
+	b.saleID = saleID
+	return b
+}
+
+func (b *CheckoutBuilder) ForUser(userID string) *CheckoutBuilder {
+	b.userID = userID
+	return b
+}
+
+func (b *CheckoutBuilder) WithItems(itemIDs ...string) *CheckoutBuilder {
+	b.itemIDs = append([]string(nil), itemIDs...)
+	return b
+}
+
+func (b *CheckoutBuilder) CreatedAt(t time.Time) *CheckoutBuilder {
+	b.createdAt = t
+	return b
+}
+
+// ExpiresAt overrides the expiry, which otherwise follows the creation time
+// by defaultCheckoutTTL.
+func (b *CheckoutBuilder) ExpiresAt(t time.Time) *CheckoutBuilder {
+	b.expiresAt = t
+	return b
+}
+
+func (b *CheckoutBuilder) Build() *sale.Checkout {
+	expiresAt := b.expiresAt
+	if expiresAt.IsZero() {
+		expiresAt = b.createdAt.Add(defaultCheckoutTTL)
+	}
+
+	return &sale.Checkout{
+		Code:      b.code,
+		SaleID:    b.saleID,
+		UserID:    b.userID,
+		ItemIDs:   append([]string(nil), b.itemIDs...),
+		CreatedAt: b.createdAt,
+		ExpiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,81 @@
+package fixtures
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+)
+
+type ItemBuilder struct {
+	item sale.Item
+}
+
+func NewItemBuilder() *ItemBuilder {
+	return &ItemBuilder{
+		item: sale.Item{
+			ID:        "item_fixture_00000",
+			SaleID:    "S-fixture001",
+			Name:      "Fixture Item",
+			ImageURL:  "https://picsum.photos/300/300",
+			Price:     decimal.New(1999, -2),
+			CreatedAt: BaseTime,
+		},
+	}
+}
+
+func (b *ItemBuilder) WithID(id string) *ItemBuilder {
+	b.item.ID = id
+	return b
+}
+
+func (b *ItemBuilder) ForSale(saleID string) *ItemBuilder {
+	b.item.SaleID = saleID
+	return b
+}
+
+func (b *ItemBuilder) WithName(name string) *ItemBuilder {
+	b.item.Name = name
+	return b
+}
+
+func (b *ItemBuilder) WithImageURL(imageURL string) *ItemBuilder {
+	b.item.ImageURL = imageURL
+	return b
+}
+
+func (b *ItemBuilder) WithPrice(price decimal.Decimal) *ItemBuilder {
+	b.item.Price = price
+	return b
+}
+
+func (b *ItemBuilder) WithDescription(description string) *ItemBuilder {
+	b.item.Description = description
+	return b
+}
+
+func (b *ItemBuilder) WithMetadata(metadata map[string]interface{}) *ItemBuilder {
+	b.item.Metadata = metadata
+	return b
+}
+
+func (b *ItemBuilder) CreatedAt(t time.Time) *ItemBuilder {
+	b.item.CreatedAt = t
+	return b
+}
+
+func (b *ItemBuilder) SoldTo(userID string, soldAt time.Time) *ItemBuilder {
+	b.item.Sold = true
+	b.item.SoldToUserID = userID
+	b.item.SoldAt = &soldAt
+	return b
+}
+
+func (b *ItemBuilder) Build() *sale.Item {
+	item := b.item
+	if b.item.SoldAt != nil {
+		soldAt := *b.item.SoldAt
+		item.SoldAt = &soldAt
+	}
+	return &item
+}
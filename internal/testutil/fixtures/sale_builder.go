@@ -0,0 +1,141 @@
+package fixtures
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+)
+
+// BaseTime is the reference instant every fixture is built around so that
+// timestamps are identical across tests unless a clock says otherwise.
+var BaseTime = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+type SaleBuilder struct {
+	id         string
+	category   string
+	startedAt  time.Time
+	endedAt    time.Time
+	totalItems int
+	itemsSold  int
+	itemCount  int
+	createdAt  time.Time
+
+	maxItemsPerUser int
+	maxItemsPerSale int
+}
+
+func NewSaleBuilder() *SaleBuilder {
+	return &SaleBuilder{
+		id:         "S-fixture001",
+		startedAt:  BaseTime,
+		endedAt:    BaseTime.Add(time.Hour),
+		totalItems: 10000,
+		createdAt:  BaseTime,
+
+		maxItemsPerUser: sale.DefaultMaxItemsPerUser,
+		maxItemsPerSale: sale.DefaultMaxItemsPerSale,
+	}
+}
+
+func (b *SaleBuilder) WithID(id string) *SaleBuilder {
+	b.id = id
+	return b
+}
+
+// Active places the sale window around the clock's current time: started
+// thirty minutes ago and ending thirty minutes from now.
+func (b *SaleBuilder) Active(c clock.Clock) *SaleBuilder {
+	now := c.Now()
+	b.startedAt = now.Add(-30 * time.Minute)
+	b.endedAt = now.Add(30 * time.Minute)
+	b.createdAt = b.startedAt
+	return b
+}
+
+func (b *SaleBuilder) Ended(c clock.Clock) *SaleBuilder {
+	now := c.Now()
+	b.startedAt = now.Add(-2 * time.Hour)
+	b.endedAt = now.Add(-time.Hour)
+	b.createdAt = b.startedAt
+	return b
+}
+
+func (b *SaleBuilder) Upcoming(c clock.Clock) *SaleBuilder {
+	now := c.Now()
+	b.startedAt = now.Add(time.Hour)
+	b.endedAt = now.Add(2 * time.Hour)
+	b.createdAt = now
+	return b
+}
+
+func (b *SaleBuilder) WithCategory(category string) *SaleBuilder {
+	b.category = category
+	return b
+}
+
+func (b *SaleBuilder) Between(startedAt, endedAt time.Time) *SaleBuilder {
+	b.startedAt = startedAt
+	b.endedAt = endedAt
+	return b
+}
+
+func (b *SaleBuilder) WithTotalItems(total int) *SaleBuilder {
+	b.totalItems = total
+	return b
+}
+
+func (b *SaleBuilder) WithItemsSold(sold int) *SaleBuilder {
+	b.itemsSold = sold
+	return b
+}
+
+func (b *SaleBuilder) WithLimits(maxItemsPerUser, maxItemsPerSale int) *SaleBuilder {
+	b.maxItemsPerUser = maxItemsPerUser
+	b.maxItemsPerSale = maxItemsPerSale
+	return b
+}
+
+// WithItems sets how many items BuildItems generates and, unless overridden
+// afterwards, the sale's total item count.
+func (b *SaleBuilder) WithItems(count int) *SaleBuilder {
+	b.itemCount = count
+	b.totalItems = count
+	return b
+}
+
+func (b *SaleBuilder) Build() *sale.Sale {
+	return &sale.Sale{
+		ID:         b.id,
+		Category:   b.category,
+		StartedAt:  b.startedAt,
+		EndedAt:    b.endedAt,
+		TotalItems: b.totalItems,
+		ItemsSold:  b.itemsSold,
+		CreatedAt:  b.createdAt,
+
+		MaxItemsPerUser: b.maxItemsPerUser,
+		MaxItemsPerSale: b.maxItemsPerSale,
+	}
+}
+
+// BuildItems returns the configured number of items for the sale. The first
+// ItemsSold items are marked as sold to deterministic users.
+func (b *SaleBuilder) BuildItems() []*sale.Item {
+	items := make([]*sale.Item, 0, b.itemCount)
+	for i := 0; i < b.itemCount; i++ {
+		item := NewItemBuilder().
+			WithID(fmt.Sprintf("item_%s_%05d", b.id, i)).
+			ForSale(b.id).
+			WithName(fmt.Sprintf("Fixture Item %d", i)).
+			CreatedAt(b.createdAt)
+
+		if i < b.itemsSold {
+			item = item.SoldTo(fmt.Sprintf("user_%d", i%10), b.startedAt.Add(time.Duration(i)*time.Second))
+		}
+
+		items = append(items, item.Build())
+	}
+	return items
+}
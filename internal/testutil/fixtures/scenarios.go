@@ -0,0 +1,98 @@
+package fixtures
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/yuzvak/flashsale-service/internal/application/ports"
+	"github.com/yuzvak/flashsale-service/internal/domain/sale"
+	"github.com/yuzvak/flashsale-service/internal/pkg/clock"
+)
+
+type Scenario struct {
+	Sale      *sale.Sale
+	Items     []*sale.Item
+	Checkouts []*sale.Checkout
+}
+
+func (s *Scenario) AvailableItemIDs() []string {
+	ids := make([]string, 0, len(s.Items))
+	for _, item := range s.Items {
+		if !item.Sold {
+			ids = append(ids, item.ID)
+		}
+	}
+	return ids
+}
+
+// FreshSale is an active sale with no items sold yet.
+func FreshSale(c clock.Clock, itemCount int) *Scenario {
+	builder := NewSaleBuilder().Active(c).WithItems(itemCount)
+	return &Scenario{
+		Sale:  builder.Build(),
+		Items: builder.BuildItems(),
+	}
+}
+
+// NearlySoldOutSale is an active sale with only remaining items left unsold.
+func NearlySoldOutSale(c clock.Clock, itemCount, remaining int) *Scenario {
+	builder := NewSaleBuilder().Active(c).WithItems(itemCount).WithItemsSold(itemCount - remaining)
+	return &Scenario{
+		Sale:  builder.Build(),
+		Items: builder.BuildItems(),
+	}
+}
+
+// EndedSaleWithOpenCheckouts is a sale whose window has closed while users
+// still hold unpurchased checkouts.
+func EndedSaleWithOpenCheckouts(c clock.Clock, itemCount, openCheckouts int) *Scenario {
+	builder := NewSaleBuilder().Ended(c).WithItems(itemCount)
+	saleEntity := builder.Build()
+	items := builder.BuildItems()
+
+	checkouts := make([]*sale.Checkout, 0, openCheckouts)
+	for i := 0; i < openCheckouts && i < len(items); i++ {
+		checkouts = append(checkouts, NewCheckoutBuilder().
+			WithCode(fmt.Sprintf("CHK-%s-%016d", saleEntity.ID, i)).
+			ForSale(saleEntity.ID).
+			ForUser(fmt.Sprintf("user_%d", i)).
+			WithItems(items[i].ID).
+			CreatedAt(saleEntity.StartedAt.Add(10*time.Minute)).
+			Build())
+	}
+
+	return &Scenario{
+		Sale:      saleEntity,
+		Items:     items,
+		Checkouts: checkouts,
+	}
+}
+
+// Seed writes the scenario through the given repositories. The checkout
+// repository may be nil when the scenario has no checkouts.
+func Seed(ctx context.Context, saleRepo ports.SaleRepository, checkoutRepo ports.CheckoutRepository, scenario *Scenario) error {
+	if err := saleRepo.CreateSale(ctx, scenario.Sale); err != nil {
+		return fmt.Errorf("failed to seed sale: %w", err)
+	}
+
+	if err := saleRepo.CreateItems(ctx, scenario.Items); err != nil {
+		return fmt.Errorf("failed to seed items: %w", err)
+	}
+
+	if len(scenario.Checkouts) == 0 {
+		return nil
+	}
+
+	if checkoutRepo == nil {
+		return fmt.Errorf("scenario has %d checkouts but no checkout repository was given", len(scenario.Checkouts))
+	}
+
+	for _, checkout := range scenario.Checkouts {
+		if err := checkoutRepo.CreateCheckout(ctx, checkout); err != nil {
+			return fmt.Errorf("failed to seed checkout %s: %w", checkout.Code, err)
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
-package loadtest
+package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -16,21 +17,25 @@ func main() {
 		ItemCount:           10000,
 	}
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
-		case "light":
-			config.ConcurrentUsers = 50
-			config.TestDurationSeconds = 30
-		case "heavy":
-			config.ConcurrentUsers = 500
-			config.TestDurationSeconds = 300
-		case "stress":
-			config.ConcurrentUsers = 1000
-			config.TestDurationSeconds = 600
-		}
+	flag.IntVar(&config.SLAConfig.MaxP99Ms, "sla-p99-ms", 0, "Fail if the P99 response time exceeds this many milliseconds")
+	flag.Float64Var(&config.SLAConfig.MaxErrorRatePct, "sla-error-rate", 0, "Fail if the error rate exceeds this percentage")
+	flag.Float64Var(&config.SLAConfig.MinPurchaseSuccessRatePct, "sla-purchase-rate", 0, "Fail if the purchase success rate is below this percentage")
+	flag.StringVar(&config.PushgatewayURL, "pushgateway-url", os.Getenv("PUSHGATEWAY_URL"), "Push the results to this Prometheus Pushgateway")
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "light":
+		config.ConcurrentUsers = 50
+		config.TestDurationSeconds = 30
+	case "heavy":
+		config.ConcurrentUsers = 500
+		config.TestDurationSeconds = 300
+	case "stress":
+		config.ConcurrentUsers = 1000
+		config.TestDurationSeconds = 600
 	}
 
-	loadTester := loadtest.NewLoadTester(config)
+	loadTester := NewLoadTester(config)
 
 	fmt.Printf("Configuration:\n")
 	fmt.Printf("- Base URL: %s\n", config.BaseURL)
@@ -50,4 +55,20 @@ func main() {
 	} else {
 		fmt.Printf("Results saved to: %s\n", filename)
 	}
+
+	if config.PushgatewayURL != "" {
+		if err := metrics.PushToPrometheus(config.PushgatewayURL, "flashsale_load_test"); err != nil {
+			log.Printf("Failed to push results to %s: %v", config.PushgatewayURL, err)
+		} else {
+			fmt.Printf("Results pushed to: %s\n", config.PushgatewayURL)
+		}
+	}
+
+	if violations := metrics.CheckSLA(config.SLAConfig); len(violations) > 0 {
+		fmt.Printf("\nSLA VIOLATIONS:\n")
+		for _, violation := range violations {
+			fmt.Printf("- %s\n", violation)
+		}
+		os.Exit(1)
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -18,8 +19,20 @@ func main() {
 		RampUpSeconds:       30,
 	}
 
-	if len(os.Args) > 1 {
-		switch os.Args[1] {
+	flag.IntVar(&config.ProfileWeights.AggressivePct, "aggressive-pct", defaultProfileWeights.AggressivePct, "Percentage of users with the aggressive buyer profile")
+	flag.IntVar(&config.ProfileWeights.NormalPct, "normal-pct", defaultProfileWeights.NormalPct, "Percentage of users with the normal buyer profile")
+	flag.IntVar(&config.ProfileWeights.BrowserPct, "browser-pct", defaultProfileWeights.BrowserPct, "Percentage of users with the browser profile")
+	profilesPath := flag.String("profiles", "", "JSON file of custom user profiles, replacing the built-in ones")
+	flag.Parse()
+
+	if *profilesPath == "" {
+		if err := config.ProfileWeights.Validate(); err != nil {
+			log.Fatal("Invalid profile weights: ", err)
+		}
+	}
+
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
 		case "light":
 			config.ConcurrentUsers = 200
 			config.TestDurationSeconds = 120
@@ -38,6 +51,7 @@ func main() {
 	if dbConn := os.Getenv("DB_CONNECTION_STRING"); dbConn != "" {
 		dbConnStr = dbConn
 	}
+	config.PushgatewayURL = os.Getenv("PUSHGATEWAY_URL")
 
 	tester, err := NewRealisticLoadTester(dbConnStr, config)
 	if err != nil {
@@ -45,12 +59,22 @@ func main() {
 	}
 	defer tester.Close()
 
+	if *profilesPath != "" {
+		profiles, err := LoadUserProfiles(*profilesPath)
+		if err != nil {
+			log.Fatal("Failed to load profiles: ", err)
+		}
+		if err := tester.SetProfiles(profiles); err != nil {
+			log.Fatal("Invalid profiles: ", err)
+		}
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(config.TestDurationSeconds)*time.Second)
+		time.Duration(config.WarmUpSeconds+config.TestDurationSeconds)*time.Second)
 	defer cancel()
 
 	fmt.Println("Starting realistic load test...")
-	fmt.Printf("User distribution: 10%% aggressive, 60%% normal, 30%% browsers\n")
+	fmt.Printf("User distribution: %s\n", tester.ProfileSummary())
 	fmt.Printf("Test will run for %d seconds with %d concurrent users\n",
 		config.TestDurationSeconds, config.ConcurrentUsers)
 
@@ -68,4 +92,12 @@ func main() {
 	} else {
 		fmt.Printf("Results saved to: %s\n", filename)
 	}
+
+	if config.PushgatewayURL != "" {
+		if err := metrics.PushToPrometheus(config.PushgatewayURL, "flashsale_realistic_load_test"); err != nil {
+			log.Printf("Failed to push results to %s: %v", config.PushgatewayURL, err)
+		} else {
+			fmt.Printf("Results pushed to: %s\n", config.PushgatewayURL)
+		}
+	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -14,6 +15,9 @@ import (
 	"sync/atomic"
 	"syscall"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
 )
 
 type LoadTestConfig struct {
@@ -22,32 +26,89 @@ type LoadTestConfig struct {
 	TestDurationSeconds int
 	RampUpSeconds       int
 	ItemCount           int
+	// WarmUpSeconds runs the users for this long before anything is
+	// measured, on top of TestDurationSeconds.
+	WarmUpSeconds int
+	SLAConfig     SLAConfig
+	// PushgatewayURL, when set, receives the results of every run.
+	PushgatewayURL string
+	// ProfileWeights splits the realistic test's users between the built-in
+	// behavior profiles; all zero means 10/60/30.
+	ProfileWeights ProfileWeights
+}
+
+type ProfileWeights struct {
+	AggressivePct int
+	NormalPct     int
+	BrowserPct    int
+}
+
+func (w ProfileWeights) IsZero() bool {
+	return w == ProfileWeights{}
+}
+
+func (w ProfileWeights) Validate() error {
+	if w.AggressivePct < 0 || w.NormalPct < 0 || w.BrowserPct < 0 {
+		return fmt.Errorf("profile weights must not be negative")
+	}
+	if sum := w.AggressivePct + w.NormalPct + w.BrowserPct; sum != 100 {
+		return fmt.Errorf("profile weights must sum to 100, got %d", sum)
+	}
+	return nil
+}
+
+// SLAConfig holds the limits a run must stay within; zero values are not
+// checked.
+type SLAConfig struct {
+	MaxP99Ms                  int
+	MaxErrorRatePct           float64
+	MinPurchaseSuccessRatePct float64
+}
+
+type SLAViolation struct {
+	Metric string
+	Limit  string
+	Actual string
+}
+
+func (v SLAViolation) String() string {
+	return fmt.Sprintf("%s: %s, limit %s", v.Metric, v.Actual, v.Limit)
 }
 
 type TestResult struct {
-	TotalRequests       int64
-	SuccessfulRequests  int64
-	FailedRequests      int64
-	TotalCheckouts      int64
-	SuccessfulPurchases int64
-	FailedPurchases     int64
-	ResponseTimes       []time.Duration
-	Errors              map[string]int64
-	mutex               sync.RWMutex
+	TotalRequests         int64
+	SuccessfulRequests    int64
+	FailedRequests        int64
+	TotalCheckouts        int64
+	SuccessfulPurchases   int64
+	FailedPurchases       int64
+	OversellEvents        int64
+	CheckoutResponseTimes []time.Duration
+	PurchaseResponseTimes []time.Duration
+	Errors                map[string]int64
+	mutex                 sync.RWMutex
 }
 
 type PerformanceMetrics struct {
 	StartTime           time.Time
 	EndTime             time.Time
 	TotalDuration       time.Duration
+	WarmUpDuration      time.Duration
 	ThroughputRPS       float64
 	SuccessfulTPS       float64
 	P50ResponseTime     time.Duration
 	P95ResponseTime     time.Duration
 	P99ResponseTime     time.Duration
+	CheckoutP50         time.Duration
+	CheckoutP95         time.Duration
+	CheckoutP99         time.Duration
+	PurchaseP50         time.Duration
+	PurchaseP95         time.Duration
+	PurchaseP99         time.Duration
 	ErrorRate           float64
 	CheckoutSuccessRate float64
 	PurchaseSuccessRate float64
+	OversellEvents      int64
 }
 
 type LoadTester struct {
@@ -59,6 +120,8 @@ type LoadTester struct {
 	lastCacheUpdate time.Time
 	userPurchases   map[int]map[string]bool
 	purchaseMutex   sync.RWMutex
+	// measureFrom is when the warmup ends; it is set before any user starts.
+	measureFrom time.Time
 }
 
 type SaleResponse struct {
@@ -67,7 +130,7 @@ type SaleResponse struct {
 	EndedAt    string `json:"ended_at"`
 	TotalItems int    `json:"total_items"`
 	ItemsSold  int    `json:"items_sold"`
-	Active     bool   `json:"active"`
+	Status     string `json:"status"`
 }
 
 type ItemResponse struct {
@@ -85,8 +148,9 @@ func NewLoadTester(config *LoadTestConfig) *LoadTester {
 	return &LoadTester{
 		config: config,
 		result: &TestResult{
-			ResponseTimes: make([]time.Duration, 0),
-			Errors:        make(map[string]int64),
+			CheckoutResponseTimes: make([]time.Duration, 0),
+			PurchaseResponseTimes: make([]time.Duration, 0),
+			Errors:                make(map[string]int64),
 		},
 		client: &http.Client{
 			Timeout: 30 * time.Second,
@@ -101,12 +165,42 @@ func NewLoadTester(config *LoadTestConfig) *LoadTester {
 	}
 }
 
+// startWarmUp begins the run at now and returns when measuring starts.
+func (lt *LoadTester) startWarmUp(now time.Time) time.Time {
+	lt.measureFrom = now.Add(lt.warmUpDuration())
+	return lt.measureFrom
+}
+
+func (lt *LoadTester) warmUpDuration() time.Duration {
+	return time.Duration(lt.config.WarmUpSeconds) * time.Second
+}
+
+func (lt *LoadTester) warmingUp() bool {
+	return time.Now().Before(lt.measureFrom)
+}
+
+// count increments one of the result counters unless the run is warming up.
+func (lt *LoadTester) count(counter *int64) {
+	if !lt.warmingUp() {
+		atomic.AddInt64(counter, 1)
+	}
+}
+
 func (lt *LoadTester) recordResponse(duration time.Duration, success bool, operation string, err error) {
+	if lt.warmingUp() {
+		return
+	}
+
 	lt.result.mutex.Lock()
 	defer lt.result.mutex.Unlock()
 
 	atomic.AddInt64(&lt.result.TotalRequests, 1)
-	lt.result.ResponseTimes = append(lt.result.ResponseTimes, duration)
+	switch operation {
+	case "checkout":
+		lt.result.CheckoutResponseTimes = append(lt.result.CheckoutResponseTimes, duration)
+	case "purchase":
+		lt.result.PurchaseResponseTimes = append(lt.result.PurchaseResponseTimes, duration)
+	}
 
 	if success {
 		atomic.AddInt64(&lt.result.SuccessfulRequests, 1)
@@ -189,7 +283,7 @@ func (lt *LoadTester) performCheckouts(userID int) (string, bool) {
 			if resp.StatusCode == http.StatusOK {
 				success = true
 				successfulCheckouts++
-				atomic.AddInt64(&lt.result.TotalCheckouts, 1)
+				lt.count(&lt.result.TotalCheckouts)
 
 				var result map[string]interface{}
 				body, _ := io.ReadAll(resp.Body)
@@ -303,6 +397,110 @@ func (lt *LoadTester) getActiveSaleID() (string, error) {
 	return "", fmt.Errorf("no active sale found")
 }
 
+const invariantCheckInterval = 30 * time.Second
+
+// OversellDetected reports a sale that sold more items than it has.
+type OversellDetected struct {
+	SaleID     string
+	Source     string
+	ItemsSold  int
+	TotalItems int
+}
+
+func (e *OversellDetected) Error() string {
+	return fmt.Sprintf("oversell detected in sale %s (%s): %d items sold of %d",
+		e.SaleID, e.Source, e.ItemsSold, e.TotalItems)
+}
+
+// validateInvariants checks that the active sale, as reported by both
+// /sales/active and /sales/{id}, has not sold more items than it has. Every
+// oversell found is counted in OversellEvents.
+func (lt *LoadTester) validateInvariants(ctx context.Context) error {
+	active, err := lt.fetchSale(ctx, "/sales/active")
+	if err != nil {
+		return err
+	}
+
+	current, err := lt.fetchSale(ctx, "/sales/"+active.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, check := range []struct {
+		source string
+		sale   *SaleResponse
+	}{
+		{"/sales/active", active},
+		{"/sales/" + active.ID, current},
+	} {
+		if check.sale.ItemsSold > check.sale.TotalItems {
+			atomic.AddInt64(&lt.result.OversellEvents, 1)
+			return &OversellDetected{
+				SaleID:     active.ID,
+				Source:     check.source,
+				ItemsSold:  check.sale.ItemsSold,
+				TotalItems: check.sale.TotalItems,
+			}
+		}
+	}
+
+	return nil
+}
+
+func (lt *LoadTester) fetchSale(ctx context.Context, path string) (*SaleResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, lt.config.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := lt.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", path, resp.StatusCode)
+	}
+
+	var apiResp struct {
+		Data SaleResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return &apiResp.Data, nil
+}
+
+func (lt *LoadTester) monitorInvariants(ctx context.Context) {
+	ticker := time.NewTicker(invariantCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			lt.reportInvariants(ctx)
+		}
+	}
+}
+
+func (lt *LoadTester) reportInvariants(ctx context.Context) {
+	err := lt.validateInvariants(ctx)
+	if err == nil {
+		return
+	}
+
+	var oversell *OversellDetected
+	if errors.As(err, &oversell) {
+		fmt.Printf("ERROR: %v\n", err)
+	} else if ctx.Err() == nil {
+		fmt.Printf("Warning: invariant check failed: %v\n", err)
+	}
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -323,7 +521,7 @@ func (lt *LoadTester) performPurchase(checkoutCode string, userID int) {
 
 		if resp.StatusCode == http.StatusOK {
 			success = true
-			atomic.AddInt64(&lt.result.SuccessfulPurchases, 1)
+			lt.count(&lt.result.SuccessfulPurchases)
 
 			var result map[string]interface{}
 			body, _ := io.ReadAll(resp.Body)
@@ -344,10 +542,10 @@ func (lt *LoadTester) performPurchase(checkoutCode string, userID int) {
 				}
 			}
 		} else {
-			atomic.AddInt64(&lt.result.FailedPurchases, 1)
+			lt.count(&lt.result.FailedPurchases)
 		}
 	} else {
-		atomic.AddInt64(&lt.result.FailedPurchases, 1)
+		lt.count(&lt.result.FailedPurchases)
 	}
 
 	lt.recordResponse(duration, success, "purchase", err)
@@ -358,7 +556,7 @@ func (lt *LoadTester) Run() *PerformanceMetrics {
 		lt.config.ConcurrentUsers, lt.config.TestDurationSeconds)
 
 	ctx, cancel := context.WithTimeout(context.Background(),
-		time.Duration(lt.config.TestDurationSeconds)*time.Second)
+		lt.warmUpDuration()+time.Duration(lt.config.TestDurationSeconds)*time.Second)
 	defer cancel()
 
 	sigChan := make(chan os.Signal, 1)
@@ -369,7 +567,7 @@ func (lt *LoadTester) Run() *PerformanceMetrics {
 		cancel()
 	}()
 
-	startTime := time.Now()
+	startTime := lt.startWarmUp(time.Now())
 	var wg sync.WaitGroup
 
 	userInterval := time.Duration(lt.config.RampUpSeconds) * time.Second / time.Duration(lt.config.ConcurrentUsers)
@@ -384,10 +582,15 @@ func (lt *LoadTester) Run() *PerformanceMetrics {
 	}
 
 	go lt.monitorProgress(ctx, startTime)
+	go lt.monitorInvariants(ctx)
 
 	wg.Wait()
 	endTime := time.Now()
 
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelCheck()
+	lt.reportInvariants(checkCtx)
+
 	return lt.calculateMetrics(startTime, endTime)
 }
 
@@ -401,6 +604,9 @@ func (lt *LoadTester) monitorProgress(ctx context.Context, startTime time.Time)
 			return
 		case <-ticker.C:
 			elapsed := time.Since(startTime)
+			if elapsed <= 0 {
+				continue // still warming up
+			}
 			totalReqs := atomic.LoadInt64(&lt.result.TotalRequests)
 			successReqs := atomic.LoadInt64(&lt.result.SuccessfulRequests)
 
@@ -413,18 +619,26 @@ func (lt *LoadTester) monitorProgress(ctx context.Context, startTime time.Time)
 	}
 }
 
+// calculateMetrics covers startTime to endTime, where startTime is the end
+// of the warmup.
 func (lt *LoadTester) calculateMetrics(startTime, endTime time.Time) *PerformanceMetrics {
 	lt.result.mutex.RLock()
 	defer lt.result.mutex.RUnlock()
 
+	if endTime.Before(startTime) {
+		endTime = startTime
+	}
+
 	totalDuration := endTime.Sub(startTime)
 	totalRequests := atomic.LoadInt64(&lt.result.TotalRequests)
 	successfulRequests := atomic.LoadInt64(&lt.result.SuccessfulRequests)
 
 	metrics := &PerformanceMetrics{
-		StartTime:     startTime,
-		EndTime:       endTime,
-		TotalDuration: totalDuration,
+		StartTime:      startTime,
+		EndTime:        endTime,
+		TotalDuration:  totalDuration,
+		WarmUpDuration: lt.warmUpDuration(),
+		OversellEvents: atomic.LoadInt64(&lt.result.OversellEvents),
 	}
 
 	if totalDuration.Seconds() > 0 {
@@ -445,11 +659,21 @@ func (lt *LoadTester) calculateMetrics(startTime, endTime time.Time) *Performanc
 		metrics.PurchaseSuccessRate = float64(lt.result.SuccessfulPurchases) / float64(totalPurchaseAttempts) * 100
 	}
 
-	if len(lt.result.ResponseTimes) > 0 {
-		metrics.P50ResponseTime = calculatePercentile(lt.result.ResponseTimes, 50)
-		metrics.P95ResponseTime = calculatePercentile(lt.result.ResponseTimes, 95)
-		metrics.P99ResponseTime = calculatePercentile(lt.result.ResponseTimes, 99)
-	}
+	allResponseTimes := make([]time.Duration, 0, len(lt.result.CheckoutResponseTimes)+len(lt.result.PurchaseResponseTimes))
+	allResponseTimes = append(allResponseTimes, lt.result.CheckoutResponseTimes...)
+	allResponseTimes = append(allResponseTimes, lt.result.PurchaseResponseTimes...)
+
+	metrics.P50ResponseTime = calculatePercentile(allResponseTimes, 50)
+	metrics.P95ResponseTime = calculatePercentile(allResponseTimes, 95)
+	metrics.P99ResponseTime = calculatePercentile(allResponseTimes, 99)
+
+	metrics.CheckoutP50 = calculatePercentile(lt.result.CheckoutResponseTimes, 50)
+	metrics.CheckoutP95 = calculatePercentile(lt.result.CheckoutResponseTimes, 95)
+	metrics.CheckoutP99 = calculatePercentile(lt.result.CheckoutResponseTimes, 99)
+
+	metrics.PurchaseP50 = calculatePercentile(lt.result.PurchaseResponseTimes, 50)
+	metrics.PurchaseP95 = calculatePercentile(lt.result.PurchaseResponseTimes, 95)
+	metrics.PurchaseP99 = calculatePercentile(lt.result.PurchaseResponseTimes, 99)
 
 	return metrics
 }
@@ -479,6 +703,7 @@ func calculatePercentile(durations []time.Duration, percentile int) time.Duratio
 func (pm *PerformanceMetrics) PrintReport() {
 	fmt.Printf("PERFORMANCE TEST RESULTS\n")
 	fmt.Printf("Test Duration: %v\n", pm.TotalDuration.Round(time.Second))
+	fmt.Printf("Warmup (not measured): %v\n", pm.WarmUpDuration.Round(time.Second))
 	fmt.Printf("Start Time: %s\n", pm.StartTime.Format("2006-01-02 15:04:05"))
 	fmt.Printf("End Time: %s\n", pm.EndTime.Format("2006-01-02 15:04:05"))
 	fmt.Printf("\n")
@@ -495,10 +720,125 @@ func (pm *PerformanceMetrics) PrintReport() {
 	fmt.Printf("- P99 Response Time: %v\n", pm.P99ResponseTime.Round(time.Millisecond))
 	fmt.Printf("\n")
 
+	fmt.Printf("CHECKOUT RESPONSE TIMES:\n")
+	fmt.Printf("- P50: %v\n", pm.CheckoutP50.Round(time.Millisecond))
+	fmt.Printf("- P95: %v\n", pm.CheckoutP95.Round(time.Millisecond))
+	fmt.Printf("- P99: %v\n", pm.CheckoutP99.Round(time.Millisecond))
+	fmt.Printf("\n")
+
+	fmt.Printf("PURCHASE RESPONSE TIMES:\n")
+	fmt.Printf("- P50: %v\n", pm.PurchaseP50.Round(time.Millisecond))
+	fmt.Printf("- P95: %v\n", pm.PurchaseP95.Round(time.Millisecond))
+	fmt.Printf("- P99: %v\n", pm.PurchaseP99.Round(time.Millisecond))
+	fmt.Printf("\n")
+
 	fmt.Printf("BUSINESS METRICS:\n")
 	fmt.Printf("- Checkout Success Rate: %.2f%%\n", pm.CheckoutSuccessRate)
 	fmt.Printf("- Purchase Success Rate: %.2f%%\n", pm.PurchaseSuccessRate)
 	fmt.Printf("\n")
+
+	fmt.Printf("CORRECTNESS:\n")
+	fmt.Printf("- Oversell Events: %d\n", pm.OversellEvents)
+	fmt.Printf("\n")
+}
+
+// CheckSLA returns every limit in sla that the run did not meet. Any
+// oversell is a violation regardless of sla.
+func (pm *PerformanceMetrics) CheckSLA(sla SLAConfig) []SLAViolation {
+	var violations []SLAViolation
+
+	if pm.OversellEvents > 0 {
+		violations = append(violations, SLAViolation{
+			Metric: "Oversell events",
+			Limit:  "0",
+			Actual: fmt.Sprintf("%d", pm.OversellEvents),
+		})
+	}
+
+	if sla.MaxP99Ms > 0 {
+		limit := time.Duration(sla.MaxP99Ms) * time.Millisecond
+		if pm.P99ResponseTime > limit {
+			violations = append(violations, SLAViolation{
+				Metric: "P99 response time",
+				Limit:  limit.String(),
+				Actual: pm.P99ResponseTime.Round(time.Millisecond).String(),
+			})
+		}
+	}
+
+	if sla.MaxErrorRatePct > 0 && pm.ErrorRate > sla.MaxErrorRatePct {
+		violations = append(violations, SLAViolation{
+			Metric: "Error rate",
+			Limit:  fmt.Sprintf("%.2f%%", sla.MaxErrorRatePct),
+			Actual: fmt.Sprintf("%.2f%%", pm.ErrorRate),
+		})
+	}
+
+	if sla.MinPurchaseSuccessRatePct > 0 && pm.PurchaseSuccessRate < sla.MinPurchaseSuccessRatePct {
+		violations = append(violations, SLAViolation{
+			Metric: "Purchase success rate",
+			Limit:  fmt.Sprintf("%.2f%%", sla.MinPurchaseSuccessRatePct),
+			Actual: fmt.Sprintf("%.2f%%", pm.PurchaseSuccessRate),
+		})
+	}
+
+	return violations
+}
+
+// PushToPrometheus pushes the run's results to a Pushgateway, grouped by a
+// testrun label holding the start time so that runs can be compared.
+func (pm *PerformanceMetrics) PushToPrometheus(pushgatewayURL, jobName string) error {
+	latency := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "loadtest_response_time_seconds",
+		Help: "Response time percentiles of the load test run",
+	}, []string{"endpoint", "quantile"})
+	errorRate := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadtest_error_rate_percent",
+		Help: "Percentage of failed requests",
+	})
+	throughput := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadtest_throughput_rps",
+		Help: "Requests per second",
+	})
+	successfulTPS := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadtest_successful_tps",
+		Help: "Successful requests per second",
+	})
+	purchaseSuccessRate := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "loadtest_purchase_success_rate_percent",
+		Help: "Percentage of purchase attempts that succeeded",
+	})
+
+	percentiles := []struct {
+		endpoint, quantile string
+		value              time.Duration
+	}{
+		{"all", "0.5", pm.P50ResponseTime},
+		{"all", "0.95", pm.P95ResponseTime},
+		{"all", "0.99", pm.P99ResponseTime},
+		{"checkout", "0.5", pm.CheckoutP50},
+		{"checkout", "0.95", pm.CheckoutP95},
+		{"checkout", "0.99", pm.CheckoutP99},
+		{"purchase", "0.5", pm.PurchaseP50},
+		{"purchase", "0.95", pm.PurchaseP95},
+		{"purchase", "0.99", pm.PurchaseP99},
+	}
+	for _, p := range percentiles {
+		latency.WithLabelValues(p.endpoint, p.quantile).Set(p.value.Seconds())
+	}
+	errorRate.Set(pm.ErrorRate)
+	throughput.Set(pm.ThroughputRPS)
+	successfulTPS.Set(pm.SuccessfulTPS)
+	purchaseSuccessRate.Set(pm.PurchaseSuccessRate)
+
+	return push.New(pushgatewayURL, jobName).
+		Grouping("testrun", pm.StartTime.UTC().Format("20060102T150405Z")).
+		Collector(latency).
+		Collector(errorRate).
+		Collector(throughput).
+		Collector(successfulTPS).
+		Collector(purchaseSuccessRate).
+		Push()
 }
 
 func (pm *PerformanceMetrics) SaveToFile(filename string) error {
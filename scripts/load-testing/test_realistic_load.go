@@ -8,6 +8,8 @@ import (
 	"io"
 	"log"
 	"math/rand"
+	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +26,7 @@ type RealisticLoadTester struct {
 	userMutex       sync.RWMutex
 	userPurchases   map[int]map[string]bool
 	purchaseMutex   sync.RWMutex
+	profiles        []UserBehaviorProfile
 }
 
 type ItemDistributor struct {
@@ -41,8 +44,12 @@ type UserBehaviorProfile struct {
 	ItemsPerSession     int
 	SessionDelay        time.Duration
 	PopularItemBias     float64
+	// WeightPct is the share of users given this profile.
+	WeightPct int
 }
 
+var defaultProfileWeights = ProfileWeights{AggressivePct: 10, NormalPct: 60, BrowserPct: 30}
+
 var UserProfiles = []UserBehaviorProfile{
 	{
 		Name:                "aggressive_buyer",
@@ -82,6 +89,20 @@ func NewRealisticLoadTester(dbConnStr string, config *LoadTestConfig) (*Realisti
 
 	httpTester := NewLoadTester(config)
 
+	weights := config.ProfileWeights
+	if weights.IsZero() {
+		weights = defaultProfileWeights
+	}
+	if err := weights.Validate(); err != nil {
+		return nil, err
+	}
+
+	profiles := make([]UserBehaviorProfile, len(UserProfiles))
+	copy(profiles, UserProfiles)
+	profiles[0].WeightPct = weights.AggressivePct
+	profiles[1].WeightPct = weights.NormalPct
+	profiles[2].WeightPct = weights.BrowserPct
+
 	return &RealisticLoadTester{
 		db:              db,
 		config:          config,
@@ -89,9 +110,83 @@ func NewRealisticLoadTester(dbConnStr string, config *LoadTestConfig) (*Realisti
 		itemDistributor: &ItemDistributor{},
 		userCheckouts:   make(map[int]int),
 		userPurchases:   make(map[int]map[string]bool),
+		profiles:        profiles,
 	}, nil
 }
 
+// ProfileSummary describes how users are split between the profiles.
+func (rlt *RealisticLoadTester) ProfileSummary() string {
+	parts := make([]string, 0, len(rlt.profiles))
+	for _, profile := range rlt.profiles {
+		parts = append(parts, fmt.Sprintf("%d%% %s", profile.WeightPct, profile.Name))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// SetProfiles replaces the built-in profiles; their weights must sum to 100.
+func (rlt *RealisticLoadTester) SetProfiles(profiles []UserBehaviorProfile) error {
+	if len(profiles) == 0 {
+		return fmt.Errorf("at least one profile is required")
+	}
+
+	sum := 0
+	for _, profile := range profiles {
+		if profile.WeightPct < 0 {
+			return fmt.Errorf("profile %q has a negative weight", profile.Name)
+		}
+		sum += profile.WeightPct
+	}
+	if sum != 100 {
+		return fmt.Errorf("profile weights must sum to 100, got %d", sum)
+	}
+
+	rlt.profiles = profiles
+	return nil
+}
+
+// LoadUserProfiles reads profiles from a JSON array such as
+//
+//	[{"name": "bot", "checkout_probability": 1, "purchase_probability": 1,
+//	  "items_per_session": 5, "session_delay_ms": 10,
+//	  "popular_item_bias": 0.9, "weight_pct": 100}]
+func LoadUserProfiles(path string) ([]UserBehaviorProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []struct {
+		Name                string  `json:"name"`
+		CheckoutProbability float64 `json:"checkout_probability"`
+		PurchaseProbability float64 `json:"purchase_probability"`
+		ItemsPerSession     int     `json:"items_per_session"`
+		SessionDelayMs      int     `json:"session_delay_ms"`
+		PopularItemBias     float64 `json:"popular_item_bias"`
+		WeightPct           int     `json:"weight_pct"`
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	profiles := make([]UserBehaviorProfile, 0, len(entries))
+	for _, entry := range entries {
+		if entry.ItemsPerSession <= 0 {
+			return nil, fmt.Errorf("profile %q: items_per_session must be positive", entry.Name)
+		}
+		profiles = append(profiles, UserBehaviorProfile{
+			Name:                entry.Name,
+			CheckoutProbability: entry.CheckoutProbability,
+			PurchaseProbability: entry.PurchaseProbability,
+			ItemsPerSession:     entry.ItemsPerSession,
+			SessionDelay:        time.Duration(entry.SessionDelayMs) * time.Millisecond,
+			PopularItemBias:     entry.PopularItemBias,
+			WeightPct:           entry.WeightPct,
+		})
+	}
+
+	return profiles, nil
+}
+
 func (rlt *RealisticLoadTester) LoadItemsFromDB() error {
 	var saleID string
 	err := rlt.db.QueryRow(`
@@ -149,6 +244,8 @@ func (rlt *RealisticLoadTester) LoadItemsFromDB() error {
 	return nil
 }
 
+// RunRealisticTest runs until ctx is done, so its deadline has to include
+// the config's warmup.
 func (rlt *RealisticLoadTester) RunRealisticTest(ctx context.Context) (*PerformanceMetrics, error) {
 	if err := rlt.LoadItemsFromDB(); err != nil {
 		return nil, fmt.Errorf("failed to load items: %w", err)
@@ -159,7 +256,7 @@ func (rlt *RealisticLoadTester) RunRealisticTest(ctx context.Context) (*Performa
 	fmt.Printf("Starting realistic load test with %d concurrent users\n", rlt.config.ConcurrentUsers)
 
 	var wg sync.WaitGroup
-	startTime := time.Now()
+	startTime := rlt.httpTester.startWarmUp(time.Now())
 
 	userProfiles := rlt.distributeUserProfiles()
 
@@ -173,6 +270,7 @@ func (rlt *RealisticLoadTester) RunRealisticTest(ctx context.Context) (*Performa
 	}
 
 	go rlt.monitorProgress(ctx, startTime)
+	go rlt.httpTester.monitorInvariants(ctx)
 
 	done := make(chan struct{})
 	go func() {
@@ -188,30 +286,36 @@ func (rlt *RealisticLoadTester) RunRealisticTest(ctx context.Context) (*Performa
 	}
 
 	endTime := time.Now()
+
+	checkCtx, cancelCheck := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelCheck()
+	rlt.httpTester.reportInvariants(checkCtx)
+
 	return rlt.httpTester.calculateMetrics(startTime, endTime), nil
 }
 
 func (rlt *RealisticLoadTester) distributeUserProfiles() []UserBehaviorProfile {
 	profiles := make([]UserBehaviorProfile, rlt.config.ConcurrentUsers)
 
-	aggressiveCount := rlt.config.ConcurrentUsers / 10
-	normalCount := rlt.config.ConcurrentUsers * 6 / 10
-
-	index := 0
-
-	for i := 0; i < aggressiveCount && index < len(profiles); i++ {
-		profiles[index] = UserProfiles[0]
-		index++
-	}
-
-	for i := 0; i < normalCount && index < len(profiles); i++ {
-		profiles[index] = UserProfiles[1]
-		index++
+	counts := make([]int, len(rlt.profiles))
+	assigned, largest := 0, 0
+	for i, profile := range rlt.profiles {
+		counts[i] = len(profiles) * profile.WeightPct / 100
+		assigned += counts[i]
+		if profile.WeightPct > rlt.profiles[largest].WeightPct {
+			largest = i
+		}
 	}
+	// Rounding down leaves a few users over; they get the most common
+	// profile.
+	counts[largest] += len(profiles) - assigned
 
-	for index < len(profiles) {
-		profiles[index] = UserProfiles[2]
-		index++
+	index := 0
+	for i, profile := range rlt.profiles {
+		for j := 0; j < counts[i]; j++ {
+			profiles[index] = profile
+			index++
+		}
 	}
 
 	rand.Shuffle(len(profiles), func(i, j int) {
@@ -346,7 +450,7 @@ func (rlt *RealisticLoadTester) performRealisticCheckout(userID int, items []str
 
 			if resp.StatusCode == 200 {
 				success = true
-				atomic.AddInt64(&rlt.httpTester.result.TotalCheckouts, 1)
+				rlt.httpTester.count(&rlt.httpTester.result.TotalCheckouts)
 				rlt.incrementUserCheckoutCount(userID)
 
 				var result map[string]interface{}
@@ -380,7 +484,7 @@ func (rlt *RealisticLoadTester) performRealisticPurchase(checkoutCode string, us
 
 		if resp.StatusCode == 200 {
 			success = true
-			atomic.AddInt64(&rlt.httpTester.result.SuccessfulPurchases, 1)
+			rlt.httpTester.count(&rlt.httpTester.result.SuccessfulPurchases)
 
 			var result map[string]interface{}
 			body, _ := io.ReadAll(resp.Body)
@@ -401,10 +505,10 @@ func (rlt *RealisticLoadTester) performRealisticPurchase(checkoutCode string, us
 				}
 			}
 		} else {
-			atomic.AddInt64(&rlt.httpTester.result.FailedPurchases, 1)
+			rlt.httpTester.count(&rlt.httpTester.result.FailedPurchases)
 		}
 	} else {
-		atomic.AddInt64(&rlt.httpTester.result.FailedPurchases, 1)
+		rlt.httpTester.count(&rlt.httpTester.result.FailedPurchases)
 	}
 
 	rlt.httpTester.recordResponse(duration, success, "purchase", err)
@@ -436,6 +540,9 @@ func (rlt *RealisticLoadTester) monitorProgress(ctx context.Context, startTime t
 			return
 		case <-ticker.C:
 			elapsed := time.Since(startTime)
+			if elapsed <= 0 {
+				continue // still warming up
+			}
 			totalReqs := atomic.LoadInt64(&rlt.httpTester.result.TotalRequests)
 			successReqs := atomic.LoadInt64(&rlt.httpTester.result.SuccessfulRequests)
 			checkouts := atomic.LoadInt64(&rlt.httpTester.result.TotalCheckouts)